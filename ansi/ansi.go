@@ -200,6 +200,35 @@ func Escape(text string) string {
 	return strings.Replace(text, "\033", "\\033", -1)
 }
 
+// Quote escapes the color codes in the text so Colorize leaves them as text,
+// for text that shouldn't change colors like what players say.
+func Quote(text string) string {
+	return colorRx.ReplaceAllStringFunc(text, func(s string) string {
+		code := colorRx.FindStringSubmatch(s)[1]
+		swb := strings.HasPrefix(code, "[")
+		ewb := strings.HasSuffix(code, "]")
+		prefix := ""
+		suffix := ""
+
+		switch {
+		case swb && ewb:
+			return s
+		case swb:
+			prefix = "["
+			code = code[1:]
+		case ewb:
+			suffix = "]"
+			code = code[:len(code)-1]
+		}
+
+		if _, ok := colorToANSI[code]; !ok {
+			return s
+		}
+
+		return prefix + "[[" + code + "]]" + suffix
+	})
+}
+
 type fallbackRange struct {
 	start, end int
 }
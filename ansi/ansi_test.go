@@ -120,6 +120,21 @@ var _ = Describe("Color", func() {
 		})
 	})
 
+	Describe("Quote", func() {
+		var (
+			str   = "[r]red[x], [[r]partial[r]] and [[r]]escaped"
+			plain = "[r]red[x], [[r]partial[r]] and [r]escaped"
+		)
+
+		It("keeps color codes from being colorized", func() {
+			Ω(Colorize(Quote(str))).Should(Equal(plain))
+		})
+
+		It("leaves other text alone", func() {
+			Ω(Quote("[nope] [x")).Should(Equal("[nope] [x"))
+		})
+	})
+
 	Describe("Partially escaped", func() {
 		var (
 			pStr    = "[[r]red[x]"
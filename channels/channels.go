@@ -0,0 +1,559 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package channels sends text between players. Saying something sends it to
+// everyone in the speaker's room, telling sends it to one player and named
+// channels send it to everyone who has joined them. Channels keep a history
+// of recent messages, players can ignore each other and every message is
+// rendered through a tmpl view (see views.go) before being sent to each
+// player's session.
+package channels
+
+import (
+	"errors"
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/session"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// DefaultHistory is the number of messages channels keep when they aren't
+// given a size.
+const DefaultHistory = 50
+
+// Events fired after text is sent and channels are joined or left, see
+// Service.On. Say has "speaker", "room" and "message", tell has "sender",
+// "to" and "message", message has "channel", "sender" and "message" and join
+// and leave have "channel" and "entity". Before each one a before:<event> is
+// fired that can stop it.
+const (
+	EvtSay     = "channels:say"
+	EvtTell    = "channels:tell"
+	EvtMessage = "channels:message"
+	EvtJoin    = "channels:join"
+	EvtLeave   = "channels:leave"
+)
+
+// Events lists every event fired by channels.
+var Events = []string{EvtSay, EvtTell, EvtMessage, EvtJoin, EvtLeave}
+
+// Errors returned by channels.
+var (
+	ErrMissingName   = errors.New("channels: channels must have a name")
+	ErrChannelExists = errors.New("channels: a channel with that name already exists")
+	ErrNotFound      = errors.New("channels: channel not found")
+	ErrNotAllowed    = errors.New("channels: that channel is private")
+	ErrRequired      = errors.New("channels: that channel can't be left")
+	ErrNotMember     = errors.New("channels: not a member of the channel")
+	ErrEmptyMessage  = errors.New("channels: there's nothing to say")
+	ErrIgnored       = errors.New("channels: they're ignoring you")
+	ErrIgnoreSelf    = errors.New("channels: you can't ignore yourself")
+	ErrRefused       = errors.New("channels: that isn't allowed")
+)
+
+// Options describe a channel.
+type Options struct {
+	Description string
+
+	// History is the number of messages kept, DefaultHistory if it's 0.
+	History int
+
+	// Private channels can only be joined by entities allowed to join them.
+	Private bool
+
+	// Required channels can't be left.
+	Required bool
+}
+
+// Channel is a named channel, anything sent to it goes to all of it's
+// members.
+type Channel struct {
+	Name string
+	Options
+}
+
+type channel struct {
+	Channel
+	members map[string]bool
+	allowed map[string]bool
+	history *history
+}
+
+// Service sends text to players' sessions.
+type Service struct {
+	world    *world.World
+	sessions *session.Registry
+	channels map[string]*channel
+	ignores  map[string]map[string]bool
+	mutex    *sync.RWMutex
+	events   *events.Emitter
+	vetoes   *events.Emitter
+	caller   interface{}
+	log      logger.Log
+}
+
+// New creates a service for the world's players, sending text to their
+// sessions in the registry.
+func New(w *world.World, sessions *session.Registry) *Service {
+	return &Service{
+		world:    w,
+		sessions: sessions,
+		channels: make(map[string]*channel),
+		ignores:  make(map[string]map[string]bool),
+		mutex:    new(sync.RWMutex),
+		events:   events.NewEmitter(logger.NewWithSource("channels")),
+		vetoes:   events.NewEmitter(logger.NewWithSource("channels")),
+		log:      logger.NewWithSource("channels"),
+	}
+}
+
+// On registers a handler for one of the service's events. Handlers for
+// before:<event> are called first, returning events.ErrHalt stops it with
+// ErrRefused and other errors are returned as they are.
+func (s *Service) On(evt string, h events.Handler) {
+	if strings.HasPrefix(evt, "before:") {
+		s.vetoes.On(evt, h)
+
+		return
+	}
+	s.events.On(evt, h)
+}
+
+// WithCaller returns the same service, except that handlers for before events
+// are given the caller as events.CallerKey in their data.
+func (s *Service) WithCaller(caller interface{}) *Service {
+	c := *s
+	c.caller = caller
+
+	return &c
+}
+
+// Create adds a channel, names are case insensitive.
+func (s *Service) Create(name string, opts Options) (*Channel, error) {
+	name = channelName(name)
+	if name == "" {
+		return nil, ErrMissingName
+	}
+	if opts.History <= 0 {
+		opts.History = DefaultHistory
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.channels[name]; ok {
+		return nil, ErrChannelExists
+	}
+	c := &channel{
+		Channel: Channel{Name: name, Options: opts},
+		members: make(map[string]bool),
+		allowed: make(map[string]bool),
+		history: newHistory(opts.History),
+	}
+	s.channels[name] = c
+	ch := c.Channel
+
+	return &ch, nil
+}
+
+// Channel fetches the channel with the name.
+func (s *Service) Channel(name string) (*Channel, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c, err := s.channel(name)
+	if err != nil {
+		return nil, err
+	}
+	ch := c.Channel
+
+	return &ch, nil
+}
+
+// Channels lists every channel, sorted by name.
+func (s *Service) Channels() []*Channel {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]*Channel, 0, len(s.channels))
+	for _, c := range s.channels {
+		ch := c.Channel
+		list = append(list, &ch)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// Destroy removes the channel along with it's history.
+func (s *Service) Destroy(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, err := s.channel(name)
+	if err != nil {
+		return err
+	}
+	delete(s.channels, c.Name)
+
+	return nil
+}
+
+// Allow lets the entity join the private channel.
+func (s *Service) Allow(name, entity string) error {
+	return s.setAllowed(name, entity, true)
+}
+
+// Disallow stops the entity from joining the private channel, if they're a
+// member they're removed from it.
+func (s *Service) Disallow(name, entity string) error {
+	return s.setAllowed(name, entity, false)
+}
+
+func (s *Service) setAllowed(name, entity string, allowed bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, err := s.channel(name)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		c.allowed[entity] = true
+	} else {
+		delete(c.allowed, entity)
+		if c.Private {
+			delete(c.members, entity)
+		}
+	}
+
+	return nil
+}
+
+// Join makes the entity a member of the channel.
+func (s *Service) Join(name, entity string) error {
+	s.mutex.RLock()
+	c, err := s.channel(name)
+	if err == nil && c.Private && !c.allowed[entity] {
+		err = ErrNotAllowed
+	}
+	s.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return s.membership(EvtJoin, c, entity, true)
+}
+
+// Leave stops the entity being a member of the channel.
+func (s *Service) Leave(name, entity string) error {
+	s.mutex.RLock()
+	c, err := s.channel(name)
+	if err == nil && !c.members[entity] {
+		err = ErrNotMember
+	}
+	if err == nil && c.Required {
+		err = ErrRequired
+	}
+	s.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return s.membership(EvtLeave, c, entity, false)
+}
+
+func (s *Service) membership(evt string, c *channel, entity string, member bool) error {
+	d := events.Data{"channel": c.Name, "entity": entity}
+	if err := s.veto(evt, d); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	if member {
+		c.members[entity] = true
+	} else {
+		delete(c.members, entity)
+	}
+	s.mutex.Unlock()
+	s.events.Emit(evt, d)
+
+	return nil
+}
+
+// Members lists the IDs of the channel's members, sorted.
+func (s *Service) Members(name string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c, err := s.channel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys(c.members), nil
+}
+
+// Memberships lists the names of the channels the entity is a member of,
+// sorted.
+func (s *Service) Memberships(entity string) []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var names []string
+	for name, c := range s.channels {
+		if c.members[entity] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// History fetches the last count messages sent to the channel, oldest first.
+// A count of 0 fetches all of them.
+func (s *Service) History(name string, count int) ([]Message, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	c, err := s.channel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.history.last(count), nil
+}
+
+// Ignore stops text from other reaching the entity, whether it's said,
+// told or sent to a channel.
+func (s *Service) Ignore(entity, other string) error {
+	if entity == other {
+		return ErrIgnoreSelf
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ignores[entity] == nil {
+		s.ignores[entity] = make(map[string]bool)
+	}
+	s.ignores[entity][other] = true
+
+	return nil
+}
+
+// Unignore lets text from other reach the entity again.
+func (s *Service) Unignore(entity, other string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.ignores[entity], other)
+}
+
+// Ignoring lists the IDs of those the entity is ignoring, sorted.
+func (s *Service) Ignoring(entity string) []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return keys(s.ignores[entity])
+}
+
+// Attach sends text for the entity to the session, replacing any session it
+// had.
+func (s *Service) Attach(entity string, sess session.Session) {
+	s.sessions.Attach(entity, sess)
+}
+
+// Detach stops sending text to the entity.
+func (s *Service) Detach(entity string) {
+	s.sessions.Detach(entity)
+}
+
+// Say sends the message to everyone in the speaker's room.
+func (s *Service) Say(speaker, message string) error {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ErrEmptyMessage
+	}
+	room, err := s.world.Location(speaker)
+	if err != nil {
+		return err
+	}
+	occupants, err := s.world.Occupants(room.ID)
+	if err != nil {
+		return err
+	}
+
+	d := events.Data{"speaker": speaker, "room": room.ID, "message": message}
+	if err := s.veto(EvtSay, d); err != nil {
+		return err
+	}
+
+	view := s.newView(speaker, message)
+	for _, id := range occupants {
+		if id == speaker {
+			s.deliver(id, SayView+".self", view)
+		} else if !s.ignoring(id, speaker) {
+			s.deliver(id, SayView, view)
+		}
+	}
+	s.events.Emit(EvtSay, d)
+
+	return nil
+}
+
+// Tell sends the message to another player, they must be connected.
+func (s *Service) Tell(sender, to, message string) error {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ErrEmptyMessage
+	}
+	if _, ok := s.sessions.Session(to); !ok {
+		return session.ErrNotConnected
+	}
+	if s.ignoring(to, sender) {
+		return ErrIgnored
+	}
+
+	d := events.Data{"sender": sender, "to": to, "message": message}
+	if err := s.veto(EvtTell, d); err != nil {
+		return err
+	}
+
+	view := s.newView(sender, message)
+	view["to"] = template.HTML(s.name(to))
+	view["to_id"] = to
+	s.deliver(to, TellView, view)
+	s.deliver(sender, TellView+".self", view)
+	s.events.Emit(EvtTell, d)
+
+	return nil
+}
+
+// Send sends the message to every member of the channel, the sender must be a
+// member.
+func (s *Service) Send(name, sender, message string) error {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return ErrEmptyMessage
+	}
+
+	s.mutex.RLock()
+	c, err := s.channel(name)
+	if err == nil && !c.members[sender] {
+		err = ErrNotMember
+	}
+	s.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	d := events.Data{"channel": c.Name, "sender": sender, "message": message}
+	if err := s.veto(EvtMessage, d); err != nil {
+		return err
+	}
+
+	m := Message{
+		Channel:    c.Name,
+		Sender:     sender,
+		SenderName: s.name(sender),
+		Text:       message,
+		Time:       time.Now(),
+	}
+	s.mutex.Lock()
+	c.history.add(m)
+	members := keys(c.members)
+	s.mutex.Unlock()
+
+	view := s.newView(sender, message)
+	view["channel"] = c.Name
+	v := channelView(c.Name)
+	for _, id := range members {
+		if !s.ignoring(id, sender) {
+			s.deliver(id, v, view)
+		}
+	}
+	s.events.Emit(EvtMessage, d)
+
+	return nil
+}
+
+// expects the mutex to be held
+func (s *Service) channel(name string) (*channel, error) {
+	c, ok := s.channels[channelName(name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return c, nil
+}
+
+func (s *Service) ignoring(entity, other string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.ignores[entity][other]
+}
+
+// give handlers for the before event a chance to stop it
+func (s *Service) veto(evt string, d events.Data) error {
+	if s.caller != nil {
+		d = d.Clone()
+		d[events.CallerKey] = s.caller
+	}
+	err := s.vetoes.Trigger("before:"+evt, d)
+	if err == events.ErrHalt {
+		return ErrRefused
+	}
+
+	return err
+}
+
+// render the view and send it to the entity, entities nobody is playing
+// don't have a session and are skipped
+func (s *Service) deliver(entity, view string, data map[string]interface{}) {
+	text, err := render(view, data)
+	if err == nil {
+		err = s.sessions.Send(entity, text)
+	}
+	if err != nil && err != session.ErrNotConnected {
+		s.log.WithError(err).WithFields(logger.Fields{
+			"entity": entity,
+			"view":   view,
+		}).Error("Failed to deliver a message.")
+	}
+}
+
+// the name of the entity in the world, or it's ID if it has no name
+func (s *Service) name(id string) string {
+	node, err := s.world.Store().GetNode(id)
+	if err == nil {
+		if name, ok := node.Properties["name"].(string); ok && name != "" {
+			return name
+		}
+	}
+
+	return id
+}
+
+func channelName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+
+	return list
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package channels_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Channels Suite")
+}
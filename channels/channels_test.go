@@ -0,0 +1,257 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package channels_test
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/session"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	"github.com/bbuck/dragon-mud/text/tmpl"
+	"github.com/bbuck/dragon-mud/world"
+
+	. "github.com/bbuck/dragon-mud/channels"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// inbox is a session keeping the text sent to it
+type inbox struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (i *inbox) Send(text string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.lines = append(i.lines, text)
+
+	return nil
+}
+
+func (i *inbox) read() []string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return append([]string(nil), i.lines...)
+}
+
+var _ = Describe("Channels", func() {
+	var (
+		w                 *world.World
+		s                 *Service
+		alice, bob, carol string
+		inboxes           map[string]*inbox
+		square            *world.Room
+	)
+
+	BeforeEach(func() {
+		w = world.New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+		sessions := session.NewRegistry()
+		s = New(w, sessions)
+
+		square, _ = w.CreateRoom("Square", "", nil)
+		inn, _ := w.CreateRoom("Inn", "", nil)
+		inboxes = make(map[string]*inbox)
+		player := func(name string, room *world.Room) string {
+			node, err := w.Store().CreateNode(nil, storage.Properties{"name": name})
+			Ω(err).Should(BeNil())
+			Ω(w.Move(node.ID, room.ID)).Should(BeNil())
+			inboxes[node.ID] = new(inbox)
+			sessions.Attach(node.ID, inboxes[node.ID])
+
+			return node.ID
+		}
+		alice = player("Alice", square)
+		bob = player("Bob", square)
+		carol = player("Carol", inn)
+	})
+
+	Context("saying", func() {
+		It("sends the message to the speaker's room", func() {
+			Ω(s.Say(alice, "Hello there.")).Should(BeNil())
+			Ω(inboxes[alice].read()).Should(Equal([]string{`You say, "Hello there."`}))
+			Ω(inboxes[bob].read()).Should(Equal([]string{`Alice says, "Hello there."`}))
+			Ω(inboxes[carol].read()).Should(BeEmpty())
+		})
+
+		It("skips occupants without a session", func() {
+			guard, _ := w.Store().CreateNode(nil, storage.Properties{"name": "a guard"})
+			w.Move(guard.ID, square.ID)
+			Ω(s.Say(guard.ID, "Move along.")).Should(BeNil())
+			Ω(inboxes[alice].read()).Should(Equal([]string{`a guard says, "Move along."`}))
+		})
+
+		It("doesn't send empty messages", func() {
+			Ω(s.Say(alice, "  ")).Should(Equal(ErrEmptyMessage))
+		})
+
+		It("doesn't let players send color or control codes", func() {
+			Ω(s.Say(alice, "[r]Hello\033[31m <b>there</b>.")).Should(BeNil())
+			Ω(inboxes[bob].read()).Should(Equal([]string{`Alice says, "[[r]]Hello[31m <b>there</b>."`}))
+		})
+
+		It("renders the game's views", func() {
+			tmpl.Register(SayView, `{{sender}}: {{message}}`)
+			defer tmpl.Register(SayView, `{{sender}} says, "{{message}}"`)
+
+			s.Say(alice, "Hi.")
+			Ω(inboxes[bob].read()).Should(Equal([]string{"Alice: Hi."}))
+		})
+	})
+
+	Context("telling", func() {
+		It("sends the message to one player", func() {
+			Ω(s.Tell(alice, carol, "Meet me at the inn.")).Should(BeNil())
+			Ω(inboxes[carol].read()).Should(Equal([]string{`Alice tells you, "Meet me at the inn."`}))
+			Ω(inboxes[alice].read()).Should(Equal([]string{`You tell Carol, "Meet me at the inn."`}))
+			Ω(inboxes[bob].read()).Should(BeEmpty())
+		})
+
+		It("only tells players who are connected", func() {
+			guard, _ := w.Store().CreateNode(nil, storage.Properties{"name": "a guard"})
+			Ω(s.Tell(alice, guard.ID, "Hello?")).Should(Equal(session.ErrNotConnected))
+		})
+	})
+
+	Context("ignoring", func() {
+		BeforeEach(func() {
+			Ω(s.Ignore(bob, alice)).Should(BeNil())
+		})
+
+		It("keeps messages from reaching the player", func() {
+			s.Say(alice, "Hello.")
+			Ω(inboxes[bob].read()).Should(BeEmpty())
+			Ω(s.Tell(alice, bob, "Hello?")).Should(Equal(ErrIgnored))
+			Ω(s.Ignoring(bob)).Should(Equal([]string{alice}))
+		})
+
+		It("can be stopped", func() {
+			s.Unignore(bob, alice)
+			Ω(s.Tell(alice, bob, "Hello?")).Should(BeNil())
+			Ω(s.Ignoring(bob)).Should(BeEmpty())
+		})
+
+		It("doesn't let players ignore themselves", func() {
+			Ω(s.Ignore(bob, bob)).Should(Equal(ErrIgnoreSelf))
+		})
+	})
+
+	Context("channels", func() {
+		BeforeEach(func() {
+			_, err := s.Create("OOC", Options{Description: "Out of character", History: 2})
+			Ω(err).Should(BeNil())
+			Ω(s.Join("ooc", alice)).Should(BeNil())
+			Ω(s.Join("ooc", carol)).Should(BeNil())
+		})
+
+		It("sends messages to the members", func() {
+			Ω(s.Send("ooc", alice, "Anyone around?")).Should(BeNil())
+			Ω(inboxes[alice].read()).Should(Equal([]string{"[ooc] Alice: Anyone around?"}))
+			Ω(inboxes[carol].read()).Should(Equal([]string{"[ooc] Alice: Anyone around?"}))
+			Ω(inboxes[bob].read()).Should(BeEmpty())
+		})
+
+		It("only takes messages from members", func() {
+			Ω(s.Send("ooc", bob, "Hello?")).Should(Equal(ErrNotMember))
+		})
+
+		It("uses views for the channel", func() {
+			tmpl.Register(ChannelView+".ooc", `(OOC) {{sender}}: {{message}}`)
+			defer tmpl.Unregister(ChannelView + ".ooc")
+
+			s.Send("ooc", alice, "Hi.")
+			Ω(inboxes[carol].read()).Should(Equal([]string{"(OOC) Alice: Hi."}))
+		})
+
+		It("keeps a history", func() {
+			for _, text := range []string{"one", "two", "three"} {
+				Ω(s.Send("ooc", alice, text)).Should(BeNil())
+			}
+
+			messages, err := s.History("ooc", 0)
+			Ω(err).Should(BeNil())
+			Ω(messages).Should(HaveLen(2))
+			Ω(messages[0].Text).Should(Equal("two"))
+			Ω(messages[1].Text).Should(Equal("three"))
+			Ω(messages[1].SenderName).Should(Equal("Alice"))
+
+			messages, _ = s.History("ooc", 1)
+			Ω(messages).Should(HaveLen(1))
+			Ω(messages[0].Text).Should(Equal("three"))
+		})
+
+		It("lists members and memberships", func() {
+			s.Create("newbie", Options{})
+			s.Join("newbie", alice)
+			Ω(s.Members("ooc")).Should(ConsistOf(alice, carol))
+			Ω(s.Memberships(alice)).Should(Equal([]string{"newbie", "ooc"}))
+		})
+
+		It("can be left", func() {
+			Ω(s.Leave("ooc", carol)).Should(BeNil())
+			s.Send("ooc", alice, "Hi.")
+			Ω(inboxes[carol].read()).Should(BeEmpty())
+			Ω(s.Leave("ooc", carol)).Should(Equal(ErrNotMember))
+		})
+
+		It("can't be created twice", func() {
+			_, err := s.Create("ooc", Options{})
+			Ω(err).Should(Equal(ErrChannelExists))
+		})
+
+		It("keeps players in required channels", func() {
+			s.Create("announcements", Options{Required: true})
+			s.Join("announcements", bob)
+			Ω(s.Leave("announcements", bob)).Should(Equal(ErrRequired))
+		})
+
+		It("only lets allowed players join private channels", func() {
+			s.Create("immortals", Options{Private: true})
+			Ω(s.Join("immortals", bob)).Should(Equal(ErrNotAllowed))
+			s.Allow("immortals", bob)
+			Ω(s.Join("immortals", bob)).Should(BeNil())
+
+			s.Disallow("immortals", bob)
+			Ω(s.Members("immortals")).Should(BeEmpty())
+		})
+
+		It("lets handlers refuse joining", func() {
+			s.On("before:"+EvtJoin, events.HandlerFunc(func(d events.Data) error {
+				if d["entity"] == bob {
+					return events.ErrHalt
+				}
+
+				return nil
+			}))
+
+			Ω(s.Join("ooc", bob)).Should(Equal(ErrRefused))
+		})
+
+		It("fires events", func() {
+			var (
+				mutex sync.Mutex
+				fired []events.Data
+			)
+			s.On(EvtMessage, events.HandlerFunc(func(d events.Data) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				fired = append(fired, d)
+
+				return nil
+			}))
+			s.Send("ooc", alice, "Hi.")
+
+			Eventually(func() []events.Data {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				return append([]events.Data(nil), fired...)
+			}).Should(Equal([]events.Data{{"channel": "ooc", "sender": alice, "message": "Hi."}}))
+		})
+	})
+})
@@ -0,0 +1,55 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package channels
+
+import "time"
+
+// Message is a message sent to a channel.
+type Message struct {
+	Channel    string
+	Sender     string
+	SenderName string
+	Text       string
+	Time       time.Time
+}
+
+// history keeps the last messages sent to a channel, once it's full the
+// oldest message is replaced by each new one
+type history struct {
+	messages []Message
+	next     int
+	full     bool
+}
+
+func newHistory(size int) *history {
+	return &history{
+		messages: make([]Message, size),
+	}
+}
+
+func (h *history) add(m Message) {
+	h.messages[h.next] = m
+	h.next = (h.next + 1) % len(h.messages)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// the last count messages, oldest first, or all of them if count is 0
+func (h *history) last(count int) []Message {
+	size := h.next
+	if h.full {
+		size = len(h.messages)
+	}
+	if count <= 0 || count > size {
+		count = size
+	}
+
+	list := make([]Message, count)
+	start := h.next - count
+	for i := range list {
+		list[i] = h.messages[(start+i+len(h.messages))%len(h.messages)]
+	}
+
+	return list
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package channels
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+
+	"github.com/bbuck/dragon-mud/ansi"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/text/tmpl"
+)
+
+// Names of the views messages are rendered with, the speaker (or sender of a
+// tell) sees the ".self" view. A channel's messages use the view named after
+// it ("channels.channel.ooc") if the game has one. Views are given "sender",
+// "sender_id" and "message", along with "to" and "to_id" for tells and
+// "channel" for channels. Games replace these views by adding their own, like
+// views/channels/say.view.
+const (
+	SayView     = "channels.say"
+	TellView    = "channels.tell"
+	ChannelView = "channels.channel"
+)
+
+var defaultViews = map[string]string{
+	SayView:            `{{sender}} says, "{{message}}"`,
+	SayView + ".self":  `You say, "{{message}}"`,
+	TellView:           `{{sender}} tells you, "{{message}}"`,
+	TellView + ".self": `You tell {{to}}, "{{message}}"`,
+	ChannelView:        `[{{channel}}] {{sender}}: {{message}}`,
+}
+
+// register the default views, views loaded from plugins and the game are
+// loaded later and replace them
+func init() {
+	for name, contents := range defaultViews {
+		if err := tmpl.Register(name, contents); err != nil {
+			logger.NewWithSource("channels").WithError(err).WithField("view", name).Error("Failed to register a view.")
+		}
+	}
+}
+
+// the view for messages sent to the channel
+func channelView(name string) string {
+	if _, err := tmpl.Template(ChannelView + "." + name); err == nil {
+		return ChannelView + "." + name
+	}
+
+	return ChannelView
+}
+
+// the data views are rendered with, the text is marked safe since it's sent
+// to players' sessions and not to a browser. Names come from the world but
+// messages are typed by players, so they go through playerText first.
+func (s *Service) newView(sender, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"sender":    template.HTML(s.name(sender)),
+		"sender_id": sender,
+		"message":   playerText(message),
+	}
+}
+
+// text typed by a player is shown as they typed it, control characters (like
+// the escape starting an ANSI code) are dropped and color codes are escaped
+func playerText(text string) template.HTML {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+
+		return r
+	}, text)
+
+	return template.HTML(ansi.Quote(text))
+}
+
+func render(view string, data map[string]interface{}) (string, error) {
+	r, err := tmpl.Template(view)
+	if err != nil {
+		return "", err
+	}
+
+	return r.Render(data)
+}
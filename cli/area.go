@@ -0,0 +1,168 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package cli
+
+import (
+	"os"
+
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/output"
+	"github.com/bbuck/dragon-mud/world"
+	"github.com/bbuck/dragon-mud/world/areafile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	areaFormat  string
+	areaName    string
+	areaParent  string
+	areaReplace bool
+	areaOutput  string
+
+	areaCmd = &cobra.Command{
+		Use:   "area",
+		Short: "Import and export areas of the world.",
+		Long: `Commands for moving areas in and out of the world. Classic ROM style ".are"
+files can be imported, and areas can be imported from and exported to a native
+TOML or JSON format that is easy to edit and diff.`,
+	}
+
+	areaImportCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import an area file into the world.",
+		Long: `Imports the rooms, exits, mobiles, objects and resets of an area file into the
+world. The format is picked from the file's extension, ".are" for ROM files,
+".json" for JSON and TOML for anything else, unless --format is given. An area
+that already exists is only replaced with --replace.`,
+		Run: func(_ *cobra.Command, args []string) {
+			log := logger.NewWithSource("cmd(area import)")
+			if len(args) != 1 {
+				log.Fatal("Expected the area file to import.")
+			}
+
+			f, err := readAreaFile(args[0])
+			if err != nil {
+				log.WithError(err).WithField("file", args[0]).Fatal("Failed to read the area file.")
+			}
+
+			w := loadWorld(log)
+			opts := areafile.ImportOptions{
+				Name:    areaName,
+				Replace: areaReplace,
+			}
+			if areaParent != "" {
+				parent, err := w.FindArea(areaParent)
+				if err != nil {
+					log.WithError(err).WithField("area", areaParent).Fatal("Failed to find the parent area.")
+				}
+				opts.Parent = parent.ID
+			}
+
+			res, err := areafile.Import(w, f, opts)
+			if err != nil {
+				log.WithError(err).WithField("file", args[0]).Fatal("Failed to import the area.")
+			}
+
+			out := output.Stdout()
+			for _, warning := range res.Warnings {
+				out.Printf("[Y]warning[x]   %s\n", warning)
+			}
+			out.Printf("[G]imported[x]  %s: %d rooms, %d exits, %d mobiles, %d objects, %d resets\n", res.Area.Name, res.Rooms, res.Exits, res.Mobiles, res.Objects, res.Resets)
+		},
+	}
+
+	areaExportCmd = &cobra.Command{
+		Use:   "export <area>",
+		Short: "Export an area of the world.",
+		Long: `Exports the named area as TOML, or JSON, to standard out or the --output file.
+The format is picked from the output file's extension unless --format is
+given.`,
+		Run: func(_ *cobra.Command, args []string) {
+			log := logger.NewWithSource("cmd(area export)")
+			if len(args) != 1 {
+				log.Fatal("Expected the name of the area to export.")
+			}
+
+			w := loadWorld(log)
+			area, err := w.FindArea(args[0])
+			if err != nil {
+				log.WithError(err).WithField("area", args[0]).Fatal("Failed to find the area.")
+			}
+
+			f, err := areafile.Export(w, area.ID)
+			if err != nil {
+				log.WithError(err).WithField("area", args[0]).Fatal("Failed to export the area.")
+			}
+
+			format := areaFormat
+			if format == "" {
+				format = areafile.FormatTOML
+				if areaOutput != "" {
+					format = areafile.FormatFor(areaOutput)
+				}
+			}
+
+			if areaOutput == "" {
+				err = areafile.Write(os.Stdout, f, format)
+			} else {
+				err = writeAreaFile(areaOutput, f, format)
+			}
+			if err != nil {
+				log.WithError(err).Fatal("Failed to write the area.")
+			}
+			if areaOutput != "" {
+				output.Stdout().Printf("[G]exported[x]  %s to %s\n", area.Name, areaOutput)
+			}
+		},
+	}
+)
+
+func readAreaFile(path string) (*areafile.File, error) {
+	if areaFormat == "" {
+		return areafile.ReadFile(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return areafile.Read(file, areaFormat)
+}
+
+func writeAreaFile(path string, f *areafile.File, format string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := areafile.Write(file, f, format); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+// connect to the database and load the world kept in it
+func loadWorld(log logger.Log) *world.World {
+	w, err := data.World()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load the world.")
+	}
+
+	return w
+}
+
+func init() {
+	areaCmd.PersistentFlags().StringVarP(&areaFormat, "format", "f", "", `Area file format, "toml", "json" or "rom" (import only)`)
+	areaImportCmd.Flags().StringVarP(&areaName, "name", "n", "", "Name to give the area instead of the one in the file")
+	areaImportCmd.Flags().StringVarP(&areaParent, "parent", "p", "", "Name of the area the imported area is part of")
+	areaImportCmd.Flags().BoolVarP(&areaReplace, "replace", "r", false, "Replace the area if it already exists")
+	areaExportCmd.Flags().StringVarP(&areaOutput, "output", "o", "", "File to write the area to instead of standard out")
+
+	areaCmd.AddCommand(areaImportCmd, areaExportCmd)
+	RootCmd.AddCommand(areaCmd)
+}
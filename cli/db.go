@@ -0,0 +1,120 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package cli
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/migrate"
+	"github.com/bbuck/dragon-mud/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rollbackSteps int
+
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manage the game's database.",
+		Long: `Commands for managing the game's database, such as applying and rolling back
+schema migrations. Migrations live in the "migrations" directory of the game and
+of each plugin.`,
+	}
+
+	dbMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply all pending migrations.",
+		Long: `Applies every migration that has not yet been applied, from the game and all
+plugins, in version order. Stops at the first migration that fails.`,
+		Run: func(*cobra.Command, []string) {
+			log := logger.NewWithSource("cmd(db migrate)")
+			mr := loadMigrator(log)
+
+			done, err := mr.Migrate()
+			out := output.Stdout()
+			for _, m := range done {
+				out.Printf("[G]migrated[x]     %s\n", m.ID())
+			}
+			if err != nil {
+				log.WithError(err).Fatal("Migration failed.")
+			}
+			if len(done) == 0 {
+				out.Println("Database is up to date.")
+			}
+		},
+	}
+
+	dbRollbackCmd = &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back the most recently applied migrations.",
+		Long: `Rolls back the most recently applied migrations, one by default. Migrations
+without a down step cannot be rolled back.`,
+		Run: func(*cobra.Command, []string) {
+			log := logger.NewWithSource("cmd(db rollback)")
+			mr := loadMigrator(log)
+
+			done, err := mr.Rollback(rollbackSteps)
+			out := output.Stdout()
+			for _, m := range done {
+				out.Printf("[Y]rolled back[x]  %s\n", m.ID())
+			}
+			if err != nil {
+				log.WithError(err).Fatal("Rollback failed.")
+			}
+			if len(done) == 0 {
+				out.Println("No migrations to roll back.")
+			}
+		},
+	}
+
+	dbStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they have been applied.",
+		Run: func(*cobra.Command, []string) {
+			log := logger.NewWithSource("cmd(db status)")
+			mr := loadMigrator(log)
+
+			statuses, err := mr.Status()
+			if err != nil {
+				log.WithError(err).Fatal("Failed to fetch migration status.")
+			}
+
+			out := output.Stdout()
+			for _, s := range statuses {
+				switch {
+				case s.Missing:
+					out.Printf("[R]missing[x]  %s (applied %s)\n", s.ID(), s.AppliedAt.Format("2006-01-02 15:04:05"))
+				case s.Applied:
+					out.Printf("[G]applied[x]  %s (%s)\n", s.ID(), s.AppliedAt.Format("2006-01-02 15:04:05"))
+				default:
+					out.Printf("[Y]pending[x]  %s\n", s.ID())
+				}
+			}
+			if len(statuses) == 0 {
+				out.Println("No migrations found.")
+			}
+		},
+	}
+)
+
+// load the migrations for the game and connect to the database
+func loadMigrator(log logger.Log) *migrate.Migrator {
+	migrations, err := migrate.Load()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load migrations.")
+	}
+
+	db, err := data.DB()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to connect to the database.")
+	}
+
+	return migrate.New(db, migrations)
+}
+
+func init() {
+	dbRollbackCmd.Flags().IntVarP(&rollbackSteps, "steps", "s", 1, "Number of migrations to roll back")
+
+	dbCmd.AddCommand(dbMigrateCmd, dbRollbackCmd, dbStatusCmd)
+	RootCmd.AddCommand(dbCmd)
+}
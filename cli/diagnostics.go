@@ -0,0 +1,76 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/output"
+	"github.com/bbuck/dragon-mud/plugins"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diagnosticsTop int
+	diagnosticsCmd = &cobra.Command{
+		Use:   "diagnostics",
+		Short: "Report on the resources used by scripts at each security level.",
+		Long: `Builds an engine for each security level (server, client and entity), loading
+all plugin code for that level, and reports the memory held by each engine along
+with the globals and modules consuming the most of it. Use this to track down
+plugins that are holding on to more memory than they should.`,
+		Aliases: []string{"diag"},
+		Run: func(*cobra.Command, []string) {
+			log := logger.NewWithSource("cmd(diagnostics)")
+
+			if err := plugins.LoadViews(); err != nil {
+				log.WithError(err).Error("Failed to load views")
+			}
+
+			out := output.Stdout()
+			levels := []scripting.SecurityLevel{
+				scripting.ServerLevel,
+				scripting.ClientLevel,
+				scripting.EntityLevel,
+			}
+			for _, sl := range levels {
+				report := scripting.ReportMemory(sl, diagnosticsTop)
+
+				out.Printf("[W]%s[x] engine: [C]%s[x] used", sl, formatBytes(report.Usage.Total()))
+				if report.Limit > 0 {
+					out.Printf(" of [C]%s[x]", formatBytes(report.Limit))
+				}
+				out.Printf(" (%d tables, %d strings)\n", report.Usage.Tables, report.Usage.Strings)
+
+				for _, consumer := range report.Consumers {
+					out.Printf("  %10s  %s\n", formatBytes(consumer.Usage.Total()), consumer.Name)
+				}
+				out.PlainPrintln("")
+			}
+		},
+	}
+)
+
+// format a number of bytes in a human readable way
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	diagnosticsCmd.Flags().IntVarP(&diagnosticsTop, "top", "t", 10, "Number of top memory consumers to report for each security level")
+
+	RootCmd.AddCommand(diagnosticsCmd)
+}
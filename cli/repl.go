@@ -35,13 +35,19 @@ in libraries for quick testing.`,
 			if err := plugins.LoadViews(); err != nil {
 				log.WithError(err).Error("Failed to load views")
 			}
+			if err := plugins.LoadTables(); err != nil {
+				log.WithError(err).Error("Failed to load random tables")
+			}
 
-			// TODO: Add security level specic engine creation here
-			eng := lua.NewEngine(lua.EngineOptions{
-				FieldNaming:  lua.SnakeCaseNames,
-				MethodNaming: lua.SnakeCaseNames,
-			})
-			scripting.OpenLibs(eng, "*")
+			sl, err := scripting.ParseSecurityLevel(level)
+			if err != nil {
+				log.WithError(err).Fatal("Cannot start console with the requested security level.")
+			}
+			log = log.WithField("level", sl.String())
+
+			scripting.InitializeEmitters()
+			eng := scripting.NewEngine(sl)
+			defer eng.Close()
 
 			name := strings.ToLower(viper.GetString("name"))
 			repl := lua.NewREPLWithConfig(lua.REPLConfig{
@@ -52,7 +58,7 @@ in libraries for quick testing.`,
 			})
 
 			fmt.Printf("\n  type '.exit' to quit.\n\n")
-			err := repl.Run()
+			err = repl.Run()
 			if err != nil {
 				log.WithError(err).Error("Encountered error running Console.")
 			}
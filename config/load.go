@@ -48,6 +48,15 @@ func RegisterDefaults() {
 	viper.SetDefault("database.development.host", "localhost")
 	viper.SetDefault("database.development.username", "neo4j")
 	viper.SetDefault("database.development.port", 7687)
+
+	// entity cache defaults
+	viper.SetDefault("entity_cache.flush_interval", "5s")
+
+	// entity script defaults
+	viper.SetDefault("scripting.entity.engines", 4)
+
+	// world defaults
+	viper.SetDefault("world.reset_interval", "15m")
 }
 
 func bindEnvVars() {
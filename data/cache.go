@@ -0,0 +1,32 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package data
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/entity"
+	"github.com/spf13/viper"
+)
+
+var (
+	cacheMutex  = new(sync.Mutex)
+	entityCache *entity.Cache
+)
+
+// EntityCache fetches the cache shared by every entity registry, configured
+// with entity_cache in the Dragonfile. This is nil if the cache isn't
+// enabled. Changes held by the cache are written when the database is closed.
+func EntityCache() *entity.Cache {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if entityCache == nil && viper.GetBool("entity_cache.enabled") {
+		entityCache = entity.NewCache(Lazy(), entity.CacheOptions{
+			FlushInterval: viper.GetDuration("entity_cache.flush_interval"),
+			MaxSize:       viper.GetInt("entity_cache.max_size"),
+		})
+	}
+
+	return entityCache
+}
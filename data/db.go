@@ -1,45 +1,161 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
 package data
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/bbuck/dragon-mud/logger"
 	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
 	"github.com/spf13/viper"
 )
 
+// Adapters that can be given as database.<env>.adapter in the Dragonfile.
+const (
+	Neo4jAdapter  = "neo4j"
+	MemoryAdapter = "memory"
+)
+
+// UnknownAdapterError is returned when the Dragonfile asks for an adapter that
+// doesn't exist.
+type UnknownAdapterError string
+
+// Error describes the adapter requested.
+func (uae UnknownAdapterError) Error() string {
+	return fmt.Sprintf("unknown database adapter %q, expected %q or %q", string(uae), Neo4jAdapter, MemoryAdapter)
+}
+
 var (
-	connectOptions *talon.ConnectOptions
-	db             *talon.DB
-	log            logger.Log
+	mutex = new(sync.Mutex)
+	db    *talon.DB
+	log   logger.Log
+	lazy  = talon.NewDB(talon.Dialer(func() (bolt.Conn, error) {
+		d, err := DB()
+		if err != nil {
+			return nil, err
+		}
+
+		return d.Conn()
+	}))
 )
 
 // DB fetches a connection to the database using the connection information
-// provided in the Dragonfile for the current environment.
-func DB() *talon.DB {
-	if connectOptions == nil {
-		env := viper.GetString("env")
-		log = logger.NewWithSource("database").WithField("env", env)
-		log.Debug("Connecting to database for environment.")
-
-		connectOptions = &talon.ConnectOptions{
-			User: viper.GetString(fmt.Sprintf("database.%s.username", env)),
-			Host: viper.GetString(fmt.Sprintf("database.%s.host", env)),
-			Port: uint16(viper.GetInt64(fmt.Sprintf("database.%s.port", env))),
-			Pool: uint16(viper.GetInt64(fmt.Sprintf("database.%s.connection_max", env))),
-		}
+// provided in the Dragonfile for the current environment. If the database
+// can't be reached an error is returned and the next call will try to connect
+// again. With the "memory" adapter the database is held in memory instead,
+// it's emptied when the database is closed.
+func DB() (*talon.DB, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if db != nil {
+		return db, nil
+	}
+
+	env := viper.GetString("env")
+	log = logger.NewWithSource("database").WithField("env", env)
+	log.Debug("Connecting to database for environment.")
+
+	key := func(name string) string {
+		return fmt.Sprintf("database.%s.%s", env, name)
+	}
+
+	switch adapter := viper.GetString(key("adapter")); adapter {
+	case Neo4jAdapter, "":
+	case MemoryAdapter:
+		log.Debug("Using an in memory database.")
+		// connections are pooled the same way they are for Neo4j, so code
+		// that holds on to connections fails the same way in tests
+		db = talon.NewDB(talon.NewPool(memory.NewDriver().Conn, talon.ConnectOptions{
+			Pool:        uint16(viper.GetInt64(key("connection_max"))),
+			WaitTimeout: viper.GetDuration(key("connection_wait_timeout")),
+		}))
+
+		return db, nil
+	default:
+		err := UnknownAdapterError(adapter)
+		log.WithError(err).Error("Invalid database adapter.")
+
+		return nil, err
+	}
+
+	co := talon.ConnectOptions{
+		User:                viper.GetString(key("username")),
+		Host:                viper.GetString(key("host")),
+		Port:                uint16(viper.GetInt64(key("port"))),
+		Pool:                uint16(viper.GetInt64(key("connection_max"))),
+		Timeout:             viper.GetDuration(key("query_timeout")),
+		WaitTimeout:         viper.GetDuration(key("connection_wait_timeout")),
+		HealthCheckInterval: viper.GetDuration(key("health_check_interval")),
+		MaxRetries:          viper.GetInt(key("connect_retries")),
+		RetryBackoff:        viper.GetDuration(key("connect_retry_backoff")),
+	}
+	if viper.GetBool(key("authentication")) {
+		co.Pass = viper.GetString(key("password"))
+	}
+
+	conn, err := co.Connect()
+	if err != nil {
+		log.WithError(err).Error("Invalid database connection settings.")
+
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		log.WithError(err).Error("Failed to connect to the database.")
+
+		return nil, err
+	}
+	log.Debug("Successfully connected to the database.")
+	db = conn
 
-		if viper.GetBool(fmt.Sprintf("database.%s.authentication", env)) {
-			connectOptions.Pass = viper.GetString(fmt.Sprintf("database.%s.password", env))
+	return db, nil
+}
+
+// Lazy returns a database that connects with DB the first time a query is
+// run, so queries can be built before the database can be reached. Any error
+// connecting is returned when running the query.
+func Lazy() *talon.DB {
+	return lazy
+}
+
+// Close writes any changes held by the entity cache and then releases the
+// world and it's inventory, the store and every connection held to the
+// database, the next call to DB, Store, World or Inventory will connect again.
+func Close() error {
+	var err error
+	cacheMutex.Lock()
+	if entityCache != nil {
+		err = entityCache.Close()
+		entityCache = nil
+	}
+	cacheMutex.Unlock()
+
+	worldMutex.Lock()
+	gameWorld = nil
+	gameInventory = nil
+	worldMutex.Unlock()
+
+	storeMutex.Lock()
+	if store != nil {
+		if serr := store.Close(); serr != nil && err == nil {
+			err = serr
 		}
+		store = nil
+	}
+	storeMutex.Unlock()
 
-		var err error
-		db, err = connectOptions.Connect()
-		if err != nil {
-			log.WithError(err).Fatal("Failed to initialize connection with database.")
+	mutex.Lock()
+	defer mutex.Unlock()
+	if db != nil {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
-		log.Debug("Successfully connected to the database.")
+		db = nil
 	}
 
-	return db
+	return err
 }
@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package data
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/spf13/viper"
+)
+
+var (
+	storeMutex = new(sync.Mutex)
+	store      storage.Store
+)
+
+// Store fetches the storage backend configured for the current environment
+// with database.<env>.backend in the Dragonfile. The "neo4j" backend (the
+// default) uses the same connection as DB, the "embedded" backend keeps the
+// world in the file at database.<env>.path, "db/<env>.db" by default. The
+// store only backs the world (and inventory built on it), entities, the
+// entity cache, talon and migrations run Cypher so they always go through DB
+// and the database.<env>.adapter.
+func Store() (storage.Store, error) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+
+	if store != nil {
+		return store, nil
+	}
+
+	env := viper.GetString("env")
+	key := func(name string) string {
+		return fmt.Sprintf("database.%s.%s", env, name)
+	}
+
+	switch backend := viper.GetString(key("backend")); backend {
+	case storage.Neo4jBackend, "":
+		db, err := DB()
+		if err != nil {
+			return nil, err
+		}
+		store = storage.NewNeo4jStore(db)
+	case storage.EmbeddedBackend:
+		path := viper.GetString(key("path"))
+		if path == "" {
+			path = filepath.Join("db", env+".db")
+		}
+		es, err := storage.OpenEmbedded(path)
+		if err != nil {
+			return nil, err
+		}
+		store = es
+	default:
+		return nil, storage.UnknownBackendError(backend)
+	}
+
+	return store, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package data
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/inventory"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+var (
+	worldMutex    = new(sync.Mutex)
+	gameWorld     *world.World
+	gameInventory *inventory.Inventory
+)
+
+// World fetches the game world, kept in the configured Store. Every call
+// returns the same world until the database is closed, so handlers given to
+// it's On method hear about everything that happens in the game.
+func World() (*world.World, error) {
+	worldMutex.Lock()
+	defer worldMutex.Unlock()
+
+	return loadWorld()
+}
+
+// Inventory fetches the inventory of the game world's items, like World every
+// call returns the same inventory until the database is closed.
+func Inventory() (*inventory.Inventory, error) {
+	worldMutex.Lock()
+	defer worldMutex.Unlock()
+
+	if gameInventory != nil {
+		return gameInventory, nil
+	}
+
+	w, err := loadWorld()
+	if err != nil {
+		return nil, err
+	}
+	gameInventory = inventory.New(w)
+
+	return gameInventory, nil
+}
+
+// expects the world mutex to be held
+func loadWorld() (*world.World, error) {
+	if gameWorld != nil {
+		return gameWorld, nil
+	}
+
+	s, err := Store()
+	if err != nil {
+		return nil, err
+	}
+	gameWorld = world.New(s)
+
+	return gameWorld, nil
+}
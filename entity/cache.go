@@ -0,0 +1,516 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// Events fired on a cache's emitter, see Cache.On.
+const (
+	// EvtFlushed is fired after changed entities are written, with "count"
+	// set to the number written.
+	EvtFlushed = "entity:flushed"
+
+	// EvtEvicted is fired when an entity is dropped from the cache, with "id"
+	// and "reason" ("evicted", "full" or "destroyed").
+	EvtEvicted = "entity:evicted"
+
+	// EvtInvalidated is fired when an entity is dropped from the cache
+	// without writing it's changes, with "id".
+	EvtInvalidated = "entity:invalidated"
+)
+
+// CacheEvents lists every event fired by a cache.
+var CacheEvents = []string{EvtFlushed, EvtEvicted, EvtInvalidated}
+
+// CacheOptions control how long changes are held and how many entities are
+// kept in memory.
+type CacheOptions struct {
+	// FlushInterval is how often saved entities are written to the database,
+	// if it's 0 they're only written when Flush is called.
+	FlushInterval time.Duration
+
+	// MaxSize is the most entities the cache will hold, past it the least
+	// recently used entities are dropped. Pinned entities and those waiting
+	// to be written are never dropped to make room. 0 means no limit.
+	MaxSize int
+}
+
+// record holds the properties of a single node, every entity loaded for the
+// node through the cache shares it. The record's lock guards it's properties
+// and changes, pinned and elem belong to the cache's mutex.
+type record struct {
+	sync.Mutex
+	id         string
+	labels     []string
+	properties talon.Properties
+	changed    map[string]bool
+	pinned     bool
+	cache      *Cache
+	elem       *list.Element
+}
+
+// Cache is an identity map in front of the database, nodes loaded by models
+// using the cache are held in memory by ID so finding them again doesn't
+// query the database and every entity for the same node shares it's
+// properties. Saving an entity that's held by the cache marks it as changed
+// rather than writing it, changes are written together every FlushInterval
+// and when the cache is closed.
+//
+// Queries such as Model.Where always go to the database, so they won't see
+// changes that haven't been written yet.
+type Cache struct {
+	db      *talon.DB
+	options CacheOptions
+	events  *events.Emitter
+	log     logger.Log
+
+	mutex   *sync.Mutex
+	records map[string]*record
+	lru     *list.List
+	dirty   map[*record]bool
+	closed  bool
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// only one flush writes at a time
+	flushMutex *sync.Mutex
+}
+
+// NewCache creates a cache writing to the database, if there is a flush
+// interval the cache writes in the background until it's closed.
+func NewCache(db *talon.DB, opts CacheOptions) *Cache {
+	log := logger.NewWithSource("entity(cache)")
+	c := &Cache{
+		db:         db,
+		options:    opts,
+		events:     events.NewEmitter(log),
+		log:        log,
+		mutex:      new(sync.Mutex),
+		records:    make(map[string]*record),
+		lru:        list.New(),
+		dirty:      make(map[*record]bool),
+		flushMutex: new(sync.Mutex),
+	}
+
+	if opts.FlushInterval > 0 {
+		c.stop = make(chan struct{})
+		c.stopped = make(chan struct{})
+		go c.run()
+	}
+
+	return c
+}
+
+// On registers a handler for one of the cache's events.
+func (c *Cache) On(evt string, h events.Handler) {
+	c.events.On(evt, h)
+}
+
+// Len is the number of entities held by the cache.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.records)
+}
+
+// Has determines if the entity with the ID is held by the cache.
+func (c *Cache) Has(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.records[id]
+
+	return ok
+}
+
+// Pin keeps the entity with the ID in the cache until it's unpinned, no
+// matter how full the cache gets. Returns false if the entity isn't cached.
+func (c *Cache) Pin(id string) bool {
+	return c.setPinned(id, true)
+}
+
+// Unpin allows the entity with the ID to be dropped when the cache is full.
+func (c *Cache) Unpin(id string) bool {
+	return c.setPinned(id, false)
+}
+
+func (c *Cache) setPinned(id string, pinned bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	rec, ok := c.records[id]
+	if !ok {
+		return false
+	}
+	rec.pinned = pinned
+	if !pinned {
+		c.trim()
+	}
+
+	return true
+}
+
+// Evict drops the entity with the ID from the cache, writing it first if it
+// has been saved since the last flush. The next time it's found it will be
+// loaded from the database.
+func (c *Cache) Evict(id string) error {
+	c.mutex.Lock()
+	rec, ok := c.records[id]
+	if !ok {
+		c.mutex.Unlock()
+
+		return nil
+	}
+	dirty := c.dirty[rec]
+	delete(c.dirty, rec)
+	c.mutex.Unlock()
+
+	if dirty {
+		if err := c.write([]*record{rec}); err != nil {
+			c.markDirty(rec)
+
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	removed := c.remove(rec)
+	c.mutex.Unlock()
+	if removed {
+		c.events.Emit(EvtEvicted, events.Data{"id": id, "reason": "evicted"})
+	}
+
+	return nil
+}
+
+// Invalidate drops the entity with the ID from the cache without writing
+// any of it's changes, for when the node has been changed in the database
+// by something other than the cache.
+func (c *Cache) Invalidate(id string) {
+	c.mutex.Lock()
+	rec, ok := c.records[id]
+	if ok {
+		delete(c.dirty, rec)
+		c.remove(rec)
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		c.events.Emit(EvtInvalidated, events.Data{"id": id})
+	}
+}
+
+// Flush writes every entity saved since the last flush in a single
+// transaction. If it fails the entities are kept to try again.
+func (c *Cache) Flush() error {
+	c.mutex.Lock()
+	recs := make([]*record, 0, len(c.dirty))
+	for rec := range c.dirty {
+		recs = append(recs, rec)
+	}
+	c.dirty = make(map[*record]bool)
+	c.mutex.Unlock()
+
+	if len(recs) == 0 {
+		return nil
+	}
+
+	if err := c.write(recs); err != nil {
+		for _, rec := range recs {
+			c.markDirty(rec)
+		}
+
+		return err
+	}
+	c.events.Emit(EvtFlushed, events.Data{"count": len(recs)})
+
+	c.mutex.Lock()
+	c.trim()
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Close stops writing in the background and flushes any remaining changes.
+func (c *Cache) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+
+		return nil
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		<-c.stopped
+	}
+
+	return c.Flush()
+}
+
+// flush on the interval until the cache is closed
+func (c *Cache) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				c.log.WithError(err).Error("Failed to write changed entities.")
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// write the changed properties of the records, records with the same labels
+// and changes are written with a single batch.
+func (c *Cache) write(recs []*record) error {
+	c.flushMutex.Lock()
+	defer c.flushMutex.Unlock()
+
+	type batch struct {
+		cypher string
+		rows   []talon.Properties
+	}
+	var (
+		batches = make(map[string]*batch)
+		order   []string
+		taken   = make(map[*record]map[string]bool)
+	)
+	for _, rec := range recs {
+		rec.Lock()
+		if len(rec.changed) == 0 {
+			rec.Unlock()
+
+			continue
+		}
+		names := make([]string, 0, len(rec.changed))
+		row := talon.Properties{IDProperty: rec.id}
+		for name := range rec.changed {
+			names = append(names, name)
+			row[name] = rec.properties[name]
+		}
+		taken[rec] = rec.changed
+		rec.changed = make(map[string]bool)
+		labels := rec.labels
+		rec.Unlock()
+
+		sort.Strings(names)
+		key := strings.Join(labels, ":") + "|" + strings.Join(names, ",")
+		b, ok := batches[key]
+		if !ok {
+			b = &batch{cypher: updateCypher(labels, names)}
+			batches[key] = b
+			order = append(order, key)
+		}
+		b.rows = append(b.rows, row)
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	err := c.writeBatches(func(tx *talon.Tx) error {
+		for _, key := range order {
+			b := batches[key]
+			if _, err := tx.Batch(b.cypher, b.rows); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		// put the changes back, keeping any made while writing
+		for rec, names := range taken {
+			rec.Lock()
+			for name := range names {
+				rec.changed[name] = true
+			}
+			rec.Unlock()
+		}
+	}
+
+	return err
+}
+
+func (c *Cache) writeBatches(fn func(*talon.Tx) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// the query updating the named properties of each row's node
+func updateCypher(labels, names []string) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("MATCH (n")
+	for _, label := range labels {
+		buf.WriteRune(':')
+		buf.WriteString(label)
+	}
+	buf.WriteString(") WHERE n.")
+	buf.WriteString(IDProperty)
+	buf.WriteString(" = row.")
+	buf.WriteString(IDProperty)
+	buf.WriteString(" SET ")
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("n.")
+		buf.WriteString(name)
+		buf.WriteString(" = row.")
+		buf.WriteString(name)
+	}
+
+	return buf.String()
+}
+
+// fetch the record for the ID if it's held and has all of the labels
+func (c *Cache) get(id string, labels []string) *record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	rec, ok := c.records[id]
+	if !ok {
+		return nil
+	}
+	for _, label := range labels {
+		if !hasString(rec.labels, label) {
+			return nil
+		}
+	}
+	c.lru.MoveToFront(rec.elem)
+
+	return rec
+}
+
+// add the node to the cache, if it's already held the cached record is
+// returned and the properties given are ignored since the cache may hold
+// changes that have not been written.
+func (c *Cache) add(id string, labels []string, props talon.Properties) *record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if rec, ok := c.records[id]; ok {
+		c.lru.MoveToFront(rec.elem)
+
+		return rec
+	}
+
+	rec := &record{
+		id:         id,
+		labels:     labels,
+		properties: props,
+		changed:    make(map[string]bool),
+		cache:      c,
+	}
+	c.insert(rec)
+	c.trim()
+
+	return rec
+}
+
+// mark the record as needing to be written on the next flush, if the record
+// had been dropped from the cache it's added back.
+func (c *Cache) markDirty(rec *record) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.records[rec.id]; !ok {
+		c.insert(rec)
+	}
+	c.dirty[rec] = true
+}
+
+// drop a destroyed entity from the cache
+func (c *Cache) destroyed(rec *record) {
+	c.mutex.Lock()
+	delete(c.dirty, rec)
+	removed := c.remove(rec)
+	c.mutex.Unlock()
+
+	if removed {
+		c.events.Emit(EvtEvicted, events.Data{"id": rec.id, "reason": "destroyed"})
+	}
+}
+
+// must be called with the mutex held
+func (c *Cache) insert(rec *record) {
+	c.records[rec.id] = rec
+	rec.elem = c.lru.PushFront(rec)
+}
+
+// must be called with the mutex held, returns false if the record had
+// already been removed.
+func (c *Cache) remove(rec *record) bool {
+	if c.records[rec.id] != rec {
+		return false
+	}
+	delete(c.records, rec.id)
+	c.lru.Remove(rec.elem)
+
+	return true
+}
+
+// drop the least recently used records until the cache is no longer over
+// it's limit, must be called with the mutex held.
+func (c *Cache) trim() {
+	if c.options.MaxSize <= 0 {
+		return
+	}
+
+	elem := c.lru.Back()
+	for len(c.records) > c.options.MaxSize && elem != nil {
+		rec := elem.Value.(*record)
+		elem = elem.Prev()
+
+		if rec.pinned || c.dirty[rec] {
+			continue
+		}
+		rec.Lock()
+		changed := len(rec.changed) > 0
+		rec.Unlock()
+		if changed {
+			continue
+		}
+
+		c.remove(rec)
+		c.events.Emit(EvtEvicted, events.Data{"id": rec.id, "reason": "full"})
+	}
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/bbuck/dragon-mud/entity"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		db       *talon.DB
+		cache    *Cache
+		registry *Registry
+		player   *Model
+		bob      *Entity
+	)
+
+	// define the player model on a registry using the cache
+	definePlayer := func(r *Registry) *Model {
+		m := r.Define("Player")
+		m.AddProperty(&Property{Name: "name", Type: String})
+		m.AddProperty(&Property{Name: "level", Type: Integer})
+
+		return m
+	}
+
+	// read bob's level straight from the database
+	storedLevel := func() interface{} {
+		q, err := db.CypherP("MATCH (p:Player) WHERE p.uuid = {id} RETURN p.level", talon.Properties{"id": bob.ID})
+		Ω(err).Should(BeNil())
+		rows, err := q.Query()
+		Ω(err).Should(BeNil())
+		defer rows.Close()
+		row, err := rows.Next()
+		Ω(err).Should(BeNil())
+		level, _ := row.GetIndex(0)
+
+		return level
+	}
+
+	newCache := func(opts CacheOptions) {
+		cache = NewCache(db, opts)
+		registry = NewRegistry(db)
+		registry.Cache = cache
+		player = definePlayer(registry)
+
+		var err error
+		bob, err = player.New(talon.Properties{"name": "bob", "level": 1})
+		Ω(err).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+	}
+
+	BeforeEach(func() {
+		db = talon.NewDB(memory.NewDriver())
+		newCache(CacheOptions{})
+	})
+
+	AfterEach(func() {
+		cache.Close()
+	})
+
+	It("holds entities once they're saved", func() {
+		Ω(bob.IsCached()).Should(BeTrue())
+		Ω(cache.Has(bob.ID)).Should(BeTrue())
+	})
+
+	It("finds entities without going to the database", func() {
+		_, err := db.Cypher("MATCH (p:Player) DETACH DELETE p").Exec()
+		Ω(err).Should(BeNil())
+
+		found, err := player.Find(bob.ID)
+		Ω(err).Should(BeNil())
+		Ω(found.Get("name")).Should(Equal("bob"))
+	})
+
+	It("shares properties between every entity for the same node", func() {
+		r := NewRegistry(db)
+		r.Cache = cache
+		other := definePlayer(r)
+
+		found, err := other.Find(bob.ID)
+		Ω(err).Should(BeNil())
+		Ω(found.Set("level", 2)).Should(BeNil())
+		Ω(bob.Get("level")).Should(Equal(int64(2)))
+
+		all, err := player.All()
+		Ω(err).Should(BeNil())
+		Ω(all).Should(HaveLen(1))
+		Ω(all[0].Get("level")).Should(Equal(int64(2)))
+	})
+
+	It("writes saved changes when flushed", func() {
+		var (
+			mutex   sync.Mutex
+			flushed interface{}
+		)
+		cache.On(EvtFlushed, events.HandlerFunc(func(d events.Data) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			flushed = d["count"]
+
+			return nil
+		}))
+
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+		Ω(storedLevel()).Should(Equal(int64(1)))
+
+		Ω(cache.Flush()).Should(BeNil())
+		Ω(storedLevel()).Should(Equal(int64(5)))
+		Eventually(func() interface{} {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			return flushed
+		}).Should(Equal(1))
+	})
+
+	It("doesn't write changes that haven't been saved", func() {
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(cache.Flush()).Should(BeNil())
+		Ω(storedLevel()).Should(Equal(int64(1)))
+	})
+
+	It("writes changes when closed", func() {
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+		Ω(cache.Close()).Should(BeNil())
+		Ω(storedLevel()).Should(Equal(int64(5)))
+	})
+
+	It("writes changes in the background", func() {
+		cache.Close()
+		newCache(CacheOptions{FlushInterval: 10 * time.Millisecond})
+
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+		Eventually(storedLevel).Should(Equal(int64(5)))
+	})
+
+	It("writes entities before evicting them", func() {
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+		Ω(cache.Evict(bob.ID)).Should(BeNil())
+
+		Ω(cache.Has(bob.ID)).Should(BeFalse())
+		Ω(storedLevel()).Should(Equal(int64(5)))
+	})
+
+	It("drops changes when entities are invalidated", func() {
+		Ω(bob.Set("level", 5)).Should(BeNil())
+		Ω(bob.Save()).Should(BeNil())
+		cache.Invalidate(bob.ID)
+		Ω(cache.Flush()).Should(BeNil())
+
+		found, err := player.Find(bob.ID)
+		Ω(err).Should(BeNil())
+		Ω(found.Get("level")).Should(Equal(int64(1)))
+	})
+
+	It("drops the least recently used entities when full", func() {
+		cache.Close()
+		newCache(CacheOptions{MaxSize: 2})
+		Ω(cache.Pin(bob.ID)).Should(BeTrue())
+
+		for _, name := range []string{"alice", "carol"} {
+			e, _ := player.New(talon.Properties{"name": name})
+			Ω(e.Save()).Should(BeNil())
+		}
+
+		Ω(cache.Len()).Should(Equal(2))
+		Ω(cache.Has(bob.ID)).Should(BeTrue())
+	})
+
+	It("drops entities that are destroyed", func() {
+		Ω(bob.Destroy()).Should(BeNil())
+		Ω(cache.Has(bob.ID)).Should(BeFalse())
+		Ω(bob.IsCached()).Should(BeFalse())
+	})
+})
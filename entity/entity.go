@@ -0,0 +1,314 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity
+
+import (
+	"fmt"
+
+	"github.com/bbuck/dragon-mud/talon"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Entity is a single instance of a model, like a specific player or item.
+// Entities are identified by ID once they've been saved.
+type Entity struct {
+	Model *Model
+	ID    string
+
+	properties talon.Properties
+	persisted  bool
+
+	// set when the entity is held by a cache, the record's properties are the
+	// entity's properties
+	record *record
+}
+
+// Get returns the value of the property, or nil if it's not set.
+func (e *Entity) Get(name string) interface{} {
+	if name == IDProperty {
+		return e.ID
+	}
+
+	e.lock()
+	defer e.unlock()
+
+	return e.properties[name]
+}
+
+// Set assigns a value to the property, converting it to the property's type.
+// Only properties defined on the model can be set.
+func (e *Entity) Set(name string, val interface{}) error {
+	p, ok := e.Model.properties[name]
+	if !ok {
+		return fmt.Errorf("%s has no property named %q", e.Model.Name, name)
+	}
+
+	coerced, err := p.Type.Coerce(val)
+	if err != nil {
+		return fmt.Errorf("%s.%s: %s", e.Model.Name, name, err)
+	}
+	e.lock()
+	e.properties[name] = coerced
+	if e.record != nil {
+		e.record.changed[name] = true
+	}
+	e.unlock()
+
+	return nil
+}
+
+// Properties returns a copy of the entity's properties, including it's ID if
+// it has one.
+func (e *Entity) Properties() talon.Properties {
+	e.lock()
+	props := e.properties.Merge(nil)
+	e.unlock()
+	if e.ID != "" {
+		props[IDProperty] = e.ID
+	}
+
+	return props
+}
+
+// IsNew is true for entities that have not been saved.
+func (e *Entity) IsNew() bool {
+	return !e.persisted
+}
+
+// IsCached is true for entities held by their model's cache.
+func (e *Entity) IsCached() bool {
+	return e.record != nil
+}
+
+// Validate checks every property of the entity, returning a ValidationError
+// if any of them have problems.
+func (e *Entity) Validate() error {
+	props := e.Properties()
+	problems := make(map[string][]string)
+	for _, p := range e.Model.Properties() {
+		if errs := p.validate(props[p.Name]); len(errs) > 0 {
+			problems[p.Name] = errs
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// Save validates the entity and then creates or updates it in the database,
+// firing lifecycle events along the way. Entities held by a cache aren't
+// written right away, their changes are written with the cache's next flush.
+func (e *Entity) Save() error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	m := e.Model
+	creating := e.IsNew()
+	if err := m.trigger("before:save", e); err != nil {
+		return err
+	}
+	if creating {
+		if err := m.trigger("before:create", e); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch {
+	case creating:
+		err = e.create()
+	case e.record != nil:
+		e.record.cache.markDirty(e.record)
+	default:
+		err = e.update()
+	}
+	if err != nil {
+		return err
+	}
+
+	if creating {
+		if err := m.trigger("after:create", e); err != nil {
+			return err
+		}
+	}
+
+	return m.trigger("after:save", e)
+}
+
+func (e *Entity) create() error {
+	id := uuid.NewV4().String()
+	props := e.properties.Merge(talon.Properties{IDProperty: id})
+	_, err := e.Model.db().Create(e.Model.node("n").Props(props)).Exec()
+	if err != nil {
+		return err
+	}
+
+	e.ID = id
+	e.persisted = true
+	if c := e.Model.cache(); c != nil {
+		e.record = c.add(id, e.Model.Labels, e.properties)
+		e.properties = e.record.properties
+	}
+
+	return nil
+}
+
+func (e *Entity) update() error {
+	if len(e.properties) == 0 {
+		return nil
+	}
+
+	_, err := e.Model.db().
+		Match(e.node("n")).
+		Set("n", e.properties).
+		Exec()
+
+	return err
+}
+
+// Destroy deletes the entity, and all of it's relationships, from the
+// database.
+func (e *Entity) Destroy() error {
+	if e.IsNew() {
+		return nil
+	}
+
+	m := e.Model
+	if err := m.trigger("before:destroy", e); err != nil {
+		return err
+	}
+
+	_, err := m.db().Match(e.node("n")).DetachDelete("n").Exec()
+	if err != nil {
+		return err
+	}
+	e.persisted = false
+	if e.record != nil {
+		e.record.cache.destroyed(e.record)
+		e.properties = e.Properties()
+		delete(e.properties, IDProperty)
+		e.record = nil
+	}
+
+	return m.trigger("after:destroy", e)
+}
+
+// Related fetches the entities related to this one through the named
+// relationship.
+func (e *Entity) Related(name string) ([]*Entity, error) {
+	r, other, err := e.relationship(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := e.Model.db().Match(e.path(r, e.node("a"), other.node("b"))).Return("b")
+	if !r.Many {
+		b.Limit(1)
+	}
+
+	return other.load(b, "b")
+}
+
+// Relate connects the other entity to this one through the named
+// relationship, for has one relationships any existing connection is
+// replaced.
+func (e *Entity) Relate(name string, to *Entity) error {
+	r, _, err := e.relationship(name, to)
+	if err != nil {
+		return err
+	}
+
+	b := e.Model.db().Match(e.node("a"), to.node("b"))
+	if !r.Many {
+		// has one, drop the existing edge first
+		var existing talon.Pattern
+		if r.Incoming {
+			existing = talon.N("a").In(talon.R("old", r.Type), talon.N(""))
+		} else {
+			existing = talon.N("a").Out(talon.R("old", r.Type), talon.N(""))
+		}
+		b.OptionalMatch(existing).Delete("old").With("DISTINCT a", "b")
+	}
+	_, err = b.Merge(e.path(r, talon.N("a"), talon.N("b"))).Exec()
+
+	return err
+}
+
+// Unrelate removes the connection between the other entity and this one for
+// the named relationship.
+func (e *Entity) Unrelate(name string, from *Entity) error {
+	r, _, err := e.relationship(name, from)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.Model.db().
+		Match(e.pathWithEdge(r, "r", e.node("a"), from.node("b"))).
+		Delete("r").
+		Exec()
+
+	return err
+}
+
+// lock the entity's properties, which are shared when it's cached
+func (e *Entity) lock() {
+	if e.record != nil {
+		e.record.Lock()
+	}
+}
+
+func (e *Entity) unlock() {
+	if e.record != nil {
+		e.record.Unlock()
+	}
+}
+
+// build a node pattern matching this entity
+func (e *Entity) node(name string) *talon.NodePattern {
+	return e.Model.node(name).Where(talon.Eq(IDProperty, e.ID))
+}
+
+// build the path from this entity through the relationship
+func (e *Entity) path(r *Relationship, from, to *talon.NodePattern) *talon.PathPattern {
+	return e.pathWithEdge(r, "", from, to)
+}
+
+func (e *Entity) pathWithEdge(r *Relationship, edge string, from, to *talon.NodePattern) *talon.PathPattern {
+	if r.Incoming {
+		return from.In(talon.R(edge, r.Type), to)
+	}
+
+	return from.Out(talon.R(edge, r.Type), to)
+}
+
+// look up the relationship and related model, making sure this entity (and
+// any others given) have been saved and belong to the related model.
+func (e *Entity) relationship(name string, others ...*Entity) (*Relationship, *Model, error) {
+	r, ok := e.Model.relationships[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s has no relationship named %q", e.Model.Name, name)
+	}
+
+	other, err := e.Model.related(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.IsNew() {
+		return nil, nil, fmt.Errorf("%s must be saved before using %s", e.Model.Name, name)
+	}
+	for _, o := range others {
+		if o.Model != other {
+			return nil, nil, fmt.Errorf("%s.%s expects a %s but got a %s", e.Model.Name, name, other.Name, o.Model.Name)
+		}
+		if o.IsNew() {
+			return nil, nil, fmt.Errorf("%s must be saved before it can be related", o.Model.Name)
+		}
+	}
+
+	return r, other, nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestEntity(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Entity Suite")
+}
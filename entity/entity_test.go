@@ -0,0 +1,156 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity_test
+
+import (
+	"errors"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/talon"
+
+	. "github.com/bbuck/dragon-mud/entity"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Entity", func() {
+	var (
+		registry *Registry
+		player   *Model
+	)
+
+	BeforeEach(func() {
+		db, err := talon.ConnectOptions{}.Connect()
+		Ω(err).Should(BeNil())
+
+		registry = NewRegistry(db)
+		player = registry.Define("Player")
+		player.AddProperty(&Property{
+			Name:     "name",
+			Type:     String,
+			Required: true,
+			Validators: []Validator{
+				func(val interface{}) error {
+					if len(val.(string)) < 3 {
+						return errors.New("is too short")
+					}
+
+					return nil
+				},
+			},
+		})
+		player.AddProperty(&Property{
+			Name:    "level",
+			Type:    Integer,
+			Default: 1,
+		})
+		player.HasOne("room", "IN", "Room")
+	})
+
+	Context("when building a new entity", func() {
+		var (
+			e   *Entity
+			err error
+		)
+
+		BeforeEach(func() {
+			e, err = player.New(talon.Properties{"name": "bob"})
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("sets the properties given", func() {
+			Ω(e.Get("name")).Should(Equal("bob"))
+		})
+
+		It("sets defaults", func() {
+			Ω(e.Get("level")).Should(Equal(int64(1)))
+		})
+
+		It("is new", func() {
+			Ω(e.IsNew()).Should(BeTrue())
+		})
+	})
+
+	It("uses the model name as it's label", func() {
+		Ω(player.Labels).Should(Equal([]string{"Player"}))
+	})
+
+	It("converts values to the property type", func() {
+		e, _ := player.New(nil)
+
+		Ω(e.Set("level", float64(10))).Should(BeNil())
+		Ω(e.Get("level")).Should(Equal(int64(10)))
+	})
+
+	It("rejects values of the wrong type", func() {
+		e, _ := player.New(nil)
+
+		Ω(e.Set("level", "ten")).ShouldNot(BeNil())
+		Ω(e.Set("level", 1.5)).ShouldNot(BeNil())
+	})
+
+	It("rejects properties that aren't defined", func() {
+		_, err := player.New(talon.Properties{"title": "lord"})
+
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	Describe("validation", func() {
+		It("requires required properties", func() {
+			e, _ := player.New(nil)
+			err := e.Validate()
+
+			Ω(err).Should(BeAssignableToTypeOf(&ValidationError{}))
+			Ω(err.(*ValidationError).Problems["name"]).Should(Equal([]string{"is required"}))
+		})
+
+		It("runs validators", func() {
+			e, _ := player.New(talon.Properties{"name": "b"})
+
+			Ω(e.Validate()).Should(MatchError("validation failed: name is too short"))
+		})
+
+		It("doesn't save invalid entities", func() {
+			e, _ := player.New(nil)
+
+			Ω(e.Save()).Should(BeAssignableToTypeOf(&ValidationError{}))
+		})
+	})
+
+	Describe("lifecycle events", func() {
+		It("stops saving when a before handler fails", func() {
+			called := false
+			player.On("before:save", events.HandlerFunc(func(d events.Data) error {
+				called = d["entity"] != nil
+
+				return events.ErrHalt
+			}))
+			e, _ := player.New(talon.Properties{"name": "bob"})
+
+			Ω(e.Save()).Should(Equal(events.ErrHalt))
+			Ω(called).Should(BeTrue())
+			Ω(e.IsNew()).Should(BeTrue())
+		})
+	})
+
+	Describe("relationships", func() {
+		It("requires the related model to be defined", func() {
+			e, _ := player.New(talon.Properties{"name": "bob"})
+			_, err := e.Related("room")
+
+			Ω(err).Should(MatchError("Player.room relates to Room which is not defined"))
+		})
+
+		It("requires the entity to be saved", func() {
+			registry.Define("Room")
+			e, _ := player.New(talon.Properties{"name": "bob"})
+			_, err := e.Related("room")
+
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+})
@@ -0,0 +1,353 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// IDProperty is the property every entity is stored with to identify it, it
+// holds a UUID assigned when the entity is first saved.
+const IDProperty = "uuid"
+
+// ErrNotFound is returned when looking up an entity that does not exist.
+var ErrNotFound = errors.New("entity not found")
+
+// ValidationError is returned when an entity fails validation, Problems maps
+// property names to everything wrong with them.
+type ValidationError struct {
+	Problems map[string][]string
+}
+
+// Error lists the problems in property order.
+func (ve *ValidationError) Error() string {
+	names := make([]string, 0, len(ve.Problems))
+	for name := range ve.Problems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, problem := range ve.Problems[name] {
+			msgs = append(msgs, name+" "+problem)
+		}
+	}
+
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// Relationship connects entities of one model to entities of another through
+// edges of the given Type. By default edges point from this model to the
+// other, Incoming reverses that.
+type Relationship struct {
+	Name     string
+	Type     string
+	Model    string
+	Many     bool
+	Incoming bool
+}
+
+// Registry holds a set of models that can reference each other, along with
+// the database they're persisted in. If the registry has a Cache the
+// entities it loads are held in it, a cache can be shared by any number of
+// registries.
+type Registry struct {
+	DB    *talon.DB
+	Cache *Cache
+
+	mutex  *sync.RWMutex
+	models map[string]*Model
+}
+
+// NewRegistry creates an empty set of models persisted to the database.
+func NewRegistry(db *talon.DB) *Registry {
+	return &Registry{
+		DB:     db,
+		mutex:  new(sync.RWMutex),
+		models: make(map[string]*Model),
+	}
+}
+
+// Define creates a new model with the given labels, if no labels are given
+// the model's name is used as it's label. Defining a model with the same
+// name as an existing model replaces it.
+func (r *Registry) Define(name string, labels ...string) *Model {
+	if len(labels) == 0 {
+		labels = []string{name}
+	}
+
+	m := &Model{
+		Name:          name,
+		Labels:        labels,
+		registry:      r,
+		properties:    make(map[string]*Property),
+		relationships: make(map[string]*Relationship),
+		events:        events.NewEmitter(logger.NewWithSource("entity(" + name + ")")),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if old, ok := r.models[name]; ok {
+		old.events.Stop()
+	}
+	r.models[name] = m
+
+	return m
+}
+
+// Model fetches a model by name.
+func (r *Registry) Model(name string) (*Model, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	m, ok := r.models[name]
+
+	return m, ok
+}
+
+// Model defines the labels, properties and relationships of a kind of entity.
+// Lifecycle events are fired on the model's emitter as entities are saved and
+// destroyed:
+//   before:save, after:save - every save
+//   before:create, after:create - saves of new entities
+//   before:destroy, after:destroy - when destroyed
+// Handlers receive the entity as "entity" in the event data, returning an
+// error from a before handler stops the operation.
+type Model struct {
+	Name   string
+	Labels []string
+
+	registry      *Registry
+	properties    map[string]*Property
+	order         []string
+	relationships map[string]*Relationship
+	events        *events.Emitter
+}
+
+// AddProperty adds (or replaces) a property on the model.
+func (m *Model) AddProperty(p *Property) *Model {
+	if _, ok := m.properties[p.Name]; !ok {
+		m.order = append(m.order, p.Name)
+	}
+	m.properties[p.Name] = p
+
+	return m
+}
+
+// Property fetches the property definition by name.
+func (m *Model) Property(name string) (*Property, bool) {
+	p, ok := m.properties[name]
+
+	return p, ok
+}
+
+// Properties returns the model's properties in the order they were added.
+func (m *Model) Properties() []*Property {
+	props := make([]*Property, len(m.order))
+	for i, name := range m.order {
+		props[i] = m.properties[name]
+	}
+
+	return props
+}
+
+// AddRelationship adds (or replaces) a relationship on the model.
+func (m *Model) AddRelationship(r *Relationship) *Model {
+	m.relationships[r.Name] = r
+
+	return m
+}
+
+// HasOne relates a single entity of the other model through an edge of the
+// given type.
+func (m *Model) HasOne(name, typ, model string) *Model {
+	return m.AddRelationship(&Relationship{
+		Name:  name,
+		Type:  typ,
+		Model: model,
+	})
+}
+
+// HasMany relates any number of entities of the other model through edges of
+// the given type.
+func (m *Model) HasMany(name, typ, model string) *Model {
+	return m.AddRelationship(&Relationship{
+		Name:  name,
+		Type:  typ,
+		Model: model,
+		Many:  true,
+	})
+}
+
+// Relationship fetches the relationship definition by name.
+func (m *Model) Relationship(name string) (*Relationship, bool) {
+	r, ok := m.relationships[name]
+
+	return r, ok
+}
+
+// On registers a handler for one of the model's lifecycle events.
+func (m *Model) On(evt string, h events.Handler) {
+	m.events.On(evt, h)
+}
+
+// New builds an entity from the model with the given properties, properties
+// that aren't given are set to their defaults. The entity is not saved.
+func (m *Model) New(props talon.Properties) (*Entity, error) {
+	e := &Entity{
+		Model:      m,
+		properties: make(talon.Properties),
+	}
+	for _, p := range m.Properties() {
+		if p.Default != nil {
+			if err := e.Set(p.Name, p.Default); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for key, val := range props {
+		if err := e.Set(key, val); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Find fetches the entity with the given ID, returning ErrNotFound if it
+// doesn't exist. Entities held by the cache are returned without querying
+// the database.
+func (m *Model) Find(id string) (*Entity, error) {
+	if c := m.cache(); c != nil {
+		if rec := c.get(id, m.Labels); rec != nil {
+			return m.cachedEntity(rec), nil
+		}
+	}
+
+	found, err := m.Where(talon.Eq(IDProperty, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return found[0], nil
+}
+
+// Where fetches all entities matching the conditions, fields in the
+// conditions refer to the entity's properties.
+func (m *Model) Where(conds ...talon.Condition) ([]*Entity, error) {
+	return m.load(m.db().Match(m.node("n").Where(conds...)).Return("n"), "n")
+}
+
+// All fetches every entity of the model.
+func (m *Model) All() ([]*Entity, error) {
+	return m.Where()
+}
+
+// build a node pattern for entities of the model
+func (m *Model) node(name string) *talon.NodePattern {
+	return talon.N(name, m.Labels...)
+}
+
+func (m *Model) db() *talon.DB {
+	return m.registry.DB
+}
+
+func (m *Model) cache() *Cache {
+	return m.registry.Cache
+}
+
+// run the query, building entities from the nodes in the named column.
+func (m *Model) load(b *talon.Builder, column string) ([]*Entity, error) {
+	rows, err := b.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all, err := rows.All()
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]*Entity, 0, len(all))
+	for _, row := range all {
+		val, _ := row.GetColumn(column)
+		node, ok := val.(*talon.Node)
+		if !ok {
+			return nil, fmt.Errorf("expected a node for %s but got %T", m.Name, val)
+		}
+		entities = append(entities, m.fromNode(node))
+	}
+
+	return entities, nil
+}
+
+// build an entity from a stored node, values that no longer match the
+// property types are kept as they are. If the node is already cached the
+// entity shares the cached properties instead.
+func (m *Model) fromNode(node *talon.Node) *Entity {
+	e := &Entity{
+		Model:      m,
+		properties: make(talon.Properties),
+		persisted:  true,
+	}
+	for key, val := range node.Properties {
+		if key == IDProperty {
+			e.ID, _ = val.(string)
+
+			continue
+		}
+		if p, ok := m.properties[key]; ok {
+			if coerced, err := p.Type.Coerce(val); err == nil {
+				val = coerced
+			}
+		}
+		e.properties[key] = val
+	}
+
+	if c := m.cache(); c != nil && e.ID != "" {
+		return m.cachedEntity(c.add(e.ID, node.Labels, e.properties))
+	}
+
+	return e
+}
+
+// build an entity sharing the cached record
+func (m *Model) cachedEntity(rec *record) *Entity {
+	return &Entity{
+		Model:      m,
+		ID:         rec.id,
+		properties: rec.properties,
+		persisted:  true,
+		record:     rec,
+	}
+}
+
+// fire the lifecycle event for the entity
+func (m *Model) trigger(evt string, e *Entity) error {
+	return m.events.Trigger(evt, events.Data{
+		"entity": e,
+		"model":  m.Name,
+	})
+}
+
+// fetch the related model for the relationship
+func (m *Model) related(r *Relationship) (*Model, error) {
+	other, ok := m.registry.Model(r.Model)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s relates to %s which is not defined", m.Name, r.Name, r.Model)
+	}
+
+	return other, nil
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// PropertyType is the kind of value a property holds, values assigned to a
+// property are converted to this type if they can be.
+type PropertyType string
+
+// The types a property can have.
+const (
+	Any     PropertyType = "any"
+	String  PropertyType = "string"
+	Number  PropertyType = "number"
+	Integer PropertyType = "integer"
+	Boolean PropertyType = "boolean"
+	List    PropertyType = "list"
+)
+
+// IsValid determines if the type is one of the known property types.
+func (pt PropertyType) IsValid() bool {
+	switch pt {
+	case Any, String, Number, Integer, Boolean, List:
+		return true
+	}
+
+	return false
+}
+
+// Coerce converts the value to the property type, returning an error if the
+// value can't be converted. Nil is always allowed, it means the property is
+// not set.
+func (pt PropertyType) Coerce(val interface{}) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	rv := reflect.ValueOf(val)
+	switch pt {
+	case String:
+		if rv.Kind() == reflect.String {
+			return rv.String(), nil
+		}
+	case Number:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return rv.Float(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint()), nil
+		}
+	case Integer:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(rv.Uint()), nil
+		case reflect.Float32, reflect.Float64:
+			// Lua only has one number type, so whole floats are accepted
+			if f := rv.Float(); f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		}
+	case Boolean:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+	case List:
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			list := make([]interface{}, rv.Len())
+			for i := range list {
+				list[i] = rv.Index(i).Interface()
+			}
+
+			return list, nil
+		}
+	case Any, "":
+		return val, nil
+	default:
+		return nil, fmt.Errorf("unknown property type %q", string(pt))
+	}
+
+	return nil, fmt.Errorf("expected a value of type %s but got %T", pt, val)
+}
+
+// Validator checks a property's value, returning an error describing what's
+// wrong with it. Validators are only called for properties that are set.
+type Validator func(value interface{}) error
+
+// Property describes a single property of a model.
+type Property struct {
+	Name       string
+	Type       PropertyType
+	Default    interface{}
+	Required   bool
+	Validators []Validator
+}
+
+// validate the value given for the property, returning a list of problems.
+func (p *Property) validate(val interface{}) []string {
+	var problems []string
+	if val == nil || val == "" {
+		if p.Required {
+			problems = append(problems, "is required")
+		}
+
+		return problems
+	}
+
+	for _, v := range p.Validators {
+		if err := v(val); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package entity
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Min validates that a number is at least the minimum.
+func Min(min float64) Validator {
+	return func(val interface{}) error {
+		if n, ok := toFloat(val); ok && n < min {
+			return fmt.Errorf("must be at least %v", min)
+		}
+
+		return nil
+	}
+}
+
+// Max validates that a number is no more than the maximum.
+func Max(max float64) Validator {
+	return func(val interface{}) error {
+		if n, ok := toFloat(val); ok && n > max {
+			return fmt.Errorf("must be at most %v", max)
+		}
+
+		return nil
+	}
+}
+
+// MinLength validates that a string (or list) has at least the given length.
+func MinLength(min int) Validator {
+	return func(val interface{}) error {
+		if l, ok := length(val); ok && l < min {
+			return fmt.Errorf("must have a length of at least %d", min)
+		}
+
+		return nil
+	}
+}
+
+// MaxLength validates that a string (or list) has at most the given length.
+func MaxLength(max int) Validator {
+	return func(val interface{}) error {
+		if l, ok := length(val); ok && l > max {
+			return fmt.Errorf("must have a length of at most %d", max)
+		}
+
+		return nil
+	}
+}
+
+// OneOf validates that the value is one of the values given.
+func OneOf(values ...interface{}) Validator {
+	return func(val interface{}) error {
+		for _, v := range values {
+			if reflect.DeepEqual(v, val) {
+				return nil
+			}
+			// numbers are compared by value, not type
+			if a, ok := toFloat(v); ok {
+				if b, ok := toFloat(val); ok && a == b {
+					return nil
+				}
+			}
+		}
+
+		return fmt.Errorf("must be one of %v", values)
+	}
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	f, err := Number.Coerce(val)
+	if err != nil || f == nil {
+		return 0, false
+	}
+
+	return f.(float64), true
+}
+
+func length(val interface{}) (int, bool) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len(), true
+	}
+
+	return 0, false
+}
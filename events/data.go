@@ -8,6 +8,11 @@ package events
 // (who received the damage), and then data about the damage itself.
 type Data map[string]interface{}
 
+// CallerKey holds whatever caused the event in data given to handlers called
+// through Trigger, those handlers run before Trigger returns so they can use
+// anything the caller is holding on to. It should never be passed on.
+const CallerKey = "caller"
+
 // NewData returns an empty map[string]interface{} wrapped in the Data type,
 // as an easy way to seen event emissions with empty data (where nil would mean
 // no data).
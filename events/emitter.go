@@ -144,6 +144,16 @@ func (e *Emitter) Off(evt string) {
 	e.off("after:" + evt)
 }
 
+// Remove will unbind a single handler from the event, handlers are matched by
+// their Source.
+func (e *Emitter) Remove(evt string, h Handler) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if hs, ok := e.handlers[evt]; ok {
+		hs.remove(h)
+	}
+}
+
 // clear handlers for event
 func (e *Emitter) off(evt string) {
 	e.mutex.RLock()
@@ -258,6 +268,19 @@ func (e *Emitter) EmitOnce(evt string, d Data) <-chan struct{} {
 	return done
 }
 
+// Trigger calls the handlers for the event immediately, waiting for them to
+// finish and returning the error (if any) that halted them. Unlike Emit no
+// before or after events are fired, so Trigger can be used to fire meta
+// events directly. This is meant for lifecycle hooks that need to finish (or
+// halt) before work continues.
+func (e *Emitter) Trigger(evt string, d Data) error {
+	if d == nil {
+		d = NewData()
+	}
+
+	return e.emit(evt, d)
+}
+
 // this handles the meat of emitting events, it will iterate over the one time
 // handlers and clear out all (or only those that get touched) and then all
 // persistent handlers
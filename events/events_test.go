@@ -212,5 +212,28 @@ var _ = Describe("Events", func() {
 			close(c)
 			close(done)
 		})
+
+		Context("when triggering events", func() {
+			It("calls handlers before returning", func() {
+				called := false
+				em.On("before:test9", events.HandlerFunc(func(events.Data) error {
+					called = true
+
+					return nil
+				}))
+
+				err := em.Trigger("before:test9", nil)
+				Ω(err).Should(BeNil())
+				Ω(called).Should(BeTrue())
+			})
+
+			It("returns the error that halted the handlers", func() {
+				em.On("test10", events.HandlerFunc(func(events.Data) error {
+					return events.ErrHalt
+				}))
+
+				Ω(em.Trigger("test10", nil)).Should(Equal(events.ErrHalt))
+			})
+		})
 	})
 })
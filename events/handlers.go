@@ -100,6 +100,28 @@ func (hs *handlers) addOnce(h Handler) {
 	hs.onceHandlers = append(hs.onceHandlers, h)
 }
 
+// remove the handler (matched by source) from the persistent and once
+// handlers
+func (hs *handlers) remove(h Handler) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	hs.persistent = withoutSource(hs.persistent, h.Source())
+	hs.onceHandlers = withoutSource(hs.onceHandlers, h.Source())
+}
+
+// return a new list of handlers without any from the given source
+func withoutSource(list []Handler, src interface{}) []Handler {
+	filtered := make([]Handler, 0, len(list))
+	for _, h := range list {
+		if h.Source() != src {
+			filtered = append(filtered, h)
+		}
+	}
+
+	return filtered
+}
+
 // remove all handlers
 func (hs *handlers) clear() {
 	hs.mutex.Lock()
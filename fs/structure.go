@@ -24,7 +24,12 @@ var ProjectStructure = Dir{
 	"client": Dir{
 		"init.lua": File{},
 	},
-	"views": Dir{},
+	"entity": Dir{
+		"init.lua": File{},
+	},
+	"views":      Dir{},
+	"migrations": Dir{},
+	"tables":     Dir{},
 }
 
 // PluginStructure represents what a plugin is intended to look like.
@@ -39,7 +44,12 @@ var PluginStructure = Dir{
 	"client": Dir{
 		"init.lua": File{},
 	},
-	"views": Dir{},
+	"entity": Dir{
+		"init.lua": File{},
+	},
+	"views":      Dir{},
+	"migrations": Dir{},
+	"tables":     Dir{},
 }
 
 // CreateStructureParams makes it easier and more meaningful to call
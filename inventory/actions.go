@@ -0,0 +1,535 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package inventory
+
+import (
+	"sort"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// Moving items returns the ID of the stack the items ended up in, which isn't
+// the item moved when part of a stack is moved or the items join a stack that
+// was already there. A quantity of 0 moves the whole stack.
+//
+// Handlers for before events run while items are being moved, so they can
+// look at items but moving them would wait forever.
+
+// Get picks the item up from the floor of the actor's room, or takes it out of
+// a container the actor can reach.
+func (inv *Inventory) Get(actor, item string, qty int) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, err := inv.item(item)
+	if err != nil {
+		return "", err
+	}
+	p, err := inv.place(item)
+	if err != nil {
+		return "", err
+	}
+	switch p.position {
+	case InRoom:
+		room, err := inv.room(actor)
+		if err != nil {
+			return "", err
+		}
+		if p.holder != room {
+			return "", ErrNotHere
+		}
+	case Inside:
+		if ok, err := inv.reachable(actor, p.holder); err != nil || !ok {
+			return "", orNotHere(err)
+		}
+	default:
+		return "", ErrNotHere
+	}
+
+	d := events.Data{"actor": actor, "item": item, "from": p.holder}
+
+	return inv.move(EvtGet, d, node, qty, actor, world.CarriedByType)
+}
+
+// Drop puts the carried item on the floor of the actor's room.
+func (inv *Inventory) Drop(actor, item string, qty int) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, err := inv.carried(actor, item)
+	if err != nil {
+		return "", err
+	}
+	room, err := inv.room(actor)
+	if err != nil {
+		return "", err
+	}
+
+	d := events.Data{"actor": actor, "item": item, "room": room}
+
+	return inv.move(EvtDrop, d, node, qty, room, world.LocatedInType)
+}
+
+// Put puts the carried item inside a container the actor can reach.
+func (inv *Inventory) Put(actor, item, container string, qty int) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, err := inv.carried(actor, item)
+	if err != nil {
+		return "", err
+	}
+	c, err := inv.item(container)
+	if err == ErrNotItem {
+		return "", ErrNotContainer
+	} else if err != nil {
+		return "", err
+	}
+	if open, _ := c.Properties[ContainerProperty].(bool); !open {
+		return "", ErrNotContainer
+	}
+	if ok, err := inv.reachable(actor, container); err != nil || !ok {
+		return "", orNotHere(err)
+	}
+	holders, err := inv.holders(container)
+	if err != nil {
+		return "", err
+	}
+	if container == item || contains(holders, item) {
+		return "", ErrContainsItself
+	}
+
+	d := events.Data{"actor": actor, "item": item, "container": container}
+
+	return inv.move(EvtPut, d, node, qty, container, world.InsideType)
+}
+
+// Give hands the carried item to another character in the actor's room.
+func (inv *Inventory) Give(actor, item, to string, qty int) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, err := inv.carried(actor, item)
+	if err != nil {
+		return "", err
+	}
+	room, err := inv.room(actor)
+	if err != nil {
+		return "", err
+	}
+	if there, err := inv.world.Location(to); err != nil || there.ID != room {
+		return "", ErrNotHere
+	}
+
+	d := events.Data{"actor": actor, "item": item, "to": to}
+
+	return inv.move(EvtGive, d, node, qty, to, world.CarriedByType)
+}
+
+// Wear wears one of the carried items in the slot, an empty slot wears it in
+// the first slot it can be worn in.
+func (inv *Inventory) Wear(actor, item, slot string) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, err := inv.carried(actor, item)
+	if err != nil {
+		return "", err
+	}
+	slots := wornIn(node)
+	if slot == "" && len(slots) > 0 {
+		slot = slots[0]
+	}
+	if !contains(slots, slot) {
+		return "", ErrCantWear
+	}
+	if _, _, err := inv.worn(actor, slot); err == nil {
+		return "", ErrSlotTaken
+	} else if err != ErrNotWearing {
+		return "", err
+	}
+
+	d := events.Data{"actor": actor, "item": item, "slot": slot, "quantity": 1}
+	if err := inv.veto(EvtWear, d); err != nil {
+		return "", err
+	}
+	if quantity(node) > 1 {
+		if node, err = inv.split(node, 1); err != nil {
+			return "", err
+		}
+	}
+	if err := inv.hold(node.ID, actor, world.CarriedByType, storage.Properties{world.WearProperty: slot}); err != nil {
+		return "", err
+	}
+	d["item"] = node.ID
+	inv.events.Emit(EvtWear, d)
+
+	return node.ID, nil
+}
+
+// Remove takes off the item worn in the slot, it's carried again afterwards.
+func (inv *Inventory) Remove(actor, slot string) (string, error) {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+
+	node, _, err := inv.worn(actor, slot)
+	if err != nil {
+		return "", err
+	}
+
+	d := events.Data{"actor": actor, "item": node.ID, "slot": slot, "quantity": 1}
+	if err := inv.veto(EvtRemove, d); err != nil {
+		return "", err
+	}
+	if err := inv.hold(node.ID, actor, world.CarriedByType, nil); err != nil {
+		return "", err
+	}
+	id, err := inv.stack(node.ID, actor)
+	if err != nil {
+		return "", err
+	}
+	d["item"] = id
+	inv.events.Emit(EvtRemove, d)
+
+	return id, nil
+}
+
+// move qty of the item to the holder once handlers for the before event allow
+// it, then let everyone know it moved
+func (inv *Inventory) move(evt string, d events.Data, node *storage.Node, qty int, to, typ string) (string, error) {
+	have := quantity(node)
+	if qty == 0 {
+		qty = have
+	}
+	if qty < 0 || qty > have {
+		return "", ErrQuantity
+	}
+	d["quantity"] = qty
+
+	added, err := inv.weight(node)
+	if err != nil {
+		return "", err
+	}
+	if qty < have {
+		each, _ := number(node.Properties[WeightProperty])
+		added = each * float64(qty)
+	}
+	if err := inv.fits(node.ID, added, to); err != nil {
+		return "", err
+	}
+
+	if err := inv.veto(evt, d); err != nil {
+		return "", err
+	}
+	if qty < have {
+		if node, err = inv.split(node, qty); err != nil {
+			return "", err
+		}
+	}
+	if err := inv.hold(node.ID, to, typ, nil); err != nil {
+		return "", err
+	}
+	id, err := inv.stack(node.ID, to)
+	if err != nil {
+		return "", err
+	}
+	d["item"] = id
+	inv.events.Emit(evt, d)
+
+	return id, nil
+}
+
+// give handlers for the before event a chance to stop it
+func (inv *Inventory) veto(evt string, d events.Data) error {
+	if inv.caller != nil {
+		d = d.Clone()
+		d[events.CallerKey] = inv.caller
+	}
+	err := inv.vetoes.Trigger("before:"+evt, d)
+	if err == events.ErrHalt {
+		return ErrRefused
+	}
+
+	return err
+}
+
+// check the weight added to the holder fits in it and in everything holding
+// it, those already holding the item already carry it's weight
+func (inv *Inventory) fits(item string, added float64, to string) error {
+	current, err := inv.holders(item)
+	if err != nil {
+		return err
+	}
+	holders, err := inv.holders(to)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range append([]string{to}, holders...) {
+		if contains(current, h) {
+			continue
+		}
+		node, err := inv.store.GetNode(h)
+		if err != nil {
+			return err
+		}
+		if node.HasLabel(world.RoomLabel) {
+			return nil
+		}
+		capacity, limited := number(node.Properties[CapacityProperty])
+		if !limited {
+			continue
+		}
+		load, err := inv.Load(h)
+		if err != nil {
+			return err
+		}
+		if load+added > capacity {
+			if node.HasLabel(world.ObjectLabel) {
+				return ErrFull
+			}
+
+			return ErrTooHeavy
+		}
+	}
+
+	return nil
+}
+
+// the things holding the item, innermost first, ending with the room they're
+// in
+func (inv *Inventory) holders(id string) ([]string, error) {
+	var holders []string
+	for {
+		p, err := inv.place(id)
+		if err != nil {
+			return nil, err
+		}
+		if p.holder == "" || contains(holders, p.holder) {
+			return holders, nil
+		}
+		holders = append(holders, p.holder)
+		id = p.holder
+	}
+}
+
+// whether the actor can reach the item, it's on the floor of their room or
+// they're carrying it, or it's inside something that is
+func (inv *Inventory) reachable(actor, item string) (bool, error) {
+	room, err := inv.room(actor)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		p, err := inv.place(item)
+		if err != nil {
+			return false, err
+		}
+		switch p.position {
+		case InRoom:
+			return p.holder == room, nil
+		case Carried, Worn:
+			return p.holder == actor, nil
+		case Inside:
+			item = p.holder
+		default:
+			return false, nil
+		}
+	}
+}
+
+// the room the actor is in
+func (inv *Inventory) room(actor string) (string, error) {
+	room, err := inv.world.Location(actor)
+	if err != nil {
+		return "", err
+	}
+
+	return room.ID, nil
+}
+
+// fetch the item the actor is carrying, but not wearing
+func (inv *Inventory) carried(actor, item string) (*storage.Node, error) {
+	node, err := inv.item(item)
+	if err != nil {
+		return nil, err
+	}
+	p, err := inv.place(item)
+	if err != nil {
+		return nil, err
+	}
+	if p.holder != actor {
+		return nil, ErrNotCarried
+	}
+	if p.position == Worn {
+		return nil, ErrWorn
+	}
+
+	return node, nil
+}
+
+// fetch the item worn in the slot
+func (inv *Inventory) worn(actor, slot string) (*storage.Node, *place, error) {
+	nodes, err := inv.contents(actor)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, n := range nodes {
+		p, err := inv.place(n.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p.position == Worn && p.slot == slot {
+			return n, p, nil
+		}
+	}
+
+	return nil, nil, ErrNotWearing
+}
+
+// put the item in or on the holder, taking it from wherever it was
+func (inv *Inventory) hold(item, holder, typ string, props storage.Properties) error {
+	for _, t := range []string{world.LocatedInType, world.CarriedByType, world.InsideType} {
+		rels, err := inv.store.Relationships(item, t, storage.Outgoing)
+		if err != nil {
+			return err
+		}
+		for _, r := range rels {
+			if err := inv.store.DeleteRelationship(r.ID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := inv.store.CreateRelationship(item, holder, typ, props)
+
+	return err
+}
+
+// take qty items off the stack as a new stack, which isn't anywhere yet
+func (inv *Inventory) split(node *storage.Node, qty int) (*storage.Node, error) {
+	props := make(storage.Properties, len(node.Properties))
+	for k, v := range node.Properties {
+		props[k] = v
+	}
+	props[QuantityProperty] = qty
+	part, err := inv.store.CreateNode(node.Labels, props)
+	if err != nil {
+		return nil, err
+	}
+	if err := inv.store.UpdateNode(node.ID, storage.Properties{QuantityProperty: quantity(node) - qty}); err != nil {
+		return nil, err
+	}
+
+	proto, err := inv.world.InstanceOf(node.ID)
+	if err != nil {
+		return nil, err
+	}
+	if proto != "" {
+		if _, err := inv.store.CreateRelationship(part.ID, proto, world.InstanceOfType, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return part, nil
+}
+
+// add the item to a stack of identical items held with it, returning the ID
+// of the stack it's in
+func (inv *Inventory) stack(item, holder string) (string, error) {
+	node, err := inv.store.GetNode(item)
+	if err != nil {
+		return "", err
+	}
+	if ok, _ := node.Properties[StackableProperty].(bool); !ok {
+		return item, nil
+	}
+	proto, err := inv.world.InstanceOf(item)
+	if err != nil || proto == "" {
+		return item, err
+	}
+
+	nodes, err := inv.contents(holder)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	for _, n := range nodes {
+		if n.ID == item {
+			continue
+		}
+		if ok, _ := n.Properties[StackableProperty].(bool); !ok {
+			continue
+		}
+		p, err := inv.place(n.ID)
+		if err != nil {
+			return "", err
+		}
+		if p.position == Worn {
+			continue
+		}
+		other, err := inv.world.InstanceOf(n.ID)
+		if err != nil {
+			return "", err
+		}
+		if other != proto {
+			continue
+		}
+
+		if err := inv.store.UpdateNode(n.ID, storage.Properties{QuantityProperty: quantity(n) + quantity(node)}); err != nil {
+			return "", err
+		}
+		if err := inv.store.DeleteNode(item); err != nil {
+			return "", err
+		}
+
+		return n.ID, nil
+	}
+
+	return item, nil
+}
+
+// the slots the item can be worn in
+func wornIn(n *storage.Node) []string {
+	switch slots := n.Properties[SlotsProperty].(type) {
+	case string:
+		if slots != "" {
+			return []string{slots}
+		}
+	case []string:
+		return slots
+	case []interface{}:
+		var names []string
+		for _, s := range slots {
+			if name, ok := s.(string); ok {
+				names = append(names, name)
+			}
+		}
+
+		return names
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func orNotHere(err error) error {
+	if err != nil {
+		return err
+	}
+
+	return ErrNotHere
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package inventory gives things in the world somewhere to keep their items.
+// Items (world objects) lie in rooms, are carried by characters, are worn in
+// named equipment slots or are inside containers, which can be inside other
+// containers. Items have a weight, characters and containers can have a
+// capacity limiting the weight they hold and identical stackable items are
+// kept as a single stack with a quantity.
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// Properties of items and the things holding them.
+const (
+	// WeightProperty is the weight of one item, items without one weigh
+	// nothing.
+	WeightProperty = "weight"
+
+	// QuantityProperty is the number of items in a stack, 1 if it's not set.
+	QuantityProperty = "quantity"
+
+	// StackableProperty marks items that stack with items spawned from the
+	// same prototype.
+	StackableProperty = "stackable"
+
+	// ContainerProperty marks items that other items can be put in.
+	ContainerProperty = "container"
+
+	// CapacityProperty is the most weight a character can carry or a
+	// container can hold, there's no limit without one.
+	CapacityProperty = "capacity"
+
+	// SlotsProperty is the slot (or list of slots) an item can be worn in.
+	SlotsProperty = "slots"
+)
+
+// Positions an item can be in.
+const (
+	InRoom  = "room"
+	Carried = "carried"
+	Worn    = "worn"
+	Inside  = "inside"
+)
+
+// Events fired after items are moved, see Inventory.On. Each has "actor",
+// "item" and "quantity" along with "from" (get), "room" (drop), "container"
+// (put), "to" (give) or "slot" (wear and remove). Before each one a
+// before:<event> is fired that can stop it.
+const (
+	EvtGet    = "item:get"
+	EvtDrop   = "item:drop"
+	EvtPut    = "item:put"
+	EvtGive   = "item:give"
+	EvtWear   = "item:wear"
+	EvtRemove = "item:remove"
+)
+
+// Events lists every event fired after items are moved.
+var Events = []string{EvtGet, EvtDrop, EvtPut, EvtGive, EvtWear, EvtRemove}
+
+// Errors returned when moving items.
+var (
+	ErrNotItem        = errors.New("inventory: that's not an item")
+	ErrNotHere        = errors.New("inventory: the item isn't here")
+	ErrNotCarried     = errors.New("inventory: the item isn't being carried")
+	ErrWorn           = errors.New("inventory: the item is being worn")
+	ErrNotContainer   = errors.New("inventory: that's not a container")
+	ErrContainsItself = errors.New("inventory: an item can't be put inside itself")
+	ErrTooHeavy       = errors.New("inventory: that's too heavy to carry")
+	ErrFull           = errors.New("inventory: there isn't room for that")
+	ErrQuantity       = errors.New("inventory: there aren't that many")
+	ErrCantWear       = errors.New("inventory: the item can't be worn there")
+	ErrSlotTaken      = errors.New("inventory: something is already worn there")
+	ErrNotWearing     = errors.New("inventory: nothing is worn there")
+	ErrRefused        = errors.New("inventory: that isn't allowed")
+)
+
+// Item is a stack of one or more items.
+type Item struct {
+	ID        string
+	Name      string
+	Prototype string
+	Quantity  int
+
+	// Weight is the weight of the whole stack and everything in it.
+	Weight float64
+
+	// Holder is the room, character or container the item is in, Position
+	// says which it is. Worn items are worn in the Slot.
+	Holder   string
+	Position string
+	Slot     string
+
+	Properties storage.Properties
+}
+
+// Inventory moves items between rooms, characters and containers.
+type Inventory struct {
+	world  *world.World
+	store  storage.Store
+	events *events.Emitter
+	vetoes *events.Emitter
+	caller interface{}
+
+	// moves check and change more than one relationship
+	mutex *sync.Mutex
+}
+
+// New creates the inventory of the world's items.
+func New(w *world.World) *Inventory {
+	return &Inventory{
+		world:  w,
+		store:  w.Store(),
+		events: events.NewEmitter(logger.NewWithSource("inventory")),
+		vetoes: events.NewEmitter(logger.NewWithSource("inventory")),
+		mutex:  new(sync.Mutex),
+	}
+}
+
+// WithCaller returns the same inventory, except that handlers for before
+// events are given the caller as events.CallerKey in their data.
+func (inv *Inventory) WithCaller(caller interface{}) *Inventory {
+	c := *inv
+	c.caller = caller
+
+	return &c
+}
+
+// On registers a handler for one of the inventory's events. Handlers for
+// before:<event> are called before the item is moved, returning an error
+// stops it from moving. events.ErrHalt stops it with ErrRefused, other errors
+// are returned as they are.
+func (inv *Inventory) On(evt string, h events.Handler) {
+	if strings.HasPrefix(evt, "before:") {
+		inv.vetoes.On(evt, h)
+
+		return
+	}
+	inv.events.On(evt, h)
+}
+
+// Item fetches the item.
+func (inv *Inventory) Item(id string) (*Item, error) {
+	node, err := inv.item(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv.toItem(node)
+}
+
+// Contents fetches the items in the room, carried by the character or inside
+// the container, sorted by name.
+func (inv *Inventory) Contents(holder string) ([]*Item, error) {
+	nodes, err := inv.contents(holder)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(nodes))
+	for _, n := range nodes {
+		item, err := inv.toItem(n)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name != items[j].Name {
+			return items[i].Name < items[j].Name
+		}
+
+		return items[i].ID < items[j].ID
+	})
+
+	return items, nil
+}
+
+// Equipment fetches the items the character is wearing by slot.
+func (inv *Inventory) Equipment(character string) (map[string]*Item, error) {
+	items, err := inv.Contents(character)
+	if err != nil {
+		return nil, err
+	}
+
+	worn := make(map[string]*Item)
+	for _, item := range items {
+		if item.Position == Worn {
+			worn[item.Slot] = item
+		}
+	}
+
+	return worn, nil
+}
+
+// Load is the weight of everything the character is carrying or the
+// container is holding.
+func (inv *Inventory) Load(holder string) (float64, error) {
+	nodes, err := inv.contents(holder)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, n := range nodes {
+		w, err := inv.weight(n)
+		if err != nil {
+			return 0, err
+		}
+		total += w
+	}
+
+	return total, nil
+}
+
+// fetch the node, ensuring it's an item
+func (inv *Inventory) item(id string) (*storage.Node, error) {
+	node, err := inv.store.GetNode(id)
+	if err == storage.ErrNotFound || (err == nil && !node.HasLabel(world.ObjectLabel)) {
+		return nil, ErrNotItem
+	}
+
+	return node, err
+}
+
+// the item nodes in or carried by the holder
+func (inv *Inventory) contents(holder string) ([]*storage.Node, error) {
+	node, err := inv.store.GetNode(holder)
+	if err != nil {
+		return nil, err
+	}
+
+	types := []string{world.CarriedByType, world.InsideType}
+	if node.HasLabel(world.RoomLabel) {
+		types = []string{world.LocatedInType}
+	}
+
+	var nodes []*storage.Node
+	for _, typ := range types {
+		rels, err := inv.store.Relationships(holder, typ, storage.Incoming)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rels {
+			n, err := inv.store.GetNode(r.From)
+			if err != nil {
+				return nil, err
+			}
+			if n.HasLabel(world.ObjectLabel) {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+
+	return nodes, nil
+}
+
+// the weight of the whole stack and everything inside it
+func (inv *Inventory) weight(n *storage.Node) (float64, error) {
+	each, _ := number(n.Properties[WeightProperty])
+	total := each * float64(quantity(n))
+
+	inside, err := inv.Load(n.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return total + inside, nil
+}
+
+func (inv *Inventory) toItem(n *storage.Node) (*Item, error) {
+	p, err := inv.place(n.ID)
+	if err != nil {
+		return nil, err
+	}
+	w, err := inv.weight(n)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := inv.world.InstanceOf(n.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(storage.Properties, len(n.Properties))
+	for k, v := range n.Properties {
+		props[k] = v
+	}
+	name, _ := props["name"].(string)
+	delete(props, "name")
+	delete(props, QuantityProperty)
+
+	return &Item{
+		ID:         n.ID,
+		Name:       name,
+		Prototype:  proto,
+		Quantity:   quantity(n),
+		Weight:     w,
+		Holder:     p.holder,
+		Position:   p.position,
+		Slot:       p.slot,
+		Properties: props,
+	}, nil
+}
+
+// where an item is
+type place struct {
+	rel      *storage.Relationship
+	holder   string
+	position string
+	slot     string
+}
+
+func (inv *Inventory) place(id string) (*place, error) {
+	for _, typ := range []string{world.LocatedInType, world.CarriedByType, world.InsideType} {
+		rels, err := inv.store.Relationships(id, typ, storage.Outgoing)
+		if err != nil {
+			return nil, err
+		}
+		if len(rels) == 0 {
+			continue
+		}
+
+		p := &place{rel: rels[0], holder: rels[0].To}
+		switch typ {
+		case world.LocatedInType:
+			p.position = InRoom
+		case world.InsideType:
+			p.position = Inside
+		default:
+			p.position = Carried
+			if slot, ok := rels[0].Properties[world.WearProperty].(string); ok && slot != "" {
+				p.position = Worn
+				p.slot = slot
+			}
+		}
+
+		return p, nil
+	}
+
+	return &place{}, nil
+}
+
+func quantity(n *storage.Node) int {
+	if q, ok := number(n.Properties[QuantityProperty]); ok && q > 0 {
+		return int(q)
+	}
+
+	return 1
+}
+
+func number(val interface{}) (float64, bool) {
+	switch n := val.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
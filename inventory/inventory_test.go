@@ -0,0 +1,446 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package inventory_test
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	"github.com/bbuck/dragon-mud/world"
+
+	. "github.com/bbuck/dragon-mud/inventory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory", func() {
+	var (
+		w      *world.World
+		inv    *Inventory
+		square *world.Room
+		hall   *world.Room
+		hero   string
+		guard  string
+		spawn  func(vnum int, room *world.Room) string
+	)
+
+	BeforeEach(func() {
+		w = world.New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+		inv = New(w)
+		town, _ := w.CreateArea("Town", "", nil)
+		square, _ = w.CreateRoom("Square", town.ID, nil)
+		hall, _ = w.CreateRoom("Hall", town.ID, nil)
+
+		protos := []struct {
+			kind  string
+			vnum  int
+			name  string
+			props storage.Properties
+		}{
+			{world.MobileKind, 1, "a hero", storage.Properties{CapacityProperty: 20}},
+			{world.MobileKind, 2, "a guard", nil},
+			{world.ObjectKind, 10, "a gold coin", storage.Properties{WeightProperty: 1, StackableProperty: true}},
+			{world.ObjectKind, 11, "a backpack", storage.Properties{WeightProperty: 2, ContainerProperty: true, CapacityProperty: 10}},
+			{world.ObjectKind, 12, "a pouch", storage.Properties{WeightProperty: 1, ContainerProperty: true}},
+			{world.ObjectKind, 13, "a helmet", storage.Properties{WeightProperty: 3, SlotsProperty: "head"}},
+			{world.ObjectKind, 14, "an anvil", storage.Properties{WeightProperty: 100}},
+			{world.ObjectKind, 15, "a ring", storage.Properties{StackableProperty: true, SlotsProperty: []interface{}{"left finger", "right finger"}}},
+		}
+		for _, p := range protos {
+			w.CreatePrototype(p.kind, p.vnum, p.name, town.ID, p.props)
+		}
+
+		spawn = func(vnum int, room *world.Room) string {
+			kind := world.ObjectKind
+			if vnum < 10 {
+				kind = world.MobileKind
+			}
+			p, err := w.FindPrototype(kind, vnum)
+			Ω(err).Should(BeNil())
+			id, err := w.Spawn(p.ID)
+			Ω(err).Should(BeNil())
+			Ω(w.Move(id, room.ID)).Should(BeNil())
+
+			return id
+		}
+		hero = spawn(1, square)
+		guard = spawn(2, square)
+	})
+
+	names := func(items []*Item) []string {
+		var ns []string
+		for _, item := range items {
+			ns = append(ns, item.Name)
+		}
+
+		return ns
+	}
+
+	Context("getting and dropping", func() {
+		It("picks items up from the floor", func() {
+			helmet := spawn(13, square)
+			id, err := inv.Get(hero, helmet, 0)
+			Ω(err).Should(BeNil())
+			Ω(id).Should(Equal(helmet))
+
+			item, err := inv.Item(helmet)
+			Ω(err).Should(BeNil())
+			Ω(item.Name).Should(Equal("a helmet"))
+			Ω(item.Position).Should(Equal(Carried))
+			Ω(item.Holder).Should(Equal(hero))
+			Ω(item.Weight).Should(Equal(3.0))
+
+			floor, err := inv.Contents(square.ID)
+			Ω(err).Should(BeNil())
+			Ω(floor).Should(BeEmpty())
+		})
+
+		It("only reaches the actor's room", func() {
+			helmet := spawn(13, hall)
+			_, err := inv.Get(hero, helmet, 0)
+			Ω(err).Should(Equal(ErrNotHere))
+		})
+
+		It("doesn't take things that aren't items", func() {
+			_, err := inv.Get(hero, guard, 0)
+			Ω(err).Should(Equal(ErrNotItem))
+		})
+
+		It("drops carried items in the room", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			_, err := inv.Drop(hero, helmet, 0)
+			Ω(err).Should(BeNil())
+
+			item, _ := inv.Item(helmet)
+			Ω(item.Position).Should(Equal(InRoom))
+			Ω(item.Holder).Should(Equal(square.ID))
+		})
+
+		It("only drops what the actor is carrying", func() {
+			helmet := spawn(13, square)
+			_, err := inv.Drop(hero, helmet, 0)
+			Ω(err).Should(Equal(ErrNotCarried))
+		})
+	})
+
+	Context("weight", func() {
+		It("won't let characters carry more than their capacity", func() {
+			anvil := spawn(14, square)
+			_, err := inv.Get(hero, anvil, 0)
+			Ω(err).Should(Equal(ErrTooHeavy))
+		})
+
+		It("lets characters without a capacity carry anything", func() {
+			anvil := spawn(14, square)
+			_, err := inv.Get(guard, anvil, 0)
+			Ω(err).Should(BeNil())
+		})
+
+		It("counts what's inside containers", func() {
+			pack := spawn(11, square)
+			inv.Get(hero, pack, 0)
+			for i := 0; i < 2; i++ {
+				helmet := spawn(13, square)
+				inv.Get(hero, helmet, 0)
+				_, err := inv.Put(hero, helmet, pack, 0)
+				Ω(err).Should(BeNil())
+			}
+
+			item, _ := inv.Item(pack)
+			Ω(item.Weight).Should(Equal(8.0))
+			load, err := inv.Load(hero)
+			Ω(err).Should(BeNil())
+			Ω(load).Should(Equal(8.0))
+		})
+	})
+
+	Context("containers", func() {
+		var pack, pouch string
+
+		BeforeEach(func() {
+			pack = spawn(11, square)
+			pouch = spawn(12, square)
+			inv.Get(hero, pack, 0)
+			inv.Get(hero, pouch, 0)
+		})
+
+		It("holds items", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			_, err := inv.Put(hero, helmet, pack, 0)
+			Ω(err).Should(BeNil())
+
+			contents, err := inv.Contents(pack)
+			Ω(err).Should(BeNil())
+			Ω(names(contents)).Should(Equal([]string{"a helmet"}))
+			Ω(contents[0].Position).Should(Equal(Inside))
+		})
+
+		It("nests", func() {
+			coin := spawn(10, square)
+			inv.Get(hero, coin, 0)
+			Ω(inv.Put(hero, coin, pouch, 0)).Should(Equal(coin))
+			_, err := inv.Put(hero, pouch, pack, 0)
+			Ω(err).Should(BeNil())
+
+			id, err := inv.Get(hero, coin, 0)
+			Ω(err).Should(BeNil())
+			Ω(id).Should(Equal(coin))
+		})
+
+		It("can't be put inside themselves", func() {
+			_, err := inv.Put(hero, pack, pack, 0)
+			Ω(err).Should(Equal(ErrContainsItself))
+		})
+
+		It("can't be put inside something they contain", func() {
+			_, err := inv.Put(hero, pouch, pack, 0)
+			Ω(err).Should(BeNil())
+			_, err = inv.Put(hero, pack, pouch, 0)
+			Ω(err).Should(Equal(ErrContainsItself))
+		})
+
+		It("stop at their capacity", func() {
+			for i := 0; i < 3; i++ {
+				helmet := spawn(13, square)
+				inv.Get(hero, helmet, 0)
+				_, err := inv.Put(hero, helmet, pack, 0)
+				Ω(err).Should(BeNil())
+			}
+
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			_, err := inv.Put(hero, helmet, pack, 0)
+			Ω(err).Should(Equal(ErrFull))
+		})
+
+		It("must be containers", func() {
+			helmet := spawn(13, square)
+			coin := spawn(10, square)
+			inv.Get(hero, coin, 0)
+			_, err := inv.Put(hero, coin, helmet, 0)
+			Ω(err).Should(Equal(ErrNotContainer))
+			_, err = inv.Put(hero, coin, guard, 0)
+			Ω(err).Should(Equal(ErrNotContainer))
+		})
+
+		It("must be within reach", func() {
+			other := spawn(11, square)
+			inv.Get(guard, other, 0)
+			coin := spawn(10, square)
+			inv.Get(hero, coin, 0)
+			_, err := inv.Put(hero, coin, other, 0)
+			Ω(err).Should(Equal(ErrNotHere))
+		})
+	})
+
+	Context("stacking", func() {
+		It("merges identical items", func() {
+			first := spawn(10, square)
+			second := spawn(10, square)
+			Ω(inv.Get(hero, first, 0)).Should(Equal(first))
+			Ω(inv.Get(hero, second, 0)).Should(Equal(first))
+
+			item, _ := inv.Item(first)
+			Ω(item.Quantity).Should(Equal(2))
+			Ω(item.Weight).Should(Equal(2.0))
+			_, err := inv.Item(second)
+			Ω(err).Should(Equal(ErrNotItem))
+		})
+
+		It("splits stacks", func() {
+			coins := spawn(10, square)
+			w.Store().UpdateNode(coins, storage.Properties{QuantityProperty: 5})
+
+			part, err := inv.Get(hero, coins, 2)
+			Ω(err).Should(BeNil())
+			Ω(part).ShouldNot(Equal(coins))
+
+			taken, _ := inv.Item(part)
+			Ω(taken.Quantity).Should(Equal(2))
+			Ω(taken.Holder).Should(Equal(hero))
+			left, _ := inv.Item(coins)
+			Ω(left.Quantity).Should(Equal(3))
+			Ω(left.Holder).Should(Equal(square.ID))
+			Ω(taken.Prototype).Should(Equal(left.Prototype))
+
+			Ω(inv.Get(hero, coins, 3)).Should(Equal(part))
+			taken, _ = inv.Item(part)
+			Ω(taken.Quantity).Should(Equal(5))
+		})
+
+		It("can't take more than there are", func() {
+			coin := spawn(10, square)
+			_, err := inv.Get(hero, coin, 2)
+			Ω(err).Should(Equal(ErrQuantity))
+		})
+	})
+
+	Context("giving", func() {
+		It("hands items to characters in the room", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			_, err := inv.Give(hero, helmet, guard, 0)
+			Ω(err).Should(BeNil())
+
+			contents, _ := inv.Contents(guard)
+			Ω(names(contents)).Should(Equal([]string{"a helmet"}))
+		})
+
+		It("doesn't reach other rooms", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			w.Move(guard, hall.ID)
+			_, err := inv.Give(hero, helmet, guard, 0)
+			Ω(err).Should(Equal(ErrNotHere))
+		})
+
+		It("checks their capacity", func() {
+			anvil := spawn(14, square)
+			inv.Get(guard, anvil, 0)
+			_, err := inv.Give(guard, anvil, hero, 0)
+			Ω(err).Should(Equal(ErrTooHeavy))
+		})
+	})
+
+	Context("equipment", func() {
+		It("wears items in their slot", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			_, err := inv.Wear(hero, helmet, "")
+			Ω(err).Should(BeNil())
+
+			worn, err := inv.Equipment(hero)
+			Ω(err).Should(BeNil())
+			Ω(worn).Should(HaveKey("head"))
+			Ω(worn["head"].ID).Should(Equal(helmet))
+			Ω(worn["head"].Position).Should(Equal(Worn))
+
+			_, err = inv.Drop(hero, helmet, 0)
+			Ω(err).Should(Equal(ErrWorn))
+		})
+
+		It("only wears items where they can be worn", func() {
+			helmet := spawn(13, square)
+			coin := spawn(10, square)
+			inv.Get(hero, helmet, 0)
+			inv.Get(hero, coin, 0)
+			_, err := inv.Wear(hero, helmet, "feet")
+			Ω(err).Should(Equal(ErrCantWear))
+			_, err = inv.Wear(hero, coin, "")
+			Ω(err).Should(Equal(ErrCantWear))
+		})
+
+		It("wears one item in each slot", func() {
+			first := spawn(13, square)
+			second := spawn(13, square)
+			inv.Get(hero, first, 0)
+			inv.Get(hero, second, 0)
+			inv.Wear(hero, first, "head")
+			_, err := inv.Wear(hero, second, "head")
+			Ω(err).Should(Equal(ErrSlotTaken))
+		})
+
+		It("wears one item from a stack", func() {
+			rings := spawn(15, square)
+			w.Store().UpdateNode(rings, storage.Properties{QuantityProperty: 2})
+			inv.Get(hero, rings, 0)
+
+			left, err := inv.Wear(hero, rings, "")
+			Ω(err).Should(BeNil())
+			right, err := inv.Wear(hero, rings, "right finger")
+			Ω(err).Should(BeNil())
+			Ω(left).ShouldNot(Equal(right))
+
+			worn, _ := inv.Equipment(hero)
+			Ω(worn).Should(HaveLen(2))
+			Ω(worn["left finger"].Quantity).Should(Equal(1))
+			Ω(worn["right finger"].Quantity).Should(Equal(1))
+		})
+
+		It("removes worn items back onto their stack", func() {
+			rings := spawn(15, square)
+			w.Store().UpdateNode(rings, storage.Properties{QuantityProperty: 2})
+			inv.Get(hero, rings, 0)
+			inv.Wear(hero, rings, "")
+
+			id, err := inv.Remove(hero, "left finger")
+			Ω(err).Should(BeNil())
+			Ω(id).Should(Equal(rings))
+			item, _ := inv.Item(rings)
+			Ω(item.Quantity).Should(Equal(2))
+			Ω(item.Position).Should(Equal(Carried))
+
+			_, err = inv.Remove(hero, "left finger")
+			Ω(err).Should(Equal(ErrNotWearing))
+		})
+	})
+
+	Context("events", func() {
+		It("fires events after items move", func() {
+			var (
+				mutex sync.Mutex
+				fired []events.Data
+			)
+			for _, evt := range Events {
+				inv.On(evt, events.HandlerFunc(func(d events.Data) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+					fired = append(fired, d)
+
+					return nil
+				}))
+			}
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+
+			Eventually(func() []events.Data {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				return append([]events.Data(nil), fired...)
+			}).Should(Equal([]events.Data{{
+				"actor":    hero,
+				"item":     helmet,
+				"from":     square.ID,
+				"quantity": 1,
+			}}))
+		})
+
+		It("lets before handlers veto moves", func() {
+			anvil := spawn(14, square)
+			inv.On("before:"+EvtGet, events.HandlerFunc(func(d events.Data) error {
+				if d["item"] == anvil {
+					return events.ErrHalt
+				}
+
+				return nil
+			}))
+
+			_, err := inv.Get(guard, anvil, 0)
+			Ω(err).Should(Equal(ErrRefused))
+			item, _ := inv.Item(anvil)
+			Ω(item.Holder).Should(Equal(square.ID))
+
+			helmet := spawn(13, square)
+			_, err = inv.Get(guard, helmet, 0)
+			Ω(err).Should(BeNil())
+		})
+
+		It("returns other errors from before handlers", func() {
+			helmet := spawn(13, square)
+			inv.Get(hero, helmet, 0)
+			inv.On("before:"+EvtDrop, events.HandlerFunc(func(events.Data) error {
+				return ErrNotHere
+			}))
+
+			_, err := inv.Drop(hero, helmet, 0)
+			Ω(err).Should(Equal(ErrNotHere))
+		})
+	})
+})
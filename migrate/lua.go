@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/bbuck/dragon-mud/plugins"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// load a Lua migration, the file should return a table with an "up" function
+// and optionally a "down" function. Migrations run with the modules available
+// to server scripts and use the talon module to talk to the database, which
+// queries the database the migrations are being run against:
+//   local talon = require("talon")
+//
+//   return {
+//     up = function()
+//       talon.exec("MATCH (p:Player) SET p.gold = 0")
+//     end,
+//     down = function()
+//       talon.exec("MATCH (p:Player) REMOVE p.gold")
+//     end,
+//   }
+// The file isn't run until the migration is, so a missing down function is
+// only reported when rolling back.
+func loadLua(m *Migration) {
+	m.Up = luaStep(m, "up")
+	m.Down = luaStep(m, "down")
+}
+
+func luaStep(m *Migration, direction string) Step {
+	return func(db *talon.DB) error {
+		eng := lua.NewEngine(lua.EngineOptions{
+			FieldNaming:  lua.SnakeCaseNames,
+			MethodNaming: lua.SnakeCaseNames,
+		})
+		defer eng.Close()
+		eng.Meta[keys.TalonDB] = db
+		eng.SecureRequire(plugins.GetScriptLoadPaths())
+		scripting.ServerLevel.Profile().Apply(eng)
+
+		chunk, err := eng.LoadFile(m.Path)
+		if err != nil {
+			return err
+		}
+		results, err := chunk.Call(1)
+		if err != nil {
+			return err
+		}
+
+		fn := results[0]
+		if fn.IsTable() {
+			fn = fn.Get(direction)
+		}
+		if fn == nil || !fn.IsFunction() {
+			return fmt.Errorf("%s does not define a %q function", m.ID(), direction)
+		}
+		_, err = fn.Call(0)
+
+		return err
+	}
+}
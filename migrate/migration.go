@@ -0,0 +1,224 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bbuck/dragon-mud/plugins"
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// Dir is the name of the directory migrations are kept in, both in the
+// project root and in each plugin.
+const Dir = "migrations"
+
+// migration files are named like 20170102150405_add_player_index.cypher, the
+// version is used to order migrations and must be unique within a namespace.
+var fileRx = regexp.MustCompile(`^(\d+)_([\w-]+)\.(cypher|lua)$`)
+
+// markers used to split a Cypher migration into it's up and down halves.
+const (
+	upMarker   = "// +up"
+	downMarker = "// +down"
+)
+
+// Step is one direction of a migration.
+type Step func(db *talon.DB) error
+
+// Migration is a single change to the database. Migrations from plugins are
+// namespaced by the plugin's name, migrations from the game itself have no
+// namespace. Down is nil for migrations that can't be rolled back.
+type Migration struct {
+	Namespace string
+	Version   string
+	Name      string
+	Path      string
+	Up        Step
+	Down      Step
+}
+
+// ID uniquely identifies the migration, it's the namespace (if any) followed
+// by the version and name.
+func (m *Migration) ID() string {
+	id := m.Version + "_" + m.Name
+	if m.Namespace != "" {
+		id = m.Namespace + "/" + id
+	}
+
+	return id
+}
+
+// Less orders migrations by version, migrations from different namespaces with
+// the same version are ordered by namespace.
+func (m *Migration) Less(other *Migration) bool {
+	if m.Version != other.Version {
+		return versionLess(m.Version, other.Version)
+	}
+
+	return m.Namespace < other.Namespace
+}
+
+// versions are compared as numbers, without being limited to the size of an
+// integer.
+func versionLess(a, b string) bool {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+// Load finds the migrations for the game and every plugin, in the order they
+// should be applied.
+func Load() ([]*Migration, error) {
+	migrations, err := LoadDir(filepath.Join(plugins.Root, Dir), "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range plugins.Names {
+		pm, err := LoadDir(filepath.Join(plugins.PluginRoot, name, Dir), name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, pm...)
+	}
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Less(migrations[j])
+	})
+
+	return migrations, nil
+}
+
+// LoadDir reads the migrations in the directory, giving them the namespace.
+// A directory that doesn't exist has no migrations. Files that don't look like
+// migrations are ignored.
+func LoadDir(dir, namespace string) ([]*Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	seen := make(map[string]string)
+	for _, fi := range files {
+		matches := fileRx.FindStringSubmatch(fi.Name())
+		if fi.IsDir() || matches == nil {
+			continue
+		}
+
+		m := &Migration{
+			Namespace: namespace,
+			Version:   matches[1],
+			Name:      matches[2],
+			Path:      filepath.Join(dir, fi.Name()),
+		}
+		if other, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share the version %s", other, fi.Name(), m.Version)
+		}
+		seen[m.Version] = fi.Name()
+
+		switch matches[3] {
+		case "cypher":
+			err = loadCypher(m)
+		case "lua":
+			loadLua(m)
+		}
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Less(migrations[j])
+	})
+
+	return migrations, nil
+}
+
+// load a Cypher migration, the statements following "// +up" are run when
+// migrating and those following "// +down" are run when rolling back. A file
+// without markers is treated as only having an up half.
+func loadCypher(m *Migration) error {
+	src, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		return err
+	}
+
+	up, down, hasDown := splitCypher(src)
+	m.Up = cypherStep(up)
+	if hasDown {
+		m.Down = cypherStep(down)
+	}
+
+	return nil
+}
+
+// split the source into the up and down statements.
+func splitCypher(src []byte) (up, down []string, hasDown bool) {
+	var (
+		current = &up
+		stmt    = new(bytes.Buffer)
+	)
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			*current = append(*current, strings.TrimSuffix(s, ";"))
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == upMarker:
+			flush()
+			current = &up
+		case trimmed == downMarker:
+			flush()
+			current = &down
+			hasDown = true
+		case strings.HasPrefix(trimmed, "//"):
+			// comments are dropped
+		default:
+			stmt.WriteString(line)
+			stmt.WriteRune('\n')
+			// statements end with a semicolon at the end of a line, each is
+			// sent on it's own since Neo4j only runs one statement per query.
+			if strings.HasSuffix(trimmed, ";") {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return up, down, hasDown
+}
+
+// run each statement in order
+func cypherStep(stmts []string) Step {
+	return func(db *talon.DB) error {
+		for _, stmt := range stmts {
+			if _, err := db.Cypher(stmt).Exec(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
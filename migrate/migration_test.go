@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package migrate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/bbuck/dragon-mud/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migration", func() {
+	var (
+		dir        string
+		migrations []*Migration
+		err        error
+	)
+
+	write := func(name, src string) {
+		Ω(ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)).Should(BeNil())
+	}
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "migrations")
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("LoadDir", func() {
+		BeforeEach(func() {
+			write("10_add_gold.lua", "return {}")
+			write("9_player_index.cypher", "// +up\nCREATE INDEX ON :Player(name);\n// +down\nDROP INDEX ON :Player(name);\n")
+			write("README.md", "not a migration")
+		})
+
+		JustBeforeEach(func() {
+			migrations, err = LoadDir(dir, "quests")
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("loads migrations in version order", func() {
+			Ω(migrations).Should(HaveLen(2))
+			Ω(migrations[0].ID()).Should(Equal("quests/9_player_index"))
+			Ω(migrations[1].ID()).Should(Equal("quests/10_add_gold"))
+		})
+
+		It("gives every migration steps", func() {
+			for _, m := range migrations {
+				Ω(m.Up).ShouldNot(BeNil())
+				Ω(m.Down).ShouldNot(BeNil())
+			}
+		})
+
+		Context("with a Cypher migration without markers", func() {
+			BeforeEach(func() {
+				write("11_data.cypher", "MATCH (p:Player) SET p.gold = 0;")
+			})
+
+			It("can't be rolled back", func() {
+				Ω(migrations[2].Down).Should(BeNil())
+			})
+		})
+
+		Context("with a duplicate version", func() {
+			BeforeEach(func() {
+				write("10_other.cypher", "RETURN 1;")
+			})
+
+			It("fails", func() {
+				Ω(err).ShouldNot(BeNil())
+			})
+		})
+
+		Context("with a directory that doesn't exist", func() {
+			It("has no migrations", func() {
+				migrations, err = LoadDir(filepath.Join(dir, "missing"), "")
+				Ω(err).Should(BeNil())
+				Ω(migrations).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("ordering", func() {
+		It("orders by version and then namespace", func() {
+			a := &Migration{Namespace: "b", Version: "2"}
+			b := &Migration{Namespace: "a", Version: "2"}
+			c := &Migration{Namespace: "z", Version: "0010"}
+
+			Ω(b.Less(a)).Should(BeTrue())
+			Ω(a.Less(c)).Should(BeTrue())
+			Ω(c.Less(a)).Should(BeFalse())
+		})
+	})
+
+	Describe("Lua migrations", func() {
+		BeforeEach(func() {
+			write("1_lua.lua", `
+				return {
+					up = function()
+						migrated = true
+					end,
+				}
+			`)
+			migrations, err = LoadDir(dir, "")
+			Ω(err).Should(BeNil())
+		})
+
+		It("runs the up function", func() {
+			Ω(migrations[0].Up(nil)).Should(BeNil())
+		})
+
+		It("fails to roll back without a down function", func() {
+			Ω(migrations[0].Down(nil)).Should(MatchError(`1_lua does not define a "down" function`))
+		})
+
+		It("queries the database it's run against", func() {
+			write("2_players.lua", `
+				local talon = require("talon")
+
+				return {
+					up = function()
+						talon.exec("CREATE (:Player {name: 'Bob'})")
+					end,
+				}
+			`)
+			migrations, err = LoadDir(dir, "")
+			Ω(err).Should(BeNil())
+
+			db := talon.NewDB(memory.NewDriver())
+			Ω(migrations[1].Up(db)).Should(BeNil())
+
+			rows, err := db.Cypher("MATCH (p:Player) RETURN p.name").Query()
+			Ω(err).Should(BeNil())
+			all, err := rows.All()
+			Ω(err).Should(BeNil())
+			Ω(all).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,225 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// Label is given to the nodes recording which migrations have been applied.
+const Label = "SchemaMigration"
+
+// the node recorded for an applied migration
+type record struct {
+	Namespace string `talon:"namespace"`
+	Version   string `talon:"version"`
+	Name      string `talon:"name"`
+	AppliedAt int64  `talon:"applied_at"`
+}
+
+func (r *record) key() string {
+	return r.Namespace + "/" + r.Version
+}
+
+func key(m *Migration) string {
+	return m.Namespace + "/" + m.Version
+}
+
+// Status describes a migration and whether it's been applied. Migrations
+// that have been applied but whose files no longer exist are Missing, they
+// have no Up or Down steps.
+type Status struct {
+	*Migration
+	Applied   bool
+	AppliedAt time.Time
+	Missing   bool
+}
+
+// Migrator applies and rolls back migrations, recording which have been
+// applied as :SchemaMigration nodes in the database.
+type Migrator struct {
+	DB         *talon.DB
+	Migrations []*Migration
+}
+
+// New creates a migrator for the migrations, they're sorted into the order
+// they should be applied.
+func New(db *talon.DB, migrations []*Migration) *Migrator {
+	sorted := append([]*Migration(nil), migrations...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Less(sorted[j])
+	})
+
+	return &Migrator{
+		DB:         db,
+		Migrations: sorted,
+	}
+}
+
+// Status reports on every migration, applied or not, in the order they're
+// applied.
+func (mr *Migrator) Status() ([]Status, error) {
+	applied, err := mr.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	known := make(map[string]bool)
+	for _, m := range mr.Migrations {
+		s := Status{Migration: m}
+		if r, ok := applied[key(m)]; ok {
+			s.Applied = true
+			s.AppliedAt = time.Unix(r.AppliedAt, 0)
+		}
+		known[key(m)] = true
+		statuses = append(statuses, s)
+	}
+
+	for k, r := range applied {
+		if known[k] {
+			continue
+		}
+		statuses = append(statuses, Status{
+			Migration: &Migration{
+				Namespace: r.Namespace,
+				Version:   r.Version,
+				Name:      r.Name,
+			},
+			Applied:   true,
+			AppliedAt: time.Unix(r.AppliedAt, 0),
+			Missing:   true,
+		})
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Less(statuses[j].Migration)
+	})
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied.
+func (mr *Migrator) Pending() ([]*Migration, error) {
+	applied, err := mr.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, m := range mr.Migrations {
+		if _, ok := applied[key(m)]; !ok {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order, stopping at the first
+// that fails. The migrations that were applied are returned, even when
+// there's an error.
+func (mr *Migrator) Migrate() ([]*Migration, error) {
+	pending, err := mr.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, m := range pending {
+		if err := m.Up(mr.DB); err != nil {
+			return done, fmt.Errorf("migrating %s: %s", m.ID(), err)
+		}
+
+		_, err := mr.DB.Create(talon.N("m", Label).Props(talon.Properties{
+			"namespace":  m.Namespace,
+			"version":    m.Version,
+			"name":       m.Name,
+			"applied_at": time.Now().Unix(),
+		})).Exec()
+		if err != nil {
+			return done, fmt.Errorf("recording %s: %s", m.ID(), err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// Rollback undoes the given number of applied migrations, most recent first,
+// stopping at the first that fails. The migrations that were rolled back are
+// returned, even when there's an error.
+func (mr *Migrator) Rollback(steps int) ([]*Migration, error) {
+	statuses, err := mr.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Status
+	for _, s := range statuses {
+		if s.Applied {
+			applied = append(applied, s)
+		}
+	}
+	// statuses are in the order migrations are applied, roll back from the
+	// last applied to the first
+	sort.SliceStable(applied, func(i, j int) bool {
+		if !applied[i].AppliedAt.Equal(applied[j].AppliedAt) {
+			return applied[i].AppliedAt.After(applied[j].AppliedAt)
+		}
+
+		return applied[j].Less(applied[i].Migration)
+	})
+
+	var done []*Migration
+	for i := 0; i < steps && i < len(applied); i++ {
+		m := applied[i].Migration
+		switch {
+		case applied[i].Missing:
+			return done, fmt.Errorf("cannot roll back %s, it's migration file is missing", m.ID())
+		case m.Down == nil:
+			return done, fmt.Errorf("cannot roll back %s, it has no down migration", m.ID())
+		}
+
+		if err := m.Down(mr.DB); err != nil {
+			return done, fmt.Errorf("rolling back %s: %s", m.ID(), err)
+		}
+
+		_, err := mr.DB.
+			Match(talon.N("m", Label).Where(
+				talon.Eq("namespace", m.Namespace),
+				talon.Eq("version", m.Version),
+			)).
+			Delete("m").
+			Exec()
+		if err != nil {
+			return done, fmt.Errorf("unrecording %s: %s", m.ID(), err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// fetch the records of applied migrations by namespace and version
+func (mr *Migrator) applied() (map[string]*record, error) {
+	rows, err := mr.DB.Match(talon.N("m", Label)).Return("m").Query()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*record
+	if err := rows.Scan(&records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]*record, len(records))
+	for _, r := range records {
+		applied[r.key()] = r
+	}
+
+	return applied, nil
+}
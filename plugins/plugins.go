@@ -11,6 +11,7 @@ import (
 
 	"github.com/bbuck/dragon-mud/errs"
 	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/random"
 	"github.com/bbuck/dragon-mud/scripting/lua"
 	"github.com/bbuck/dragon-mud/text/tmpl"
 )
@@ -75,6 +76,21 @@ func GetScriptLoadPaths() []string {
 	return loadPaths
 }
 
+// FindScript finds the file for a script named the way modules are named for
+// require, "town.guard" is found at "town/guard.lua" or "town/guard/init.lua"
+// in the game or it's plugins.
+func FindScript(name string) (string, bool) {
+	name = strings.Replace(name, ".", string(filepath.Separator), -1)
+	for _, p := range GetScriptLoadPaths() {
+		path := strings.Replace(p, "?", name, -1)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
 // LoadViews will read all plugin views and compile them, then perform the
 // sam eoperation on root views. Root view definitions can overwrite
 func LoadViews() error {
@@ -112,6 +128,38 @@ func LoadViews() error {
 	return nil
 }
 
+// LoadTables reads every random table defined in TOML files in plugin "tables"
+// directories followed by the game's own "tables" directory, so the game can
+// replace tables defined by plugins.
+func LoadTables() error {
+	msgs := make([]string, 0)
+	dirs := make([]string, 0, len(Names)+1)
+	for _, name := range Names {
+		dirs = append(dirs, filepath.Join(PluginRoot, name, "tables"))
+	}
+	dirs = append(dirs, filepath.Join(Root, "tables"))
+
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+			if err != nil || f.IsDir() || filepath.Ext(path) != ".toml" {
+				return nil
+			}
+
+			if err := random.Tables.LoadFile(path); err != nil {
+				msgs = append(msgs, err.Error())
+			}
+
+			return nil
+		})
+	}
+
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
 // LoadCommands runs all the init.lua files for commands in the users codebase
 // and with all plugins.
 func LoadCommands(eng *lua.Engine) error {
@@ -130,6 +178,12 @@ func LoadClient(eng *lua.Engine) error {
 	return loadPluginCode("client", eng)
 }
 
+// LoadEntity runs all the init.lua files for entity in the users codebase
+// and with all plugins.
+func LoadEntity(eng *lua.Engine) error {
+	return loadPluginCode("entity", eng)
+}
+
 // run require command for the user's code and all plugins to initiate a plugin
 // level. Like "commands" or "server", etc...
 func loadPluginCode(kind string, eng *lua.Engine) error {
@@ -151,8 +205,12 @@ func loadPluginCode(kind string, eng *lua.Engine) error {
 	return nil
 }
 
+// determine if the error is the one raised by a secure require when no file
+// could be found for the module, which is safe to ignore as not every plugin
+// defines code for every level.
 func isModNotFoundError(err error, mod string) bool {
-	msg := fmt.Sprintf("module %s not found", mod)
+	mod = strings.Replace(mod, ".", "/", -1)
+	msg := fmt.Sprintf("%q module not found", mod)
 
 	return strings.Contains(err.Error(), msg)
 }
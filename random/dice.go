@@ -3,68 +3,138 @@
 package random
 
 import (
+	"bytes"
 	"strconv"
-	"strings"
 )
 
-var validSides = map[string]func() int{
-	"2":   D2,
-	"4":   D4,
-	"6":   D6,
-	"8":   D8,
-	"10":  D10,
-	"12":  D12,
-	"20":  D20,
-	"100": D100,
-}
-
 // D2 represents a 2-sided die
-func D2() int { return Range(1, 2) }
+func D2() int { return rollSides(2) }
 
 // D4 represents a 4-sided die
-func D4() int { return Range(1, 4) }
+func D4() int { return rollSides(4) }
 
 // D6 represents a 6-sided die
-func D6() int { return Range(1, 6) }
+func D6() int { return rollSides(6) }
 
 // D8 represents a 8-sided die
-func D8() int { return Range(1, 8) }
+func D8() int { return rollSides(8) }
 
 // D10 represents a 10-sided die
-func D10() int { return Range(1, 10) }
+func D10() int { return rollSides(10) }
 
 // D12 represents a 12-sided die
-func D12() int { return Range(1, 12) }
+func D12() int { return rollSides(12) }
 
 // D20 represents a 20-sided die
-func D20() int { return Range(1, 20) }
+func D20() int { return rollSides(20) }
 
 // D100 represents a 100-sided die
-func D100() int { return Range(1, 100) }
+func D100() int { return rollSides(100) }
+
+// roll a single die, from 1 to sides
+func rollSides(sides int) int {
+	return Intn(sides) + 1
+}
 
-// RollDie takes a string value of die, such as '3d20' and returns an int slice
-// with the results.
+// RollDie takes a dice expression, such as '3d20' or '4d6kh3+2', and returns
+// the values of every die that counts towards the total. An invalid
+// expression returns an empty slice, use RollDice to find out what was wrong
+// with it or to get the total.
 func RollDie(die string) []int {
-	rolls := make([]int, 0)
-	values := strings.Split(die, "d")
-	if len(values) != 2 {
-		return rolls
+	roll, err := RollDice(die)
+	if err != nil {
+		return make([]int, 0)
+	}
+
+	return roll.Values()
+}
+
+// RollDice parses and rolls the dice expression, see ParseDice for what an
+// expression can contain.
+func RollDice(expr string) (*Roll, error) {
+	de, err := ParseDice(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return de.Roll(), nil
+}
+
+// Roll is the outcome of rolling a dice expression, with every die rolled
+// along the way.
+type Roll struct {
+	Expression string
+	Total      int
+	Dice       []*DiceRoll
+
+	// Breakdown is the expression with every group of dice replaced by the
+	// values rolled, like "[6, 5, 3, ~2~] + 2".
+	Breakdown string
+}
+
+// Values returns the value of every die that counts towards the total.
+func (r *Roll) Values() []int {
+	values := make([]int, 0)
+	for _, group := range r.Dice {
+		for _, d := range group.Rolls {
+			if !d.Dropped {
+				values = append(values, d.Value)
+			}
+		}
 	}
-	count := 1
-	if len(values[0]) > 0 {
-		var err error
-		count, err = strconv.Atoi(values[0])
-		if err != nil {
-			return rolls
+
+	return values
+}
+
+// String shows the breakdown and total of the roll.
+func (r *Roll) String() string {
+	return r.Expression + ": " + r.Breakdown + " = " + strconv.Itoa(r.Total)
+}
+
+// DiceRoll is the outcome of a single group of dice in an expression, like
+// the 4d6kh3 in "4d6kh3+2".
+type DiceRoll struct {
+	Notation string
+	Sides    int
+	Total    int
+	Rolls    []Die
+}
+
+// String lists the dice rolled in the group.
+func (dr *DiceRoll) String() string {
+	buf := new(bytes.Buffer)
+	buf.WriteRune('[')
+	for i, d := range dr.Rolls {
+		if i > 0 {
+			buf.WriteString(", ")
 		}
+		buf.WriteString(d.String())
 	}
-	rollFn, valid := validSides[values[1]]
-	if !valid {
-		return rolls
+	buf.WriteRune(']')
+
+	return buf.String()
+}
+
+// Die is one die from a group, Rerolls holds the values it rolled before
+// it's rerolls stopped. Dice that exploded caused the die after them to be
+// rolled, dropped dice don't count towards the total.
+type Die struct {
+	Value    int
+	Rerolls  []int
+	Exploded bool
+	Dropped  bool
+}
+
+// String shows the value of the die, exploded dice are followed by a "!" and
+// dropped dice are wrapped in "~".
+func (d Die) String() string {
+	str := strconv.Itoa(d.Value)
+	if d.Exploded {
+		str += "!"
 	}
-	for i := 0; i < count; i++ {
-		rolls = append(rolls, rollFn())
+	if d.Dropped {
+		str = "~" + str + "~"
 	}
 
-	return rolls
+	return str
 }
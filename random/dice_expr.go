@@ -0,0 +1,557 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package random
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// limits keeping a single expression from running away, maxDice is the most
+// dice in one group and maxTotalDice the most in the whole expression
+const (
+	maxDice      = 1000
+	maxTotalDice = 5000
+	maxSides     = 1000000000
+	maxRerolls   = 100
+)
+
+// DiceError describes what's wrong with a dice expression and where.
+type DiceError struct {
+	Expression string
+	Offset     int
+	Msg        string
+}
+
+// Error includes the expression and the offset of the problem.
+func (de *DiceError) Error() string {
+	return fmt.Sprintf("random: invalid dice expression %q at %d: %s", de.Expression, de.Offset, de.Msg)
+}
+
+// DiceExpr is a parsed dice expression, it can be rolled any number of times.
+type DiceExpr struct {
+	expr string
+	root diceNode
+}
+
+// ParseDice parses a dice expression. Expressions add, subtract and multiply
+// numbers and groups of dice, with parentheses for grouping:
+//   NdS     roll N dice with S sides, N defaults to 1 and d% is a d100
+//   khN klN keep the highest or lowest N dice (k is kh)
+//   dhN dlN drop the highest or lowest N dice (d is dl)
+//   rC      reroll dice matching C until they don't, roC rerolls once
+//   !C      roll another die for each die matching C, ! alone explodes on
+//           the highest side
+// Conditions (C) are a number, which the die must equal, or a comparison
+// like <3 or >=5. Keep and drop default to 1 die. For example:
+//   4d6kh3   2d20kl1+5   3d6r1   1d6!   1d20+1d4-1   2*(1d8+3)
+func ParseDice(expr string) (*DiceExpr, error) {
+	p := &diceParser{expr: expr}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiceExpr{expr: expr, root: root}, nil
+}
+
+// String returns the expression as it was given.
+func (de *DiceExpr) String() string {
+	return de.expr
+}
+
+// Roll rolls every die in the expression.
+func (de *DiceExpr) Roll() *Roll {
+	return de.roll(rollSides)
+}
+
+// RollWith rolls every die in the expression using numbers from the given
+// stream.
+func (de *DiceExpr) RollWith(s *RNG) *Roll {
+	return de.roll(s.Roll)
+}
+
+func (de *DiceExpr) roll(die func(sides int) int) *Roll {
+	ctx := &rollContext{
+		roll: &Roll{Expression: de.expr},
+		buf:  new(bytes.Buffer),
+		die:  die,
+	}
+	ctx.roll.Total = de.root.roll(ctx)
+	ctx.roll.Breakdown = ctx.buf.String()
+
+	return ctx.roll
+}
+
+// rollContext collects the dice and breakdown while rolling an expression
+type rollContext struct {
+	roll *Roll
+	buf  *bytes.Buffer
+	die  func(sides int) int
+}
+
+// the nodes of a parsed expression, rolling writes the breakdown and adds any
+// groups of dice to the roll.
+type diceNode interface {
+	roll(ctx *rollContext) int
+}
+
+type numberNode int
+
+func (n numberNode) roll(ctx *rollContext) int {
+	ctx.buf.WriteString(strconv.Itoa(int(n)))
+
+	return int(n)
+}
+
+type negateNode struct {
+	node diceNode
+}
+
+func (n negateNode) roll(ctx *rollContext) int {
+	ctx.buf.WriteRune('-')
+
+	return -n.node.roll(ctx)
+}
+
+type parenNode struct {
+	node diceNode
+}
+
+func (n parenNode) roll(ctx *rollContext) int {
+	ctx.buf.WriteRune('(')
+	val := n.node.roll(ctx)
+	ctx.buf.WriteRune(')')
+
+	return val
+}
+
+type binaryNode struct {
+	op          byte
+	left, right diceNode
+}
+
+func (n binaryNode) roll(ctx *rollContext) int {
+	left := n.left.roll(ctx)
+	ctx.buf.WriteString(" " + string(n.op) + " ")
+	right := n.right.roll(ctx)
+
+	switch n.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	}
+
+	return left * right
+}
+
+// condition a die can match for rerolls and explosions
+type condition struct {
+	op    string
+	value int
+}
+
+func (c condition) matches(val int) bool {
+	switch c.op {
+	case "<":
+		return val < c.value
+	case "<=":
+		return val <= c.value
+	case ">":
+		return val > c.value
+	case ">=":
+		return val >= c.value
+	}
+
+	return val == c.value
+}
+
+// determine if every side of the die matches
+func (c condition) always(sides int) bool {
+	for side := 1; side <= sides; side++ {
+		if !c.matches(side) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type keepKind int
+
+const (
+	keepAll keepKind = iota
+	keepHighest
+	keepLowest
+	dropHighest
+	dropLowest
+)
+
+type diceGroup struct {
+	notation   string
+	count      int
+	sides      int
+	keep       keepKind
+	keepCount  int
+	reroll     *condition
+	rerollOnce bool
+	explode    *condition
+}
+
+func (g *diceGroup) roll(ctx *rollContext) int {
+	dr := &DiceRoll{
+		Notation: g.notation,
+		Sides:    g.sides,
+		Rolls:    make([]Die, 0, g.count),
+	}
+	for i := 0; i < g.count; i++ {
+		for explosions := 0; ; explosions++ {
+			d := g.rollOne(ctx.die)
+			// the last die of a capped explosion doesn't get another roll
+			if explosions == maxRerolls {
+				d.Exploded = false
+			}
+			dr.Rolls = append(dr.Rolls, d)
+			if !d.Exploded {
+				break
+			}
+		}
+	}
+	g.applyKeep(dr.Rolls)
+
+	for _, d := range dr.Rolls {
+		if !d.Dropped {
+			dr.Total += d.Value
+		}
+	}
+	ctx.roll.Dice = append(ctx.roll.Dice, dr)
+	ctx.buf.WriteString(dr.String())
+
+	return dr.Total
+}
+
+// roll a single die, applying rerolls and marking it if it explodes
+func (g *diceGroup) rollOne(die func(sides int) int) Die {
+	d := Die{Value: die(g.sides)}
+	if g.reroll != nil {
+		for i := 0; i < maxRerolls && g.reroll.matches(d.Value); i++ {
+			d.Rerolls = append(d.Rerolls, d.Value)
+			d.Value = die(g.sides)
+			if g.rerollOnce {
+				break
+			}
+		}
+	}
+	d.Exploded = g.explode != nil && g.explode.matches(d.Value)
+
+	return d
+}
+
+// mark the dice that are dropped by keeping or dropping
+func (g *diceGroup) applyKeep(dice []Die) {
+	if g.keep == keepAll {
+		return
+	}
+
+	// indexes of the dice from lowest to highest, ties keep the order rolled
+	order := make([]int, len(dice))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return dice[order[i]].Value < dice[order[j]].Value
+	})
+
+	n := g.keepCount
+	if n > len(dice) {
+		n = len(dice)
+	}
+
+	var dropped []int
+	switch g.keep {
+	case keepHighest:
+		dropped = order[:len(order)-n]
+	case keepLowest:
+		dropped = order[n:]
+	case dropHighest:
+		dropped = order[len(order)-n:]
+	case dropLowest:
+		dropped = order[:n]
+	}
+	for _, i := range dropped {
+		dice[i].Dropped = true
+	}
+}
+
+type diceParser struct {
+	expr  string
+	pos   int
+	total int
+}
+
+// parse the whole expression, reporting the first problem found
+func (p *diceParser) parse() (node diceNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(*DiceError)
+			if !ok {
+				panic(r)
+			}
+			node, err = nil, de
+		}
+	}()
+
+	p.skipSpace()
+	if p.done() {
+		p.fail("expected dice or a number")
+	}
+	node = p.sum()
+	p.skipSpace()
+	if !p.done() {
+		p.fail("unexpected %q", p.expr[p.pos:p.pos+1])
+	}
+
+	return node, nil
+}
+
+func (p *diceParser) fail(format string, args ...interface{}) {
+	panic(&DiceError{
+		Expression: p.expr,
+		Offset:     p.pos,
+		Msg:        fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *diceParser) done() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *diceParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+
+	return p.expr[p.pos]
+}
+
+func (p *diceParser) skipSpace() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// accept the text if it comes next, case insensitive
+func (p *diceParser) accept(text string) bool {
+	end := p.pos + len(text)
+	if end <= len(p.expr) && strings.EqualFold(p.expr[p.pos:end], text) {
+		p.pos = end
+
+		return true
+	}
+
+	return false
+}
+
+func (p *diceParser) sum() diceNode {
+	node := p.product()
+	for {
+		p.skipSpace()
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return node
+		}
+		p.pos++
+		node = binaryNode{op: op, left: node, right: p.product()}
+	}
+}
+
+func (p *diceParser) product() diceNode {
+	node := p.unary()
+	for {
+		p.skipSpace()
+		if p.peek() != '*' {
+			return node
+		}
+		p.pos++
+		node = binaryNode{op: '*', left: node, right: p.unary()}
+	}
+}
+
+func (p *diceParser) unary() diceNode {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '-':
+		p.pos++
+
+		return negateNode{p.unary()}
+	case c == '(':
+		p.pos++
+		node := p.sum()
+		p.skipSpace()
+		if !p.accept(")") {
+			p.fail("expected \")\"")
+		}
+
+		return parenNode{node}
+	case c == 'd' || c == 'D':
+		return p.dice(1, p.pos)
+	case isDigit(c):
+		start := p.pos
+		n := p.number()
+		if c := p.peek(); c == 'd' || c == 'D' {
+			return p.dice(n, start)
+		}
+
+		return numberNode(n)
+	case p.done():
+		p.fail("expected dice or a number but the expression ended")
+	}
+	p.fail("unexpected %q", p.expr[p.pos:p.pos+1])
+
+	return nil
+}
+
+func (p *diceParser) number() int {
+	start := p.pos
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		p.fail("expected a number")
+	}
+
+	digits := p.expr[start:p.pos]
+	n, err := strconv.Atoi(digits)
+	if err != nil || n > maxSides {
+		p.pos = start
+		p.fail("%s is too large", digits)
+	}
+
+	return n
+}
+
+// parse a group of dice, the count has already been read and the d is next
+func (p *diceParser) dice(count, start int) diceNode {
+	if count > maxDice {
+		p.pos = start
+		p.fail("can't roll more than %d dice at once", maxDice)
+	}
+	p.total += count
+	if p.total > maxTotalDice {
+		p.pos = start
+		p.fail("can't roll more than %d dice in one expression", maxTotalDice)
+	}
+
+	p.pos++
+	g := &diceGroup{count: count}
+	sidesAt := p.pos
+	if p.accept("%") {
+		g.sides = 100
+	} else {
+		if !isDigit(p.peek()) {
+			p.fail("expected the number of sides")
+		}
+		g.sides = p.number()
+	}
+	if g.sides < 1 {
+		p.pos = sidesAt
+		p.fail("dice need at least one side")
+	}
+
+	for p.modifier(g) {
+	}
+	g.notation = p.expr[start:p.pos]
+
+	return g
+}
+
+// parse a modifier for the group of dice, returns false if there isn't one
+func (p *diceParser) modifier(g *diceGroup) bool {
+	at := p.pos
+	keep := func(kind keepKind) bool {
+		if g.keep != keepAll {
+			p.pos = at
+			p.fail("dice can only be kept or dropped once")
+		}
+		g.keep = kind
+		g.keepCount = 1
+		if isDigit(p.peek()) {
+			g.keepCount = p.number()
+		}
+
+		return true
+	}
+
+	switch {
+	case p.accept("kh"):
+		return keep(keepHighest)
+	case p.accept("kl"):
+		return keep(keepLowest)
+	case p.accept("k"):
+		return keep(keepHighest)
+	case p.accept("dh"):
+		return keep(dropHighest)
+	case p.accept("dl"):
+		return keep(dropLowest)
+	case p.accept("d"):
+		return keep(dropLowest)
+	case p.accept("ro"), p.accept("r"):
+		if g.reroll != nil {
+			p.pos = at
+			p.fail("dice can only have one reroll")
+		}
+		once := p.pos-at == 2
+		c := p.condition(false, g.sides)
+		if c.always(g.sides) {
+			p.pos = at
+			p.fail("rerolling every side would never stop")
+		}
+		g.reroll = &c
+		g.rerollOnce = once
+
+		return true
+	case p.accept("!"):
+		if g.explode != nil {
+			p.pos = at
+			p.fail("dice can only explode once")
+		}
+		c := p.condition(true, g.sides)
+		if c.always(g.sides) {
+			p.pos = at
+			p.fail("exploding on every side would never stop")
+		}
+		g.explode = &c
+
+		return true
+	}
+
+	return false
+}
+
+// parse a condition, if optional the condition defaults to the highest side
+func (p *diceParser) condition(optional bool, sides int) condition {
+	c := condition{op: "="}
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if p.accept(op) {
+			c.op = op
+
+			break
+		}
+	}
+	if c.op == "=" && optional && !isDigit(p.peek()) {
+		c.value = sides
+
+		return c
+	}
+	c.value = p.number()
+
+	return c
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -21,59 +21,59 @@ var _ = Describe("Die", func() {
 
 	Describe("D2", func() {
 		It("generates a random number", func() {
-			Ω(D2()).Should(Equal(1))
+			Ω(D2()).Should(Equal(2))
 		})
 	})
 
 	Describe("D4", func() {
 		It("generates a random number", func() {
-			Ω(D4()).Should(Equal(3))
+			Ω(D4()).Should(Equal(2))
 		})
 	})
 
 	Describe("D6", func() {
 		It("generates a random number", func() {
-			Ω(D6()).Should(Equal(2))
+			Ω(D6()).Should(Equal(6))
 		})
 	})
 
 	Describe("D8", func() {
 		It("generates a random number", func() {
-			Ω(D8()).Should(Equal(7))
+			Ω(D8()).Should(Equal(2))
 		})
 	})
 
 	Describe("D10", func() {
 		It("generates a random number", func() {
-			Ω(D10()).Should(Equal(6))
+			Ω(D10()).Should(Equal(2))
 		})
 	})
 
 	Describe("D12", func() {
 		It("generates a random number", func() {
-			Ω(D12()).Should(Equal(2))
+			Ω(D12()).Should(Equal(6))
 		})
 	})
 
 	Describe("D20", func() {
 		It("generates a random number", func() {
-			Ω(D20()).Should(Equal(6))
+			Ω(D20()).Should(Equal(2))
 		})
 	})
 
 	Describe("D100", func() {
 		It("generates a random number", func() {
-			Ω(D100()).Should(Equal(24))
+			Ω(D100()).Should(Equal(82))
 		})
 	})
 
 	Describe("RollDie", func() {
 		It("works without specifying a die count", func() {
-			Ω(RollDie("d10")).Should(Equal([]int{6}))
+			Ω(RollDie("d10")).Should(Equal([]int{2}))
 		})
 
 		It("works with a die count", func() {
-			Ω(RollDie("2d20")).Should(Equal([]int{6, 15}))
+			Ω(RollDie("2d20")).Should(Equal([]int{2, 8}))
 		})
 
 		It("returns nothing with an invalid count", func() {
@@ -89,11 +89,149 @@ var _ = Describe("Die", func() {
 		})
 
 		It("generates values within the range specified", func() {
-			ret := RollDie("100000d2")
+			ret := RollDie("1000d2")
+			Ω(ret).Should(HaveLen(1000))
 			for _, n := range ret {
 				Ω(n).Should(BeNumerically(">=", 1))
 				Ω(n).Should(BeNumerically("<=", 2))
 			}
 		})
+
+		It("rolls the highest side", func() {
+			Ω(RollDie("1d2")).Should(Equal([]int{2}))
+		})
+
+		It("leaves out dropped dice", func() {
+			Ω(RollDie("4d6kh3")).Should(Equal([]int{6, 6, 6}))
+		})
+	})
+
+	Describe("RollDice", func() {
+		roll := func(expr string) *Roll {
+			r, err := RollDice(expr)
+			Ω(err).Should(BeNil())
+
+			return r
+		}
+
+		It("rolls dice with any number of sides", func() {
+			r := roll("2d7")
+			Ω(r.Total).Should(Equal(10))
+			Ω(r.Dice).Should(HaveLen(1))
+			Ω(r.Dice[0].Sides).Should(Equal(7))
+			Ω(r.Dice[0].Rolls).Should(Equal([]Die{{Value: 7}, {Value: 3}}))
+		})
+
+		It("treats d% as a d100", func() {
+			Ω(roll("d%").Total).Should(Equal(82))
+		})
+
+		It("applies modifiers", func() {
+			r := roll("3d6+2")
+			Ω(r.Total).Should(Equal(18))
+			Ω(r.Breakdown).Should(Equal("[6, 4, 6] + 2"))
+			Ω(r.String()).Should(Equal("3d6+2: [6, 4, 6] + 2 = 18"))
+		})
+
+		It("adds and subtracts groups of dice", func() {
+			r := roll("1d20 + 1d4 - 1")
+			Ω(r.Total).Should(Equal(5))
+			Ω(r.Breakdown).Should(Equal("[2] + [4] - 1"))
+			Ω(r.Dice).Should(HaveLen(2))
+			Ω(r.Dice[1].Notation).Should(Equal("1d4"))
+		})
+
+		It("multiplies and groups with parentheses", func() {
+			r := roll("2*(1d8+3)")
+			Ω(r.Total).Should(Equal(10))
+			Ω(r.Breakdown).Should(Equal("2 * ([2] + 3)"))
+		})
+
+		It("keeps the highest dice", func() {
+			r := roll("4d6kh3")
+			Ω(r.Total).Should(Equal(18))
+			Ω(r.Breakdown).Should(Equal("[6, ~4~, 6, 6]"))
+		})
+
+		It("keeps the lowest dice", func() {
+			r := roll("2d20kl1")
+			Ω(r.Total).Should(Equal(2))
+			Ω(r.Dice[0].Rolls[1].Dropped).Should(BeTrue())
+		})
+
+		It("drops the lowest dice", func() {
+			Ω(roll("4d6d1").Breakdown).Should(Equal("[6, ~4~, 6, 6]"))
+		})
+
+		It("explodes on the highest side", func() {
+			r := roll("6d6!")
+			Ω(r.Dice[0].Rolls).Should(HaveLen(9))
+			Ω(r.Breakdown).Should(Equal("[6!, 4, 6!, 6!, 2, 1, 2, 3, 5]"))
+			Ω(r.Total).Should(Equal(35))
+		})
+
+		It("explodes on a condition", func() {
+			Ω(roll("6d6!>4").Dice[0].Rolls).Should(HaveLen(10))
+		})
+
+		It("rerolls dice until they don't match", func() {
+			r := roll("8d6r1")
+			for _, d := range r.Dice[0].Rolls {
+				Ω(d.Value).ShouldNot(Equal(1))
+			}
+			Ω(r.Dice[0].Rolls[5].Rerolls).Should(Equal([]int{1}))
+		})
+
+		It("rerolls dice only once", func() {
+			r := roll("8d6ro<3")
+			Ω(r.Dice[0].Rolls[4].Value).Should(Equal(1))
+			Ω(r.Dice[0].Rolls[4].Rerolls).Should(Equal([]int{2}))
+		})
+
+		Context("with an invalid expression", func() {
+			invalid := func(expr string, offset int) {
+				_, err := RollDice(expr)
+				Ω(err).ShouldNot(BeNil())
+				de, ok := err.(*DiceError)
+				Ω(ok).Should(BeTrue())
+				Ω(de.Offset).Should(Equal(offset))
+			}
+
+			It("fails on unexpected input", func() {
+				invalid("1d6 x", 4)
+			})
+
+			It("fails without sides", func() {
+				invalid("3d", 2)
+			})
+
+			It("fails on dice without sides", func() {
+				invalid("1d0", 2)
+			})
+
+			It("fails on unclosed parentheses", func() {
+				invalid("(1d4", 4)
+			})
+
+			It("fails when keeping and dropping more than once", func() {
+				invalid("4d6kh3kl1", 6)
+			})
+
+			It("fails on rerolls that never stop", func() {
+				invalid("1d6r<=6", 3)
+			})
+
+			It("fails on explosions that never stop", func() {
+				invalid("1d1!", 3)
+			})
+
+			It("fails on too many dice", func() {
+				invalid("1001d6", 0)
+			})
+
+			It("fails on too many dice across the expression", func() {
+				invalid("1000d6+1000d6+1000d6+1000d6+1000d6+1000d6", 35)
+			})
+		})
 	})
 })
@@ -0,0 +1,233 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package random
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidState is returned when a saved stream state can't be parsed.
+var ErrInvalidState = errors.New("random: invalid stream state")
+
+var (
+	streamMutex sync.Mutex
+	streams     = make(map[string]*RNG)
+)
+
+// Stream returns the named random number stream, creating it if it doesn't
+// exist yet. New streams are seeded with the current time, Seed them to make
+// their numbers reproducible. Streams let each part of the game, like combat
+// or loot, roll numbers that can be replayed without being thrown off by
+// other parts of the game.
+func Stream(name string) *RNG {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+
+	if s, ok := streams[name]; ok {
+		return s
+	}
+
+	s := NewRNG(name, time.Now().UnixNano())
+	streams[name] = s
+
+	return s
+}
+
+// RestoreStream returns the stream named in the state after restoring it to
+// that state.
+func RestoreStream(state StreamState) *RNG {
+	s := Stream(state.Name)
+	s.Restore(state)
+
+	return s
+}
+
+// StreamState is everything needed to pick a stream back up where it left
+// off. It can be saved as text, "name:seed:state", or JSON.
+type StreamState struct {
+	Name  string
+	Seed  int64
+	State uint64
+}
+
+// ParseStreamState parses state previously returned by StreamState.String.
+func ParseStreamState(str string) (StreamState, error) {
+	var st StreamState
+	err := st.UnmarshalText([]byte(str))
+
+	return st, err
+}
+
+// String returns the state as text.
+func (st StreamState) String() string {
+	return fmt.Sprintf("%s:%d:%x", st.Name, st.Seed, st.State)
+}
+
+// MarshalText returns the state as text.
+func (st StreamState) MarshalText() ([]byte, error) {
+	return []byte(st.String()), nil
+}
+
+// UnmarshalText parses the state from text.
+func (st *StreamState) UnmarshalText(text []byte) error {
+	str := string(text)
+	// the name can contain colons, the numbers can't
+	last := strings.LastIndex(str, ":")
+	if last < 0 {
+		return ErrInvalidState
+	}
+	mid := strings.LastIndex(str[:last], ":")
+	if mid < 0 {
+		return ErrInvalidState
+	}
+
+	seed, err := strconv.ParseInt(str[mid+1:last], 10, 64)
+	if err != nil {
+		return ErrInvalidState
+	}
+	state, err := strconv.ParseUint(str[last+1:], 16, 64)
+	if err != nil {
+		return ErrInvalidState
+	}
+
+	st.Name, st.Seed, st.State = str[:mid], seed, state
+
+	return nil
+}
+
+// RNG is a seedable random number stream whose state can be saved and
+// restored. It's safe for use from multiple goroutines.
+type RNG struct {
+	mutex  sync.Mutex
+	name   string
+	seed   int64
+	source *splitMix
+	rand   *rand.Rand
+}
+
+// NewRNG creates a random number stream with the given seed, it doesn't add
+// it to the named streams returned by Stream.
+func NewRNG(name string, seed int64) *RNG {
+	s := &RNG{
+		name:   name,
+		source: new(splitMix),
+	}
+	s.rand = rand.New(s.source)
+	s.Seed(seed)
+
+	return s
+}
+
+// Name returns the name of the stream.
+func (s *RNG) Name() string {
+	return s.name
+}
+
+// Seed resets the stream, it will produce the same numbers each time it's
+// given the same seed.
+func (s *RNG) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seed = seed
+	s.source.Seed(seed)
+}
+
+// State returns the current state of the stream.
+func (s *RNG) State() StreamState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return StreamState{
+		Name:  s.name,
+		Seed:  s.seed,
+		State: s.source.state,
+	}
+}
+
+// Restore puts the stream back in the given state, the name of the state is
+// ignored.
+func (s *RNG) Restore(state StreamState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seed = state.Seed
+	s.source.state = state.State
+}
+
+// Intn generates a number from 0 up to, but not including, max.
+func (s *RNG) Intn(max int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rand.Intn(max)
+}
+
+// Range generates a number between the min and max values provided.
+func (s *RNG) Range(min, max int) int {
+	return s.Intn(max-min) + min
+}
+
+// Float64 generates a number from 0 up to, but not including, 1.
+func (s *RNG) Float64() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rand.Float64()
+}
+
+// Roll rolls a single die with the given number of sides.
+func (s *RNG) Roll(sides int) int {
+	return s.Intn(sides) + 1
+}
+
+// RollDice parses and rolls the dice expression using the numbers from this
+// stream.
+func (s *RNG) RollDice(expr string) (*Roll, error) {
+	de, err := ParseDice(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return de.RollWith(s), nil
+}
+
+// RollDie behaves like the package level RollDie, using the numbers from this
+// stream.
+func (s *RNG) RollDie(expr string) []int {
+	roll, err := s.RollDice(expr)
+	if err != nil {
+		return make([]int, 0)
+	}
+
+	return roll.Values()
+}
+
+// splitMix is the SplitMix64 generator, unlike the sources in math/rand its
+// entire state is a single number which makes saving it trivial.
+type splitMix struct {
+	state uint64
+}
+
+func (sm *splitMix) Seed(seed int64) {
+	sm.state = uint64(seed)
+}
+
+func (sm *splitMix) Uint64() uint64 {
+	sm.state += 0x9e3779b97f4a7c15
+	z := sm.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
+
+func (sm *splitMix) Int63() int64 {
+	return int64(sm.Uint64() >> 1)
+}
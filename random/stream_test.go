@@ -0,0 +1,117 @@
+package random_test
+
+import (
+	"encoding/json"
+
+	. "github.com/bbuck/dragon-mud/random"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream", func() {
+	// roll a handful of numbers from the stream
+	numbers := func(s *RNG) []int {
+		nums := make([]int, 10)
+		for i := range nums {
+			nums[i] = s.Intn(1000)
+		}
+
+		return nums
+	}
+
+	It("returns the same stream for a name", func() {
+		Ω(Stream("stream test")).Should(BeIdenticalTo(Stream("stream test")))
+		Ω(Stream("stream test").Name()).Should(Equal("stream test"))
+	})
+
+	It("generates the same numbers for the same seed", func() {
+		a, b := NewRNG("a", 42), NewRNG("b", 42)
+		Ω(numbers(a)).Should(Equal(numbers(b)))
+
+		a.Seed(42)
+		b.Seed(7)
+		Ω(numbers(a)).ShouldNot(Equal(numbers(b)))
+	})
+
+	It("isn't affected by other streams", func() {
+		a := NewRNG("a", 42)
+		expected := numbers(a)
+
+		a.Seed(42)
+		other := NewRNG("other", 42)
+		nums := make([]int, 10)
+		for i := range nums {
+			other.Intn(1000)
+			nums[i] = a.Intn(1000)
+		}
+		Ω(nums).Should(Equal(expected))
+	})
+
+	It("generates numbers in range", func() {
+		s := NewRNG("range", 1)
+		for i := 0; i < 10000; i++ {
+			Ω(s.Range(10, 20)).Should(BeNumerically(">=", 10))
+			Ω(s.Range(10, 20)).Should(BeNumerically("<", 20))
+			Ω(s.Roll(6)).Should(BeNumerically(">=", 1))
+			Ω(s.Roll(6)).Should(BeNumerically("<=", 6))
+			Ω(s.Float64()).Should(BeNumerically("<", 1))
+		}
+	})
+
+	It("rolls dice predictably", func() {
+		s := NewRNG("dice", 42)
+		first, err := s.RollDice("4d6kh3+2")
+		Ω(err).Should(BeNil())
+
+		s.Seed(42)
+		second, err := s.RollDice("4d6kh3+2")
+		Ω(err).Should(BeNil())
+		Ω(second).Should(Equal(first))
+
+		s.Seed(42)
+		Ω(s.RollDie("4d6kh3")).Should(Equal(first.Values()))
+		Ω(s.RollDie("4d")).Should(Equal([]int{}))
+	})
+
+	Describe("State", func() {
+		It("picks up where the stream left off", func() {
+			s := NewRNG("saved", 42)
+			numbers(s)
+			state := s.State()
+			expected := numbers(s)
+
+			s.Restore(state)
+			Ω(numbers(s)).Should(Equal(expected))
+		})
+
+		It("restores named streams from text", func() {
+			s := Stream("saved:stream")
+			s.Seed(3)
+			state := s.State()
+			expected := numbers(s)
+
+			parsed, err := ParseStreamState(state.String())
+			Ω(err).Should(BeNil())
+			Ω(parsed).Should(Equal(state))
+			Ω(numbers(RestoreStream(parsed))).Should(Equal(expected))
+		})
+
+		It("can be saved as JSON", func() {
+			state := NewRNG("json", 9).State()
+			b, err := json.Marshal(state)
+			Ω(err).Should(BeNil())
+
+			var loaded StreamState
+			Ω(json.Unmarshal(b, &loaded)).Should(BeNil())
+			Ω(loaded).Should(Equal(state))
+		})
+
+		It("fails on invalid state", func() {
+			for _, str := range []string{"", "name", "name:1", "name:x:1", "name:1:xyz"} {
+				_, err := ParseStreamState(str)
+				Ω(err).Should(Equal(ErrInvalidState))
+			}
+		})
+	})
+})
@@ -0,0 +1,556 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package random
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// ErrTableNotFound is returned when rolling on a table that hasn't been
+// defined.
+var ErrTableNotFound = errors.New("random: table not found")
+
+// tables can reference tables that reference them, this keeps a loop from
+// rolling forever.
+const maxTableDepth = 32
+
+// Tables holds every table defined by the game and it's plugins.
+var Tables = NewTableSet()
+
+// DefineTable adds the table to Tables, replacing any table with the same
+// name.
+func DefineTable(t *Table) error {
+	return Tables.Define(t)
+}
+
+// GetTable fetches the named table from Tables.
+func GetTable(name string) (*Table, bool) {
+	return Tables.Get(name)
+}
+
+// WeightedChoice picks an index from the weights, the chance of an index
+// being picked is it's weight out of the total of all weights. Weights less
+// than 1 are never picked, if none of the weights can be picked -1 is
+// returned.
+func WeightedChoice(weights []int) int {
+	return weightedChoice(Intn, weights)
+}
+
+// WeightedChoice is the same as the package level WeightedChoice using
+// numbers from this stream.
+func (s *RNG) WeightedChoice(weights []int) int {
+	return weightedChoice(s.Intn, weights)
+}
+
+func weightedChoice(intn func(int) int, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+
+	n := intn(total)
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+
+	return -1
+}
+
+// TableContext is the information available to the conditions on entries,
+// such as the level of the player or the current season.
+type TableContext map[string]interface{}
+
+// Conditions restrict when an entry can be picked, every key must match the
+// value in the context. Values can be:
+//   a string or number, the context must have the same value
+//   a list of values, the context must have one of them
+//   a comparison like ">= 5" or "!= winter", numbers are compared as numbers
+type Conditions map[string]interface{}
+
+// Allows determines if every condition is met by the context.
+func (c Conditions) Allows(ctx TableContext) bool {
+	for key, want := range c {
+		have, ok := ctx[key]
+		if !matchCondition(want, have, ok) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var comparisons = []string{">=", "<=", "!=", ">", "<", "="}
+
+// validate the conditions, ensuring every comparison can be understood.
+func (c Conditions) validate() error {
+	for key, want := range c {
+		str, ok := want.(string)
+		if !ok {
+			continue
+		}
+		op, operand := splitComparison(str)
+		if op == "" || op == "=" || op == "!=" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(operand, 64); err != nil {
+			return fmt.Errorf("condition %q compares %q which isn't a number", key, operand)
+		}
+	}
+
+	return nil
+}
+
+func matchCondition(want, have interface{}, present bool) bool {
+	if list, ok := want.([]interface{}); ok {
+		for _, w := range list {
+			if matchCondition(w, have, present) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	str, ok := want.(string)
+	if !ok {
+		return present && sameValue(want, have)
+	}
+
+	op, operand := splitComparison(str)
+	switch op {
+	case "":
+		return present && sameValue(str, have)
+	case "=":
+		return present && sameValue(operand, have)
+	case "!=":
+		return !present || !sameValue(operand, have)
+	}
+
+	num, ok := toFloat(have)
+	if !present || !ok {
+		return false
+	}
+	val, _ := strconv.ParseFloat(operand, 64)
+	switch op {
+	case ">=":
+		return num >= val
+	case "<=":
+		return num <= val
+	case ">":
+		return num > val
+	}
+
+	return num < val
+}
+
+// split a string like ">= 5" into it's comparison and operand
+func splitComparison(str string) (string, string) {
+	for _, op := range comparisons {
+		if strings.HasPrefix(str, op) {
+			return op, strings.TrimSpace(str[len(op):])
+		}
+	}
+
+	return "", str
+}
+
+// compare values, numbers are equal regardless of their type and strings
+// equal numbers they represent
+func sameValue(a, b interface{}) bool {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return af == bf
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(i interface{}) (float64, bool) {
+	switch n := i.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// Entry is one of the possible results of rolling on a table. Entries
+// either produce a Value or roll on another Table. Count is a dice expression
+// for how many of the value are produced, or how many times the other table
+// is rolled on, it defaults to 1.
+type Entry struct {
+	Weight int         `mapstructure:"weight"`
+	Value  interface{} `mapstructure:"value"`
+	Table  string      `mapstructure:"table"`
+	Count  string      `mapstructure:"count"`
+	When   Conditions  `mapstructure:"when"`
+
+	count *DiceExpr
+}
+
+// Table is a set of weighted entries. Rolling on a table picks entries by
+// their weight, if the table is Unique an entry is only picked once per roll.
+type Table struct {
+	Name    string   `mapstructure:"name"`
+	Unique  bool     `mapstructure:"unique"`
+	Entries []*Entry `mapstructure:"entries"`
+
+	set *TableSet
+}
+
+// Pick is a value produced by rolling on a table, Table is the name of the
+// table the entry belonged to which may be a table referenced by the table
+// rolled on.
+type Pick struct {
+	Value interface{}
+	Count int
+	Table string
+}
+
+// Roll rolls on the table n times, picking entries allowed by the context.
+// Nested tables are rolled on as they're picked. Unique tables can return
+// fewer than n picks if they run out of entries.
+func (t *Table) Roll(n int, ctx TableContext) ([]Pick, error) {
+	return t.roll(Intn, n, ctx, 0)
+}
+
+// RollWith is the same as Roll using numbers from the given stream.
+func (t *Table) RollWith(s *RNG, n int, ctx TableContext) ([]Pick, error) {
+	return t.roll(s.Intn, n, ctx, 0)
+}
+
+func (t *Table) roll(intn func(int) int, n int, ctx TableContext, depth int) ([]Pick, error) {
+	if depth >= maxTableDepth {
+		return nil, fmt.Errorf("random: table %q nests too deeply, it may reference itself", t.Name)
+	}
+
+	var available []*Entry
+	for _, e := range t.Entries {
+		if e.When.Allows(ctx) {
+			available = append(available, e)
+		}
+	}
+
+	picks := make([]Pick, 0, n)
+	for i := 0; i < n; i++ {
+		weights := make([]int, len(available))
+		for j, e := range available {
+			weights[j] = e.Weight
+		}
+		idx := weightedChoice(intn, weights)
+		if idx < 0 {
+			break
+		}
+
+		e := available[idx]
+		if t.Unique {
+			available = append(available[:idx], available[idx+1:]...)
+		}
+
+		count := 1
+		if e.count != nil {
+			count = e.count.roll(func(sides int) int {
+				return intn(sides) + 1
+			}).Total
+		}
+		if count < 1 {
+			continue
+		}
+
+		if e.Table == "" {
+			picks = append(picks, Pick{Value: e.Value, Count: count, Table: t.Name})
+
+			continue
+		}
+
+		nested, ok := t.set.Get(e.Table)
+		if !ok {
+			return nil, fmt.Errorf("random: table %q references unknown table %q", t.Name, e.Table)
+		}
+		more, err := nested.roll(intn, count, ctx, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		picks = append(picks, more...)
+	}
+
+	return picks, nil
+}
+
+// prepare the entries for rolling, reporting any that are invalid
+func (t *Table) compile() error {
+	if t.Name == "" {
+		return errors.New("random: tables must have a name")
+	}
+
+	for i, e := range t.Entries {
+		fail := func(msg string) error {
+			return fmt.Errorf("random: table %q entry %d %s", t.Name, i+1, msg)
+		}
+
+		if e.Value == nil && e.Table == "" {
+			return fail("needs a value or a table")
+		}
+		if e.Value != nil && e.Table != "" {
+			return fail("can't have both a value and a table")
+		}
+		if e.Count != "" {
+			de, err := ParseDice(e.Count)
+			if err != nil {
+				return fail(err.Error())
+			}
+			e.count = de
+		}
+		if err := e.When.validate(); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	return nil
+}
+
+// TableSet is a collection of tables that can reference each other by name,
+// names are case insensitive.
+type TableSet struct {
+	mutex  sync.RWMutex
+	tables map[string]*Table
+}
+
+// NewTableSet creates an empty set of tables.
+func NewTableSet() *TableSet {
+	return &TableSet{
+		tables: make(map[string]*Table),
+	}
+}
+
+// Define adds the table to the set, replacing any table with the same name.
+// Entries are checked when they're defined, referenced tables don't have to
+// be defined until the table is rolled on.
+func (ts *TableSet) Define(t *Table) error {
+	if err := t.compile(); err != nil {
+		return err
+	}
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	t.set = ts
+	ts.tables[strings.ToLower(t.Name)] = t
+
+	return nil
+}
+
+// Get fetches the named table.
+func (ts *TableSet) Get(name string) (*Table, bool) {
+	if ts == nil {
+		return nil, false
+	}
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	t, ok := ts.tables[strings.ToLower(name)]
+
+	return t, ok
+}
+
+// Names returns the names of every table in the set, sorted.
+func (ts *TableSet) Names() []string {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	names := make([]string, 0, len(ts.tables))
+	for _, t := range ts.tables {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Roll rolls on the named table, see Table.Roll.
+func (ts *TableSet) Roll(name string, n int, ctx TableContext) ([]Pick, error) {
+	t, ok := ts.Get(name)
+	if !ok {
+		return nil, ErrTableNotFound
+	}
+
+	return t.Roll(n, ctx)
+}
+
+// Load reads table definitions from TOML, each table is keyed by it's name.
+//   [goblin_loot]
+//   unique = true
+//
+//     [[goblin_loot.entries]]
+//     value = "rusty dagger"
+//     weight = 10
+//
+//     [[goblin_loot.entries]]
+//     value = "gold"
+//     count = "2d6"
+//     weight = 5
+//
+//     [[goblin_loot.entries]]
+//     table = "gems"
+//     when = { level = ">= 5" }
+// Weights default to 1. Keys are read case insensitively, so table names and
+// the keys of any tables given as values are lowercased.
+func (ts *TableSet) Load(r io.Reader) error {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(r); err != nil {
+		return fmt.Errorf("random: failed to read tables: %s", err)
+	}
+
+	defs := v.AllSettings()
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t, err := DecodeTable(name, defs[name])
+		if err != nil {
+			return err
+		}
+		if err := ts.Define(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadFile loads the tables defined in the TOML file.
+func (ts *TableSet) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := ts.Load(f); err != nil {
+		return fmt.Errorf("%s (%s)", err, path)
+	}
+
+	return nil
+}
+
+// DecodeTable builds a table from a generic definition, like those read from
+// TOML or a Lua table. Entries without a weight are given a weight of 1 and
+// numeric counts are treated as dice expressions, so 3 is the same as "3".
+func DecodeTable(name string, def interface{}) (*Table, error) {
+	t := &Table{Name: name}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           t,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(def); err != nil {
+		return nil, fmt.Errorf("random: invalid table %q: %s", name, err)
+	}
+	t.Name = name
+
+	// mapstructure leaves the weight at zero when it's not given
+	if defs, ok := entryDefs(def); ok {
+		for i, e := range t.Entries {
+			if i < len(defs) && !hasKey(defs[i], "weight") {
+				e.Weight = 1
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// fetch the generic entry definitions from a table definition
+func entryDefs(def interface{}) ([]interface{}, bool) {
+	entries, ok := mapIndex(def, "entries")
+	if !ok {
+		return nil, false
+	}
+	list := reflect.ValueOf(entries)
+	if list.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	defs := make([]interface{}, list.Len())
+	for i := range defs {
+		defs[i] = list.Index(i).Interface()
+	}
+
+	return defs, true
+}
+
+func hasKey(def interface{}, key string) bool {
+	_, ok := mapIndex(def, key)
+
+	return ok
+}
+
+// fetch the key from any map with string keys
+func mapIndex(def interface{}, key string) (interface{}, bool) {
+	m := reflect.ValueOf(def)
+	if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	val := m.MapIndex(reflect.ValueOf(key).Convert(m.Type().Key()))
+	if !val.IsValid() {
+		return nil, false
+	}
+
+	return val.Interface(), true
+}
@@ -0,0 +1,234 @@
+package random_test
+
+import (
+	"strings"
+
+	. "github.com/bbuck/dragon-mud/random"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Table", func() {
+	var (
+		tables *TableSet
+		rng    *RNG
+	)
+
+	define := func(t *Table) *Table {
+		Ω(tables.Define(t)).Should(BeNil())
+
+		return t
+	}
+
+	values := func(picks []Pick) []interface{} {
+		vals := make([]interface{}, len(picks))
+		for i, p := range picks {
+			vals[i] = p.Value
+		}
+
+		return vals
+	}
+
+	BeforeEach(func() {
+		tables = NewTableSet()
+		rng = NewRNG("table test", 1)
+	})
+
+	Describe("WeightedChoice", func() {
+		It("picks by weight", func() {
+			counts := make([]int, 3)
+			for i := 0; i < 10000; i++ {
+				counts[rng.WeightedChoice([]int{0, 1, 3})]++
+			}
+			Ω(counts[0]).Should(Equal(0))
+			Ω(counts[2]).Should(BeNumerically(">", counts[1]*2))
+		})
+
+		It("returns -1 when nothing can be picked", func() {
+			Ω(WeightedChoice(nil)).Should(Equal(-1))
+			Ω(WeightedChoice([]int{0, -1})).Should(Equal(-1))
+		})
+	})
+
+	It("rolls the same picks for the same seed", func() {
+		t := define(&Table{Name: "colors", Entries: []*Entry{
+			{Weight: 1, Value: "red"},
+			{Weight: 2, Value: "green"},
+			{Weight: 3, Value: "blue"},
+		}})
+
+		first, err := t.RollWith(rng, 10, nil)
+		Ω(err).Should(BeNil())
+		Ω(first).Should(HaveLen(10))
+
+		rng.Seed(1)
+		second, err := t.RollWith(rng, 10, nil)
+		Ω(err).Should(BeNil())
+		Ω(second).Should(Equal(first))
+	})
+
+	It("picks entries once from unique tables", func() {
+		t := define(&Table{Name: "unique", Unique: true, Entries: []*Entry{
+			{Weight: 1, Value: "a"},
+			{Weight: 1, Value: "b"},
+			{Weight: 1, Value: "c"},
+		}})
+
+		picks, err := t.RollWith(rng, 5, nil)
+		Ω(err).Should(BeNil())
+		Ω(values(picks)).Should(ConsistOf("a", "b", "c"))
+	})
+
+	It("rolls the count of each entry", func() {
+		t := define(&Table{Name: "gold", Entries: []*Entry{
+			{Weight: 1, Value: "gold", Count: "3d1+2"},
+		}})
+
+		picks, err := t.Roll(1, nil)
+		Ω(err).Should(BeNil())
+		Ω(picks).Should(Equal([]Pick{{Value: "gold", Count: 5, Table: "gold"}}))
+	})
+
+	It("rolls on nested tables", func() {
+		define(&Table{Name: "gems", Entries: []*Entry{
+			{Weight: 1, Value: "ruby"},
+		}})
+		t := define(&Table{Name: "hoard", Entries: []*Entry{
+			{Weight: 1, Table: "GEMS", Count: "2"},
+		}})
+
+		picks, err := t.Roll(1, nil)
+		Ω(err).Should(BeNil())
+		Ω(picks).Should(Equal([]Pick{
+			{Value: "ruby", Count: 1, Table: "gems"},
+			{Value: "ruby", Count: 1, Table: "gems"},
+		}))
+	})
+
+	It("fails on unknown nested tables", func() {
+		t := define(&Table{Name: "broken", Entries: []*Entry{
+			{Weight: 1, Table: "missing"},
+		}})
+
+		_, err := t.Roll(1, nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring(`unknown table "missing"`))
+	})
+
+	It("fails on tables that reference themselves", func() {
+		t := define(&Table{Name: "loop", Entries: []*Entry{
+			{Weight: 1, Table: "loop"},
+		}})
+
+		_, err := t.Roll(1, nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("nests too deeply"))
+	})
+
+	Describe("conditions", func() {
+		var t *Table
+
+		BeforeEach(func() {
+			t = define(&Table{Name: "encounters", Unique: true, Entries: []*Entry{
+				{Weight: 1, Value: "rat"},
+				{Weight: 1, Value: "dragon", When: Conditions{"level": ">= 10"}},
+				{Weight: 1, Value: "wolf", When: Conditions{"season": []interface{}{"winter", "fall"}}},
+				{Weight: 1, Value: "bee", When: Conditions{"season": "!= winter"}},
+				{Weight: 1, Value: "ghost", When: Conditions{"night": true}},
+			}})
+		})
+
+		roll := func(ctx TableContext) []interface{} {
+			picks, err := t.RollWith(rng, 5, ctx)
+			Ω(err).Should(BeNil())
+
+			return values(picks)
+		}
+
+		It("leaves out entries that aren't allowed", func() {
+			Ω(roll(nil)).Should(ConsistOf("rat", "bee"))
+		})
+
+		It("includes entries that are allowed", func() {
+			ctx := TableContext{"level": 12, "season": "winter", "night": true}
+			Ω(roll(ctx)).Should(ConsistOf("rat", "dragon", "wolf", "ghost"))
+		})
+
+		It("compares numbers regardless of type", func() {
+			Ω(roll(TableContext{"level": 10.0})).Should(ContainElement("dragon"))
+			Ω(roll(TableContext{"level": int64(9)})).ShouldNot(ContainElement("dragon"))
+		})
+	})
+
+	Describe("Define", func() {
+		It("requires a value or a table", func() {
+			err := tables.Define(&Table{Name: "bad", Entries: []*Entry{{Weight: 1}}})
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("requires valid counts", func() {
+			err := tables.Define(&Table{Name: "bad", Entries: []*Entry{{Value: 1, Count: "2d"}}})
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("requires comparisons to be numbers", func() {
+			err := tables.Define(&Table{Name: "bad", Entries: []*Entry{
+				{Value: 1, When: Conditions{"level": ">= high"}},
+			}})
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("Load", func() {
+		It("defines tables from TOML", func() {
+			err := tables.Load(strings.NewReader(`
+				[Goblin_Loot]
+				unique = true
+
+				[[Goblin_Loot.entries]]
+				value = "dagger"
+
+				[[Goblin_Loot.entries]]
+				value = "gold"
+				count = "2d1"
+				weight = 3
+
+				[[Goblin_Loot.entries]]
+				table = "gems"
+				when = { level = ">= 5" }
+
+				[gems]
+				[[gems.entries]]
+				value = "ruby"
+			`))
+			Ω(err).Should(BeNil())
+			Ω(tables.Names()).Should(Equal([]string{"gems", "goblin_loot"}))
+
+			t, ok := tables.Get("goblin_loot")
+			Ω(ok).Should(BeTrue())
+			Ω(t.Unique).Should(BeTrue())
+			Ω(t.Entries).Should(HaveLen(3))
+			Ω(t.Entries[0].Weight).Should(Equal(1))
+			Ω(t.Entries[1].Weight).Should(Equal(3))
+
+			picks, err := tables.Roll("Goblin_Loot", 3, TableContext{"level": 5})
+			Ω(err).Should(BeNil())
+			Ω(values(picks)).Should(ConsistOf("dagger", "gold", "ruby"))
+		})
+
+		It("reports invalid tables", func() {
+			err := tables.Load(strings.NewReader(`
+				[bad]
+				[[bad.entries]]
+				weight = 2
+			`))
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+
+	It("fails to roll on undefined tables", func() {
+		_, err := tables.Roll("missing", 1, nil)
+		Ω(err).Should(Equal(ErrTableNotFound))
+	})
+})
@@ -0,0 +1,36 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package scripting
+
+import "github.com/bbuck/dragon-mud/scripting/lua"
+
+// MemoryReport describes the memory held by a freshly built engine of the
+// given security level, after all plugin code for that level has been loaded.
+type MemoryReport struct {
+	Level     SecurityLevel
+	Limit     uint64
+	Usage     lua.MemoryStats
+	Consumers []lua.MemoryConsumer
+}
+
+// ReportMemory builds an engine for the security level and reports the top n
+// globals and modules holding memory in it, allowing builders to find plugins
+// that are using more than their share.
+func ReportMemory(sl SecurityLevel, n int) MemoryReport {
+	InitializeEmitters()
+
+	// engines are built in a pool since plugin code binding events expects the
+	// engine to belong to one.
+	pool := lua.NewEnginePool(1, sl.Mutator())
+	defer pool.Shutdown()
+
+	eng := pool.Get()
+	defer eng.Release()
+
+	return MemoryReport{
+		Level:     sl,
+		Limit:     sl.Profile().MemoryLimit,
+		Usage:     eng.MemoryUsage(),
+		Consumers: eng.MemoryConsumers(n),
+	}
+}
@@ -2,14 +2,19 @@ package scripting
 
 import (
 	"fmt"
-	"math"
 	"sync/atomic"
 
+	"github.com/bbuck/dragon-mud/channels"
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/entity"
 	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/inventory"
 	"github.com/bbuck/dragon-mud/logger"
 	"github.com/bbuck/dragon-mud/plugins"
 	"github.com/bbuck/dragon-mud/scripting/keys"
 	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/session"
+	"github.com/bbuck/dragon-mud/world"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/viper"
 )
@@ -31,25 +36,108 @@ var (
 	// entity pool in the game (potentially a large number of entities).
 	EntityEmitter *events.Emitter
 
+	// Entities runs the scripts attached to things in the world.
+	Entities *EntityScripts
+
+	// Channels sends text between players, through the online sessions.
+	Channels *channels.Service
+
 	serverID uint64 = 1
+	entityID uint64 = 1
 )
 
 // Initialize sets up the engine tools, creating emitters and various engine
-// pools.
+// pools. Events from the entity cache, the world, it's inventory and channels
+// are passed along to the server engines.
 func Initialize() {
-	ServerEmitter = events.NewEmitter(logger.NewWithSource("emitter(server)"))
-	ClientEmitter = events.NewEmitter(logger.NewWithSource("emitter(client)"))
-	EntityEmitter = events.NewEmitter(logger.NewWithSource("emitter(entity)"))
+	InitializeEmitters()
+
+	if c := data.EntityCache(); c != nil {
+		for _, evt := range entity.CacheEvents {
+			c.On(evt, forwardToServer(evt))
+		}
+	}
 
-	size := viper.GetInt("scripting.server.engine_pool_size")
-	if size < 0 {
-		size = 0
+	if w, err := data.World(); err == nil {
+		for _, evt := range world.Events {
+			w.On(evt, forwardToServer(evt))
+		}
+		Entities = NewEntityScripts(w, EntityScriptsConfig{
+			Engines: viper.GetInt("scripting.entity.engines"),
+		})
+		Channels = channels.New(w, session.Online)
+		for _, evt := range channels.Events {
+			Channels.On(evt, forwardToServer(evt))
+		}
+	} else {
+		logger.NewWithSource("scripting").WithError(err).Error("Failed to load the world, world events won't reach scripts.")
 	}
-	if size > int(math.MaxUint8) {
-		size = int(math.MaxUint8)
+
+	if inv, err := data.Inventory(); err == nil {
+		for _, evt := range inventory.Events {
+			inv.On(evt, forwardToServer(evt))
+			inv.On("before:"+evt, askItemScript(evt))
+		}
+	}
+
+	ServerPool = lua.NewEnginePoolWithConfig(lua.EnginePoolConfig{
+		MinSize:     viper.GetInt("scripting.server.engine_pool_min_size"),
+		MaxSize:     viper.GetInt("scripting.server.engine_pool_size"),
+		IdleTimeout: viper.GetDuration("scripting.server.engine_pool_idle_timeout"),
+		Mutator:     ServerEngineMutator,
+	})
+}
+
+// emit the event to the server engines when it's fired elsewhere
+func forwardToServer(evt string) events.Handler {
+	return events.HandlerFunc(func(d events.Data) error {
+		ServerEmitter.Emit(evt, d)
+
+		return nil
+	})
+}
+
+// items with scripts can refuse to be moved, an item's on_before_item_drop
+// returning false keeps it from being dropped
+func askItemScript(evt string) events.Handler {
+	return events.HandlerFunc(func(d events.Data) error {
+		item, _ := d["item"].(string)
+		if Entities == nil || item == "" {
+			return nil
+		}
+
+		if _, ok := d[events.CallerKey]; ok {
+			d = d.Clone()
+			delete(d, events.CallerKey)
+		}
+
+		ok, err := Entities.Trigger(item, "before:"+evt, d)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return events.ErrHalt
+		}
+
+		return nil
+	})
+}
+
+// InitializeEmitters creates the emitters for each security level, if they
+// have not already been created. Engines built outside of the server (such as
+// those for the console) only need the emitters and not the pools.
+func InitializeEmitters() {
+	if ServerEmitter == nil {
+		ServerEmitter = events.NewEmitter(logger.NewWithSource("emitter(server)"))
+	}
+
+	if ClientEmitter == nil {
+		ClientEmitter = events.NewEmitter(logger.NewWithSource("emitter(client)"))
+	}
+
+	if EntityEmitter == nil {
+		EntityEmitter = events.NewEmitter(logger.NewWithSource("emitter(entity)"))
 	}
-	usize := uint8(size)
-	ServerPool = lua.NewEnginePool(usize, ServerEngineMutator)
 }
 
 // GlobalEmit will emit to all tiers of engines, primarily used for tick
@@ -63,23 +151,10 @@ func GlobalEmit(evt string, data events.Data) {
 // ServerEngineMutator is a mutator function for the server EnginePool to use
 // to "build" a server engine.
 func ServerEngineMutator(eng *lua.Engine) {
-	id := atomic.LoadUint64(&serverID)
-	atomic.AddUint64(&serverID, 1)
+	id := atomic.AddUint64(&serverID, 1) - 1
 	engineID := fmt.Sprintf("server_engine(%d)", id)
-	eng.Meta[keys.EngineID] = engineID
-	eng.Meta[keys.ExternalEmitter] = ServerEmitter
-
-	eng.SecureRequire(plugins.GetScriptLoadPaths())
-	OpenLibs(eng, "*")
-
-	eng.SetGlobal("global_emit", GlobalEmit)
-	log := logger.NewWithSource(engineID)
-	eng.SetGlobal("print", log.Info)
 
-	err := plugins.LoadServer(eng)
-	if err != nil {
-		eng.RaiseError(err.Error())
-	}
+	prepareEngine(eng, ServerLevel, engineID, ServerEmitter, plugins.LoadServer)
 }
 
 // ClientEngineMutator is a mutator function for the client EnginePool to use
@@ -87,18 +162,91 @@ func ServerEngineMutator(eng *lua.Engine) {
 func ClientEngineMutator(eng *lua.Engine) {
 	id := uuid.NewV1().String()
 	engineID := fmt.Sprintf("client_engine(%s)", id)
+
+	prepareEngine(eng, ClientLevel, engineID, ClientEmitter, plugins.LoadClient)
+}
+
+// EntityEngineMutator is a mutator function for entity engines, these are the
+// most restricted engines in the game and are attached to things that exist
+// in the world (NPCs, items, etc...).
+func EntityEngineMutator(eng *lua.Engine) {
+	id := atomic.AddUint64(&entityID, 1) - 1
+	engineID := fmt.Sprintf("entity_engine(%d)", id)
+
+	prepareEngine(eng, EntityLevel, engineID, EntityEmitter, plugins.LoadEntity)
+}
+
+// perform the setup common to all engines, regardless of security level. The
+// plugin code is loaded before execution limits are applied so that large
+// plugins aren't killed while they're being loaded.
+func prepareEngine(eng *lua.Engine, sl SecurityLevel, engineID string, emitter *events.Emitter, load func(*lua.Engine) error) {
+	profile := sl.Profile()
+
 	eng.Meta[keys.EngineID] = engineID
-	eng.Meta[keys.ExternalEmitter] = ClientEmitter
+	eng.Meta[keys.ExternalEmitter] = emitter
+	eng.Meta[keys.SecurityLevel] = sl
+	if Entities != nil {
+		eng.Meta[keys.EntityScripts] = Entities
+	}
+	if Channels != nil {
+		eng.Meta[keys.Channels] = Channels
+	}
 
 	eng.SecureRequire(plugins.GetScriptLoadPaths())
-	OpenLibs(eng, "*")
+	profile.Apply(eng)
+	eng.OnLimitExceeded(handleLimitExceeded)
 
 	eng.SetGlobal("global_emit", GlobalEmit)
 	log := logger.NewWithSource(engineID)
 	eng.SetGlobal("print", log.Info)
 
-	err := plugins.LoadClient(eng)
+	err := load(eng)
 	if err != nil {
 		eng.RaiseError(err.Error())
 	}
+
+	// an engine that starts out over it's memory limit would fail every call
+	// (and be replaced by another just like it), so the limit is dropped
+	limits := profile.Limits()
+	if limits.Memory > 0 {
+		if usage := eng.MemoryUsage().Total(); usage > limits.Memory {
+			log.WithFields(logger.Fields{
+				"level":        sl.String(),
+				"memory":       usage,
+				"memory_limit": limits.Memory,
+			}).Error("Engine uses more memory than it's limit once plugins are loaded, the memory limit won't be enforced.")
+			limits.Memory = 0
+		}
+	}
+	eng.SetExecutionLimits(limits)
+}
+
+// handleLimitExceeded logs scripts that were killed for running past their
+// budget and notifies the server so plugins can react to runaway scripts. Memory
+// limits emit "script:memory_limit" instead of "script:timeout".
+func handleLimitExceeded(eng *lua.Engine, lerr *lua.LimitError) {
+	engineID, _ := eng.Meta[keys.EngineID].(string)
+	level, _ := eng.Meta[keys.SecurityLevel].(SecurityLevel)
+
+	fields := logger.Fields{
+		"level":       level.String(),
+		"reason":      lerr.Reason.Error(),
+		"stack_trace": lerr.StackTrace,
+	}
+	evt := "script:timeout"
+	if lerr.Reason == lua.ErrMemoryLimit {
+		evt = "script:memory_limit"
+		fields["memory"] = eng.LastMemoryUsage().Total()
+	}
+
+	logger.NewWithSource(engineID).WithFields(fields).Error("Script exceeded it's execution budget and was stopped.")
+
+	if ServerEmitter != nil {
+		ServerEmitter.Emit(evt, events.Data{
+			"engine":      engineID,
+			"level":       level.String(),
+			"reason":      lerr.Reason.Error(),
+			"stack_trace": lerr.StackTrace,
+		})
+	}
 }
@@ -0,0 +1,300 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package scripting
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/plugins"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// ScriptProperty is the property of a node in the world naming the script
+// attached to it. Prototypes can have scripts, what's spawned from them gets
+// the same script.
+const ScriptProperty = "script"
+
+// EntityScriptsConfig controls how entity scripts are run.
+//   Engines is the number of entity engines the scripts share, defaults to 1.
+//   Mutator builds the engines, defaults to EntityEngineMutator.
+//   Load compiles the named script, defaults to compiling the file
+//     plugins.FindScript finds for it.
+type EntityScriptsConfig struct {
+	Engines int
+	Mutator lua.EngineMutator
+	Load    func(name string) (*lua.Chunk, error)
+}
+
+// EntityScripts runs the scripts attached to things in the world, such as an
+// NPC's on_greet or an item's on_wear. There can be thousands of them, so
+// rather than an engine each, entities share a few entity level engines and
+// each runs it's script in it's own environment. Globals a script sets belong
+// to the entity it's running for, and `self` is a table with the entity's id
+// and script. Scripts are compiled once and environments are only built the
+// first time an entity is sent an event.
+type EntityScripts struct {
+	world  *world.World
+	config EntityScriptsConfig
+
+	chunkMutex sync.Mutex
+	chunks     map[string]*lua.Chunk
+
+	shards []*scriptShard
+}
+
+// a shared engine and the environments of the entities using it
+type scriptShard struct {
+	mutex  sync.Mutex
+	engine *lua.Engine
+	envs   map[string]*lua.Value
+}
+
+// NewEntityScripts creates the entity script engines for the world, NPCs in
+// the room an entity moves into are sent "greet".
+func NewEntityScripts(w *world.World, config EntityScriptsConfig) *EntityScripts {
+	if config.Engines < 1 {
+		config.Engines = 1
+	}
+	if config.Mutator == nil {
+		config.Mutator = EntityEngineMutator
+	}
+	if config.Load == nil {
+		config.Load = loadScriptFile
+	}
+
+	es := &EntityScripts{
+		world:  w,
+		config: config,
+		chunks: make(map[string]*lua.Chunk),
+		shards: make([]*scriptShard, config.Engines),
+	}
+	for i := range es.shards {
+		es.shards[i] = &scriptShard{envs: make(map[string]*lua.Value)}
+	}
+	w.On(world.EvtMoved, events.HandlerFunc(es.greet))
+
+	return es
+}
+
+// Trigger sends the event to the entity's script, calling it's on_<event>
+// handler with the data (names are snake cased, so "item:wear" calls
+// on_item_wear). It returns false if the handler returned false, which
+// callers can take as the entity refusing, and true otherwise, including
+// when the entity has no script or handler.
+func (es *EntityScripts) Trigger(entity, evt string, data events.Data) (bool, error) {
+	script, err := es.scriptFor(entity)
+	if err != nil || script == "" {
+		return true, err
+	}
+
+	shard := es.shardFor(entity)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if shard.engine == nil {
+		shard.engine = lua.NewEngine(lua.EngineOptions{
+			FieldNaming:  lua.SnakeCaseNames,
+			MethodNaming: lua.SnakeCaseNames,
+		})
+		es.config.Mutator(shard.engine)
+	}
+	defer shard.checkHealth()
+
+	env, err := es.environment(shard, entity, script)
+	if err != nil {
+		return true, err
+	}
+
+	fn := env.RawGet(handlerName(evt))
+	if !fn.IsFunction() {
+		return true, nil
+	}
+	ret, err := fn.Call(1, shard.engine.TableFromMap(map[string]interface{}(data)))
+	if err != nil {
+		return true, err
+	}
+
+	return !(ret[0].IsBool() && ret[0].IsFalse()), nil
+}
+
+// Attach sets the script of the entity, an empty name removes it's script.
+// The entity starts over with a fresh environment the next time it's sent an
+// event.
+func (es *EntityScripts) Attach(entity, script string) error {
+	var val interface{}
+	if script != "" {
+		val = script
+	}
+	if err := es.world.Store().UpdateNode(entity, storage.Properties{ScriptProperty: val}); err != nil {
+		return err
+	}
+	es.Forget(entity)
+
+	return nil
+}
+
+// Forget drops the entity's environment, it should be called when entities
+// are destroyed so their environments don't linger.
+func (es *EntityScripts) Forget(entity string) {
+	shard := es.shardFor(entity)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	delete(shard.envs, entity)
+}
+
+// Reload drops every compiled script and environment so scripts are read
+// again, with their entities starting over.
+func (es *EntityScripts) Reload() {
+	es.chunkMutex.Lock()
+	es.chunks = make(map[string]*lua.Chunk)
+	es.chunkMutex.Unlock()
+
+	for _, shard := range es.shards {
+		shard.mutex.Lock()
+		shard.envs = make(map[string]*lua.Value)
+		shard.mutex.Unlock()
+	}
+}
+
+// Len is the number of entities with an environment.
+func (es *EntityScripts) Len() int {
+	n := 0
+	for _, shard := range es.shards {
+		shard.mutex.Lock()
+		n += len(shard.envs)
+		shard.mutex.Unlock()
+	}
+
+	return n
+}
+
+// Close closes the engines.
+func (es *EntityScripts) Close() {
+	for _, shard := range es.shards {
+		shard.mutex.Lock()
+		if shard.engine != nil {
+			shard.engine.Close()
+			shard.engine = nil
+		}
+		shard.envs = make(map[string]*lua.Value)
+		shard.mutex.Unlock()
+	}
+}
+
+// send "greet" to everything else in the room an entity moved into
+func (es *EntityScripts) greet(d events.Data) error {
+	mover, _ := d["entity"].(string)
+	room, _ := d["to"].(string)
+	occupants, err := es.world.Occupants(room)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range occupants {
+		if o == mover {
+			continue
+		}
+		if _, err := es.Trigger(o, "greet", d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (es *EntityScripts) scriptFor(entity string) (string, error) {
+	node, err := es.world.Store().GetNode(entity)
+	if err != nil {
+		return "", err
+	}
+	script, _ := node.Properties[ScriptProperty].(string)
+
+	return script, nil
+}
+
+func (es *EntityScripts) shardFor(entity string) *scriptShard {
+	h := fnv.New32a()
+	h.Write([]byte(entity))
+
+	return es.shards[h.Sum32()%uint32(len(es.shards))]
+}
+
+// the entity's environment, running it's script in a new one if it doesn't
+// have one yet
+func (es *EntityScripts) environment(shard *scriptShard, entity, script string) (*lua.Value, error) {
+	if env, ok := shard.envs[entity]; ok {
+		return env, nil
+	}
+
+	chunk, err := es.chunk(script)
+	if err != nil {
+		return nil, err
+	}
+
+	env := shard.engine.NewEnvironment()
+	self := shard.engine.NewTable()
+	self.Set("id", entity)
+	self.Set("script", script)
+	env.RawSet("self", self)
+	if err := shard.engine.RunChunk(chunk, env); err != nil {
+		return nil, err
+	}
+	shard.envs[entity] = env
+
+	return env, nil
+}
+
+func (es *EntityScripts) chunk(script string) (*lua.Chunk, error) {
+	es.chunkMutex.Lock()
+	defer es.chunkMutex.Unlock()
+
+	if c, ok := es.chunks[script]; ok {
+		return c, nil
+	}
+	c, err := es.config.Load(script)
+	if err != nil {
+		return nil, err
+	}
+	es.chunks[script] = c
+
+	return c, nil
+}
+
+// engines stopped for running past their budget (or holding too much memory)
+// may have environments left half updated, so they're replaced and their
+// entities start over. A handler failing with an error only affects it's own
+// entity, so the engine is kept.
+func (shard *scriptShard) checkHealth() {
+	if shard.engine != nil && !lua.DefaultHealthCheck(shard.engine) {
+		shard.engine.Close()
+		shard.engine = nil
+		shard.envs = make(map[string]*lua.Value)
+	}
+}
+
+func loadScriptFile(name string) (*lua.Chunk, error) {
+	path, ok := plugins.FindScript(name)
+	if !ok {
+		return nil, fmt.Errorf("scripting: there's no file for the script %q", name)
+	}
+
+	return lua.CompileFile(path)
+}
+
+// the name of the handler for the event, "item:wear" is on_item_wear
+func handlerName(evt string) string {
+	return "on_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+
+		return '_'
+	}, evt)
+}
@@ -0,0 +1,163 @@
+package scripting_test
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	. "github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	"github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EntityScripts", func() {
+	var (
+		w       *world.World
+		es      *EntityScripts
+		config  EntityScriptsConfig
+		square  *world.Room
+		guard   string
+		mutex   sync.Mutex
+		records []string
+		sources = map[string]string{
+			"town.guard": `
+				function on_poke(evt)
+					pokes = (pokes or 0) + 1
+					return pokes < 2
+				end
+
+				function on_greet(evt)
+					record(self.id, "greeted " .. evt.entity)
+				end
+
+				function on_item_wear(evt)
+					record(self.id, "wearing " .. evt.item)
+				end
+
+				function on_spin()
+					while true do end
+				end
+
+				function on_fail()
+					error("boom")
+				end
+			`,
+		}
+		loads int
+	)
+
+	recorded := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return append([]string(nil), records...)
+	}
+
+	spawn := func(props storage.Properties) string {
+		node, err := w.Store().CreateNode([]string{"Thing"}, props)
+		Ω(err).Should(BeNil())
+
+		return node.ID
+	}
+
+	BeforeEach(func() {
+		InitializeEmitters()
+		records = nil
+		loads = 0
+
+		w = world.New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+		square, _ = w.CreateRoom("Square", "", nil)
+		guard = spawn(storage.Properties{ScriptProperty: "town.guard"})
+		w.Move(guard, square.ID)
+
+		config = EntityScriptsConfig{
+			Engines: 2,
+			Mutator: func(eng *lua.Engine) {
+				EntityEngineMutator(eng)
+				eng.SetGlobal("record", func(id, msg string) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					records = append(records, id+": "+msg)
+				})
+			},
+			Load: func(name string) (*lua.Chunk, error) {
+				loads++
+
+				return lua.CompileString(sources[name], name)
+			},
+		}
+		es = NewEntityScripts(w, config)
+	})
+
+	AfterEach(func() {
+		es.Close()
+	})
+
+	It("keeps each entity's globals apart", func() {
+		other := spawn(storage.Properties{ScriptProperty: "town.guard"})
+
+		Ω(es.Trigger(guard, "poke", nil)).Should(BeTrue())
+		Ω(es.Trigger(guard, "poke", nil)).Should(BeFalse())
+		Ω(es.Trigger(other, "poke", nil)).Should(BeTrue())
+		Ω(es.Len()).Should(Equal(2))
+		Ω(loads).Should(Equal(1))
+	})
+
+	It("ignores entities without scripts or handlers", func() {
+		plain := spawn(nil)
+		Ω(es.Trigger(plain, "poke", nil)).Should(BeTrue())
+		Ω(es.Trigger(guard, "dance", nil)).Should(BeTrue())
+		Ω(es.Len()).Should(Equal(1))
+	})
+
+	It("names handlers after events", func() {
+		_, err := es.Trigger(guard, "item:wear", events.Data{"item": "hat"})
+		Ω(err).Should(BeNil())
+		Ω(recorded()).Should(Equal([]string{guard + ": wearing hat"}))
+	})
+
+	It("greets entities moving into the room", func() {
+		visitor := spawn(nil)
+		Ω(w.Move(visitor, square.ID)).Should(BeNil())
+
+		Eventually(recorded).Should(Equal([]string{guard + ": greeted " + visitor}))
+	})
+
+	It("starts entities over when scripts are attached", func() {
+		es.Trigger(guard, "poke", nil)
+		Ω(es.Attach(guard, "town.guard")).Should(BeNil())
+		Ω(es.Trigger(guard, "poke", nil)).Should(BeTrue())
+
+		Ω(es.Attach(guard, "")).Should(BeNil())
+		node, _ := w.Store().GetNode(guard)
+		Ω(node.Properties).ShouldNot(HaveKey(ScriptProperty))
+		Ω(es.Len()).Should(Equal(0))
+	})
+
+	It("replaces engines that run past their budget", func() {
+		es.Trigger(guard, "poke", nil)
+		_, err := es.Trigger(guard, "spin", nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(es.Len()).Should(Equal(0))
+
+		Ω(es.Trigger(guard, "poke", nil)).Should(BeTrue())
+	})
+
+	It("keeps the engine when a handler fails", func() {
+		es.Close()
+		config.Engines = 1
+		es = NewEntityScripts(w, config)
+		other := spawn(storage.Properties{ScriptProperty: "town.guard"})
+
+		Ω(es.Trigger(other, "poke", nil)).Should(BeTrue())
+		_, err := es.Trigger(guard, "fail", nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(es.Len()).Should(Equal(2))
+		Ω(es.Trigger(other, "poke", nil)).Should(BeFalse())
+	})
+})
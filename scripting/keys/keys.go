@@ -8,7 +8,19 @@ const (
 	Pool            = "engine pool"
 	Logger          = "logger"
 	RootCmd         = "root command"
+	SecurityLevel   = "security level"
+	EntityScripts   = "entity scripts"
+	Channels        = "channels"
+	InventoryHooks  = "inventory hooks"
+	ChannelHooks    = "channel hooks"
+	TalonDB         = "talon database"
 
-	TalonRowMetatable  = "talon row metatable"
-	TalonRowsMetatable = "talon rows metatable"
+	EntityRegistry        = "entity registry"
+	EntityMetatable       = "entity metatable"
+	EntityModelMetatable  = "entity model metatable"
+	TalonBuilderMetatable = "talon builder metatable"
+	TalonRowMetatable     = "talon row metatable"
+	TalonRowsMetatable    = "talon rows metatable"
+	TalonTxMetatable      = "talon transaction metatable"
+	RandomTableMetatable  = "random table metatable"
 )
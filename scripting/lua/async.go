@@ -0,0 +1,267 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package lua
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/yuin/gopher-lua"
+)
+
+// ErrNotInTask is raised when a function that suspends is called from outside
+// of a task, there is nothing that could resume it.
+var ErrNotInTask = errors.New("cannot suspend outside of a task, use async.run to start one")
+
+// ErrNoPool is raised when a task tries to suspend in an engine that doesn't
+// belong to a pool, without one nothing keeps the engine from being used while
+// the task is resumed.
+var ErrNoPool = errors.New("cannot suspend in an engine that does not belong to a pool")
+
+// ErrEngineGone is the error given to tasks that could not be resumed because
+// their engine was closed or discarded by it's pool while they were suspended.
+var ErrEngineGone = errors.New("the engine running the task is no longer available")
+
+// ResumeFunc resumes a suspended task, the values given are returned from the
+// function that suspended it. Maps and slices are converted to tables. It's
+// safe to call from any goroutine, and only the first call has any effect.
+type ResumeFunc func(values ...interface{})
+
+// Suspension is given to Engine.Suspend to describe how a task waits. It's
+// called once the task has suspended, while the engine is still held, and
+// must arrange for resume to be called at some point in the future. It must
+// not block.
+type Suspension func(resume ResumeFunc)
+
+// Task is a Lua function running as a coroutine scheduled by Go. While a task
+// is suspended the engine it belongs to is free to be used by others (and
+// returned to it's pool), when it's resumed the engine is reacquired. Tasks in
+// engines without a pool fail with ErrNoPool if they suspend.
+type Task struct {
+	engine  *Engine
+	pool    *EnginePool
+	thread  *lua.LState
+	cancel  context.CancelFunc
+	fn      *lua.LFunction
+	done    chan struct{}
+	results []*Value
+	err     error
+}
+
+// Done returns a channel that is closed once the task has finished running.
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Results returns the values returned from the task's function, this is only
+// valid once the task is done.
+func (t *Task) Results() []*Value {
+	return t.results
+}
+
+// Err returns the error the task failed with, if any. This is only valid once
+// the task is done.
+func (t *Task) Err() error {
+	return t.err
+}
+
+// finish marks the task as done with the results or error given
+func (t *Task) finish(results []*Value, err error) {
+	t.results = results
+	t.err = err
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.engine.tasks.remove(t.thread)
+	close(t.done)
+}
+
+// tasks tracks the threads being run as tasks in an engine, this is how we
+// know if it's safe to suspend.
+type tasks struct {
+	sync.Mutex
+	threads map[*lua.LState]*Task
+}
+
+// add the task to the set of running tasks
+func (ts *tasks) add(t *Task) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if ts.threads == nil {
+		ts.threads = make(map[*lua.LState]*Task)
+	}
+	ts.threads[t.thread] = t
+}
+
+// remove the thread from the set of running tasks
+func (ts *tasks) remove(thread *lua.LState) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	delete(ts.threads, thread)
+}
+
+// determine if the thread belongs to a running task
+func (ts *tasks) has(thread *lua.LState) bool {
+	ts.Lock()
+	defer ts.Unlock()
+
+	_, ok := ts.threads[thread]
+
+	return ok
+}
+
+// Go runs the function as a task, it runs until it either finishes or
+// suspends before returning. The returned task is done if the function
+// finished without suspending.
+func (e *Engine) Go(fn *Value, args ...interface{}) *Task {
+	root := e.rootEngine()
+	t := &Task{
+		engine: root,
+		done:   make(chan struct{}),
+	}
+	if pool, ok := root.Meta[keys.Pool].(*EnginePool); ok {
+		t.pool = pool
+	}
+
+	lfn, ok := fn.lval.(*lua.LFunction)
+	if !ok {
+		t.finish(nil, errors.New("tasks can only be started with a function"))
+
+		return t
+	}
+
+	t.fn = lfn
+	t.thread, t.cancel = root.state.NewThread()
+	root.tasks.add(t)
+
+	largs := make([]lua.LValue, len(args))
+	for i, arg := range args {
+		largs[i] = root.resumeValue(arg)
+	}
+	root.step(t, largs...)
+
+	return t
+}
+
+// Suspend pauses the task currently running, it's intended to be returned
+// from a ScriptFunction:
+//   return eng.Suspend(func(resume lua.ResumeFunc) {
+//     time.AfterFunc(time.Second, func() { resume() })
+//   })
+// Only engines that belong to a pool can suspend.
+func (e *Engine) Suspend(s Suspension) int {
+	root := e.rootEngine()
+	if !root.tasks.has(e.state) {
+		e.RaiseError(ErrNotInTask.Error())
+
+		return 0
+	}
+	if _, ok := root.Meta[keys.Pool].(*EnginePool); !ok {
+		e.RaiseError(ErrNoPool.Error())
+
+		return 0
+	}
+
+	ud := e.state.NewUserData()
+	ud.Value = s
+
+	return e.state.Yield(ud)
+}
+
+// step resumes the task's thread until it finishes or suspends again, this
+// must be called while holding the engine.
+func (e *Engine) step(t *Task, args ...lua.LValue) {
+	budgeted := e.budget != nil || !e.limits.IsZero()
+	var b *budget
+	if budgeted {
+		b = e.startBudget(t.thread)
+	}
+	st, err, vals := e.state.G.CurrentThread.Resume(t.thread, t.fn, args...)
+	if budgeted {
+		err = e.finishBudget(b, t.thread, err)
+	}
+
+	switch {
+	case err != nil:
+		e.lastErr = err
+		t.finish(nil, err)
+	case st == lua.ResumeOK:
+		results := make([]*Value, len(vals))
+		for i, val := range vals {
+			results[i] = e.newValue(val)
+		}
+		t.finish(results, nil)
+	case t.pool == nil:
+		// a plain coroutine.yield, resuming it in the background would run
+		// the engine without anything holding it
+		t.finish(nil, ErrNoPool)
+	default:
+		var once sync.Once
+		resume := func(values ...interface{}) {
+			once.Do(func() {
+				go e.resume(t, values)
+			})
+		}
+
+		t.pool.pin(e)
+
+		if len(vals) > 0 {
+			if ud, ok := vals[0].(*lua.LUserData); ok {
+				if s, ok := ud.Value.(Suspension); ok {
+					s(resume)
+
+					return
+				}
+			}
+		}
+
+		// a plain coroutine.yield from the task, just let others have a turn
+		resume()
+	}
+}
+
+// reacquire the engine and continue running the task with the given values
+func (e *Engine) resume(t *Task, values []interface{}) {
+	pe := t.pool.Acquire(e)
+	t.pool.unpin(e)
+	if pe == nil {
+		t.finish(nil, ErrEngineGone)
+
+		return
+	}
+	defer pe.Release()
+
+	if e.closed {
+		t.finish(nil, ErrEngineGone)
+
+		return
+	}
+
+	args := make([]lua.LValue, len(values))
+	for i, val := range values {
+		args[i] = e.resumeValue(val)
+	}
+	e.step(t, args...)
+}
+
+// convert a value given to a task into a Lua value, maps and slices are
+// converted into tables.
+func (e *Engine) resumeValue(val interface{}) lua.LValue {
+	if val == nil {
+		return lua.LNil
+	}
+
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Map:
+		return e.TableFromMap(val).lval
+	case reflect.Slice:
+		return e.TableFromSlice(val).lval
+	default:
+		return e.ValueFor(val).lval
+	}
+}
@@ -0,0 +1,96 @@
+package lua_test
+
+import (
+	. "github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Task", func() {
+	var engine *Engine
+
+	pause := func(eng *Engine) int {
+		return eng.Suspend(func(resume ResumeFunc) {
+			go resume("resumed")
+		})
+	}
+
+	BeforeEach(func() {
+		engine = NewEngine(EngineOptions{
+			Limits: ExecutionLimits{Instructions: 1000},
+		})
+		engine.OpenCoroutine()
+		engine.SetGlobal("pause", pause)
+		engine.DoString(`
+			function add(a, b)
+				return a + b
+			end
+
+			function paused()
+				local value = pause()
+
+				return value
+			end
+
+			function forever()
+				while true do end
+			end
+		`)
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	It("returns results from functions that don't suspend", func() {
+		task := engine.Go(engine.GetGlobal("add"), 1, 2)
+
+		Ω(task.Done()).Should(BeClosed())
+		Ω(task.Err()).Should(BeNil())
+		Ω(task.Results()[0].AsNumber()).Should(Equal(float64(3)))
+	})
+
+	It("resumes suspended functions", func() {
+		pool := NewEnginePool(1, func(eng *Engine) {
+			eng.SetGlobal("pause", pause)
+			eng.DoString(`
+				function paused()
+					local value = pause()
+
+					return value
+				end
+			`)
+		})
+		defer pool.Shutdown()
+
+		eng := pool.Get()
+		task := eng.Go(eng.GetGlobal("paused"))
+		eng.Release()
+
+		Eventually(task.Done()).Should(BeClosed())
+		Ω(task.Err()).Should(BeNil())
+		Ω(task.Results()[0].AsString()).Should(Equal("resumed"))
+	})
+
+	It("refuses to suspend in engines without a pool", func() {
+		task := engine.Go(engine.GetGlobal("paused"))
+
+		Ω(task.Done()).Should(BeClosed())
+		Ω(task.Err()).ShouldNot(BeNil())
+		Ω(task.Err().Error()).Should(ContainSubstring(ErrNoPool.Error()))
+	})
+
+	It("applies execution limits", func() {
+		task := engine.Go(engine.GetGlobal("forever"))
+
+		Ω(task.Done()).Should(BeClosed())
+		Ω(IsLimitError(task.Err())).Should(BeTrue())
+	})
+
+	It("cannot suspend outside of a task", func() {
+		_, err := engine.Call("paused", 1)
+
+		Ω(err).ShouldNot(BeNil())
+	})
+})
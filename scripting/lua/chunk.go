@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package lua
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Chunk is Lua code compiled once that can be run by any engine, any number
+// of times. Each run can be given it's own environment so many things can
+// share one engine without sharing their globals.
+type Chunk struct {
+	Name  string
+	proto *lua.FunctionProto
+}
+
+// Compile compiles the code read from the reader, the name is used in error
+// messages and stack traces.
+func Compile(r io.Reader, name string) (*Chunk, error) {
+	stmts, err := parse.Parse(r, name)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(stmts, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chunk{
+		Name:  name,
+		proto: proto,
+	}, nil
+}
+
+// CompileString compiles the source code.
+func CompileString(src, name string) (*Chunk, error) {
+	return Compile(strings.NewReader(src), name)
+}
+
+// CompileFile compiles the file at the path.
+func CompileFile(path string) (*Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Compile(file, path)
+}
+
+// NewEnvironment creates a table to run chunks in. Globals the chunk sets are
+// kept in the environment and globals it doesn't set are looked up in the
+// engine's globals.
+func (e *Engine) NewEnvironment() *Value {
+	env := e.state.NewTable()
+	meta := e.state.NewTable()
+	meta.RawSetString("__index", e.state.G.Global)
+	e.state.SetMetatable(env, meta)
+
+	return e.newValue(env)
+}
+
+// RunChunk runs the chunk in the environment, functions it defines keep using
+// the environment for their globals when they're called later. The engine's
+// execution limits apply.
+func (e *Engine) RunChunk(c *Chunk, env *Value) error {
+	// built by hand, the pinned gopher-lua has no NewFunctionFromProto
+	fn := &lua.LFunction{
+		IsG:      false,
+		Env:      e.state.Env,
+		Proto:    c.proto,
+		Upvalues: make([]*lua.Upvalue, 0),
+	}
+	if env != nil {
+		fn.Env = env.asTable()
+	}
+
+	return e.protectedCall(lua.P{
+		Fn:      fn,
+		NRet:    0,
+		Protect: true,
+	})
+}
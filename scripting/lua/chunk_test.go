@@ -0,0 +1,62 @@
+package lua_test
+
+import (
+	. "github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Chunk", func() {
+	var (
+		engine *Engine
+		chunk  *Chunk
+	)
+
+	BeforeEach(func() {
+		engine = NewEngine()
+		engine.SetGlobal("greeting", "hello")
+
+		var err error
+		chunk, err = CompileString(`
+			count = 0
+			function greet(name)
+				count = count + 1
+				return greeting .. " " .. name .. " " .. count
+			end
+		`, "greeter")
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	It("keeps globals in the environment", func() {
+		first, second := engine.NewEnvironment(), engine.NewEnvironment()
+		Ω(engine.RunChunk(chunk, first)).Should(BeNil())
+		Ω(engine.RunChunk(chunk, second)).Should(BeNil())
+
+		first.Get("greet").Call(1, "bob")
+		ret, err := first.Get("greet").Call(1, "bob")
+		Ω(err).Should(BeNil())
+		Ω(ret[0].AsString()).Should(Equal("hello bob 2"))
+
+		ret, err = second.Get("greet").Call(1, "sue")
+		Ω(err).Should(BeNil())
+		Ω(ret[0].AsString()).Should(Equal("hello sue 1"))
+
+		Ω(engine.GetGlobal("count").IsNil()).Should(BeTrue())
+	})
+
+	It("runs in the globals without an environment", func() {
+		Ω(engine.RunChunk(chunk, nil)).Should(BeNil())
+		Ω(engine.GetGlobal("count").AsNumber()).Should(Equal(float64(0)))
+	})
+
+	It("fails to compile bad code", func() {
+		_, err := CompileString("function (", "broken")
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("broken"))
+	})
+})
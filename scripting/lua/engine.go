@@ -15,8 +15,18 @@ import (
 
 // Engine struct stores a pointer to a gluaLState providing a simplified API.
 type Engine struct {
-	state *lua.LState
-	Meta  map[string]interface{}
+	state        *lua.LState
+	Meta         map[string]interface{}
+	limits       ExecutionLimits
+	limitHandler LimitHandler
+	budget       *budget
+	memory       memory
+	unmeasured   uint64
+	exceeded     bool
+	lastErr      error
+	closed       bool
+	tasks        tasks
+	root         *Engine
 }
 
 // ScriptFunction is a type alias for a function that receives an Engine and
@@ -55,6 +65,10 @@ func (e *Engine) configureFromOptions(options []EngineOptions) {
 			e.OpenLibs()
 		}
 
+		if !opt.Limits.IsZero() {
+			e.SetExecutionLimits(opt.Limits)
+		}
+
 		config := luar.GetConfig(e.state)
 		switch opt.FieldNaming {
 		case SnakeCaseExportedNames:
@@ -86,9 +100,21 @@ func (e *Engine) configureFromOptions(options []EngineOptions) {
 
 // Close will perform a close on the Lua state.
 func (e *Engine) Close() {
+	e.closed = true
 	e.state.Close()
 }
 
+// IsClosed determines if the engine has been closed.
+func (e *Engine) IsClosed() bool {
+	return e.closed
+}
+
+// LastError returns the error from the last script run in the engine, nil if
+// it succeeded.
+func (e *Engine) LastError() error {
+	return e.lastErr
+}
+
 // OpenBase allows the Lua engine to open the base library up for use in
 // scripts.
 func (e *Engine) OpenBase() int {
@@ -104,7 +130,10 @@ func (e *Engine) OpenChannel() int {
 // OpenCoroutine allows the Lua module for goroutine suppor tto be accessible
 // to scripts.
 func (e *Engine) OpenCoroutine() int {
-	return lua.OpenCoroutine(e.state)
+	n := lua.OpenCoroutine(e.state)
+	e.budgetThreads()
+
+	return n
 }
 
 // OpenDebug allows the Lua module support debug features to be accissible
@@ -149,11 +178,21 @@ func (e *Engine) OpenTable() int {
 // be used if security isn't necessarily a major concern.
 func (e *Engine) OpenLibs() {
 	e.state.OpenLibs()
+	e.budgetThreads()
 }
 
 // DoFile runs the file through the Lua interpreter.
 func (e *Engine) DoFile(fn string) error {
-	return e.state.DoFile(fn)
+	lfn, err := e.state.LoadFile(fn)
+	if err != nil {
+		return err
+	}
+
+	return e.protectedCall(lua.P{
+		Fn:      lfn,
+		NRet:    lua.MultRet,
+		Protect: true,
+	})
 }
 
 // LoadString runs the given string through the Lua interpreter, wrapping it
@@ -181,7 +220,16 @@ func (e *Engine) LoadFile(fpath string) (*Value, error) {
 
 // DoString runs the given string through the Lua interpreter.
 func (e *Engine) DoString(src string) error {
-	return e.state.DoString(src)
+	fn, err := e.state.LoadString(src)
+	if err != nil {
+		return err
+	}
+
+	return e.protectedCall(lua.P{
+		Fn:      fn,
+		NRet:    lua.MultRet,
+		Protect: true,
+	})
 }
 
 // RaiseError will throw an error in the Lua engine.
@@ -425,7 +473,7 @@ func (e *Engine) Call(name string, retCount int, params ...interface{}) ([]*Valu
 		luaParams[i] = v.lval
 	}
 
-	err := e.state.CallByParam(lua.P{
+	err := e.protectedCall(lua.P{
 		Fn:      e.state.GetGlobal(name),
 		NRet:    retCount,
 		Protect: true,
@@ -560,13 +608,49 @@ func (e *Engine) NewUserData(val interface{}, mt interface{}) *Value {
 	return e.newValue(ud)
 }
 
-// wrapScriptFunction turns a ScriptFunction into a lua.LGFunction
+// wrapScriptFunction turns a ScriptFunction into a lua.LGFunction, functions
+// called from within a coroutine are given an engine that works with the
+// coroutine's stack.
 func (e *Engine) wrapScriptFunction(fn ScriptFunction) lua.LGFunction {
 	return func(l *lua.LState) int {
-		return fn(e)
+		if l == e.state {
+			return fn(e)
+		}
+
+		return fn(e.forThread(l))
+	}
+}
+
+// forThread returns an engine for the given thread (coroutine) of this engine,
+// sharing it's Meta, limits and tasks.
+func (e *Engine) forThread(l *lua.LState) *Engine {
+	root := e.rootEngine()
+
+	return &Engine{
+		state:        l,
+		Meta:         root.Meta,
+		limits:       root.limits,
+		limitHandler: root.limitHandler,
+		root:         root,
 	}
 }
 
+// Root returns the engine that owns the main thread, which is the engine
+// itself unless this engine was given to a function called from a coroutine.
+func (e *Engine) Root() *Engine {
+	return e.rootEngine()
+}
+
+// rootEngine returns the engine that owns the main thread, which is the
+// engine itself unless this engine was created for a coroutine.
+func (e *Engine) rootEngine() *Engine {
+	if e.root != nil {
+		return e.root
+	}
+
+	return e
+}
+
 // genScriptFunc will wrap a ScriptFunction with a function that gopher-lua
 // expects to see when calling method from Lua.
 func (e *Engine) genScriptFunc(fn ScriptFunction) *lua.LFunction {
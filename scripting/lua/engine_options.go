@@ -19,10 +19,11 @@ const (
 )
 
 // EngineOptions allows for customization of a lua.Engine such as altering
-// the names of fields and methods as well as whether or not to open all
-// libraries.
+// the names of fields and methods, whether or not to open all libraries and
+// the execution limits applied to calls into the engine.
 type EngineOptions struct {
 	OpenLibs     bool
 	FieldNaming  NamingConvention
 	MethodNaming NamingConvention
+	Limits       ExecutionLimits
 }
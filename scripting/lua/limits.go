@@ -0,0 +1,316 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Errors that describe which execution budget a script exhausted, see also
+// ErrMemoryLimit.
+var (
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+	ErrTimeLimit        = errors.New("execution time limit exceeded")
+)
+
+// ExecutionLimits defines the budget given to a single call into an engine.
+// A zero value for any limit means that limit is not enforced. Memory is the
+// (estimated) number of bytes the engine may hold while the call runs.
+type ExecutionLimits struct {
+	Instructions uint64
+	Duration     time.Duration
+	Memory       uint64
+}
+
+// IsZero determines if no limits have been set.
+func (el ExecutionLimits) IsZero() bool {
+	return el.Instructions == 0 && el.Duration == 0 && el.Memory == 0
+}
+
+// LimitError is returned from a call that was killed for exceeding it's
+// execution budget. Reason will be one of the ErrXLimit values, and the
+// StackTrace is the Lua stack at the point the script was stopped.
+type LimitError struct {
+	Reason     error
+	StackTrace string
+	Cause      error
+}
+
+// Error returns the reason the script was killed along with the stack trace.
+func (le *LimitError) Error() string {
+	if le.StackTrace == "" {
+		return le.Reason.Error()
+	}
+
+	return fmt.Sprintf("%s\n%s", le.Reason, le.StackTrace)
+}
+
+// IsLimitError determines if the error was caused by a script exceeding it's
+// budget.
+func IsLimitError(err error) bool {
+	_, ok := err.(*LimitError)
+
+	return ok
+}
+
+// LimitHandler is called whenever a script run by the engine is killed for
+// exceeding it's budget.
+type LimitHandler func(*Engine, *LimitError)
+
+// budget is a context given to the Lua state for the duration of a call. The
+// VM checks Done before every instruction it executes, which is what allows
+// us to count instructions without a hook.
+type budget struct {
+	context.Context
+	cancel    context.CancelFunc
+	engine    *Engine
+	limit     uint64
+	memory    uint64
+	count     uint64
+	exhausted chan struct{}
+	reason    error
+}
+
+// create a new budget for the engine with the given limits.
+func newBudget(eng *Engine, limits ExecutionLimits) *budget {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if limits.Duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), limits.Duration)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	return &budget{
+		Context:   ctx,
+		cancel:    cancel,
+		engine:    eng,
+		limit:     limits.Instructions,
+		memory:    limits.Memory,
+		exhausted: make(chan struct{}),
+	}
+}
+
+// Done counts the instruction being executed and reports the budget as done
+// once it's been used up or time has run out.
+func (b *budget) Done() <-chan struct{} {
+	if b.reason != nil {
+		return b.exhausted
+	}
+
+	b.count++
+	if b.limit > 0 && b.count > b.limit {
+		b.exhaust(ErrInstructionLimit)
+
+		return b.exhausted
+	}
+
+	if b.memory > 0 && b.count%memorySampleRate == 0 {
+		if b.engine.MemoryUsage().Total() > b.memory {
+			b.exhaust(ErrMemoryLimit)
+
+			return b.exhausted
+		}
+	}
+
+	return b.Context.Done()
+}
+
+// Err reports which of the limits was exceeded, if any.
+func (b *budget) Err() error {
+	if b.reason != nil {
+		return b.reason
+	}
+
+	if err := b.Context.Err(); err != nil {
+		if err == context.DeadlineExceeded {
+			return ErrTimeLimit
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// threadBudget is the context given to coroutines created by scripts. The VM
+// gives new threads a context derived from the running one, which wouldn't
+// count their instructions, so they're counted against whatever budget the
+// engine is running under instead.
+type threadBudget struct {
+	context.Context
+	engine *Engine
+}
+
+// Done counts the instruction against the engine's budget, if it has one.
+func (tb threadBudget) Done() <-chan struct{} {
+	if b := tb.engine.budget; b != nil {
+		return b.Done()
+	}
+
+	return nil
+}
+
+// Err reports which of the engine's limits was exceeded, if any.
+func (tb threadBudget) Err() error {
+	if b := tb.engine.budget; b != nil {
+		return b.Err()
+	}
+
+	return nil
+}
+
+// replace coroutine.create and coroutine.wrap so the threads they create
+// count against the engine's budget
+func (e *Engine) budgetThreads() {
+	co, ok := e.state.GetGlobal(lua.CoroutineLibName).(*lua.LTable)
+	if !ok {
+		return
+	}
+
+	budgetThread := func(th lua.LValue) {
+		if t, ok := th.(*lua.LState); ok {
+			t.SetContext(threadBudget{
+				Context: context.Background(),
+				engine:  e,
+			})
+		}
+	}
+
+	if create, ok := co.RawGetString("create").(*lua.LFunction); ok && create.IsG {
+		co.RawSetString("create", e.state.NewFunction(func(l *lua.LState) int {
+			n := create.GFunction(l)
+			budgetThread(l.Get(-1))
+
+			return n
+		}))
+	}
+
+	// wrap returns a function holding the thread as it's only upvalue
+	if wrap, ok := co.RawGetString("wrap").(*lua.LFunction); ok && wrap.IsG {
+		co.RawSetString("wrap", e.state.NewFunction(func(l *lua.LState) int {
+			n := wrap.GFunction(l)
+			if fn, ok := l.Get(-1).(*lua.LFunction); ok && len(fn.Upvalues) > 0 {
+				budgetThread(fn.Upvalues[0].Value())
+			}
+
+			return n
+		}))
+	}
+}
+
+// exhaust marks the budget as used up for the given reason.
+func (b *budget) exhaust(reason error) {
+	if b.reason == nil {
+		b.reason = reason
+		close(b.exhausted)
+	}
+}
+
+// SetExecutionLimits sets the budget given to each call made into the engine.
+func (e *Engine) SetExecutionLimits(limits ExecutionLimits) {
+	e.limits = limits
+}
+
+// ExecutionLimits returns the budget currently given to each call made into
+// the engine.
+func (e *Engine) ExecutionLimits() ExecutionLimits {
+	return e.limits
+}
+
+// OnLimitExceeded registers a function to be called any time a script is
+// killed for exceeding it's budget.
+func (e *Engine) OnLimitExceeded(handler LimitHandler) {
+	e.limitHandler = handler
+}
+
+// protectedCall is the entry point for all calls into the engine, it applies
+// execution limits to the outermost call (calls made from Go functions that
+// were themselves called from Lua share the budget of the original call).
+func (e *Engine) protectedCall(p lua.P, args ...lua.LValue) error {
+	var err error
+	if e.root != nil || e.budget != nil || e.limits.IsZero() {
+		err = e.state.CallByParam(p, args...)
+	} else {
+		b := e.startBudget(e.state)
+		err = e.finishBudget(b, e.state, e.state.CallByParam(p, args...))
+	}
+	// nested calls finish first, so this ends up holding the outermost result
+	e.rootEngine().lastErr = err
+
+	return err
+}
+
+// startBudget begins a new budget for the state (the engine's own state or
+// one of it's threads). If a budget is already running it's shared and nil is
+// returned.
+func (e *Engine) startBudget(state *lua.LState) *budget {
+	if e.budget != nil {
+		state.SetContext(e.budget)
+
+		return nil
+	}
+
+	b := newBudget(e, e.limits)
+	e.budget = b
+	state.SetContext(b)
+
+	return b
+}
+
+// finishBudget ends the budget started with startBudget, converting the error
+// into a LimitError if the budget was exceeded.
+func (e *Engine) finishBudget(b *budget, state *lua.LState, err error) error {
+	if b == nil {
+		// the state shared a budget owned by an outer call
+		if state != e.state {
+			state.RemoveContext()
+		}
+
+		return err
+	}
+
+	state.RemoveContext()
+	e.budget = nil
+	reason := b.Err()
+	b.cancel()
+
+	// walking the engine is expensive, so like the checks made while the call
+	// runs it's only measured once enough instructions have run since the last
+	// time, which may have been during earlier calls
+	if e.limits.Memory > 0 && reason == nil {
+		e.unmeasured += b.count % memorySampleRate
+		if e.unmeasured >= memorySampleRate && e.MemoryUsage().Total() > e.limits.Memory {
+			reason = ErrMemoryLimit
+			if err == nil {
+				err = errors.New(reason.Error())
+			}
+		}
+	}
+
+	if err != nil && reason != nil {
+		le := &LimitError{
+			Reason: reason,
+			Cause:  err,
+		}
+		if aerr, ok := err.(*lua.ApiError); ok {
+			le.StackTrace = aerr.StackTrace
+		}
+
+		e.exceeded = true
+		if e.limitHandler != nil {
+			e.limitHandler(e, le)
+		}
+
+		return le
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+package lua_test
+
+import (
+	"time"
+
+	. "github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExecutionLimits", func() {
+	var (
+		engine *Engine
+		script = `
+			function forever()
+				while true do end
+			end
+
+			function add(a, b)
+				return a + b
+			end
+		`
+	)
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	Context("with an instruction limit", func() {
+		var (
+			err     error
+			handled *LimitError
+		)
+
+		BeforeEach(func() {
+			engine = NewEngine(EngineOptions{
+				Limits: ExecutionLimits{Instructions: 1000},
+			})
+			engine.OnLimitExceeded(func(_ *Engine, lerr *LimitError) {
+				handled = lerr
+			})
+			engine.DoString(script)
+			_, err = engine.Call("forever", 0)
+		})
+
+		It("stops runaway scripts", func() {
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrInstructionLimit))
+		})
+
+		It("notifies the limit handler", func() {
+			Ω(handled).ShouldNot(BeNil())
+			Ω(handled.Reason).Should(Equal(ErrInstructionLimit))
+		})
+
+		It("still allows well behaved calls", func() {
+			results, err := engine.Call("add", 1, 1, 2)
+			Ω(err).Should(BeNil())
+			Ω(results[0].AsNumber()).Should(Equal(float64(3)))
+		})
+	})
+
+	Context("with an instruction limit and coroutines", func() {
+		BeforeEach(func() {
+			// the time limit keeps the spec from hanging if the coroutines
+			// aren't counted
+			engine = NewEngine(EngineOptions{
+				OpenLibs: true,
+				Limits:   ExecutionLimits{Instructions: 1000, Duration: time.Second},
+			})
+		})
+
+		It("counts instructions run by wrapped coroutines", func() {
+			err := engine.DoString(`coroutine.wrap(function() while true do end end)()`)
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrInstructionLimit))
+		})
+
+		It("counts instructions run by resumed coroutines", func() {
+			err := engine.DoString(`
+				local ok = coroutine.resume(coroutine.create(function() while true do end end))
+				finished = true
+			`)
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrInstructionLimit))
+			Ω(engine.GetGlobal("finished").IsNil()).Should(BeTrue())
+		})
+	})
+
+	Context("with a time limit", func() {
+		var err error
+
+		BeforeEach(func() {
+			engine = NewEngine(EngineOptions{
+				Limits: ExecutionLimits{Duration: 10 * time.Millisecond},
+			})
+			engine.DoString(script)
+			_, err = engine.Call("forever", 0)
+		})
+
+		It("stops runaway scripts", func() {
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrTimeLimit))
+		})
+	})
+
+	Context("with a memory limit", func() {
+		var err error
+
+		BeforeEach(func() {
+			engine = NewEngine(EngineOptions{
+				Limits: ExecutionLimits{Memory: 64 * 1024},
+			})
+			engine.DoString(`
+				function hoard()
+					local t = {}
+					while true do
+						t[#t + 1] = string.rep("x", 100)
+					end
+				end
+			`)
+			_, err = engine.Call("hoard", 0)
+		})
+
+		It("stops scripts holding on to too much memory", func() {
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrMemoryLimit))
+		})
+	})
+
+	Context("with a memory limit and short calls", func() {
+		BeforeEach(func() {
+			engine = NewEngine(EngineOptions{
+				Limits: ExecutionLimits{Memory: 64 * 1024},
+			})
+			engine.DoString(`
+				hoard = {}
+
+				function grow()
+					hoard[#hoard + 1] = string.rep("x", 100)
+				end
+			`)
+		})
+
+		It("doesn't measure the engine after every call", func() {
+			_, err := engine.Call("grow", 0)
+			Ω(err).Should(BeNil())
+			Ω(engine.LastMemoryUsage().Total()).Should(BeZero())
+		})
+
+		It("measures it once enough instructions have run", func() {
+			var err error
+			for i := 0; i < 10000 && err == nil; i++ {
+				_, err = engine.Call("grow", 0)
+			}
+			Ω(IsLimitError(err)).Should(BeTrue())
+			Ω(err.(*LimitError).Reason).Should(Equal(ErrMemoryLimit))
+		})
+	})
+})
@@ -0,0 +1,239 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package lua
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// ErrMemoryLimit is the reason given when a script is stopped for holding on
+// to more memory than it's engine is allowed.
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// the memory usage of an engine is sampled once every memorySampleRate
+// instructions, whether they're run by one call or spread over many, walking
+// the heap on every instruction (or after every call) would be far too slow.
+const memorySampleRate = 10000
+
+// rough sizes (in bytes) used to estimate the memory held by Lua values, these
+// aren't exact but they're consistent, which is what matters when trying to
+// spot growth.
+const (
+	tableOverhead  = 64
+	tableEntrySize = 48
+	stringOverhead = 16
+)
+
+// MemoryStats is an estimate of the memory held by tables and strings
+// reachable from within an engine.
+type MemoryStats struct {
+	Tables      int
+	Strings     int
+	TableBytes  uint64
+	StringBytes uint64
+}
+
+// Total returns the total estimated number of bytes held.
+func (ms MemoryStats) Total() uint64 {
+	return ms.TableBytes + ms.StringBytes
+}
+
+// add combines the stats together.
+func (ms MemoryStats) add(other MemoryStats) MemoryStats {
+	return MemoryStats{
+		Tables:      ms.Tables + other.Tables,
+		Strings:     ms.Strings + other.Strings,
+		TableBytes:  ms.TableBytes + other.TableBytes,
+		StringBytes: ms.StringBytes + other.StringBytes,
+	}
+}
+
+// MemoryConsumer associates the memory reachable from a global or loaded
+// module with it's name.
+type MemoryConsumer struct {
+	Name  string
+	Usage MemoryStats
+}
+
+// memory tracks the last measured usage of an engine, it's kept behind a lock
+// so pools can report on engines that are currently in use.
+type memory struct {
+	sync.RWMutex
+	last MemoryStats
+}
+
+// memoryWalker traverses values in the engine, never visiting the same
+// table twice.
+type memoryWalker struct {
+	state   *lua.LState
+	visited map[lua.LValue]bool
+}
+
+// create a new walker for the given state
+func newMemoryWalker(state *lua.LState) *memoryWalker {
+	return &memoryWalker{
+		state:   state,
+		visited: make(map[lua.LValue]bool),
+	}
+}
+
+// walk measures the memory reachable from the value that has not already been
+// measured by this walker.
+func (mw *memoryWalker) walk(val lua.LValue) MemoryStats {
+	var stats MemoryStats
+	mw.measure(val, &stats)
+
+	return stats
+}
+
+// measure adds the size of the value, and everything reachable from it, to
+// the given stats.
+func (mw *memoryWalker) measure(val lua.LValue, stats *MemoryStats) {
+	switch v := val.(type) {
+	case lua.LString:
+		stats.Strings++
+		stats.StringBytes += uint64(len(v)) + stringOverhead
+	case *lua.LTable:
+		if mw.visited[v] {
+			return
+		}
+		mw.visited[v] = true
+
+		stats.Tables++
+		stats.TableBytes += tableOverhead
+		v.ForEach(func(key, value lua.LValue) {
+			stats.TableBytes += tableEntrySize
+			mw.measure(key, stats)
+			mw.measure(value, stats)
+		})
+		mw.measure(v.Metatable, stats)
+	case *lua.LFunction:
+		if mw.visited[v] {
+			return
+		}
+		mw.visited[v] = true
+
+		if v.Env != nil {
+			mw.measure(v.Env, stats)
+		}
+		for _, uv := range v.Upvalues {
+			if uv != nil {
+				mw.measure(uv.Value(), stats)
+			}
+		}
+	case *lua.LUserData:
+		if mw.visited[v] {
+			return
+		}
+		mw.visited[v] = true
+
+		if v.Env != nil {
+			mw.measure(v.Env, stats)
+		}
+		mw.measure(v.Metatable, stats)
+	}
+}
+
+// walkStack measures the locals (and temporaries) of every frame on the call
+// stack.
+func (mw *memoryWalker) walkStack() MemoryStats {
+	var stats MemoryStats
+	for level := 0; ; level++ {
+		dbg, ok := mw.state.GetStack(level)
+		if !ok {
+			break
+		}
+
+		for n := 1; ; n++ {
+			name, val := mw.state.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			mw.measure(val, &stats)
+		}
+	}
+
+	return stats
+}
+
+// MemoryUsage walks everything reachable in the engine (globals, the registry
+// and the call stack) and estimates the memory held by tables and strings.
+// This has to be called from the goroutine using the engine.
+func (e *Engine) MemoryUsage() MemoryStats {
+	stats := e.measureMemory()
+	e.unmeasured = 0
+	e.memory.Lock()
+	e.memory.last = stats
+	e.memory.Unlock()
+
+	return stats
+}
+
+// LastMemoryUsage returns the usage recorded the last time the engine was
+// measured, unlike MemoryUsage it's safe to call while the engine is in use.
+func (e *Engine) LastMemoryUsage() MemoryStats {
+	e.memory.RLock()
+	defer e.memory.RUnlock()
+
+	return e.memory.last
+}
+
+// perform the walk of the engine
+func (e *Engine) measureMemory() MemoryStats {
+	mw := newMemoryWalker(e.state)
+	stats := mw.walk(e.state.G.Global)
+	stats = stats.add(mw.walk(e.state.G.Registry))
+
+	return stats.add(mw.walkStack())
+}
+
+// MemoryConsumers attributes the memory held by the engine to each loaded
+// module and global value, returning the top n sorted from largest to
+// smallest (n <= 0 returns all of them). Values reachable from more than one
+// place are attributed to modules first, then globals. This has to be called
+// from the goroutine using the engine.
+func (e *Engine) MemoryConsumers(n int) []MemoryConsumer {
+	mw := newMemoryWalker(e.state)
+	globals := e.state.G.Global
+	mw.visited[globals] = true
+
+	var consumers []MemoryConsumer
+	add := func(name string, val lua.LValue) {
+		usage := mw.walk(val)
+		if usage.Total() > 0 {
+			consumers = append(consumers, MemoryConsumer{
+				Name:  name,
+				Usage: usage,
+			})
+		}
+	}
+
+	if pkg, ok := globals.RawGetString("package").(*lua.LTable); ok {
+		mw.visited[pkg] = true
+		if loaded, ok := pkg.RawGetString("loaded").(*lua.LTable); ok {
+			mw.visited[loaded] = true
+			loaded.ForEach(func(key, val lua.LValue) {
+				add(fmt.Sprintf("require(%q)", key.String()), val)
+			})
+		}
+	}
+
+	globals.ForEach(func(key, val lua.LValue) {
+		add(fmt.Sprintf("_G.%s", key.String()), val)
+	})
+
+	sort.SliceStable(consumers, func(i, j int) bool {
+		return consumers[i].Usage.Total() > consumers[j].Usage.Total()
+	})
+
+	if n > 0 && len(consumers) > n {
+		consumers = consumers[:n]
+	}
+
+	return consumers
+}
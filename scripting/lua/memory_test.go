@@ -0,0 +1,53 @@
+package lua_test
+
+import (
+	. "github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Engine memory", func() {
+	var engine *Engine
+
+	BeforeEach(func() {
+		engine = NewEngine()
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	It("grows as tables and strings are held", func() {
+		before := engine.MemoryUsage()
+		engine.DoString(`
+			hoard = {}
+			for i = 1, 100 do
+				hoard[i] = { name = string.rep("x", 100) }
+			end
+		`)
+		after := engine.MemoryUsage()
+
+		Ω(after.Tables - before.Tables).Should(BeNumerically(">=", 101))
+		Ω(after.StringBytes - before.StringBytes).Should(BeNumerically(">=", 100*100))
+	})
+
+	It("records the last usage measured", func() {
+		usage := engine.MemoryUsage()
+		Ω(engine.LastMemoryUsage()).Should(Equal(usage))
+	})
+
+	It("reports the largest consumers first", func() {
+		engine.DoString(`
+			small = { 1 }
+			large = {}
+			for i = 1, 100 do
+				large[i] = string.rep("x", 100)
+			end
+		`)
+		consumers := engine.MemoryConsumers(1)
+
+		Ω(consumers).Should(HaveLen(1))
+		Ω(consumers[0].Name).Should(Equal("_G.large"))
+	})
+})
@@ -18,6 +18,30 @@ const EnginePoolMetaKey = "engine pool"
 // executing code, etc...
 type EngineMutator func(*Engine)
 
+// HealthCheck is called with an engine as it's returned to the pool, if it
+// returns false the engine is closed and discarded rather than reused.
+type HealthCheck func(*Engine) bool
+
+// DefaultSpawnDelay is how long Get waits for an engine in use to be released
+// before spawning another.
+const DefaultSpawnDelay = 250 * time.Millisecond
+
+// DefaultHealthCheck discards engines that have been closed, that had a script
+// killed for exceeding it's budget (which can leave globals half updated) or
+// that are holding on to more memory than they're allowed. Scripts that fail
+// with an error don't make the engine unusable, LastError reports them.
+func DefaultHealthCheck(eng *Engine) bool {
+	if eng.closed || eng.exceeded {
+		return false
+	}
+
+	if eng.limits.Memory > 0 && eng.LastMemoryUsage().Total() > eng.limits.Memory {
+		return false
+	}
+
+	return true
+}
+
 // PooledEngine wraps a Lua engine. It's purpose is provide a means with which
 // to return the engine to the EnginePool when it's not longer being used.
 type PooledEngine struct {
@@ -30,133 +54,433 @@ type PooledEngine struct {
 // to prevent continued usage of the engine.
 func (pe *PooledEngine) Release() {
 	if pe.Engine != nil {
-		if !pe.pool.closed {
-			pe.pool.engines <- pe.Engine
-		}
+		pe.pool.put(pe.Engine)
 		pe.Engine = nil
 	}
 }
 
+// EnginePoolConfig defines how a pool is sized and how it manages it's
+// engines.
+//   MinSize engines are spawned when the pool is created and the pool will
+//     never evict below this number, defaults to 1.
+//   MaxSize is the most engines the pool will have at once, callers will wait
+//     for an engine to be released once this is reached, defaults to MinSize.
+//   IdleTimeout is how long an engine can sit unused before it's closed,
+//     0 means idle engines are never evicted.
+//   SpawnDelay is how long to wait for an engine in use to be released before
+//     spawning a new one, engines that are reused keep handlers registered
+//     by scripts at runtime. Defaults to DefaultSpawnDelay, a negative delay
+//     spawns right away.
+//   Mutator is used to prepare each engine spawned by the pool.
+//   HealthCheck decides if an engine can be reused, defaults to
+//     DefaultHealthCheck.
+type EnginePoolConfig struct {
+	MinSize     int
+	MaxSize     int
+	IdleTimeout time.Duration
+	SpawnDelay  time.Duration
+	Mutator     EngineMutator
+	HealthCheck HealthCheck
+}
+
+// track an engine along with information the pool needs to manage it.
+type poolEntry struct {
+	engine   *Engine
+	index    int
+	lastUsed time.Time
+	pins     int
+}
+
 // EnginePool represents a grouping of predefined/preloaded engines that can be
-// grabbed for use when Lua scripts need to run.
+// grabbed for use when Lua scripts need to run. Engines are spawned on demand
+// up to MaxSize and idle engines are evicted down to MinSize.
 type EnginePool struct {
-	MaxPoolSize   uint8
-	Mutator       EngineMutator
-	numEngines    uint8
-	engines       chan *Engine
-	cachedEngines []*Engine
-	mutex         *sync.Mutex
-	closed        bool
+	MinSize     int
+	MaxSize     int
+	IdleTimeout time.Duration
+	SpawnDelay  time.Duration
+	Mutator     EngineMutator
+	HealthCheck HealthCheck
+
+	mutex    *sync.Mutex
+	cond     *sync.Cond
+	idle     []*poolEntry
+	entries  map[*Engine]*poolEntry
+	spawning int
+	spawned  int
+	closed   bool
+	stop     chan struct{}
+	counters PoolCounters
 }
 
 // NewEnginePool constructs a new pool with the specific maximum size and the
 // engine mutator. It will seed the pool with one engine.
-func NewEnginePool(poolSize uint8, mutator EngineMutator) *EnginePool {
-	if poolSize == 0 {
-		poolSize = 1
+func NewEnginePool(poolSize int, mutator EngineMutator) *EnginePool {
+	return NewEnginePoolWithConfig(EnginePoolConfig{
+		MinSize: 1,
+		MaxSize: poolSize,
+		Mutator: mutator,
+	})
+}
+
+// NewEnginePoolWithConfig constructs a new pool from the given configuration,
+// spawning MinSize engines before returning.
+func NewEnginePoolWithConfig(config EnginePoolConfig) *EnginePool {
+	if config.MinSize < 1 {
+		config.MinSize = 1
+	}
+	if config.MaxSize < config.MinSize {
+		config.MaxSize = config.MinSize
+	}
+	if config.HealthCheck == nil {
+		config.HealthCheck = DefaultHealthCheck
+	}
+	if config.SpawnDelay == 0 {
+		config.SpawnDelay = DefaultSpawnDelay
 	}
+
 	ep := &EnginePool{
-		MaxPoolSize:   poolSize,
-		Mutator:       mutator,
-		numEngines:    1,
-		engines:       make(chan *Engine, poolSize),
-		mutex:         new(sync.Mutex),
-		cachedEngines: make([]*Engine, 0),
-		closed:        false,
+		MinSize:     config.MinSize,
+		MaxSize:     config.MaxSize,
+		IdleTimeout: config.IdleTimeout,
+		SpawnDelay:  config.SpawnDelay,
+		Mutator:     config.Mutator,
+		HealthCheck: config.HealthCheck,
+		mutex:       new(sync.Mutex),
+		entries:     make(map[*Engine]*poolEntry),
+		stop:        make(chan struct{}),
+	}
+	ep.cond = sync.NewCond(ep.mutex)
+
+	for i := 0; i < ep.MinSize; i++ {
+		ep.mutex.Lock()
+		ep.spawning++
+		ep.mutex.Unlock()
+
+		entry := ep.spawn()
+		ep.mutex.Lock()
+		ep.idle = append(ep.idle, entry)
+		ep.mutex.Unlock()
+	}
+
+	if ep.IdleTimeout > 0 {
+		go ep.evictLoop()
 	}
-	ep.engines <- ep.generateEngine()
 
 	return ep
 }
 
-// Len will return the number of engines that have been spawned during the
-// execution fo the pool.
+// Len will return the number of engines currently alive in the pool, whether
+// they're idle or in use.
 func (ep *EnginePool) Len() int {
-	return len(ep.cachedEngines)
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	return len(ep.entries)
 }
 
 // Get will fetch the next available engine from the EnginePool. If no engines
-// are available and the maximum number of active engines in the pool have been
-// created yet then the spawner will be invoked to spawn a new engine and return
-// that.
+// are available Get waits up to SpawnDelay for one to be released, after that
+// a new engine is spawned if the maximum number of engines has not been
+// reached, otherwise Get waits for an engine to be released. Returns nil if
+// the pool has been shut down.
 func (ep *EnginePool) Get() *PooledEngine {
+	start := time.Now()
+	spawnAt := start.Add(ep.SpawnDelay)
+
+	ep.mutex.Lock()
+	var (
+		entry *poolEntry
+		timer *time.Timer
+	)
+	for entry == nil {
+		if ep.closed {
+			ep.mutex.Unlock()
+
+			return nil
+		}
+
+		if n := len(ep.idle); n > 0 {
+			entry = ep.idle[n-1]
+			ep.idle = ep.idle[:n-1]
+
+			break
+		}
+
+		if len(ep.entries)+ep.spawning < ep.MaxSize {
+			// prefer an engine that's already in use over a fresh one
+			if len(ep.entries) > 0 && time.Now().Before(spawnAt) {
+				if timer == nil {
+					timer = time.AfterFunc(time.Until(spawnAt), ep.wake)
+				}
+				ep.cond.Wait()
+
+				continue
+			}
+
+			ep.spawning++
+			ep.mutex.Unlock()
+			entry = ep.spawn()
+			ep.mutex.Lock()
+
+			break
+		}
+
+		ep.cond.Wait()
+	}
+
+	ep.counters.Checkouts++
+	ep.counters.WaitTime += time.Since(start)
+	ep.mutex.Unlock()
+	if timer != nil {
+		timer.Stop()
+	}
+
+	pe := &PooledEngine{
+		Engine: entry.engine,
+		pool:   ep,
+	}
+	// NOTE: precaution to prevent leaks for long running servers, not a perfect
+	//       solution. BE DILIGENT AND RELEASE YOUR ENGINES!!
+	runtime.SetFinalizer(pe, (*PooledEngine).Release)
+
+	return pe
+}
+
+// wake everyone waiting on the pool so they can check it again
+func (ep *EnginePool) wake() {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	ep.cond.Broadcast()
+}
+
+// put returns the engine to the pool, discarding it if it fails the health
+// check.
+func (ep *EnginePool) put(eng *Engine) {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	entry, ok := ep.entries[eng]
+	if !ok {
+		return
+	}
+
 	if ep.closed {
-		return nil
+		delete(ep.entries, eng)
+		eng.Close()
+
+		return
 	}
 
-	if ep.MaxPoolSize == 0 {
-		ep.MaxPoolSize = 1
+	if !ep.HealthCheck(eng) {
+		delete(ep.entries, eng)
+		ep.counters.Discarded++
+		go eng.Close()
+		if len(ep.entries)+ep.spawning < ep.MinSize {
+			ep.spawning++
+			go ep.replace()
+		}
+		ep.cond.Broadcast()
+
+		return
 	}
 
-	var engine *Engine
-	select {
-	case eng := <-ep.engines:
-		engine = eng
-	case <-time.After(250 * time.Millisecond):
-		if uint8(ep.Len()) < ep.MaxPoolSize {
-			ep.mutex.Lock()
-			engine = ep.generateEngine()
+	eng.state.SetTop(0)
+	entry.lastUsed = time.Now()
+	ep.idle = append(ep.idle, entry)
+	// callers of Acquire wait on specific engines, so everyone is woken
+	ep.cond.Broadcast()
+}
+
+// Acquire checks out a specific engine from the pool, waiting for it to be
+// released if it's currently in use. This is used to resume tasks that were
+// suspended in the engine. Returns nil if the engine no longer belongs to
+// the pool.
+func (ep *EnginePool) Acquire(eng *Engine) *PooledEngine {
+	start := time.Now()
+
+	ep.mutex.Lock()
+	var entry *poolEntry
+	for entry == nil {
+		if _, ok := ep.entries[eng]; !ok || ep.closed {
 			ep.mutex.Unlock()
-		} else {
-			engine = <-ep.engines
+
+			return nil
+		}
+
+		for i, idle := range ep.idle {
+			if idle.engine == eng {
+				entry = idle
+				ep.idle = append(ep.idle[:i], ep.idle[i+1:]...)
+
+				break
+			}
+		}
+
+		if entry == nil {
+			ep.cond.Wait()
 		}
 	}
-	// if len(ep.engines) > 0 {
 
-	// } else if uint8(ep.Len()) < ep.MaxPoolSize {
-	// 	ep.mutex.Lock()
-	// 	engine = ep.generateEngine()
-	// 	ep.mutex.Unlock()
-	// } else {
-	// 	engine = <-ep.engines
-	// }
+	ep.counters.Checkouts++
+	ep.counters.WaitTime += time.Since(start)
+	ep.mutex.Unlock()
 
 	pe := &PooledEngine{
-		Engine: engine,
+		Engine: entry.engine,
 		pool:   ep,
 	}
-	// NOTE: precaution to prevent leaks for long running servers, not a perfect
-	//       solution. BE DILIGENT AND RELEASE YOUR ENGINES!!
 	runtime.SetFinalizer(pe, (*PooledEngine).Release)
 
 	return pe
 }
 
+// pin prevents the engine from being evicted while it has suspended tasks
+func (ep *EnginePool) pin(eng *Engine) {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if entry, ok := ep.entries[eng]; ok {
+		entry.pins++
+	}
+}
+
+// unpin releases a pin placed on the engine
+func (ep *EnginePool) unpin(eng *Engine) {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if entry, ok := ep.entries[eng]; ok && entry.pins > 0 {
+		entry.pins--
+	}
+}
+
 // EachEngine will call the provided handler with each engine. IN NO WAY SHOULD
 // THIS BE USED TO UNDERMINE GET, THIS IS FOR MAINTENANCE.
 func (ep *EnginePool) EachEngine(fn func(*Engine)) {
-	for _, eng := range ep.cachedEngines {
+	ep.mutex.Lock()
+	engines := make([]*Engine, 0, len(ep.entries))
+	for eng := range ep.entries {
+		engines = append(engines, eng)
+	}
+	ep.mutex.Unlock()
+
+	for _, eng := range engines {
 		fn(eng)
 	}
 }
 
-// Shutdown will empty the channel, close all generated engines and mark the
-// pool closed.
+// EvictIdle closes engines that have been idle longer than the IdleTimeout,
+// never dropping the pool below MinSize. Returns the number of engines
+// evicted. This is called periodically when the pool has an IdleTimeout.
+func (ep *EnginePool) EvictIdle() int {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if ep.closed || ep.IdleTimeout <= 0 {
+		return 0
+	}
+
+	evicted := 0
+	cutoff := time.Now().Add(-ep.IdleTimeout)
+	idle := ep.idle[:0]
+	for _, entry := range ep.idle {
+		// engines with suspended tasks are kept so the tasks can be resumed
+		if len(ep.entries) <= ep.MinSize || entry.pins > 0 || entry.lastUsed.After(cutoff) {
+			idle = append(idle, entry)
+
+			continue
+		}
+
+		delete(ep.entries, entry.engine)
+		go entry.engine.Close()
+		evicted++
+	}
+	ep.idle = idle
+	ep.counters.Evicted += uint64(evicted)
+
+	return evicted
+}
+
+// periodically evict idle engines until the pool is shut down
+func (ep *EnginePool) evictLoop() {
+	ticker := time.NewTicker(ep.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ep.EvictIdle()
+		case <-ep.stop:
+			return
+		}
+	}
+}
+
+// Shutdown will close all idle engines and mark the pool closed, engines that
+// are currently in use are closed as they are released.
 func (ep *EnginePool) Shutdown() {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
 	if !ep.closed {
 		ep.closed = true
+		close(ep.stop)
 
-		close(ep.engines)
-
-		for range ep.engines {
-			// emptyting out the engines channel
+		for _, entry := range ep.idle {
+			delete(ep.entries, entry.engine)
+			entry.engine.Close()
 		}
+		ep.idle = nil
 
-		for _, eng := range ep.cachedEngines {
-			eng.Close()
-		}
+		ep.cond.Broadcast()
+	}
+}
+
+// spawn an idle engine in place of one that was discarded, so the pool doesn't
+// drop below MinSize. This expects ep.spawning to have been incremented by the
+// caller.
+func (ep *EnginePool) replace() {
+	entry := ep.spawn()
+
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if ep.closed {
+		delete(ep.entries, entry.engine)
+		entry.engine.Close()
+
+		return
 	}
+
+	ep.idle = append(ep.idle, entry)
+	ep.cond.Broadcast()
 }
 
-// create a new engine for use in the pool
-func (ep *EnginePool) generateEngine() *Engine {
+// create a new engine for use in the pool, this expects ep.spawning to have
+// been incremented by the caller and must be called without holding the lock.
+func (ep *EnginePool) spawn() *poolEntry {
 	eng := NewEngine()
 	eng.Meta[keys.Pool] = ep
-	ep.cachedEngines = append(ep.cachedEngines, eng)
 
 	if ep.Mutator != nil {
 		ep.Mutator(eng)
 	}
+	eng.MemoryUsage()
+
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	entry := &poolEntry{
+		engine:   eng,
+		index:    ep.spawned,
+		lastUsed: time.Now(),
+	}
+	ep.spawned++
+	ep.spawning--
+	ep.counters.Spawned++
+	ep.entries[eng] = entry
 
-	return eng
+	return entry
 }
@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package lua
+
+import (
+	"sort"
+	"time"
+)
+
+// PoolCounters are running totals kept by an EnginePool over it's lifetime.
+//   Checkouts is the number of times an engine was fetched with Get.
+//   WaitTime is the total time spent in Get waiting for (or spawning) an
+//     engine.
+//   Spawned is the number of engines the pool has created.
+//   Discarded is the number of engines thrown away for failing a health check.
+//   Evicted is the number of engines closed for sitting idle too long.
+type PoolCounters struct {
+	Checkouts uint64
+	WaitTime  time.Duration
+	Spawned   uint64
+	Discarded uint64
+	Evicted   uint64
+}
+
+// AverageWait returns the average time a call to Get has waited for an
+// engine.
+func (pc PoolCounters) AverageWait() time.Duration {
+	if pc.Checkouts == 0 {
+		return 0
+	}
+
+	return pc.WaitTime / time.Duration(pc.Checkouts)
+}
+
+// EngineStats reports on a single engine within a pool, Index is the order in
+// which the engine was spawned.
+type EngineStats struct {
+	Index  int
+	Idle   bool
+	Memory MemoryStats
+}
+
+// PoolStats is a snapshot of the state of a pool. Memory is the combined usage
+// of every engine, as of the last time each was measured.
+type PoolStats struct {
+	PoolCounters
+	Size    int
+	Idle    int
+	InUse   int
+	MinSize int
+	MaxSize int
+	Engines []EngineStats
+	Memory  MemoryStats
+}
+
+// Stats returns a snapshot of the pool, it's counters and the memory used by
+// it's engines. This is safe to call while engines are in use.
+func (ep *EnginePool) Stats() PoolStats {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	idle := make(map[*Engine]bool, len(ep.idle))
+	for _, entry := range ep.idle {
+		idle[entry.engine] = true
+	}
+
+	stats := PoolStats{
+		PoolCounters: ep.counters,
+		Size:         len(ep.entries),
+		Idle:         len(ep.idle),
+		InUse:        len(ep.entries) - len(ep.idle),
+		MinSize:      ep.MinSize,
+		MaxSize:      ep.MaxSize,
+	}
+	for _, entry := range ep.entries {
+		usage := entry.engine.LastMemoryUsage()
+		stats.Engines = append(stats.Engines, EngineStats{
+			Index:  entry.index,
+			Idle:   idle[entry.engine],
+			Memory: usage,
+		})
+		stats.Memory = stats.Memory.add(usage)
+	}
+	sort.Slice(stats.Engines, func(i, j int) bool {
+		return stats.Engines[i].Index < stats.Engines[j].Index
+	})
+
+	return stats
+}
@@ -0,0 +1,175 @@
+package lua_test
+
+import (
+	"time"
+
+	. "github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EnginePool", func() {
+	var (
+		pool   *EnginePool
+		config EnginePoolConfig
+	)
+
+	BeforeEach(func() {
+		config = EnginePoolConfig{
+			MinSize: 1,
+			MaxSize: 2,
+		}
+	})
+
+	JustBeforeEach(func() {
+		pool = NewEnginePoolWithConfig(config)
+	})
+
+	AfterEach(func() {
+		pool.Shutdown()
+	})
+
+	It("spawns the minimum number of engines", func() {
+		Ω(pool.Len()).Should(Equal(1))
+	})
+
+	It("spawns engines on demand up to the maximum", func() {
+		one := pool.Get()
+		two := pool.Get()
+		defer one.Release()
+		defer two.Release()
+
+		Ω(pool.Len()).Should(Equal(2))
+		Ω(pool.Stats().InUse).Should(Equal(2))
+	})
+
+	It("waits for a released engine once the maximum is reached", func() {
+		one := pool.Get()
+		two := pool.Get()
+		defer two.Release()
+
+		got := make(chan *Engine)
+		go func() {
+			eng := pool.Get()
+			got <- eng.Engine
+			eng.Release()
+		}()
+
+		Consistently(got).ShouldNot(Receive())
+		eng := one.Engine
+		one.Release()
+		Eventually(got).Should(Receive(Equal(eng)))
+	})
+
+	It("counts checkouts and spawns", func() {
+		for i := 0; i < 3; i++ {
+			pool.Get().Release()
+		}
+		stats := pool.Stats()
+
+		Ω(stats.Checkouts).Should(Equal(uint64(3)))
+		Ω(stats.Spawned).Should(Equal(uint64(1)))
+	})
+
+	It("reuses an engine released before it would spawn another", func() {
+		one := pool.Get()
+		eng := one.Engine
+		time.AfterFunc(10*time.Millisecond, one.Release)
+		two := pool.Get()
+		defer two.Release()
+
+		Ω(two.Engine).Should(Equal(eng))
+		Ω(pool.Len()).Should(Equal(1))
+	})
+
+	It("returns nil once shut down", func() {
+		pool.Shutdown()
+
+		Ω(pool.Get()).Should(BeNil())
+	})
+
+	Context("with a health check", func() {
+		BeforeEach(func() {
+			config.HealthCheck = func(eng *Engine) bool {
+				return eng.GetGlobal("broken").IsNil()
+			}
+		})
+
+		It("discards engines that fail it", func() {
+			eng := pool.Get()
+			eng.DoString("broken = true")
+			eng.Release()
+
+			Ω(pool.Stats().Discarded).Should(Equal(uint64(1)))
+		})
+
+		It("spawns engines to replace them", func() {
+			eng := pool.Get()
+			eng.DoString("broken = true")
+			eng.Release()
+
+			Eventually(pool.Len).Should(Equal(1))
+			eng = pool.Get()
+			defer eng.Release()
+			Ω(eng.GetGlobal("broken").IsNil()).Should(BeTrue())
+		})
+
+		It("keeps engines that pass it", func() {
+			pool.Get().Release()
+
+			Ω(pool.Len()).Should(Equal(1))
+		})
+	})
+
+	Context("when engines exceed their limits", func() {
+		BeforeEach(func() {
+			config.Mutator = func(eng *Engine) {
+				eng.DoString("function forever() while true do end end")
+				eng.SetExecutionLimits(ExecutionLimits{Instructions: 1000})
+			}
+		})
+
+		It("discards them", func() {
+			eng := pool.Get()
+			eng.Call("forever", 0)
+			eng.Release()
+
+			Ω(pool.Stats().Discarded).Should(Equal(uint64(1)))
+		})
+	})
+
+	Context("when scripts fail", func() {
+		It("keeps the engine", func() {
+			eng := pool.Get()
+			eng.DoString(`x = 1`)
+			eng.DoString(`error("boom")`)
+			Ω(eng.LastError()).ShouldNot(BeNil())
+			eng.Release()
+
+			Ω(pool.Len()).Should(Equal(1))
+			Ω(pool.Stats().Discarded).Should(Equal(uint64(0)))
+			eng = pool.Get()
+			defer eng.Release()
+			Ω(eng.GetGlobal("x").AsNumber()).Should(Equal(float64(1)))
+		})
+	})
+
+	Context("with an idle timeout", func() {
+		BeforeEach(func() {
+			config.IdleTimeout = time.Millisecond
+		})
+
+		It("evicts idle engines down to the minimum", func() {
+			one := pool.Get()
+			two := pool.Get()
+			one.Release()
+			two.Release()
+			time.Sleep(5 * time.Millisecond)
+			pool.EvictIdle()
+
+			Ω(pool.Len()).Should(Equal(1))
+			Ω(pool.Stats().Evicted).Should(BeNumerically(">=", 1))
+		})
+	})
+})
@@ -484,14 +484,15 @@ func (v *Value) Call(retCount int, argList ...interface{}) ([]*Value, error) {
 			args[i] = getLValue(v.owner, iface)
 		}
 
-		err := v.owner.state.CallByParam(p, args...)
+		err := v.owner.protectedCall(p, args...)
 		if err != nil {
 			return nil, err
 		}
 
 		retVals := make([]*Value, retCount)
-		for i := 0; i < retCount; i++ {
+		for i := retCount - 1; i >= 0; i-- {
 			retVals[i] = v.owner.ValueFor(v.owner.state.Get(-1))
+			v.owner.state.Pop(1)
 		}
 
 		return retVals, nil
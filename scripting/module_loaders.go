@@ -8,22 +8,29 @@ import (
 )
 
 var simpleModuleMap = map[string]lua.TableMap{
-	"tmpl":     modules.Tmpl,
-	"password": modules.Password,
-	"die":      modules.Die,
-	"random":   modules.Random,
-	"events":   modules.Events,
-	"log":      modules.Log,
-	"sutil":    modules.Sutil,
-	"cli":      modules.Cli,
-	"config":   modules.Config,
-	"time":     modules.Time,
-	"uuid":     modules.UUID,
+	"tmpl":      modules.Tmpl,
+	"password":  modules.Password,
+	"die":       modules.Die,
+	"events":    modules.Events,
+	"log":       modules.Log,
+	"sutil":     modules.Sutil,
+	"cli":       modules.Cli,
+	"config":    modules.Config,
+	"time":      modules.Time,
+	"uuid":      modules.UUID,
+	"pool":      modules.Pool,
+	"async":     modules.Async,
+	"world":     modules.World,
+	"scripts":   modules.Scripts,
+	"inventory": modules.Inventory,
+	"channels":  modules.Channels,
 }
 
 var complexModuleMap = map[string]func(*lua.Engine){
-	"talon": modules.TalonLoader,
-	"fn":    modules.ScriptLoader("modules/fn.lua"),
+	"talon":  modules.TalonLoader,
+	"entity": modules.EntityLoader,
+	"random": modules.RandomLoader,
+	"fn":     modules.ScriptLoader("modules/fn.lua"),
 }
 
 // OpenLibs will open all modules given to the function as defined in the
@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+)
+
+// Async allows scripts to wait without holding on to an engine. Functions that
+// wait can only be called from within a task, event handlers are always run as
+// tasks and async.run can be used to start new ones. While a task is waiting
+// the engine is free for other scripts to use. Only engines that belong to a
+// pool can wait, elsewhere (such as the REPL) waiting raises an error.
+//   run(fn, ...)
+//     @param fn: function = the function to run as a task
+//     @param ...: any = arguments to pass to the function
+//     start a new task, it runs until it finishes or waits before returning.
+//   sleep(duration)
+//     @param duration: number | string | table = how long to wait, any value
+//       accepted by time.duration
+//     pause the current task for the given duration.
+//   wait(event[, timeout]): table | nil, string
+//     @param event: string = the event to wait for.
+//     @param timeout: number | string | table = the longest to wait for the
+//       event, any value accepted by time.duration; default: no timeout
+//     pause the current task until the event is emitted, returning the event
+//     data. If the timeout passes first nil and "timeout" are returned.
+//   all(...): table, string
+//     @param ...: function = functions to run as tasks
+//     run each function as it's own task, waiting for all of them to finish.
+//     Returns a table with the first value returned from each function (in
+//     the order given). If any of them fail, the error is returned as the
+//     second value.
+var Async = lua.TableMap{
+	"run": func(eng *lua.Engine) int {
+		args := popArgs(eng)
+		if len(args) == 0 || !args[0].IsFunction() {
+			eng.ArgumentError(1, "expected a function to run")
+
+			return 0
+		}
+
+		fnArgs := make([]interface{}, len(args)-1)
+		for i, arg := range args[1:] {
+			fnArgs[i] = arg
+		}
+		task := eng.Go(args[0], fnArgs...)
+		logTaskFailure(eng, task)
+
+		return 0
+	},
+	"sleep": func(eng *lua.Engine) int {
+		dur := durationFromValue(eng.PopValue())
+
+		return eng.Suspend(func(resume lua.ResumeFunc) {
+			time.AfterFunc(dur, func() {
+				resume()
+			})
+		})
+	},
+	"wait": func(eng *lua.Engine) int {
+		var timeout time.Duration
+		if eng.StackSize() >= 2 {
+			timeout = durationFromValue(eng.PopValue())
+		}
+		evt := eng.PopValue().AsString()
+		ee := externalEmitterForEngine(eng)
+
+		return eng.Suspend(func(resume lua.ResumeFunc) {
+			w := &eventWaiter{resume: resume}
+			ee.Once(evt, w)
+			if timeout > 0 {
+				time.AfterFunc(timeout, func() {
+					ee.Remove(evt, w)
+					resume(nil, "timeout")
+				})
+			}
+		})
+	},
+	"all": func(eng *lua.Engine) int {
+		fns := popArgs(eng)
+		for i, fn := range fns {
+			if !fn.IsFunction() {
+				eng.ArgumentError(i+1, "expected a function")
+
+				return 0
+			}
+		}
+
+		return eng.Suspend(func(resume lua.ResumeFunc) {
+			tasks := make([]*lua.Task, len(fns))
+			for i, fn := range fns {
+				tasks[i] = eng.Go(fn)
+			}
+
+			go func() {
+				// keyed by position so that nil results don't shift the others
+				results := make(map[int]interface{})
+				var errMsg interface{}
+				for i, task := range tasks {
+					<-task.Done()
+					if err := task.Err(); err != nil {
+						if errMsg == nil {
+							errMsg = err.Error()
+						}
+
+						continue
+					}
+
+					if vals := task.Results(); len(vals) > 0 {
+						results[i+1] = vals[0]
+					}
+				}
+
+				resume(results, errMsg)
+			}()
+		})
+	},
+}
+
+// eventWaiter resumes a task waiting for an event, only the first of the event
+// or the timeout will resume the task.
+type eventWaiter struct {
+	resume lua.ResumeFunc
+}
+
+// Call resumes the waiting task with the event data.
+func (ew *eventWaiter) Call(d events.Data) error {
+	ew.resume(map[string]interface{}(d))
+
+	return nil
+}
+
+// Source returns the waiter itself, as each waiter is unique.
+func (ew *eventWaiter) Source() interface{} {
+	return ew
+}
+
+// pop all arguments off the stack, returning them in the order given
+func popArgs(eng *lua.Engine) []*lua.Value {
+	args := make([]*lua.Value, eng.StackSize())
+	for i := len(args) - 1; i >= 0; i-- {
+		args[i] = eng.PopValue()
+	}
+
+	return args
+}
+
+// log the error if the task fails, whenever it finishes
+func logTaskFailure(eng *lua.Engine, task *lua.Task) {
+	l := log("async").WithField("engine", nameForEngine(eng))
+	go func() {
+		<-task.Done()
+		if err := task.Err(); err != nil {
+			l.WithError(err).Error("Task failed.")
+		}
+	}()
+}
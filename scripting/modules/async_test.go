@@ -0,0 +1,108 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Async Lua Module", func() {
+	var (
+		p       *lua.EnginePool
+		em      *events.Emitter
+		results chan interface{}
+	)
+
+	BeforeEach(func() {
+		results = make(chan interface{}, 4)
+		em = events.NewEmitter(logger.New().WithField("note", "async_emitter"))
+		p = lua.NewEnginePool(1, func(e *lua.Engine) {
+			e.Meta[keys.ExternalEmitter] = em
+
+			e.OpenChannel()
+			scripting.OpenLibs(e, "async", "events")
+
+			e.SetGlobal("results", results)
+			e.DoString(`async = require("async")`)
+		})
+	})
+
+	AfterEach(func() {
+		p.Shutdown()
+	})
+
+	run := func(script string) {
+		eng := p.Get()
+		defer eng.Release()
+
+		err := eng.DoString(script)
+		Ω(err).Should(BeNil())
+	}
+
+	It("does not hold the engine while sleeping", func() {
+		run(`
+			async.run(function()
+				async.sleep("20ms")
+				results:send("awake")
+			end)
+		`)
+
+		Ω(p.Stats().InUse).Should(Equal(0))
+		Eventually(results).Should(Receive(Equal("awake")))
+	})
+
+	It("waits for events", func() {
+		run(`
+			async.run(function()
+				local data = async.wait("test:ready")
+				results:send(data.value)
+			end)
+		`)
+
+		em.Emit("test:ready", events.Data{"value": "ready"})
+		Eventually(results).Should(Receive(Equal("ready")))
+	})
+
+	It("stops waiting for events after a timeout", func() {
+		run(`
+			async.run(function()
+				local data, err = async.wait("test:never", "10ms")
+				results:send(err)
+			end)
+		`)
+
+		Eventually(results).Should(Receive(Equal("timeout")))
+	})
+
+	It("waits for all tasks to finish", func() {
+		run(`
+			async.run(function()
+				local values = async.all(
+					function()
+						async.sleep("10ms")
+						return 1
+					end,
+					function()
+						return 2
+					end
+				)
+				results:send(values[1] + values[2])
+			end)
+		`)
+
+		Eventually(results).Should(Receive(Equal(float64(3))))
+	})
+
+	It("cannot suspend outside of a task", func() {
+		eng := p.Get()
+		defer eng.Release()
+
+		err := eng.DoString(`async.sleep(1)`)
+		Ω(err).ShouldNot(BeNil())
+	})
+})
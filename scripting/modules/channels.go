@@ -0,0 +1,287 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"github.com/bbuck/dragon-mud/channels"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/session"
+)
+
+// Channels sends text between players, it's rendered with the channels.say,
+// channels.tell and channels.channel views (which the game can replace) and
+// sent to each player's session. Anywhere an entity is expected it's table
+// or id can be given. Functions that can fail for reasons a player might
+// cause (telling someone who isn't connected, joining a private channel)
+// return nil or false and an error message.
+//   say(speaker, message): boolean
+//     send the message to everyone in the speaker's room.
+//   tell(sender, to, message): boolean
+//     send the message to a player, they must be connected.
+//   create(name, [options]): table
+//     @param name: string = the name of the channel, names are case
+//       insensitive
+//     @param options: table = any of:
+//       description: string = what the channel is for
+//       history: number = the number of messages to keep; default: 50
+//       private: boolean = only entities allowed with allow can join
+//       required: boolean = members can't leave
+//     create a channel, channels are tables with name and the options.
+//   channel(name): table
+//     fetch the channel with the name, or nil.
+//   list(): table
+//     list every channel, sorted by name.
+//   destroy(name): boolean
+//     remove the channel.
+//   allow(name, entity), disallow(name, entity): boolean
+//     let the entity join the private channel, or stop them.
+//   join(name, entity), leave(name, entity): boolean
+//     add the entity to (or remove them from) the channel's members.
+//   send(name, sender, message): boolean
+//     send the message to every member of the channel.
+//   members(name): table
+//     list the ids of the channel's members.
+//   memberships(entity): table
+//     list the names of the channels the entity is a member of.
+//   history(name, [count]): table
+//     @param count: number = the number of messages; default: all of them
+//     the last messages sent to the channel, oldest first, as tables with
+//     channel, sender, sender_name, message and time (in seconds).
+//   ignore(entity, other), unignore(entity, other): boolean
+//     stop (or start) text from the other entity reaching the entity.
+//   ignoring(entity): table
+//     list the ids of those the entity is ignoring.
+//   attach(entity, session)
+//     @param session: userdata = the session given with the player:connect
+//       server event
+//     send text for the entity to the session, replacing any it had. The
+//       session is released when the player disconnects.
+//   detach(entity)
+//     stop sending text to the entity.
+//   on(event, fn)
+//     @param event: string = channels:say, channels:tell, channels:message,
+//       channels:join or channels:leave, or one of them with before: or
+//       after:
+//     @param fn: function = called with a table of the event's data
+//     call the function when text is sent or channels are joined or left.
+//     Returning false (or an error message) from a before: handler stops it.
+//       channels.on("before:channels:say", function(evt)
+//         if muted[evt.speaker] then
+//           return "You can't speak."
+//         end
+//       end)
+var Channels = lua.TableMap{
+	"say": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Say(idArg(args, 0), stringArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"tell": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Tell(idArg(args, 0), idArg(args, 1), stringArg(args, 2))
+
+		return pushWorldResult(engine, err)
+	},
+	"create": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		c, err := channelsFor(engine).Create(stringArg(args, 0), channelOptionsArg(args, 1))
+
+		return pushChannel(engine, c, err)
+	},
+	"channel": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		c, err := channelsFor(engine).Channel(stringArg(args, 0))
+
+		return pushChannel(engine, c, err)
+	},
+	"list": func(engine *lua.Engine) int {
+		popArgs(engine)
+		list := engine.NewTable()
+		for _, c := range channelsFor(engine).Channels() {
+			list.Append(channelToLua(engine, c))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"destroy": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, channelsFor(engine).Destroy(stringArg(args, 0)))
+	},
+	"allow": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Allow(stringArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"disallow": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Disallow(stringArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"join": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Join(stringArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"leave": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Leave(stringArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"send": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Send(stringArg(args, 0), idArg(args, 1), stringArg(args, 2))
+
+		return pushWorldResult(engine, err)
+	},
+	"members": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		ids, err := channelsFor(engine).Members(stringArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(engine.TableFromSlice(ids))
+
+		return 1
+	},
+	"memberships": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		names := channelsFor(engine).Memberships(idArg(args, 0))
+		engine.PushValue(engine.TableFromSlice(names))
+
+		return 1
+	},
+	"history": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		messages, err := channelsFor(engine).History(stringArg(args, 0), intArg(args, 1))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, m := range messages {
+			tbl := engine.NewTable()
+			tbl.Set("channel", m.Channel)
+			tbl.Set("sender", m.Sender)
+			tbl.Set("sender_name", m.SenderName)
+			tbl.Set("message", m.Text)
+			tbl.Set("time", m.Time.Unix())
+			list.Append(tbl)
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"ignore": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := channelsFor(engine).Ignore(idArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"unignore": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		channelsFor(engine).Unignore(idArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, nil)
+	},
+	"ignoring": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		ids := channelsFor(engine).Ignoring(idArg(args, 0))
+		engine.PushValue(engine.TableFromSlice(ids))
+
+		return 1
+	},
+	"attach": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		var sess session.Session
+		if len(args) > 1 {
+			sess, _ = args[1].Interface().(session.Session)
+		}
+		if sess == nil {
+			engine.RaiseError("expected an entity and a session")
+
+			return 0
+		}
+		channelsFor(engine).Attach(idArg(args, 0), sess)
+
+		return 0
+	},
+	"detach": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		channelsFor(engine).Detach(idArg(args, 0))
+
+		return 0
+	},
+	"on": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		if len(args) < 2 || !args[1].IsFunction() {
+			engine.RaiseError("expected an event name and a function")
+
+			return 0
+		}
+		bindHook(engine, keys.ChannelHooks, stringArg(args, 0), args[1], channelsFor(engine).On)
+
+		return 0
+	},
+}
+
+// fetch the channels, raising an error if they aren't running. Handlers for
+// before events are run on the engine while it's waiting on the channels.
+func channelsFor(engine *lua.Engine) *channels.Service {
+	s, ok := engine.Meta[keys.Channels].(*channels.Service)
+	if !ok {
+		engine.RaiseError("channels aren't running")
+
+		return nil
+	}
+
+	return s.WithCaller(engine.Root())
+}
+
+func channelOptionsArg(args []*lua.Value, i int) channels.Options {
+	var opts channels.Options
+	if i >= len(args) || !args[i].IsTable() {
+		return opts
+	}
+
+	tbl := args[i]
+	if desc := tbl.Get("description"); desc.IsString() {
+		opts.Description = desc.AsString()
+	}
+	if history := tbl.Get("history"); history.IsNumber() {
+		opts.History = int(history.AsNumber())
+	}
+	opts.Private = tbl.Get("private").IsTrue()
+	opts.Required = tbl.Get("required").IsTrue()
+
+	return opts
+}
+
+func pushChannel(engine *lua.Engine, c *channels.Channel, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(channelToLua(engine, c))
+
+	return 1
+}
+
+func channelToLua(engine *lua.Engine, c *channels.Channel) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("name", c.Name)
+	if c.Description != "" {
+		tbl.Set("description", c.Description)
+	}
+	tbl.Set("history", c.History)
+	tbl.Set("private", c.Private)
+	tbl.Set("required", c.Required)
+
+	return tbl
+}
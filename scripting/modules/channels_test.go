@@ -0,0 +1,130 @@
+package modules_test
+
+import (
+	"bytes"
+
+	"github.com/bbuck/dragon-mud/channels"
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/session"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Channels Module", func() {
+	var (
+		engine   *lua.Engine
+		env      string
+		alice    *bytes.Buffer
+		bob      *bytes.Buffer
+		sessions *session.Registry
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "channels_test")
+		viper.Set("database.channels_test.adapter", data.MemoryAdapter)
+
+		w, err := data.World()
+		Ω(err).Should(BeNil())
+		sessions = session.NewRegistry()
+		engine = lua.NewEngine()
+		engine.Meta[keys.Channels] = channels.New(w, sessions)
+		scripting.OpenLibs(engine, "world", "channels")
+		err = engine.DoString(`
+			world = require("world")
+			channels = require("channels")
+
+			square = world.create_room("Town Square")
+			alice = world.spawn(world.create_prototype("mobile", 1, "Alice"), square)
+			bob = world.spawn(world.create_prototype("mobile", 2, "Bob"), square)
+		`)
+		Ω(err).Should(BeNil())
+
+		alice, bob = new(bytes.Buffer), new(bytes.Buffer)
+		sessions.Attach(engine.GetGlobal("alice").AsString(), session.NewWriter(alice))
+		sessions.Attach(engine.GetGlobal("bob").AsString(), session.NewWriter(bob))
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("says and tells", func() {
+		err := engine.DoString(`
+			channels.say(alice, "Hello.")
+			channels.tell(bob, alice, "Hi!")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(alice.String()).Should(Equal("You say, \"Hello.\"\r\nBob tells you, \"Hi!\"\r\n"))
+		Ω(bob.String()).Should(Equal("Alice says, \"Hello.\"\r\nYou tell Alice, \"Hi!\"\r\n"))
+	})
+
+	It("sends to channels and keeps their history", func() {
+		err := engine.DoString(`
+			ooc = channels.create("OOC", { description = "Out of character" })
+			channels.join("ooc", alice)
+			channels.join("ooc", bob)
+			channels.send("ooc", alice, "Anyone around?")
+
+			history = channels.history("ooc")
+			members = #channels.members("ooc")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(bob.String()).Should(Equal("[ooc] Alice: Anyone around?\r\n"))
+		Ω(engine.GetGlobal("ooc").Get("name").AsString()).Should(Equal("ooc"))
+		Ω(engine.GetGlobal("members").AsNumber()).Should(Equal(float64(2)))
+		first := engine.GetGlobal("history").Get(1)
+		Ω(first.Get("message").AsString()).Should(Equal("Anyone around?"))
+		Ω(first.Get("sender_name").AsString()).Should(Equal("Alice"))
+	})
+
+	It("returns errors players can cause", func() {
+		err := engine.DoString(`
+			channels.create("immortals", { private = true })
+			joined, join_err = channels.join("immortals", bob)
+			channels.ignore(alice, bob)
+			told, tell_err = channels.tell(bob, alice, "Hello?")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("joined").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("join_err").AsString()).Should(Equal("channels: that channel is private"))
+		Ω(engine.GetGlobal("told").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("tell_err").AsString()).Should(Equal("channels: they're ignoring you"))
+	})
+
+	It("lets handlers stop messages", func() {
+		err := engine.DoString(`
+			channels.on("before:channels:say", function(evt)
+				return "You can't speak."
+			end)
+			said, say_err = channels.say(alice, "Hello.")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("said").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("say_err").AsString()).Should(Equal("You can't speak."))
+		Ω(bob.Len()).Should(Equal(0))
+	})
+
+	It("attaches sessions to entities", func() {
+		carol := new(bytes.Buffer)
+		engine.SetGlobal("conn", session.NewWriter(carol))
+		err := engine.DoString(`
+			carol = world.spawn(world.create_prototype("mobile", 3, "Carol"), square)
+			channels.attach(carol, conn)
+			told = channels.tell(alice, carol, "Welcome!")
+			channels.detach(carol)
+			told_again = channels.tell(alice, carol, "Hello?")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("told").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("told_again").AsBool()).Should(BeFalse())
+		Ω(carol.String()).Should(Equal("Alice tells you, \"Welcome!\"\r\n"))
+	})
+})
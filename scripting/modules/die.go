@@ -1,6 +1,8 @@
 package modules
 
 import (
+	"fmt"
+
 	"github.com/bbuck/dragon-mud/random"
 	"github.com/bbuck/dragon-mud/scripting/lua"
 )
@@ -27,21 +29,133 @@ import (
 //     @param die: string = the string defining how many of what to roll
 //     parse die input and roll the specified number of sided die, for example
 //     die.roll("3d8") will simulate rolling 3 8-sided die, and return the values
-//     as a table.
-var Die = lua.TableMap{
-	"d2":   random.D2,
-	"d4":   random.D4,
-	"d6":   random.D6,
-	"d8":   random.D8,
-	"d10":  random.D10,
-	"d12":  random.D12,
-	"d20":  random.D20,
-	"d100": random.D100,
-	"roll": func(e *lua.Engine) int {
-		str := e.PopString()
-		rolls := random.RollDie(str)
-		e.PushValue(e.TableFromSlice(rolls))
-
-		return 1
-	},
+//     as a table. Dice dropped by the expression aren't included and an
+//     invalid expression returns an empty table.
+//   total(expr): number
+//     @param expr: string = a dice expression like "4d6kh3+2"
+//     roll the expression and return the total, raises an error if the
+//     expression is invalid.
+//   evaluate(expr): table
+//     @param expr: string = a dice expression like "4d6kh3+2"
+//     roll the expression and return everything rolled, raises an error if the
+//     expression is invalid. The result looks like:
+//       {
+//         expression = "4d6kh3+2",
+//         total = 15,
+//         breakdown = "[6, 5, 2, ~1~] + 2",
+//         dice = {
+//           {
+//             notation = "4d6kh3",
+//             sides = 6,
+//             total = 13,
+//             rolls = {
+//               { value = 6, rerolls = {}, exploded = false, dropped = false },
+//               ...
+//             },
+//           },
+//         },
+//       }
+//     Expressions support keeping (kh, kl) and dropping (dh, dl) dice,
+//     rerolls (r, ro), exploding dice (!) and math with +, -, * and
+//     parentheses, for example "2d20kl1", "3d6r<2" or "1d6!+1d4-1".
+//   stream(name): table
+//     @param name: string = the name of the random number stream to roll with
+//     return a table with all of the functions in this module that rolls
+//     dice using the named stream (see the random module), seeding the stream
+//     makes every roll predictable.
+//       random.stream("combat").seed(42)
+//       local combat = die.stream("combat")
+//       combat.total("1d20+5")
+var Die = dieFunctions(random.RollDice, func(sides int) int {
+	return random.Intn(sides) + 1
+})
+
+// build the die functions, rolling dice with the functions given so they can
+// be used with the global generator or a stream.
+func dieFunctions(rollDice func(string) (*random.Roll, error), roll func(sides int) int) lua.TableMap {
+	fns := lua.TableMap{
+		"roll": func(e *lua.Engine) int {
+			str := e.PopString()
+			rolls := make([]int, 0)
+			if r, err := rollDice(str); err == nil {
+				rolls = r.Values()
+			}
+			e.PushValue(e.TableFromSlice(rolls))
+
+			return 1
+		},
+		"total": func(e *lua.Engine) int {
+			r := rollDiceExpr(e, rollDice)
+			e.PushValue(r.Total)
+
+			return 1
+		},
+		"evaluate": func(e *lua.Engine) int {
+			r := rollDiceExpr(e, rollDice)
+			e.PushValue(e.TableFromMap(rollToMap(r)))
+
+			return 1
+		},
+		"stream": func(e *lua.Engine) int {
+			s := random.Stream(e.PopString())
+			e.PushValue(e.TableFromMap(dieFunctions(s.RollDice, s.Roll)))
+
+			return 1
+		},
+	}
+	for _, sides := range []int{2, 4, 6, 8, 10, 12, 20, 100} {
+		sides := sides
+		fns[fmt.Sprintf("d%d", sides)] = func() int {
+			return roll(sides)
+		}
+	}
+
+	return fns
+}
+
+// pop the dice expression and roll it, raising an error if it's invalid
+func rollDiceExpr(e *lua.Engine, rollDice func(string) (*random.Roll, error)) *random.Roll {
+	str := e.PopString()
+	r, err := rollDice(str)
+	if err != nil {
+		// expressions can contain a %, so don't let it be read as a format
+		e.RaiseError("%s", err.Error())
+
+		return &random.Roll{}
+	}
+
+	return r
+}
+
+// convert the roll into the table returned by evaluate
+func rollToMap(r *random.Roll) map[string]interface{} {
+	dice := make([]map[string]interface{}, 0, len(r.Dice))
+	for _, group := range r.Dice {
+		rolls := make([]map[string]interface{}, 0, len(group.Rolls))
+		for _, d := range group.Rolls {
+			rerolls := d.Rerolls
+			if rerolls == nil {
+				rerolls = []int{}
+			}
+			rolls = append(rolls, map[string]interface{}{
+				"value":    d.Value,
+				"rerolls":  rerolls,
+				"exploded": d.Exploded,
+				"dropped":  d.Dropped,
+			})
+		}
+		dice = append(dice, map[string]interface{}{
+			"notation": group.Notation,
+			"sides":    group.Sides,
+			"total":    group.Total,
+			"rolls":    rolls,
+		})
+	}
+
+	return map[string]interface{}{
+		"expression": r.Expression,
+		"total":      r.Total,
+		"breakdown":  r.Breakdown,
+		"dice":       dice,
+	}
 }
@@ -38,7 +38,7 @@ func validateRange(i interface{}, min, max float64) {
 
 var _ = Describe("Die", func() {
 	e := lua.NewEngine()
-	scripting.OpenLibs(e, "die")
+	scripting.OpenLibs(e, "die", "random")
 	e.DoString(`
 		local die = require("die")
 		function callSimple(name)
@@ -78,4 +78,59 @@ var _ = Describe("Die", func() {
 			validateRange(i, 1, 8)
 		}
 	})
+
+	Describe("total()", func() {
+		It("totals the expression", func() {
+			err := e.DoString(`total = require("die").total("2d1+3")`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("total").AsNumber()).Should(Equal(float64(5)))
+		})
+
+		It("raises an error for invalid expressions", func() {
+			err := e.DoString(`require("die").total("1d%x")`)
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.Error()).Should(ContainSubstring(`"1d%x" at 3`))
+		})
+	})
+
+	Describe("evaluate()", func() {
+		It("returns every die rolled", func() {
+			err := e.DoString(`
+				local result = require("die").evaluate("3d1kh2+1")
+				total = result.total
+				breakdown = result.breakdown
+				notation = result.dice[1].notation
+				rolled = #result.dice[1].rolls
+				dropped = result.dice[1].rolls[1].dropped
+				rerolls = #result.dice[1].rolls[1].rerolls
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("total").AsNumber()).Should(Equal(float64(3)))
+			Ω(e.GetGlobal("breakdown").AsString()).Should(Equal("[~1~, 1, 1] + 1"))
+			Ω(e.GetGlobal("notation").AsString()).Should(Equal("3d1kh2"))
+			Ω(e.GetGlobal("rolled").AsNumber()).Should(Equal(float64(3)))
+			Ω(e.GetGlobal("dropped").AsBool()).Should(BeTrue())
+			Ω(e.GetGlobal("rerolls").AsNumber()).Should(Equal(float64(0)))
+		})
+	})
+
+	Describe("stream()", func() {
+		It("rolls predictably once the stream is seeded", func() {
+			err := e.DoString(`
+				local combat = require("die").stream("die test")
+				local random = require("random")
+
+				random.stream("die test").seed(42)
+				first = combat.evaluate("4d6kh3+2").breakdown
+				d20 = combat.d20()
+
+				random.stream("die test").seed(42)
+				second = combat.evaluate("4d6kh3+2").breakdown
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("first").AsString()).Should(Equal(e.GetGlobal("second").AsString()))
+			Ω(e.GetGlobal("d20").AsNumber()).Should(BeNumerically(">=", 1))
+			Ω(e.GetGlobal("d20").AsNumber()).Should(BeNumerically("<=", 20))
+		})
+	})
 })
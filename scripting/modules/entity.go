@@ -0,0 +1,819 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/entity"
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/talon"
+)
+
+// EntityLoader will create the meta tables for entity.Model and entity.Entity
+// for this Engine.
+func EntityLoader(engine *lua.Engine) {
+	loadEntityModel(engine)
+	loadEntity(engine)
+
+	engine.RegisterModule("entity", Entity)
+}
+
+// Entity lets scripts define models that are persisted in the database
+// without writing any Cypher.
+//   define(name, definition): entity.Model
+//     @param name: string = the name of the model
+//     @param definition: table = describes the model, any of:
+//       labels: table = labels for the model's nodes; default: { name }
+//       properties: table = property name to either a type or a table with:
+//         type: string = "string", "number", "integer", "boolean", "list" or
+//           "any"; default: "any"
+//         default: any = the value for new entities
+//         required: boolean = the property must be set to save
+//         min, max: number = bounds for number properties
+//         min_length, max_length: number = bounds on the length of strings
+//           and lists
+//         one_of: table = a list of the allowed values
+//         validate: function = called with the value, returns an error
+//           message if the value is invalid
+//       has_one, has_many: table = relationship name to a table with:
+//         type: string = the type of the edges between entities
+//         model: string = the name of the related model
+//         direction: string = "out" or "in"; default: "out"
+//     @errors raises an error if the definition is invalid
+//     define a model, replacing any model with the same name.
+//   model(name): entity.Model
+//     @param name: string = the name of the model
+//     fetch a model that's been defined, or nil if there is no such model.
+//   pin(entity), unpin(entity): boolean
+//     @param entity: entity.Entity | string = the entity or it's id
+//     keep the entity in the cache no matter how full it gets, or allow it
+//     to be dropped again. Returns false if the entity isn't cached.
+//   evict(entity)
+//     @param entity: entity.Entity | string = the entity or it's id
+//     @errors raises an error if the entity's changes can't be written
+//     drop the entity from the cache, writing it first if it's been saved
+//     since the last flush.
+//   invalidate(entity)
+//     @param entity: entity.Entity | string = the entity or it's id
+//     drop the entity from the cache without writing it's changes, for when
+//     it's been changed in the database directly.
+//   flush()
+//     @errors raises an error if the changes can't be written
+//     write every entity saved since the last flush, this happens on it's own
+//     every entity_cache.flush_interval.
+//   With entity_cache enabled in the Dragonfile entities are held in memory
+//   once they're loaded, finding them again doesn't go to the database and
+//   every script sees the same values for them. Saving a cached entity only
+//   marks it changed, the changes are written in the background. The cache
+//   fires entity:flushed, entity:evicted and entity:invalidated on the
+//   server's events. When the cache isn't enabled these functions do nothing.
+//   entity.Model
+//     @property name: string = the name of the model
+//     new([properties]): entity.Entity
+//       @param properties: table = initial properties of the entity
+//       @errors raises an error if a property isn't defined or the value is
+//         the wrong type
+//       build a new entity, it's not saved until save is called.
+//     find(id): entity.Entity
+//       @param id: string = the id of the entity to find
+//       fetch an entity by it's id, or nil if it doesn't exist.
+//     where(...): table
+//       @param ...: table | talon.Condition = a table of property values to
+//         match or conditions built with the talon module
+//       fetch a list of entities matching the conditions.
+//     all(): table
+//       fetch a list of every entity of the model.
+//     on(event, handler)
+//       @param event: string = before:save, after:save, before:create,
+//         after:create, before:destroy or after:destroy
+//       @param handler: function = called with a table containing entity and
+//         model, returning an error message from a before handler stops the
+//         save or destroy.
+//       register a handler for the lifecycle event.
+//   entity.Entity
+//     @property id: string = the id of the entity, nil until it's saved
+//     properties are read and assigned like table fields, p.name = "bob"
+//     get(name), set(name, value)
+//       read or assign properties that share a name with a method.
+//     save(): boolean, string
+//       validate and save the entity, returning false and an error message if
+//       it's invalid or could not be saved.
+//     validate(): boolean, table
+//       validate the entity, returning false and a table of property names to
+//       a list of problems if it's invalid.
+//     destroy(): boolean, string
+//       delete the entity from the database.
+//     is_new(): boolean
+//       true if the entity has not been saved yet.
+//     is_cached(): boolean
+//       true if the entity is held by the cache.
+//     related(name): entity.Entity | table
+//       @param name: string = the name of the relationship
+//       fetch the related entity for has_one relationships and a list of
+//       entities for has_many.
+//     relate(name, other), unrelate(name, other)
+//       @param name: string = the name of the relationship
+//       @param other: entity.Entity = the entity to connect or disconnect
+//       connect or disconnect the other entity, for has_one relationships any
+//       existing connection is replaced.
+var Entity = lua.TableMap{
+	"define": func(engine *lua.Engine) int {
+		var def *lua.Value
+		if engine.StackSize() >= 2 {
+			def = engine.PopValue()
+		}
+		name := engine.PopString()
+		if name == "" {
+			engine.ArgumentError(1, "expected a model name")
+
+			return 0
+		}
+
+		m, err := defineEntityModel(engine, name, def)
+		if err != nil {
+			engine.RaiseError(err.Error())
+
+			return 0
+		}
+		engine.PushValue(entityModelToLua(engine, m))
+
+		return 1
+	},
+	"model": func(engine *lua.Engine) int {
+		name := engine.PopString()
+		if m, ok := entityRegistryForEngine(engine).Model(name); ok {
+			engine.PushValue(entityModelToLua(engine, m))
+		} else {
+			engine.PushValue(nil)
+		}
+
+		return 1
+	},
+	"pin": func(engine *lua.Engine) int {
+		return entityCacheFunc(engine, func(c *entity.Cache, id string) int {
+			engine.PushValue(c.Pin(id))
+
+			return 1
+		})
+	},
+	"unpin": func(engine *lua.Engine) int {
+		return entityCacheFunc(engine, func(c *entity.Cache, id string) int {
+			engine.PushValue(c.Unpin(id))
+
+			return 1
+		})
+	},
+	"evict": func(engine *lua.Engine) int {
+		return entityCacheFunc(engine, func(c *entity.Cache, id string) int {
+			if err := c.Evict(id); err != nil {
+				engine.RaiseError(err.Error())
+			}
+
+			return 0
+		})
+	},
+	"invalidate": func(engine *lua.Engine) int {
+		return entityCacheFunc(engine, func(c *entity.Cache, id string) int {
+			c.Invalidate(id)
+
+			return 0
+		})
+	},
+	"flush": func(engine *lua.Engine) int {
+		if c := data.EntityCache(); c != nil {
+			if err := c.Flush(); err != nil {
+				engine.RaiseError(err.Error())
+			}
+		}
+
+		return 0
+	},
+}
+
+// call the function with the cache and the id of the entity passed to the
+// Lua function, which can be an entity or an id. Pushes false if the cache
+// isn't enabled.
+func entityCacheFunc(engine *lua.Engine, fn func(*entity.Cache, string) int) int {
+	var (
+		val = engine.PopValue()
+		id  string
+	)
+	if e, ok := val.Interface().(*entity.Entity); ok {
+		id = e.ID
+	} else if val.IsString() {
+		id = val.AsString()
+	}
+
+	c := data.EntityCache()
+	if c == nil || id == "" {
+		engine.PushValue(false)
+
+		return 1
+	}
+
+	return fn(c, id)
+}
+
+// fetch the registry for the engine, models are defined per engine since
+// their hooks and validators belong to it.
+func entityRegistryForEngine(engine *lua.Engine) *entity.Registry {
+	if r, ok := engine.Meta[keys.EntityRegistry].(*entity.Registry); ok {
+		return r
+	}
+
+	r := entity.NewRegistry(data.Lazy())
+	r.Cache = data.EntityCache()
+	engine.Meta[keys.EntityRegistry] = r
+
+	return r
+}
+
+// build a model from it's Lua definition
+func defineEntityModel(engine *lua.Engine, name string, def *lua.Value) (*entity.Model, error) {
+	var labels []string
+	if def != nil && def.IsTable() {
+		for _, label := range def.Get("labels").AsSliceInterface() {
+			if str, ok := label.(string); ok {
+				labels = append(labels, str)
+			}
+		}
+	}
+	m := entityRegistryForEngine(engine).Define(name, labels...)
+	if def == nil || !def.IsTable() {
+		return m, nil
+	}
+
+	props := def.Get("properties")
+	for _, key := range sortedKeys(props) {
+		p, err := entityProperty(engine, key, props.Get(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", name, key, err)
+		}
+		m.AddProperty(p)
+	}
+
+	for _, kind := range []string{"has_one", "has_many"} {
+		rels := def.Get(kind)
+		for _, key := range sortedKeys(rels) {
+			rel := rels.Get(key)
+			if !rel.IsTable() {
+				return nil, fmt.Errorf("%s.%s: expected a table describing the relationship", name, key)
+			}
+			r := &entity.Relationship{
+				Name:     key,
+				Type:     rel.Get("type").AsString(),
+				Model:    rel.Get("model").AsString(),
+				Many:     kind == "has_many",
+				Incoming: rel.Get("direction").AsString() == "in",
+			}
+			if r.Type == "" || r.Model == "" {
+				return nil, fmt.Errorf("%s.%s: relationships need a type and a model", name, key)
+			}
+			m.AddRelationship(r)
+		}
+	}
+
+	return m, nil
+}
+
+// build a property from it's definition, which is either a type name or a
+// table.
+func entityProperty(engine *lua.Engine, name string, def *lua.Value) (*entity.Property, error) {
+	p := &entity.Property{
+		Name: name,
+		Type: entity.Any,
+	}
+	switch {
+	case def.IsString():
+		p.Type = entity.PropertyType(def.AsString())
+	case def.IsTable():
+		if typ := def.Get("type"); typ.IsString() {
+			p.Type = entity.PropertyType(typ.AsString())
+		}
+	default:
+		return nil, errors.New("expected a type or a table describing the property")
+	}
+	if !p.Type.IsValid() {
+		return nil, fmt.Errorf("unknown property type %q", string(p.Type))
+	}
+	if def.IsString() {
+		return p, nil
+	}
+
+	if val := def.Get("default"); !val.IsNil() {
+		p.Default = entityValueFromLua(val)
+	}
+	p.Required = def.Get("required").AsBool()
+
+	if val := def.Get("min"); val.IsNumber() {
+		p.Validators = append(p.Validators, entity.Min(val.AsNumber()))
+	}
+	if val := def.Get("max"); val.IsNumber() {
+		p.Validators = append(p.Validators, entity.Max(val.AsNumber()))
+	}
+	if val := def.Get("min_length"); val.IsNumber() {
+		p.Validators = append(p.Validators, entity.MinLength(int(val.AsNumber())))
+	}
+	if val := def.Get("max_length"); val.IsNumber() {
+		p.Validators = append(p.Validators, entity.MaxLength(int(val.AsNumber())))
+	}
+	if val := def.Get("one_of"); val.IsTable() {
+		p.Validators = append(p.Validators, entity.OneOf(val.AsSliceInterface()...))
+	}
+	if fn := def.Get("validate"); fn.IsFunction() {
+		p.Validators = append(p.Validators, func(value interface{}) error {
+			ret, err := runEntityFunction(engine, fn, entityValueToLua(engine, value))
+			if err != nil {
+				return err
+			}
+
+			return entityErrorFromLua(ret)
+		})
+	}
+
+	return p, nil
+}
+
+// the string keys of a table in sorted order, so definitions are processed
+// the same way every time.
+func sortedKeys(tbl *lua.Value) []string {
+	if tbl == nil || !tbl.IsTable() {
+		return nil
+	}
+
+	var keys []string
+	tbl.ForEach(func(key, _ *lua.Value) {
+		if key.IsString() {
+			keys = append(keys, key.AsString())
+		}
+	})
+	sort.Strings(keys)
+
+	return keys
+}
+
+// run a Lua function for the entity framework (hooks and validators) as a
+// task, if the function waits it can no longer affect the outcome.
+func runEntityFunction(engine *lua.Engine, fn *lua.Value, args ...interface{}) (*lua.Value, error) {
+	task := engine.Go(fn, args...)
+	select {
+	case <-task.Done():
+	default:
+		logTaskFailure(engine, task)
+
+		return nil, nil
+	}
+
+	if err := task.Err(); err != nil {
+		return nil, err
+	}
+	if vals := task.Results(); len(vals) > 0 {
+		return vals[0], nil
+	}
+
+	return nil, nil
+}
+
+// convert a value returned from a hook or validator into an error, strings
+// and errors are failures.
+func entityErrorFromLua(val *lua.Value) error {
+	if val == nil || val.IsNil() {
+		return nil
+	}
+	if val.IsString() {
+		return errors.New(val.AsString())
+	}
+	if err, ok := val.Interface().(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// entityHook runs a Lua function for a model's lifecycle event
+type entityHook struct {
+	engine *lua.Engine
+	fn     *lua.Value
+}
+
+// Call runs the hook with a table containing the entity and model name.
+func (eh *entityHook) Call(d events.Data) error {
+	tbl := eh.engine.NewTable()
+	if e, ok := d["entity"].(*entity.Entity); ok {
+		tbl.Set("entity", entityToLua(eh.engine, e))
+	}
+	tbl.Set("model", d["model"])
+
+	ret, err := runEntityFunction(eh.engine, eh.fn, tbl)
+	if err != nil {
+		return err
+	}
+
+	return entityErrorFromLua(ret)
+}
+
+// Source returns the function, so the same function can't be bound twice.
+func (eh *entityHook) Source() interface{} {
+	return eh.fn
+}
+
+// convert a Lua value into a value for an entity property
+func entityValueFromLua(val *lua.Value) interface{} {
+	if val.IsTable() {
+		if val.IsMaybeList() {
+			return val.AsSliceInterface()
+		}
+
+		return val.AsMapStringInterface()
+	}
+
+	return val.AsRaw()
+}
+
+// convert an entity property into a Lua value, lists become tables
+func entityValueToLua(engine *lua.Engine, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Slice:
+		return engine.TableFromSlice(val)
+	case reflect.Map:
+		return engine.TableFromMap(val)
+	default:
+		return val
+	}
+}
+
+func entityToLua(engine *lua.Engine, e *entity.Entity) *lua.Value {
+	return engine.NewUserData(e, engine.Meta[keys.EntityMetatable])
+}
+
+func entityModelToLua(engine *lua.Engine, m *entity.Model) *lua.Value {
+	return engine.NewUserData(m, engine.Meta[keys.EntityModelMetatable])
+}
+
+// convert a list of entities into a Lua table
+func entitiesToLua(engine *lua.Engine, entities []*entity.Entity) *lua.Value {
+	tbl := engine.NewTable()
+	for _, e := range entities {
+		tbl.Append(entityToLua(engine, e))
+	}
+
+	return tbl
+}
+
+// pop the arguments for a method, the receiver is returned separately
+func popEntityMethodArgs(engine *lua.Engine) (interface{}, []*lua.Value) {
+	args := popArgs(engine)
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	return args[0].Interface(), args[1:]
+}
+
+// build the lua type for *entity.Model
+func loadEntityModel(eng *lua.Engine) {
+	methods := map[string]func(*lua.Engine, *entity.Model, []*lua.Value) int{
+		"new": func(engine *lua.Engine, m *entity.Model, args []*lua.Value) int {
+			var props talon.Properties
+			if len(args) > 0 && args[0].IsTable() {
+				props = make(talon.Properties)
+				args[0].ForEach(func(key, val *lua.Value) {
+					props[key.AsString()] = entityValueFromLua(val)
+				})
+			}
+
+			e, err := m.New(props)
+			if err != nil {
+				engine.RaiseError(err.Error())
+
+				return 0
+			}
+			engine.PushValue(entityToLua(engine, e))
+
+			return 1
+		},
+		"find": func(engine *lua.Engine, m *entity.Model, args []*lua.Value) int {
+			if len(args) == 0 {
+				engine.ArgumentError(2, "expected an id")
+
+				return 0
+			}
+
+			e, err := m.Find(args[0].AsString())
+			switch {
+			case err == entity.ErrNotFound:
+				engine.PushValue(nil)
+			case err != nil:
+				engine.RaiseError(err.Error())
+
+				return 0
+			default:
+				engine.PushValue(entityToLua(engine, e))
+			}
+
+			return 1
+		},
+		"where": func(engine *lua.Engine, m *entity.Model, args []*lua.Value) int {
+			var conds []talon.Condition
+			for i, arg := range args {
+				if cond, ok := arg.Interface().(talon.Condition); ok {
+					conds = append(conds, cond)
+
+					continue
+				}
+				if !arg.IsTable() {
+					engine.ArgumentError(i+2, "expected a table or condition")
+
+					return 0
+				}
+				for _, key := range sortedKeys(arg) {
+					conds = append(conds, talon.Eq(key, entityValueFromLua(arg.Get(key))))
+				}
+			}
+
+			found, err := m.Where(conds...)
+			if err != nil {
+				engine.RaiseError(err.Error())
+
+				return 0
+			}
+			engine.PushValue(entitiesToLua(engine, found))
+
+			return 1
+		},
+		"all": func(engine *lua.Engine, m *entity.Model, _ []*lua.Value) int {
+			found, err := m.All()
+			if err != nil {
+				engine.RaiseError(err.Error())
+
+				return 0
+			}
+			engine.PushValue(entitiesToLua(engine, found))
+
+			return 1
+		},
+		"on": func(engine *lua.Engine, m *entity.Model, args []*lua.Value) int {
+			if len(args) < 2 || !args[1].IsFunction() {
+				engine.RaiseError("expected an event name and a function")
+
+				return 0
+			}
+			m.On(args[0].AsString(), &entityHook{
+				engine: engine,
+				fn:     args[1],
+			})
+
+			return 0
+		},
+	}
+
+	mt := eng.NewTable()
+	mt.Set("__index", func(engine *lua.Engine) int {
+		key := engine.PopString()
+		m, ok := engine.PopValue().Interface().(*entity.Model)
+		if !ok {
+			engine.RaiseError("model value corrupted")
+
+			return 0
+		}
+
+		if key == "name" {
+			engine.PushValue(m.Name)
+
+			return 1
+		}
+
+		method, ok := methods[key]
+		if !ok {
+			engine.PushValue(nil)
+
+			return 1
+		}
+		engine.PushValue(func(engine *lua.Engine) int {
+			recv, args := popEntityMethodArgs(engine)
+			m, ok := recv.(*entity.Model)
+			if !ok {
+				engine.RaiseError("expected a model, call methods with ':'")
+
+				return 0
+			}
+
+			return method(engine, m, args)
+		})
+
+		return 1
+	})
+
+	eng.Meta[keys.EntityModelMetatable] = mt
+}
+
+// build the lua type for *entity.Entity, properties are accessed as fields
+func loadEntity(eng *lua.Engine) {
+	methods := map[string]func(*lua.Engine, *entity.Entity, []*lua.Value) int{
+		"get": func(engine *lua.Engine, e *entity.Entity, args []*lua.Value) int {
+			if len(args) == 0 {
+				engine.ArgumentError(2, "expected a property name")
+
+				return 0
+			}
+			engine.PushValue(entityValueToLua(engine, e.Get(args[0].AsString())))
+
+			return 1
+		},
+		"set": func(engine *lua.Engine, e *entity.Entity, args []*lua.Value) int {
+			if len(args) < 2 {
+				engine.RaiseError("expected a property name and value")
+
+				return 0
+			}
+			if err := e.Set(args[0].AsString(), entityValueFromLua(args[1])); err != nil {
+				engine.RaiseError(err.Error())
+			}
+
+			return 0
+		},
+		"save": func(engine *lua.Engine, e *entity.Entity, _ []*lua.Value) int {
+			return pushEntityResult(engine, e.Save())
+		},
+		"destroy": func(engine *lua.Engine, e *entity.Entity, _ []*lua.Value) int {
+			return pushEntityResult(engine, e.Destroy())
+		},
+		"validate": func(engine *lua.Engine, e *entity.Entity, _ []*lua.Value) int {
+			err := e.Validate()
+			if err == nil {
+				engine.PushValue(true)
+
+				return 1
+			}
+
+			engine.PushValue(false)
+			problems := engine.NewTable()
+			if ve, ok := err.(*entity.ValidationError); ok {
+				for name, list := range ve.Problems {
+					problems.Set(name, engine.TableFromSlice(list))
+				}
+			}
+			engine.PushValue(problems)
+
+			return 2
+		},
+		"is_new": func(engine *lua.Engine, e *entity.Entity, _ []*lua.Value) int {
+			engine.PushValue(e.IsNew())
+
+			return 1
+		},
+		"is_cached": func(engine *lua.Engine, e *entity.Entity, _ []*lua.Value) int {
+			engine.PushValue(e.IsCached())
+
+			return 1
+		},
+		"related": func(engine *lua.Engine, e *entity.Entity, args []*lua.Value) int {
+			if len(args) == 0 {
+				engine.ArgumentError(2, "expected a relationship name")
+
+				return 0
+			}
+
+			name := args[0].AsString()
+			found, err := e.Related(name)
+			if err != nil {
+				engine.RaiseError(err.Error())
+
+				return 0
+			}
+
+			if r, _ := e.Model.Relationship(name); r.Many {
+				engine.PushValue(entitiesToLua(engine, found))
+			} else if len(found) > 0 {
+				engine.PushValue(entityToLua(engine, found[0]))
+			} else {
+				engine.PushValue(nil)
+			}
+
+			return 1
+		},
+		"relate": func(engine *lua.Engine, e *entity.Entity, args []*lua.Value) int {
+			name, other := entityRelationArgs(engine, args)
+			if other != nil {
+				if err := e.Relate(name, other); err != nil {
+					engine.RaiseError(err.Error())
+				}
+			}
+
+			return 0
+		},
+		"unrelate": func(engine *lua.Engine, e *entity.Entity, args []*lua.Value) int {
+			name, other := entityRelationArgs(engine, args)
+			if other != nil {
+				if err := e.Unrelate(name, other); err != nil {
+					engine.RaiseError(err.Error())
+				}
+			}
+
+			return 0
+		},
+	}
+
+	mt := eng.NewTable()
+	mt.Set("__index", func(engine *lua.Engine) int {
+		key := engine.PopString()
+		e, ok := engine.PopValue().Interface().(*entity.Entity)
+		if !ok {
+			engine.RaiseError("entity value corrupted")
+
+			return 0
+		}
+
+		if key == "id" {
+			if e.ID == "" {
+				engine.PushValue(nil)
+			} else {
+				engine.PushValue(e.ID)
+			}
+
+			return 1
+		}
+
+		if method, ok := methods[key]; ok {
+			engine.PushValue(func(engine *lua.Engine) int {
+				recv, args := popEntityMethodArgs(engine)
+				e, ok := recv.(*entity.Entity)
+				if !ok {
+					engine.RaiseError("expected an entity, call methods with ':'")
+
+					return 0
+				}
+
+				return method(engine, e, args)
+			})
+
+			return 1
+		}
+
+		engine.PushValue(entityValueToLua(engine, e.Get(key)))
+
+		return 1
+	})
+
+	mt.Set("__newindex", func(engine *lua.Engine) int {
+		val := engine.PopValue()
+		key := engine.PopString()
+		e, ok := engine.PopValue().Interface().(*entity.Entity)
+		if !ok {
+			engine.RaiseError("entity value corrupted")
+
+			return 0
+		}
+
+		if err := e.Set(key, entityValueFromLua(val)); err != nil {
+			engine.RaiseError(err.Error())
+		}
+
+		return 0
+	})
+
+	eng.Meta[keys.EntityMetatable] = mt
+}
+
+// push the result of saving or destroying, true or false and an error
+func pushEntityResult(engine *lua.Engine, err error) int {
+	if err != nil {
+		engine.PushValue(false)
+		engine.PushValue(err.Error())
+
+		return 2
+	}
+
+	engine.PushValue(true)
+
+	return 1
+}
+
+// pull the relationship name and entity from relate/unrelate arguments
+func entityRelationArgs(engine *lua.Engine, args []*lua.Value) (string, *entity.Entity) {
+	if len(args) < 2 {
+		engine.RaiseError("expected a relationship name and an entity")
+
+		return "", nil
+	}
+
+	other, ok := args[1].Interface().(*entity.Entity)
+	if !ok {
+		engine.ArgumentError(3, "expected an entity")
+
+		return "", nil
+	}
+
+	return args[0].AsString(), other
+}
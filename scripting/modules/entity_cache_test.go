@@ -0,0 +1,95 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Entity cache Lua functions", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "cache_test")
+		viper.Set("database.cache_test.adapter", data.MemoryAdapter)
+		viper.Set("entity_cache.enabled", true)
+
+		engine = lua.NewEngine()
+		engine.OpenCoroutine()
+		scripting.OpenLibs(engine, "entity")
+		err := engine.DoString(`
+			entity = require("entity")
+
+			Player = entity.define("Player", {
+				properties = { name = "string", level = "integer" },
+			})
+
+			bob = Player:new({ name = "bob", level = 1 })
+			bob:save()
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("entity_cache.enabled", false)
+		viper.Set("env", env)
+	})
+
+	It("caches saved entities", func() {
+		err := engine.DoString(`
+			cached = bob:is_cached()
+			same = Player:find(bob.id).name == "bob"
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("cached").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("same").AsBool()).Should(BeTrue())
+	})
+
+	It("pins entities by entity or id", func() {
+		err := engine.DoString(`
+			pinned = entity.pin(bob)
+			unpinned = entity.unpin(bob.id)
+			missing = entity.pin("missing")
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("pinned").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("unpinned").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("missing").AsBool()).Should(BeFalse())
+	})
+
+	It("writes changes before evicting entities", func() {
+		err := engine.DoString(`
+			bob.level = 5
+			bob:save()
+			entity.evict(bob)
+
+			level = Player:find(bob.id).level
+		`)
+		Ω(err).Should(BeNil())
+		Ω(data.EntityCache().Len()).Should(Equal(1))
+		Ω(engine.GetGlobal("level").AsNumber()).Should(Equal(float64(5)))
+	})
+
+	It("drops changes for invalidated entities", func() {
+		err := engine.DoString(`
+			bob.level = 5
+			bob:save()
+			entity.invalidate(bob)
+			entity.flush()
+
+			level = Player:find(bob.id).level
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("level").AsNumber()).Should(Equal(float64(1)))
+	})
+})
@@ -0,0 +1,122 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Entity Lua Module", func() {
+	var engine *lua.Engine
+
+	BeforeEach(func() {
+		engine = lua.NewEngine()
+		engine.OpenCoroutine()
+		scripting.OpenLibs(engine, "entity")
+		err := engine.DoString(`
+			entity = require("entity")
+
+			Player = entity.define("Player", {
+				properties = {
+					name = {
+						type = "string",
+						required = true,
+						validate = function(name)
+							if #name < 3 then
+								return "is too short"
+							end
+						end,
+					},
+					level = { type = "integer", default = 1, min = 1 },
+					title = "string",
+				},
+				has_one = {
+					room = { type = "IN", model = "Room" },
+				},
+			})
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	It("builds entities with defaults", func() {
+		err := engine.DoString(`
+			local p = Player:new({ name = "bob" })
+			name = p.name
+			level = p.level
+			is_new = p:is_new()
+		`)
+
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("name").AsString()).Should(Equal("bob"))
+		Ω(engine.GetGlobal("level").AsNumber()).Should(Equal(float64(1)))
+		Ω(engine.GetGlobal("is_new").AsBool()).Should(BeTrue())
+	})
+
+	It("assigns properties as fields", func() {
+		err := engine.DoString(`
+			local p = Player:new()
+			p.title = "lord"
+			title = p:get("title")
+		`)
+
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("title").AsString()).Should(Equal("lord"))
+	})
+
+	It("raises errors for values of the wrong type", func() {
+		err := engine.DoString(`
+			local p = Player:new()
+			p.level = "high"
+		`)
+
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("validates entities", func() {
+		err := engine.DoString(`
+			local p = Player:new({ name = "b", level = 0 })
+			valid, problems = p:validate()
+			name_problem = problems.name[1]
+			level_problem = problems.level[1]
+		`)
+
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("valid").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("name_problem").AsString()).Should(Equal("is too short"))
+		Ω(engine.GetGlobal("level_problem").AsString()).Should(Equal("must be at least 1"))
+	})
+
+	It("can stop saves with lifecycle hooks", func() {
+		err := engine.DoString(`
+			Player:on("before:save", function(data)
+				hooked = data.entity.name
+				return "not today"
+			end)
+
+			local p = Player:new({ name = "bob" })
+			saved, save_err = p:save()
+		`)
+
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("hooked").AsString()).Should(Equal("bob"))
+		Ω(engine.GetGlobal("saved").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("save_err").AsString()).Should(Equal("not today"))
+	})
+
+	It("looks up defined models", func() {
+		err := engine.DoString(`
+			name = entity.model("Player").name
+			missing = entity.model("Nope")
+		`)
+
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("name").AsString()).Should(Equal("Player"))
+		Ω(engine.GetGlobal("missing").IsNil()).Should(BeTrue())
+	})
+})
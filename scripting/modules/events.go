@@ -155,14 +155,27 @@ type internalLuaHandler struct {
 }
 
 // Call matches the events.Handler interface, allowing a Lua method to be called
-// from the event system.
+// from the event system. Handlers are run as tasks, so they're free to wait
+// with the async module. Once a handler waits it can no longer halt the event.
 func (lh *internalLuaHandler) Call(d events.Data) error {
-	tblData := lh.engine.TableFromMap(map[string]interface{}(d))
-	vals, err := lh.fn.Call(1, tblData)
-	if err != nil {
+	task := lh.engine.Go(lh.fn, map[string]interface{}(d))
+	select {
+	case <-task.Done():
+	default:
+		logTaskFailure(lh.engine, task)
+
+		return nil
+	}
+
+	if err := task.Err(); err != nil {
 		return err
 	}
 
+	vals := task.Results()
+	if len(vals) == 0 {
+		return nil
+	}
+
 	val := vals[0]
 	if !val.IsNil() {
 		if val.IsString() {
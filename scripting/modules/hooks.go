@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+)
+
+// bind the function to the event, the function is kept with the engine (under
+// the key given) while the service is given a single handler for the engine's
+// pool that runs the functions on an engine taken from the pool. Engines
+// without a pool only see the events they cause themselves.
+func bindHook(engine *lua.Engine, key, evt string, fn *lua.Value, on func(string, events.Handler)) {
+	engine = engine.Root()
+	hooksForEngine(engine, key).On(evt, &eventHook{
+		engine: engine,
+		fn:     fn,
+	})
+
+	ph := &poolHook{
+		key:   key,
+		event: evt,
+	}
+	if p, ok := engine.Meta[keys.Pool].(*lua.EnginePool); ok {
+		ph.pool = p
+	} else {
+		ph.engine = engine
+	}
+	on(evt, ph)
+}
+
+// fetch the emitter holding the engine's functions for the key (or create
+// one)
+func hooksForEngine(engine *lua.Engine, key string) *events.Emitter {
+	if e, ok := engine.Meta[key].(*events.Emitter); ok {
+		return e
+	}
+
+	e := events.NewEmitter(logger.NewWithSource(fmt.Sprintf("%s(%s)", key, nameForEngine(engine))))
+	engine.Meta[key] = e
+
+	return e
+}
+
+// poolHook is given to a service for every function bound to an event by the
+// engines in a pool.
+type poolHook struct {
+	pool   *lua.EnginePool
+	engine *lua.Engine
+	key    string
+	event  string
+}
+
+// Call runs the functions bound to the event. If the event was caused by a
+// script from the same pool it's called back while that engine is held, so
+// the functions are run on it, otherwise an engine is taken from the pool.
+func (ph *poolHook) Call(d events.Data) error {
+	caller, _ := d[events.CallerKey].(*lua.Engine)
+	if caller != nil {
+		d = d.Clone()
+		delete(d, events.CallerKey)
+	}
+
+	switch {
+	case caller != nil && (caller == ph.engine || (ph.pool != nil && caller.Meta[keys.Pool] == ph.pool)):
+		return hooksForEngine(caller, ph.key).Trigger(ph.event, d)
+	case ph.pool != nil:
+		pe := ph.pool.Get()
+		if pe == nil {
+			return nil
+		}
+		defer pe.Release()
+
+		return hooksForEngine(pe.Engine, ph.key).Trigger(ph.event, d)
+	}
+
+	// nothing keeps others from using an engine without a pool
+	return nil
+}
+
+// Source returns the pool (or engine) so it's only bound once for the event.
+func (ph *poolHook) Source() interface{} {
+	if ph.pool != nil {
+		return ph.pool
+	}
+
+	return ph.engine
+}
+
+// eventHook runs a Lua function for an event, for before events returning
+// false or an error message stops what was about to happen
+type eventHook struct {
+	engine *lua.Engine
+	fn     *lua.Value
+}
+
+// Call runs the function with the event's data, it's skipped once the engine
+// the function belongs to has been closed.
+func (eh *eventHook) Call(d events.Data) error {
+	if eh.engine.IsClosed() {
+		return nil
+	}
+
+	ret, err := runEntityFunction(eh.engine, eh.fn, eh.engine.TableFromMap(map[string]interface{}(d)))
+	if err != nil {
+		return err
+	}
+	if ret != nil && ret.IsBool() && !ret.AsBool() {
+		return events.ErrHalt
+	}
+	if ret != nil && ret.IsString() {
+		return errors.New(ret.AsString())
+	}
+
+	return nil
+}
+
+// Source returns the function, so the same function can't be bound twice.
+func (eh *eventHook) Source() interface{} {
+	return eh.fn
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/inventory"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+)
+
+// Inventory moves items between rooms, characters and containers. Items are
+// objects spawned in the world, they can have a weight, be stackable (items
+// from the same prototype become one item with a quantity), be a container
+// and have slots they can be worn in. Characters and containers can have a
+// capacity, the most weight they can hold. Anywhere an item, character,
+// container or room is expected it's table or id can be given. Moving items
+// returns the id of the item (or stack) moved, or nil and an error message.
+// A quantity of 0 or nil moves the whole stack.
+//   get(actor, item, [quantity]): string
+//     pick the item up off the floor of the actor's room, or take it out of a
+//     container the actor can reach.
+//   drop(actor, item, [quantity]): string
+//     drop the carried item on the floor.
+//   put(actor, item, container, [quantity]): string
+//     put the carried item inside a container the actor can reach.
+//   give(actor, item, to, [quantity]): string
+//     give the carried item to another character in the room.
+//   wear(actor, item, [slot]): string
+//     @param slot: string = where to wear it; default: the first of the
+//       item's slots
+//     wear one of the carried items.
+//   remove(actor, slot): string
+//     take off what's worn in the slot.
+//   item(id): table
+//     fetch the item, or nil. Items are tables with id, name, prototype,
+//     quantity, weight (of the stack and everything in it), holder, position
+//     ("room", "carried", "worn" or "inside"), slot and properties.
+//   contents(holder): table
+//     list the items in the room, carried by the character or inside the
+//     container, sorted by name.
+//   equipment(actor): table
+//     the items the actor is wearing, keyed by slot.
+//   load(holder): number
+//     the weight of everything the character or container holds.
+//   on(event, fn)
+//     @param event: string = item:get, item:drop, item:put, item:give,
+//       item:wear or item:remove, or one of them with before: or after:
+//     @param fn: function = called with a table of the actor, item, quantity
+//       and from, room, container, to or slot
+//     call the function when items move. Returning false (or an error
+//     message) from a before: handler stops the item from moving.
+//       inventory.on("before:item:drop", function(evt)
+//         if evt.item == cursed_sword then
+//           return "The sword refuses to leave your hand."
+//         end
+//       end)
+var Inventory = lua.TableMap{
+	"get": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		id, err := inventoryFor(engine).Get(idArg(args, 0), idArg(args, 1), intArg(args, 2))
+
+		return pushItemID(engine, id, err)
+	},
+	"drop": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		id, err := inventoryFor(engine).Drop(idArg(args, 0), idArg(args, 1), intArg(args, 2))
+
+		return pushItemID(engine, id, err)
+	},
+	"put": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		inv := inventoryFor(engine)
+		id, err := inv.Put(idArg(args, 0), idArg(args, 1), idArg(args, 2), intArg(args, 3))
+
+		return pushItemID(engine, id, err)
+	},
+	"give": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		inv := inventoryFor(engine)
+		id, err := inv.Give(idArg(args, 0), idArg(args, 1), idArg(args, 2), intArg(args, 3))
+
+		return pushItemID(engine, id, err)
+	},
+	"wear": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		id, err := inventoryFor(engine).Wear(idArg(args, 0), idArg(args, 1), stringArg(args, 2))
+
+		return pushItemID(engine, id, err)
+	},
+	"remove": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		id, err := inventoryFor(engine).Remove(idArg(args, 0), stringArg(args, 1))
+
+		return pushItemID(engine, id, err)
+	},
+	"item": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		item, err := inventoryFor(engine).Item(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(itemToLua(engine, item))
+
+		return 1
+	},
+	"contents": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		items, err := inventoryFor(engine).Contents(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, item := range items {
+			list.Append(itemToLua(engine, item))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"equipment": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		worn, err := inventoryFor(engine).Equipment(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		tbl := engine.NewTable()
+		for slot, item := range worn {
+			tbl.Set(slot, itemToLua(engine, item))
+		}
+		engine.PushValue(tbl)
+
+		return 1
+	},
+	"load": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		load, err := inventoryFor(engine).Load(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(load)
+
+		return 1
+	},
+	"on": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		if len(args) < 2 || !args[1].IsFunction() {
+			engine.RaiseError("expected an event name and a function")
+
+			return 0
+		}
+		bindHook(engine, keys.InventoryHooks, stringArg(args, 0), args[1], inventoryFor(engine).On)
+
+		return 0
+	},
+}
+
+// fetch the game's inventory, raising an error if the store can't be reached.
+// Handlers for before events are run on the engine while it's waiting on the
+// inventory.
+func inventoryFor(engine *lua.Engine) *inventory.Inventory {
+	inv, err := data.Inventory()
+	if err != nil {
+		engine.RaiseError("%s", err.Error())
+	}
+
+	return inv.WithCaller(engine.Root())
+}
+
+func pushItemID(engine *lua.Engine, id string, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(id)
+
+	return 1
+}
+
+func itemToLua(engine *lua.Engine, item *inventory.Item) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", item.ID)
+	tbl.Set("name", item.Name)
+	for k, v := range map[string]string{"prototype": item.Prototype, "holder": item.Holder, "position": item.Position, "slot": item.Slot} {
+		if v != "" {
+			tbl.Set(k, v)
+		}
+	}
+	tbl.Set("quantity", item.Quantity)
+	tbl.Set("weight", item.Weight)
+	tbl.Set("properties", engine.TableFromMap(map[string]interface{}(item.Properties)))
+
+	return tbl
+}
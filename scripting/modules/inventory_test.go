@@ -0,0 +1,171 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory Module", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "inventory_test")
+		viper.Set("database.inventory_test.adapter", data.MemoryAdapter)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "world", "inventory")
+		err := engine.DoString(`
+			world = require("world")
+			inventory = require("inventory")
+
+			town = world.create_area("Town")
+			square = world.create_room("Town Square", town)
+			hero = world.spawn(world.create_prototype("mobile", 1, "a hero", town, { capacity = 10 }), square)
+			guard = world.spawn(world.create_prototype("mobile", 2, "a guard", town), square)
+
+			coin = world.create_prototype("object", 10, "a gold coin", town, { weight = 1, stackable = true })
+			bag = world.create_prototype("object", 11, "a bag", town, { weight = 1, container = true })
+			helmet = world.create_prototype("object", 12, "a helmet", town, { weight = 2, slots = "head" })
+			anvil = world.create_prototype("object", 13, "an anvil", town, { weight = 50 })
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("moves items around", func() {
+		err := engine.DoString(`
+			local first = world.spawn(coin, square)
+			inventory.get(hero, first)
+			stack = inventory.get(hero, world.spawn(coin, square)) == first
+			quantity = inventory.item(first).quantity
+
+			local sack = world.spawn(bag, square)
+			inventory.put(hero, first, sack, 1)
+			inside = #inventory.contents(sack)
+			load = inventory.load(hero)
+
+			inventory.give(hero, first, guard)
+			given = inventory.item(first).holder == guard
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("stack").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("quantity").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("inside").AsNumber()).Should(Equal(float64(1)))
+		Ω(engine.GetGlobal("load").AsNumber()).Should(Equal(float64(1)))
+		Ω(engine.GetGlobal("given").AsBool()).Should(BeTrue())
+	})
+
+	It("wears and removes items", func() {
+		err := engine.DoString(`
+			local h = world.spawn(helmet, square)
+			inventory.get(hero, h)
+			inventory.wear(hero, h)
+			slot = inventory.equipment(hero).head.position
+
+			inventory.remove(hero, "head")
+			removed = inventory.item(h).position
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("slot").AsString()).Should(Equal("worn"))
+		Ω(engine.GetGlobal("removed").AsString()).Should(Equal("carried"))
+	})
+
+	It("returns errors for moves that can't be made", func() {
+		err := engine.DoString(`id, msg = inventory.get(hero, world.spawn(anvil, square))`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("id").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("msg").AsString()).Should(Equal("inventory: that's too heavy to carry"))
+	})
+
+	It("lets handlers veto moves", func() {
+		err := engine.DoString(`
+			local cursed = world.spawn(helmet, square)
+			inventory.get(hero, cursed)
+			inventory.on("before:item:drop", function(evt)
+				if evt.item == cursed then
+					return "The helmet won't leave your hands."
+				end
+			end)
+			inventory.on("before:item:get", function(evt)
+				return false
+			end)
+
+			dropped, drop_err = inventory.drop(hero, cursed)
+			got, get_err = inventory.get(hero, world.spawn(coin, square))
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("dropped").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("drop_err").AsString()).Should(Equal("The helmet won't leave your hands."))
+		Ω(engine.GetGlobal("got").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("get_err").AsString()).Should(Equal("inventory: that isn't allowed"))
+	})
+
+	Context("with handlers bound by a pool", func() {
+		var (
+			p     *lua.EnginePool
+			calls chan int
+		)
+
+		BeforeEach(func() {
+			calls = make(chan int, 10)
+			p = lua.NewEnginePoolWithConfig(lua.EnginePoolConfig{
+				MinSize: 2,
+				MaxSize: 2,
+				Mutator: func(e *lua.Engine) {
+					e.OpenChannel()
+					scripting.OpenLibs(e, "world", "inventory")
+					e.SetGlobal("calls", calls)
+					e.DoString(`
+						inventory = require("inventory")
+						inventory.on("before:item:get", function(evt)
+							calls:send(1)
+						end)
+					`)
+				},
+			})
+		})
+
+		AfterEach(func() {
+			p.Shutdown()
+		})
+
+		It("runs them once for the pool", func() {
+			err := engine.DoString(`got = inventory.get(hero, world.spawn(coin, square))`)
+			Ω(err).Should(BeNil())
+			Ω(engine.GetGlobal("got").IsNil()).Should(BeFalse())
+			Ω(calls).Should(HaveLen(1))
+		})
+
+		It("runs them on the engine that caused the event", func() {
+			err := engine.DoString(`item = world.spawn(coin, square)`)
+			Ω(err).Should(BeNil())
+
+			pe := p.Get()
+			defer pe.Release()
+			pe.SetGlobal("hero", engine.GetGlobal("hero").AsString())
+			pe.SetGlobal("item", engine.GetGlobal("item").AsString())
+
+			held := p.Get()
+			defer held.Release()
+
+			err = pe.DoString(`got = inventory.get(hero, item)`)
+			Ω(err).Should(BeNil())
+			Ω(pe.GetGlobal("got").IsNil()).Should(BeFalse())
+			Ω(calls).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,38 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"time"
+
+	"github.com/bbuck/dragon-mud/scripting/lua"
+)
+
+// Pool provides information about the engine pool the script is running in,
+// useful for status commands.
+//   stats(): table
+//     returns the current state of the pool and it's counters: size, idle,
+//     in_use, min_size, max_size, checkouts, spawned, discarded, evicted,
+//     wait_time and average_wait (in milliseconds) and memory (estimated bytes
+//     held by all engines in the pool).
+var Pool = lua.TableMap{
+	"stats": func(eng *lua.Engine) int {
+		stats := poolForEngine(eng).Stats()
+		eng.PushValue(eng.TableFromMap(map[string]interface{}{
+			"size":         stats.Size,
+			"idle":         stats.Idle,
+			"in_use":       stats.InUse,
+			"min_size":     stats.MinSize,
+			"max_size":     stats.MaxSize,
+			"checkouts":    stats.Checkouts,
+			"spawned":      stats.Spawned,
+			"discarded":    stats.Discarded,
+			"evicted":      stats.Evicted,
+			"wait_time":    float64(stats.WaitTime) / float64(time.Millisecond),
+			"average_wait": float64(stats.AverageWait()) / float64(time.Millisecond),
+			"memory":       stats.Memory.Total(),
+		}))
+
+		return 1
+	},
+}
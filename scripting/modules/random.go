@@ -1,10 +1,21 @@
 package modules
 
 import (
+	"sort"
+
 	"github.com/bbuck/dragon-mud/random"
+	"github.com/bbuck/dragon-mud/scripting/keys"
 	"github.com/bbuck/dragon-mud/scripting/lua"
 )
 
+// RandomLoader creates the meta table for random.Table and registers the
+// random module for this Engine.
+func RandomLoader(engine *lua.Engine) {
+	loadRandomTable(engine)
+
+	engine.RegisterModule("random", Random)
+}
+
 // Random provides a means for generating random numbers up to a maximum value
 // or between a minimum and a maximum.
 //   gen(max): number
@@ -17,7 +28,246 @@ import (
 //       numbers
 //     generate a number between the given minimum and maximum, the range
 //     [min, max)
+//   stream(name): table
+//     @param name: string = the name of the stream
+//     return the named random number stream, creating it if it doesn't exist.
+//     Streams generate numbers independently of each other and can be seeded
+//     to make them predictable, which is handy for replaying combat or
+//     testing. The stream table contains:
+//       gen(max): number
+//         the same as random.gen, using the stream
+//       range(min, max): number
+//         the same as random.range, using the stream
+//       float(): number
+//         generate a number from 0 up to 1
+//       seed(seed: number)
+//         reset the stream so it generates the same numbers every time it's
+//         given the same seed
+//       state(): string
+//         the current state of the stream, pass it to random.restore to pick
+//         up where the stream left off
+//       weighted(choices): any
+//         the same as random.weighted, using the stream
+//       name: string
+//         the name of the stream
+//   restore(state): table
+//     @param state: string = a state returned by a stream's state function
+//     @errors raises an error if the state is invalid
+//     restore the stream named in the state and return it.
+//   weighted(choices): any
+//     @param choices: table = a table of choices to their weight
+//     pick one of the choices, the chance of a choice being picked is it's
+//     weight out of the total of all weights. Returns nil if nothing can be
+//     picked.
+//       random.weighted({ sunny = 5, rain = 2, snow = 1 })
+//   define_table(name, definition)
+//     @param name: string = the name of the table, names are case insensitive
+//     @param definition: table = the table's entries and whether or not it's
+//       unique
+//     @errors raises an error if any entry is invalid
+//     define a table for loot, encounters or anything else picked by weight.
+//     Entries have a value or the name of another table to roll on, a weight
+//     (defaulting to 1), a count that's a dice expression and conditions on
+//     when they can be picked (see random.Conditions). Tables can also be
+//     defined in TOML files in the "tables" directory of the game or any
+//     plugin.
+//       random.define_table("goblin_loot", {
+//         unique = true,
+//         entries = {
+//           { value = "rusty dagger", weight = 10 },
+//           { value = "gold", count = "2d6", weight = 5 },
+//           { table = "gems", when = { level = ">= 5" } },
+//         },
+//       })
+//   table(name): random.Table
+//     @param name: string = the name of the table
+//     return the named table, or nil if it hasn't been defined. Tables have
+//     these methods:
+//       roll(n, context, stream): table
+//         @param n: number = the number of times to roll, defaults to 1
+//         @param context: table = values the entry conditions are checked
+//           against, like the player's level
+//         @param stream: string = an optional name of the stream to roll with
+//         @errors raises an error if a referenced table doesn't exist
+//         roll on the table and return every pick, picks are tables with the
+//         value, count and name of the table the value came from.
+//           for _, pick in ipairs(random.table("goblin_loot"):roll(2)) do
+//             print(pick.count, pick.value)
+//           end
+//       name(): string
+//         the name of the table
 var Random = lua.TableMap{
 	"gen":   random.Intn,
 	"range": random.Range,
+	"weighted": func(e *lua.Engine) int {
+		return pushWeighted(e, random.WeightedChoice)
+	},
+	"define_table": func(e *lua.Engine) int {
+		def := e.PopTable()
+		name := e.PopString()
+
+		t, err := random.DecodeTable(name, def.AsMapStringInterface())
+		if err == nil {
+			err = random.DefineTable(t)
+		}
+		if err != nil {
+			e.RaiseError(err.Error())
+		}
+
+		return 0
+	},
+	"table": func(e *lua.Engine) int {
+		t, ok := random.GetTable(e.PopString())
+		if !ok {
+			e.PushValue(nil)
+
+			return 1
+		}
+
+		e.PushValue(e.NewUserData(t, e.Meta[keys.RandomTableMetatable]))
+
+		return 1
+	},
+	"stream": func(e *lua.Engine) int {
+		s := random.Stream(e.PopString())
+		e.PushValue(e.TableFromMap(streamFunctions(s)))
+
+		return 1
+	},
+	"restore": func(e *lua.Engine) int {
+		state, err := random.ParseStreamState(e.PopString())
+		if err != nil {
+			e.RaiseError(err.Error())
+
+			return 0
+		}
+
+		s := random.RestoreStream(state)
+		e.PushValue(e.TableFromMap(streamFunctions(s)))
+
+		return 1
+	},
+}
+
+// build the table of functions for the random number stream
+func streamFunctions(s *random.RNG) lua.TableMap {
+	return lua.TableMap{
+		"name":  s.Name(),
+		"gen":   s.Intn,
+		"range": s.Range,
+		"float": s.Float64,
+		"seed": func(seed int64) {
+			s.Seed(seed)
+		},
+		"state": func() string {
+			return s.State().String()
+		},
+		"weighted": func(e *lua.Engine) int {
+			return pushWeighted(e, s.WeightedChoice)
+		},
+	}
+}
+
+// pop the table of choices and push the one picked, choices are sorted so
+// seeded streams always pick the same choice.
+func pushWeighted(e *lua.Engine, choose func([]int) int) int {
+	choices := e.PopTable()
+
+	var options []*lua.Value
+	weightOf := make(map[*lua.Value]int)
+	choices.ForEach(func(key, val *lua.Value) {
+		options = append(options, key)
+		weightOf[key] = int(val.AsNumber())
+	})
+	sort.Slice(options, func(i, j int) bool {
+		return options[i].String() < options[j].String()
+	})
+
+	weights := make([]int, len(options))
+	for i, opt := range options {
+		weights[i] = weightOf[opt]
+	}
+
+	idx := choose(weights)
+	if idx < 0 {
+		e.PushValue(nil)
+
+		return 1
+	}
+	e.PushValue(options[idx])
+
+	return 1
+}
+
+// build a lua type for *random.Table with it's roll method
+func loadRandomTable(eng *lua.Engine) {
+	mt := eng.NewTable()
+	mt.Set("roll", func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		if len(args) == 0 {
+			engine.RaiseError("not enough arguments passed")
+
+			return 0
+		}
+
+		t, ok := args[0].Interface().(*random.Table)
+		if !ok {
+			engine.RaiseError("table value corrupted")
+
+			return 0
+		}
+
+		n := 1
+		if len(args) > 1 && args[1].IsNumber() {
+			n = int(args[1].AsNumber())
+		}
+		var ctx random.TableContext
+		if len(args) > 2 && args[2].IsTable() {
+			ctx = random.TableContext(args[2].AsMapStringInterface())
+		}
+
+		var (
+			picks []random.Pick
+			err   error
+		)
+		if len(args) > 3 && args[3].IsString() {
+			picks, err = t.RollWith(random.Stream(args[3].AsString()), n, ctx)
+		} else {
+			picks, err = t.Roll(n, ctx)
+		}
+		if err != nil {
+			engine.RaiseError(err.Error())
+
+			return 0
+		}
+
+		result := engine.NewTable()
+		for _, p := range picks {
+			pick := engine.NewTable()
+			pick.Set("value", entityValueToLua(engine, p.Value))
+			pick.Set("count", p.Count)
+			pick.Set("table", p.Table)
+			result.Append(pick)
+		}
+		engine.PushValue(result)
+
+		return 1
+	})
+
+	mt.Set("name", func(engine *lua.Engine) int {
+		t, ok := engine.PopValue().Interface().(*random.Table)
+		if !ok {
+			engine.RaiseError("table value corrupted")
+
+			return 0
+		}
+
+		engine.PushValue(t.Name)
+
+		return 1
+	})
+
+	mt.Set("__index", mt)
+
+	eng.Meta[keys.RandomTableMetatable] = mt
 }
@@ -56,4 +56,108 @@ var _ = Describe("Random", func() {
 			Ω(result).Should(BeNumerically("<", 90))
 		})
 	})
+
+	Describe("stream()", func() {
+		It("generates the same numbers for the same seed", func() {
+			err := e.DoString(`
+				local random = require("random")
+				local s = random.stream("lua test")
+				s.seed(42)
+				first = s.gen(1000000)
+				s.seed(42)
+				second = s.gen(1000000)
+				name = s.name
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("first").AsNumber()).Should(Equal(e.GetGlobal("second").AsNumber()))
+			Ω(e.GetGlobal("name").AsString()).Should(Equal("lua test"))
+		})
+	})
+
+	Describe("restore()", func() {
+		It("picks up where the stream left off", func() {
+			err := e.DoString(`
+				local random = require("random")
+				local s = random.stream("lua test")
+				s.seed(1)
+				local state = s.state()
+				first = s.range(0, 1000000)
+				second = random.restore(state).range(0, 1000000)
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("first").AsNumber()).Should(Equal(e.GetGlobal("second").AsNumber()))
+		})
+
+		It("fails with invalid state", func() {
+			err := e.DoString(`require("random").restore("nope")`)
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+	Describe("weighted()", func() {
+		It("picks one of the choices", func() {
+			err := e.DoString(`
+				local random = require("random")
+				picked = random.weighted({ sunny = 5, rain = 2, snow = 0 })
+				none = random.weighted({ snow = 0 })
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("picked").AsString()).Should(BeElementOf("sunny", "rain"))
+			Ω(e.GetGlobal("none").IsNil()).Should(BeTrue())
+		})
+
+		It("picks the same choice with the same seed", func() {
+			err := e.DoString(`
+				local s = require("random").stream("weighted test")
+				local choices = { a = 1, b = 1, c = 1, d = 1, e = 1 }
+				s.seed(7)
+				first = s.weighted(choices)
+				s.seed(7)
+				second = s.weighted(choices)
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("first").AsString()).Should(Equal(e.GetGlobal("second").AsString()))
+		})
+	})
+
+	Describe("table()", func() {
+		It("rolls on defined tables", func() {
+			err := e.DoString(`
+				local random = require("random")
+				random.define_table("lua_gems", {
+					entries = { { value = "ruby" } },
+				})
+				random.define_table("lua_loot", {
+					unique = true,
+					entries = {
+						{ value = "gold", count = 3, weight = 2 },
+						{ table = "lua_gems" },
+						{ value = "crown", when = { level = ">= 10" } },
+					},
+				})
+
+				local loot = random.table("lua_loot")
+				name = loot:name()
+				picks = loot:roll(3, { level = 1 }, "table test")
+				missing = random.table("nope")
+			`)
+			Ω(err).Should(BeNil())
+			Ω(e.GetGlobal("name").AsString()).Should(Equal("lua_loot"))
+			Ω(e.GetGlobal("missing").IsNil()).Should(BeTrue())
+
+			picks := e.GetGlobal("picks").AsSliceInterface()
+			Ω(picks).Should(ConsistOf(
+				map[string]interface{}{"value": "gold", "count": float64(3), "table": "lua_loot"},
+				map[string]interface{}{"value": "ruby", "count": float64(1), "table": "lua_gems"},
+			))
+		})
+
+		It("raises an error for invalid tables", func() {
+			err := e.DoString(`
+				require("random").define_table("lua_bad", {
+					entries = { { weight = 1 } },
+				})
+			`)
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
 })
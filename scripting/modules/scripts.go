@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+)
+
+// the entity scripts of the game, see scripting.EntityScripts
+type entityScripts interface {
+	Attach(entity, script string) error
+	Trigger(entity, evt string, data events.Data) (bool, error)
+}
+
+// Scripts attaches scripts to things in the world and sends them events.
+// Entity scripts are Lua files named like modules for require, they define
+// handlers named on_<event> as globals that are kept separately for each
+// entity, along with `self`, a table with the entity's id and script.
+//   -- town/guard.lua
+//   function on_greet(evt)
+//     greeted = (greeted or 0) + 1
+//   end
+//   attach(entity, script): boolean
+//     @param entity: table | string = the entity (or it's id) to attach to
+//     @param script: string = the name of the script, like "town.guard", nil
+//       removes the entity's script
+//     attach the script to the entity, anything spawned from a prototype
+//     with a script property gets the same script.
+//   trigger(entity, event, [data])
+//     @param event: string = the event, "item:wear" calls on_item_wear
+//     @param data: table = passed to the handler
+//     send the event to the entity's script. It's handled after the calling
+//     script is done, so entities can send each other events.
+var Scripts = lua.TableMap{
+	"attach": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := entityScriptsFor(engine).Attach(idArg(args, 0), stringArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"trigger": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		es := entityScriptsFor(engine)
+		entity, evt := idArg(args, 0), stringArg(args, 1)
+		var data events.Data
+		if len(args) > 2 && args[2].IsTable() {
+			data = events.Data(args[2].AsMapStringInterface())
+		}
+
+		l := log("scripts").WithField("engine", nameForEngine(engine))
+		go func() {
+			if _, err := es.Trigger(entity, evt, data); err != nil {
+				l.WithError(err).WithField("entity", entity).Error("Entity script failed.")
+			}
+		}()
+
+		return 0
+	},
+}
+
+// fetch the entity scripts, raising an error if they aren't running
+func entityScriptsFor(engine *lua.Engine) entityScripts {
+	es, ok := engine.Meta[keys.EntityScripts].(entityScripts)
+	if !ok {
+		engine.RaiseError("entity scripts aren't running")
+	}
+
+	return es
+}
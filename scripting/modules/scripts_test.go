@@ -0,0 +1,87 @@
+package modules_test
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/keys"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeEntityScripts struct {
+	mutex    sync.Mutex
+	attached map[string]string
+	events   []string
+	data     []events.Data
+}
+
+func (f *fakeEntityScripts) Attach(entity, script string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.attached[entity] = script
+
+	return nil
+}
+
+func (f *fakeEntityScripts) Trigger(entity, evt string, data events.Data) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.events = append(f.events, entity+" "+evt)
+	f.data = append(f.data, data)
+
+	return true, nil
+}
+
+func (f *fakeEntityScripts) triggered() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]string(nil), f.events...)
+}
+
+var _ = Describe("Scripts Module", func() {
+	var (
+		engine *lua.Engine
+		fake   *fakeEntityScripts
+	)
+
+	BeforeEach(func() {
+		fake = &fakeEntityScripts{attached: make(map[string]string)}
+		engine = lua.NewEngine()
+		engine.Meta[keys.EntityScripts] = fake
+		scripting.OpenLibs(engine, "scripts")
+		Ω(engine.DoString(`scripts = require("scripts")`)).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	It("attaches scripts", func() {
+		err := engine.DoString(`
+			ok = scripts.attach({ id = "guard" }, "town.guard")
+			scripts.attach("other", nil)
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("ok").AsBool()).Should(BeTrue())
+		Ω(fake.attached).Should(Equal(map[string]string{"guard": "town.guard", "other": ""}))
+	})
+
+	It("triggers events", func() {
+		err := engine.DoString(`scripts.trigger("guard", "item:wear", { item = "hat" })`)
+		Ω(err).Should(BeNil())
+		Eventually(fake.triggered).Should(Equal([]string{"guard item:wear"}))
+		Ω(fake.data[0]).Should(Equal(events.Data{"item": "hat"}))
+	})
+
+	It("fails when entity scripts aren't running", func() {
+		delete(engine.Meta, keys.EntityScripts)
+		err := engine.DoString(`scripts.trigger("guard", "poke")`)
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("entity scripts aren't running"))
+	})
+})
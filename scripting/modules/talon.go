@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -10,17 +11,30 @@ import (
 	"github.com/bbuck/dragon-mud/talon"
 )
 
-// TalonLoader will create the meta tables for talon.Row and talon.Rows for
-// this Engine.
+// fetch the database the engine queries, the one stored under keys.TalonDB or
+// the game's database
+func talonDBFor(engine *lua.Engine) *talon.DB {
+	if db, ok := engine.Meta[keys.TalonDB].(*talon.DB); ok {
+		return db
+	}
+
+	return data.Lazy()
+}
+
+// TalonLoader will create the meta tables for talon.Row, talon.Rows,
+// talon.Builder and talon.Tx for this Engine.
 func TalonLoader(engine *lua.Engine) {
 	loadTalonRow(engine)
 	loadTalonRows(engine)
+	loadTalonBuilder(engine)
+	loadTalonTx(engine)
 
 	engine.RegisterModule("talon", Talon)
 }
 
 // Talon is the core database Lua wrapper, giving the coder access to running
-// queries against the database
+// queries against the database (the game's database unless the engine was
+// given another, like the one a migration is run against)
 //   exec(cypher, properties): talon.Result
 //     @param cypher: string - the cypher query to execute on the database
 //       server
@@ -40,6 +54,121 @@ func TalonLoader(engine *lua.Engine) {
 //       or the query construction
 //     executes a query on the database server and returns a set of rows with
 //     the queries results.
+//   batch(cypher, rows): talon.Result
+//     @param cypher: string - the cypher query to run for each row, the row
+//       is available to the query as `row`
+//     @param rows: table - a list of tables, one for each time the query is
+//       run
+//     @errors raises an error if there is an issue with the database connection
+//       or the query fails
+//     runs the query for every row far faster than calling exec for each one,
+//     the result holds the stats for every row combined. This is best used for
+//     importing lots of data at once.
+//       talon.batch("CREATE (:Room {id: row.id, name: row.name})", {
+//         {id = 1, name = "Hall"},
+//         {id = 2, name = "Kitchen"},
+//       })
+//   transaction(fn): any
+//     @param fn: function = called with a talon.Tx, every query run through
+//       the transaction succeeds or fails together
+//     @errors raises an error if the transaction couldn't be started, if fn
+//       raises an error or if the transaction fails to commit
+//     run the function within a transaction. The transaction is committed
+//     when the function returns and rolled back if it raises an error,
+//     returns the value returned from the function. The function can't wait
+//     (with the async module) while the transaction is open.
+//       talon.transaction(function(tx)
+//         tx:exec("MATCH (i:Item {id: {id}}) SET i.owner = {to}", props)
+//         tx:exec("MATCH (p:Player {id: {to}}) SET p.items = p.items + 1", props)
+//       end)
+//   match(...): talon.Builder
+//     @param ...: talon.Pattern = the patterns to match
+//     start building a query that matches the patterns given, values in the
+//     patterns and conditions are passed as properties so scripts never have
+//     to build Cypher strings by hand.
+//       talon.match(talon.node("p", "Player"):where(talon.eq("name", name)))
+//         :returning("p")
+//         :query()
+//   optional_match(...): talon.Builder
+//     @param ...: talon.Pattern = the patterns to optionally match
+//     start building a query that optionally matches the patterns given.
+//   create(...): talon.Builder
+//     @param ...: talon.Pattern = the patterns to create
+//     start building a query that creates the patterns given.
+//   merge(pattern): talon.Builder
+//     @param pattern: talon.Pattern = the pattern to merge
+//     start building a query that matches the pattern, creating it if it
+//     doesn't exist.
+//   node(name, ...): talon.Pattern
+//     @param name: string = the variable name for the node, can be empty
+//     @param ...: string = labels for the node
+//     build a node pattern, the pattern has props(table) and where(...)
+//     methods as well as out(rel, node), ["in"](rel, node) and
+//     both(rel, node) to build paths to other nodes.
+//   rel(name, ...): talon.Pattern
+//     @param name: string = the variable name for the relationship, can be
+//       empty
+//     @param ...: string = types the relationship can have
+//     build a relationship pattern for use with the path methods on a node.
+//   eq, ne, gt, gte, lt, lte, is_in, contains, starts_with,
+//   ends_with(field, value): talon.Condition
+//     @param field: string = the field to compare, fields given to a
+//       pattern's where are assumed to belong to the pattern
+//     @param value: any = the value to compare the field to
+//     build a condition comparing the field to the value.
+//   is_null, is_not_null(field): talon.Condition
+//     @param field: string = the field to check
+//     build a condition checking if a field is set.
+//   all, any, none(...): talon.Condition
+//     @param ...: talon.Condition = the conditions to combine
+//     combine the conditions, matching when all, any or none of them match.
+//   raw(expr, properties): talon.Condition
+//     @param expr: string = a Cypher expression to use as a condition
+//     @param properties: table = properties used by the expression
+//     use a Cypher expression as a condition for things the builder can't
+//     express.
+//   talon.Builder
+//     match(...), optional_match(...), create(...), merge(pattern): self
+//       add another clause for the given patterns.
+//     where(...): self
+//       @param ...: talon.Condition = conditions to add to the last match
+//       add conditions to the last match, fields must reference a variable.
+//     set(name, properties), on_create_set(name, properties),
+//     on_match_set(name, properties): self
+//       @param name: string = the variable to set properties on
+//       @param properties: table = the properties to set
+//       add a clause setting the properties.
+//     delete(...), detach_delete(...): self
+//       @param ...: string = the variables to delete
+//       add a clause deleting the variables.
+//     with(...), returning(...), order_by(...): self
+//       @param ...: string = expressions for the clause
+//       add a WITH, RETURN or ORDER BY clause.
+//     skip(n), limit(n): self
+//       @param n: number = the number of rows
+//       add a SKIP or LIMIT clause.
+//     to_cypher(): string, table
+//       return the Cypher and the properties built so far.
+//     exec(): talon.Result
+//       @errors raises an error if the query was invalid or failed
+//       execute the query, like talon.exec.
+//     query(): talon.Rows
+//       @errors raises an error if the query was invalid or failed
+//       execute the query, like talon.query.
+//   talon.Tx
+//     exec(cypher, properties): talon.Result
+//     query(cypher, properties): talon.Rows
+//     batch(cypher, rows): talon.Result
+//     match(...), optional_match(...), create(...), merge(pattern):
+//     talon.Builder
+//       the same as the module functions, but run within the transaction.
+//       Rows must be closed before running another query.
+//     commit()
+//       @errors raises an error if the commit fails
+//       commit the transaction early, no further queries can be run.
+//     rollback()
+//       roll back the transaction, no further queries can be run. This does
+//       not raise an error, so the function can go on to return a value.
 //   talon.Rows
 //     next(): talon.Row
 //       the rowset is a lazy loaded series of rows, next will return the next
@@ -91,58 +220,218 @@ func TalonLoader(engine *lua.Engine) {
 //     one node to another.
 var Talon = lua.TableMap{
 	"exec": func(engine *lua.Engine) int {
-		query, err := getTalonQuery(engine)
-		if err != nil {
-			engine.RaiseError(err.Error())
+		return talonExec(engine, talonDBFor(engine), popArgs(engine))
+	},
+	"query": func(engine *lua.Engine) int {
+		return talonQuery(engine, talonDBFor(engine), popArgs(engine))
+	},
+	"batch": func(engine *lua.Engine) int {
+		return talonBatch(engine, talonDBFor(engine), popArgs(engine))
+	},
+	"transaction": func(engine *lua.Engine) int {
+		fn := engine.PopValue()
+		if !fn.IsFunction() {
+			engine.ArgumentError(1, "expected a function")
 
 			return 0
 		}
 
-		result, err := query.Exec()
+		tx, err := talonDBFor(engine).Begin()
 		if err != nil {
 			engine.RaiseError(err.Error())
 
 			return 0
 		}
 
-		engine.PushValue(result)
-
-		return 1
-	},
-	"query": func(engine *lua.Engine) int {
-		query, err := getTalonQuery(engine)
+		results, err := fn.Call(1, engine.NewUserData(tx, engine.Meta[keys.TalonTxMetatable]))
 		if err != nil {
+			if tx.IsOpen() {
+				tx.Rollback()
+			}
 			engine.RaiseError(err.Error())
 
 			return 0
 		}
 
-		rows, err := query.Query()
-		if err != nil {
-			engine.RaiseError(err.Error())
+		if tx.IsOpen() {
+			if err := tx.Commit(); err != nil {
+				engine.RaiseError(err.Error())
+
+				return 0
+			}
+		}
+		engine.PushValue(results[0])
+
+		return 1
+	},
+	"match": func(engine *lua.Engine) int {
+		return startTalonBuilder(engine, talonDBFor(engine), "match", popArgs(engine), 1)
+	},
+	"optional_match": func(engine *lua.Engine) int {
+		return startTalonBuilder(engine, talonDBFor(engine), "optional_match", popArgs(engine), 1)
+	},
+	"create": func(engine *lua.Engine) int {
+		return startTalonBuilder(engine, talonDBFor(engine), "create", popArgs(engine), 1)
+	},
+	"merge": func(engine *lua.Engine) int {
+		return startTalonBuilder(engine, talonDBFor(engine), "merge", popArgs(engine), 1)
+	},
+	"node":        talon.N,
+	"rel":         talon.R,
+	"eq":          talon.Eq,
+	"ne":          talon.Ne,
+	"gt":          talon.Gt,
+	"gte":         talon.Gte,
+	"lt":          talon.Lt,
+	"lte":         talon.Lte,
+	"contains":    talon.Contains,
+	"starts_with": talon.StartsWith,
+	"ends_with":   talon.EndsWith,
+	"is_null":     talon.IsNull,
+	"is_not_null": talon.IsNotNull,
+	"all":         talon.All,
+	"any":         talon.Any,
+	"none":        talon.None,
+	"is_in": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		if len(args) < 2 {
+			engine.ArgumentError(2, "expected a list of values")
 
 			return 0
 		}
 
-		engine.PushValue(talonToLua(engine, rows))
+		// tables have to be converted by hand, they'd become maps otherwise
+		values := args[1].AsRaw()
+		if args[1].IsTable() {
+			values = args[1].AsSliceInterface()
+		}
+		engine.PushValue(talon.In(args[0].AsString(), values))
 
 		return 1
 	},
+	"raw": func(expr string, props map[string]interface{}) talon.Condition {
+		return talon.Raw(expr, talon.Properties(props))
+	},
 }
 
-// pull passed values off the engine and build the database query
-func getTalonQuery(engine *lua.Engine) (*talon.Query, error) {
+// build the database query from the cypher and properties given
+func getTalonQuery(q talon.Querier, args []*lua.Value) (*talon.Query, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected a cypher query")
+	}
+
 	var props map[string]interface{}
-	if engine.StackSize() == 2 {
-		props = engine.PopValue().AsMapStringInterface()
+	if len(args) >= 2 {
+		props = args[1].AsMapStringInterface()
 	}
-	query := engine.PopString()
+	query := args[0].AsString()
 
 	if props == nil || len(props) == 0 {
-		return data.DB().Cypher(query), nil
+		return q.Cypher(query), nil
+	}
+
+	return q.CypherP(query, talon.Properties(props))
+}
+
+// run a query that doesn't return rows, pushing the result
+func talonExec(engine *lua.Engine, q talon.Querier, args []*lua.Value) int {
+	query, err := getTalonQuery(q, args)
+	if err != nil {
+		engine.RaiseError(err.Error())
+
+		return 0
+	}
+
+	result, err := query.Exec()
+	if err != nil {
+		engine.RaiseError(err.Error())
+
+		return 0
 	}
 
-	return data.DB().CypherP(query, talon.Properties(props))
+	engine.PushValue(result)
+
+	return 1
+}
+
+// run a query that returns rows, pushing the rows
+func talonQuery(engine *lua.Engine, q talon.Querier, args []*lua.Value) int {
+	query, err := getTalonQuery(q, args)
+	if err != nil {
+		engine.RaiseError(err.Error())
+
+		return 0
+	}
+
+	rows, err := query.Query()
+	if err != nil {
+		engine.RaiseError(err.Error())
+
+		return 0
+	}
+
+	engine.PushValue(talonToLua(engine, rows))
+
+	return 1
+}
+
+// run a query for each row in a list of tables, pushing the result
+func talonBatch(engine *lua.Engine, q talon.Querier, args []*lua.Value) int {
+	if len(args) < 2 || !args[1].IsTable() {
+		engine.RaiseError("expected a cypher query and a list of rows")
+
+		return 0
+	}
+
+	var rows []talon.Properties
+	for _, item := range args[1].AsSliceInterface() {
+		props, ok := item.(map[string]interface{})
+		if !ok {
+			engine.RaiseError("expected every row to be a table")
+
+			return 0
+		}
+		rows = append(rows, talon.Properties(props))
+	}
+
+	result, err := q.Batch(args[0].AsString(), rows)
+	if err != nil {
+		engine.RaiseError(err.Error())
+
+		return 0
+	}
+
+	engine.PushValue(result)
+
+	return 1
+}
+
+// start a builder with the given clause for the patterns, first is the
+// argument number of the first pattern for error messages.
+func startTalonBuilder(engine *lua.Engine, q talon.Querier, clause string, args []*lua.Value, first int) int {
+	patterns := talonPatterns(engine, args, first)
+	if patterns == nil && len(args) > 0 {
+		return 0
+	}
+
+	var b *talon.Builder
+	switch clause {
+	case "match":
+		b = q.Match(patterns...)
+	case "optional_match":
+		b = q.OptionalMatch(patterns...)
+	case "create":
+		b = q.Create(patterns...)
+	case "merge":
+		if len(patterns) != 1 {
+			engine.RaiseError("merge expects a single pattern")
+
+			return 0
+		}
+		b = q.Merge(patterns[0])
+	}
+
+	return pushTalonBuilder(engine, b)
 }
 
 // convert a talon type to a type valid in Lua
@@ -157,6 +446,255 @@ func talonToLua(engine *lua.Engine, v interface{}) interface{} {
 	}
 }
 
+// push the builder on to the stack as a talon.Builder value
+func pushTalonBuilder(engine *lua.Engine, b *talon.Builder) int {
+	engine.PushValue(engine.NewUserData(b, engine.Meta[keys.TalonBuilderMetatable]))
+
+	return 1
+}
+
+// wraps a chainable builder method, pulling the builder off the front of the
+// arguments and returning it when the method is finished.
+func talonBuilderMethod(fn func(*lua.Engine, *talon.Builder, []*lua.Value)) func(*lua.Engine) int {
+	return func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		if len(args) == 0 {
+			engine.RaiseError("not enough arguments passed")
+
+			return 0
+		}
+
+		b, ok := args[0].Interface().(*talon.Builder)
+		if !ok {
+			engine.RaiseError("builder value corrupted")
+
+			return 0
+		}
+
+		fn(engine, b, args[1:])
+		engine.PushValue(args[0])
+
+		return 1
+	}
+}
+
+// convert the values to strings, for builder methods taking expressions.
+func talonStrings(args []*lua.Value) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.AsString()
+	}
+
+	return strs
+}
+
+// convert the values to patterns, raising an error for anything that isn't.
+// first is the argument number of the first value, for error messages.
+func talonPatterns(engine *lua.Engine, args []*lua.Value, first int) []talon.Pattern {
+	patterns := make([]talon.Pattern, 0, len(args))
+	for i, arg := range args {
+		p, ok := arg.Interface().(talon.Pattern)
+		if !ok {
+			engine.ArgumentError(first+i, "expected a pattern, use talon.node or talon.rel")
+
+			return nil
+		}
+		patterns = append(patterns, p)
+	}
+
+	return patterns
+}
+
+// build a lua type for *talon.Builder with chainable methods for each clause
+func loadTalonBuilder(eng *lua.Engine) {
+	mt := eng.NewTable()
+	mt.Set("match", talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		b.Match(talonPatterns(engine, args, 2)...)
+	}))
+	mt.Set("optional_match", talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		b.OptionalMatch(talonPatterns(engine, args, 2)...)
+	}))
+	mt.Set("create", talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		b.Create(talonPatterns(engine, args, 2)...)
+	}))
+	mt.Set("merge", talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		if patterns := talonPatterns(engine, args, 2); len(patterns) == 1 {
+			b.Merge(patterns[0])
+		} else {
+			engine.RaiseError("merge expects a single pattern")
+		}
+	}))
+	mt.Set("where", talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		conds := make([]talon.Condition, len(args))
+		for i, arg := range args {
+			cond, ok := arg.Interface().(talon.Condition)
+			if !ok {
+				engine.ArgumentError(i+2, "expected a condition")
+
+				return
+			}
+			conds[i] = cond
+		}
+		b.Where(conds...)
+	}))
+
+	sets := map[string]func(*talon.Builder, string, talon.Properties) *talon.Builder{
+		"set":           (*talon.Builder).Set,
+		"on_create_set": (*talon.Builder).OnCreateSet,
+		"on_match_set":  (*talon.Builder).OnMatchSet,
+	}
+	for name, set := range sets {
+		set := set
+		mt.Set(name, talonBuilderMethod(func(engine *lua.Engine, b *talon.Builder, args []*lua.Value) {
+			if len(args) < 2 {
+				engine.RaiseError("expected a variable name and properties")
+
+				return
+			}
+			set(b, args[0].AsString(), talon.Properties(args[1].AsMapStringInterface()))
+		}))
+	}
+
+	exprs := map[string]func(*talon.Builder, ...string) *talon.Builder{
+		"delete":        (*talon.Builder).Delete,
+		"detach_delete": (*talon.Builder).DetachDelete,
+		"with":          (*talon.Builder).With,
+		"returning":     (*talon.Builder).Return,
+		"order_by":      (*talon.Builder).OrderBy,
+	}
+	for name, expr := range exprs {
+		expr := expr
+		mt.Set(name, talonBuilderMethod(func(_ *lua.Engine, b *talon.Builder, args []*lua.Value) {
+			expr(b, talonStrings(args)...)
+		}))
+	}
+
+	mt.Set("skip", talonBuilderMethod(func(_ *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		if len(args) > 0 {
+			b.Skip(int(args[0].AsNumber()))
+		}
+	}))
+	mt.Set("limit", talonBuilderMethod(func(_ *lua.Engine, b *talon.Builder, args []*lua.Value) {
+		if len(args) > 0 {
+			b.Limit(int(args[0].AsNumber()))
+		}
+	}))
+
+	mt.Set("to_cypher", func(engine *lua.Engine) int {
+		b, ok := engine.PopValue().Interface().(*talon.Builder)
+		if !ok {
+			engine.RaiseError("builder value corrupted")
+
+			return 0
+		}
+
+		engine.PushValue(b.ToCypher())
+		engine.PushValue(engine.TableFromMap(map[string]interface{}(b.Properties())))
+
+		return 2
+	})
+
+	mt.Set("exec", func(engine *lua.Engine) int {
+		b, ok := engine.PopValue().Interface().(*talon.Builder)
+		if !ok {
+			engine.RaiseError("builder value corrupted")
+
+			return 0
+		}
+
+		result, err := b.Exec()
+		if err != nil {
+			engine.RaiseError(err.Error())
+
+			return 0
+		}
+
+		engine.PushValue(result)
+
+		return 1
+	})
+
+	mt.Set("query", func(engine *lua.Engine) int {
+		b, ok := engine.PopValue().Interface().(*talon.Builder)
+		if !ok {
+			engine.RaiseError("builder value corrupted")
+
+			return 0
+		}
+
+		rows, err := b.Query()
+		if err != nil {
+			engine.RaiseError(err.Error())
+
+			return 0
+		}
+
+		engine.PushValue(talonToLua(engine, rows))
+
+		return 1
+	})
+
+	mt.Set("__index", mt)
+
+	eng.Meta[keys.TalonBuilderMetatable] = mt
+}
+
+// build a lua type for *talon.Tx with the same query functions as the module
+func loadTalonTx(eng *lua.Engine) {
+	method := func(fn func(*lua.Engine, *talon.Tx, []*lua.Value) int) func(*lua.Engine) int {
+		return func(engine *lua.Engine) int {
+			args := popArgs(engine)
+			if len(args) == 0 {
+				engine.RaiseError("not enough arguments passed")
+
+				return 0
+			}
+
+			tx, ok := args[0].Interface().(*talon.Tx)
+			if !ok {
+				engine.RaiseError("transaction value corrupted")
+
+				return 0
+			}
+
+			return fn(engine, tx, args[1:])
+		}
+	}
+
+	mt := eng.NewTable()
+	mt.Set("exec", method(func(engine *lua.Engine, tx *talon.Tx, args []*lua.Value) int {
+		return talonExec(engine, tx, args)
+	}))
+	mt.Set("query", method(func(engine *lua.Engine, tx *talon.Tx, args []*lua.Value) int {
+		return talonQuery(engine, tx, args)
+	}))
+	mt.Set("batch", method(func(engine *lua.Engine, tx *talon.Tx, args []*lua.Value) int {
+		return talonBatch(engine, tx, args)
+	}))
+	for _, clause := range []string{"match", "optional_match", "create", "merge"} {
+		clause := clause
+		mt.Set(clause, method(func(engine *lua.Engine, tx *talon.Tx, args []*lua.Value) int {
+			return startTalonBuilder(engine, tx, clause, args, 2)
+		}))
+	}
+	mt.Set("commit", method(func(engine *lua.Engine, tx *talon.Tx, _ []*lua.Value) int {
+		if err := tx.Commit(); err != nil {
+			engine.RaiseError(err.Error())
+		}
+
+		return 0
+	}))
+	mt.Set("rollback", method(func(engine *lua.Engine, tx *talon.Tx, _ []*lua.Value) int {
+		tx.Rollback()
+
+		return 0
+	}))
+
+	mt.Set("__index", mt)
+
+	eng.Meta[keys.TalonTxMetatable] = mt
+}
+
 // this builds a lua table for a *talon.Row object containg a single get
 // method.
 func loadTalonRow(eng *lua.Engine) {
@@ -237,6 +775,9 @@ func loadTalonRows(eng *lua.Engine) {
 
 		row, err := rows.Next()
 		if err != nil {
+			// the rows are done with, release their connection even if the
+			// script never closes them
+			rows.Close()
 			if err == io.EOF {
 				engine.PushValue(engine.Nil())
 
@@ -0,0 +1,76 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Talon batch", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "batch_test")
+		viper.Set("database.batch_test.adapter", data.MemoryAdapter)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "talon")
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("runs the query for each row", func() {
+		err := engine.DoString(`
+			local talon = require("talon")
+
+			local result = talon.batch("CREATE (:Room {id: row.id, name: row.name})", {
+				{id = 1, name = "Hall"},
+				{id = 2, name = "Kitchen"},
+			})
+			created = result.Stats.NodesCreated
+
+			local rows = talon.query("MATCH (r:Room) RETURN r.name AS name ORDER BY r.id")
+			first = rows:next():get("name")
+			rows:close()
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("created").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("first").AsString()).Should(Equal("Hall"))
+	})
+
+	It("runs within transactions", func() {
+		err := engine.DoString(`
+			local talon = require("talon")
+
+			talon.transaction(function(tx)
+				tx:batch("CREATE (:Room {id: row.id})", {{id = 1}, {id = 2}, {id = 3}})
+				tx:rollback()
+			end)
+
+			local rows = talon.query("MATCH (r:Room) RETURN count(r) AS count")
+			count = rows:next():get("count")
+			rows:close()
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("count").AsNumber()).Should(Equal(float64(0)))
+	})
+
+	It("raises an error when rows aren't tables", func() {
+		err := engine.DoString(`
+			require("talon").batch("CREATE (:Room {id: row.id})", {1, 2})
+		`)
+		Ω(err).ShouldNot(BeNil())
+	})
+})
@@ -0,0 +1,113 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Talon Builder", func() {
+	var (
+		engine *lua.Engine
+		cypher string
+		name   string
+		err    error
+	)
+
+	BeforeEach(func() {
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "talon")
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	Context("matching a node", func() {
+		BeforeEach(func() {
+			err = engine.DoString(`
+				local talon = require("talon")
+
+				local b = talon.match(talon.node("p", "Player"):where(talon.eq("name", "bob")))
+					:returning("p")
+					:limit(1)
+				cypher, props = b:to_cypher()
+				name = props.p0
+			`)
+			cypher = engine.GetGlobal("cypher").AsString()
+			name = engine.GetGlobal("name").AsString()
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("builds the cypher", func() {
+			Ω(cypher).Should(Equal("MATCH (p:Player) WHERE p.name = {p0} RETURN p LIMIT 1"))
+		})
+
+		It("passes values as properties", func() {
+			Ω(name).Should(Equal("bob"))
+		})
+	})
+
+	Context("creating paths", func() {
+		BeforeEach(func() {
+			err = engine.DoString(`
+				local talon = require("talon")
+
+				cypher = talon.match(talon.node("r", "Room"):where(talon.any(talon.eq("id", 1), talon.is_null("id"))))
+					:create(talon.node("r"):out(talon.rel("", "CONTAINS"), talon.node("i", "Item"):props({name = "sword"})))
+					:to_cypher()
+			`)
+			cypher = engine.GetGlobal("cypher").AsString()
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("builds the cypher", func() {
+			Ω(cypher).Should(Equal("MATCH (r:Room) WHERE (r.id = {p0} OR r.id IS NULL) CREATE (r)-[:CONTAINS]->(i:Item {name: {p1}})"))
+		})
+	})
+
+	Context("matching a list of values", func() {
+		var count, first *lua.Value
+
+		BeforeEach(func() {
+			err = engine.DoString(`
+				local talon = require("talon")
+
+				cypher, props = talon.match(talon.node("p", "Player"):where(talon.is_in("name", {"bob", "alice"})))
+					:returning("p")
+					:to_cypher()
+				count, first = #props.p0, props.p0[1]
+			`)
+			cypher = engine.GetGlobal("cypher").AsString()
+			count = engine.GetGlobal("count")
+			first = engine.GetGlobal("first")
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("builds the cypher", func() {
+			Ω(cypher).Should(Equal("MATCH (p:Player) WHERE p.name IN {p0} RETURN p"))
+		})
+
+		It("passes the values as a list", func() {
+			Ω(count.AsNumber()).Should(Equal(float64(2)))
+			Ω(first.AsString()).Should(Equal("bob"))
+		})
+	})
+
+	It("raises an error for invalid patterns", func() {
+		err = engine.DoString(`require("talon").match("(p:Player)")`)
+
+		Ω(err).ShouldNot(BeNil())
+	})
+})
@@ -0,0 +1,58 @@
+package modules_test
+
+import (
+	"time"
+
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Talon rows", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "rows_test")
+		viper.Set("database.rows_test.adapter", data.MemoryAdapter)
+		viper.Set("database.rows_test.connection_max", 2)
+		viper.Set("database.rows_test.connection_wait_timeout", 0)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "talon")
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("releases the connection once the rows are read, without closing them", func() {
+		done := make(chan error, 1)
+		go func() {
+			done <- engine.DoString(`
+				local talon = require("talon")
+				talon.exec("CREATE (:Room {name: 'Hall'}), (:Room {name: 'Kitchen'})")
+
+				read = 0
+				for i = 1, 5 do
+					local rows = talon.query("MATCH (r:Room) RETURN r.name AS name")
+					while rows:next() do
+						read = read + 1
+					end
+				end
+			`)
+		}()
+
+		Eventually(done, 2*time.Second).Should(Receive(BeNil()))
+		Ω(engine.GetGlobal("read").AsNumber()).Should(Equal(float64(10)))
+	})
+})
@@ -47,7 +47,9 @@ var _ = Describe("Talon", func() {
 	Describe("query", func() {
 		Context("fetching nodes", func() {
 			BeforeEach(func() {
-				data.DB().Cypher(`
+				db, err := data.DB()
+				Ω(err).Should(BeNil())
+				db.Cypher(`
 					CREATE (o:TalonModuleTestNode {name: "first"}),
 						   (t:TalonModuleTestNode:OtherLabel {name: "second"}),
 						   (th:TalonModuleTestNode {name: "third"}),
@@ -57,7 +59,8 @@ var _ = Describe("Talon", func() {
 			})
 
 			AfterEach(func() {
-				data.DB().Cypher(`
+				db, _ := data.DB()
+				db.Cypher(`
 					MATCH (n:TalonModuleTestNode)
 					OPTIONAL MATCH (n)-[r:TALON_MODULE_TEST_REL]->()
 					DELETE n, r
@@ -181,17 +181,7 @@ var Time = lua.TableMap{
 		}
 
 		val := eng.PopValue()
-		var dur float64
-		switch {
-		case val.IsNumber():
-			dur = val.AsNumber()
-		case val.IsTable():
-			dur = durationFromMap(val.AsMapStringInterface())
-		case val.IsString():
-			dur = durationFromString(val.AsString())
-		}
-
-		eng.PushValue(float64(floatToDuration(dur)))
+		eng.PushValue(float64(durationFromValue(val)))
 
 		return 1
 	},
@@ -524,6 +514,22 @@ func toInt(i interface{}) int {
 	return 0
 }
 
+// convert a Lua value (number, table or string as described by time.duration)
+// into a duration
+func durationFromValue(val *lua.Value) time.Duration {
+	var dur float64
+	switch {
+	case val.IsNumber():
+		dur = val.AsNumber()
+	case val.IsTable():
+		dur = durationFromMap(val.AsMapStringInterface())
+	case val.IsString():
+		dur = durationFromString(val.AsString())
+	}
+
+	return floatToDuration(dur)
+}
+
 // convert a float to a duration, doing bound checking
 func floatToDuration(f float64) time.Duration {
 	if f > math.MaxInt64 {
@@ -0,0 +1,792 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package modules
+
+import (
+	"errors"
+
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/entity"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// World gives scripts the shared map of the game, areas, rooms and the exits
+// between them, and tracks which room entities are in. Anywhere an area,
+// room, exit or entity is expected it's table (or entity) or it's id can be
+// given. Functions that can fail for reasons a player might cause (a locked
+// door, an exit that doesn't exist) return nil or false and an error message.
+//   create_area(name, [parent], [properties]): table
+//     @param name: string = the name of the area
+//     @param parent: table | string = the area (or zone) containing this one
+//     @param properties: table = any other properties of the area
+//     create an area, returns nil and an error message if the parent doesn't
+//     exist.
+//   area(id): table
+//     fetch the area with the id, or nil.
+//   find_area(name): table
+//     fetch the area with the name, or nil.
+//   areas([parent]): table
+//     @param parent: table | string = only list the areas in this area
+//     list every area, or the areas in the parent, sorted by name.
+//   update_area(area, properties), update_room(room, properties): boolean
+//     @param properties: table = properties to merge in, nil values are
+//       removed and "name" renames
+//     change the area or room's properties.
+//   destroy_area(area), destroy_room(room): boolean
+//     remove the area or room. Rooms in a destroyed area are left without an
+//     area and anything in a destroyed room is left nowhere.
+//   create_room(name, [area], [properties]): table
+//     @param name: string = the name of the room
+//     @param area: table | string = the area the room is in
+//     @param properties: table = any other properties, like a description
+//     create a room, returns nil and an error message if the area doesn't
+//     exist.
+//   room(id): table
+//     fetch the room with the id, or nil.
+//   rooms(area): table
+//     list the rooms in the area, sorted by name.
+//   set_area(room, area): boolean
+//     move the room into the area, nil removes it from it's area.
+//   link(from, to, name, [options]): table
+//     @param from, to: table | string = the rooms to link
+//     @param name: string = the name of the exit, directions like "n" are
+//       given their full name
+//     @param options: table = any of:
+//       one_way: boolean = don't create an exit back
+//       back: string = the name of the exit back; default: the opposite
+//         direction, or the same name
+//       door: table = closed, locked and key for a door in the exit, shared
+//         by the exit back
+//       properties: table = properties of both exits
+//     create an exit between the rooms and return it.
+//   unlink(exit): boolean
+//     remove the exit and the exit back.
+//   exits(room): table
+//     list the exits out of the room, sorted by name.
+//   exit(room, name): table
+//     fetch the room's exit with the name, or nil.
+//   open(exit), close(exit), lock(exit, [key]), unlock(exit, [key]): boolean
+//     change the exit's door, firing door:opened, door:closed, door:locked
+//     or door:unlocked on the server's events.
+//   move(entity, room): boolean
+//     put the entity in the room, firing entity:moved.
+//   go(entity, exit): table
+//     @param exit: string = the name of the exit to go through
+//     move the entity through an exit of the room it's in, returning the
+//     room it ends up in. Closed doors are in the way.
+//   location(entity): table
+//     the room the entity is in, or nil.
+//   occupants(room): table
+//     list the ids of everything in the room.
+//   remove(entity): boolean
+//     take the entity out of the world.
+//   path(from, to, [options]): table
+//     @param from, to: table | string = the rooms to find a path between
+//     @param options: table = any of:
+//       steps: boolean = find the path through the fewest exits, ignoring
+//         costs
+//       avoid_closed_doors, avoid_locked_doors: boolean = don't go through
+//         closed (or only locked) doors
+//       area: table | string = keep the path in the area
+//       max_cost: number = give up on paths costing more
+//       cost: function = called with each exit, returns what it costs to go
+//         through it or nil if it can't be gone through; default: the exit's
+//         cost property, or 1
+//       coordinates: boolean = guide the search with the x, y and z
+//         properties of rooms
+//       cached: boolean = look the path up in a table of every path in the
+//         area (or the area of the first room) that's kept until the world
+//         changes, for paths found over and over. Only steps and the door
+//         options can be used with it.
+//     find the cheapest path, returning a table with rooms (a list of room
+//     ids from the first room to the last), exits, steps (the names of the
+//     exits, for speedwalking) and cost. Returns nil and an error message if
+//     there's no path.
+//       local p = world.path(here, inn, { avoid_locked_doors = true })
+//       print(table.concat(p.steps, ", "))
+//   distance(from, to, [options]): number
+//     the cost of the path found by path, or nil and an error message.
+//   create_prototype(kind, vnum, name, [area], [properties]): table
+//     @param kind: string = "mobile" or "object"
+//     @param vnum: number = the number resets refer to the prototype by,
+//       unique for each kind
+//     create a mobile or object prototype, copies are spawned from it.
+//   prototype(kind, vnum): table
+//     fetch the prototype of the kind with the vnum, or nil.
+//   prototypes(area, [kind]): table
+//     list the area's prototypes, or only those of the kind, sorted by vnum.
+//   spawn(prototype, [room]): string
+//     create a copy of the prototype, in the room if one is given, and return
+//     it's id.
+//   add_reset(area, reset): table
+//     @param reset: table = the action ("mobile", "object", "give", "equip",
+//       "put", "door" or "randomize") and what it needs of vnum, room,
+//       container, limit, count, wear, exit and state. The room is it's vnum
+//       or a room with a vnum property.
+//     add a reset to the end of the area's resets, which run in order when
+//     the area is reset. Mobile and object resets make sure there are count
+//     (or 1) of the prototype in the room, up to limit in the world.
+//       world.add_reset(town, { action = "mobile", vnum = 10, room = 3001, count = 2 })
+//       world.add_reset(town, { action = "door", room = 3001, exit = "north", state = "locked" })
+//   resets(area): table
+//     list the area's resets in the order they run.
+//   clear_resets(area): boolean
+//     remove every reset from the area.
+//   reset(area): table
+//     reset the area now, returning a table with the ids of the mobiles and
+//     objects spawned, the number of doors changed and any warnings. Areas
+//     are also reset by the server every world.reset_interval (or their
+//     reset_interval property), firing area:reset on the server's events.
+//   Areas are tables with id, name, parent and properties, rooms have id,
+//   name, area and properties, exits have id, name, from, to, door and
+//   properties and prototypes have id, kind, vnum, name, area and properties.
+var World = lua.TableMap{
+	"create_area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		a, err := w.CreateArea(stringArg(args, 0), idArg(args, 1), propertiesArg(args, 2))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(areaToLua(engine, a))
+
+		return 1
+	},
+	"area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		a, err := worldFor(engine).Area(idArg(args, 0))
+
+		return pushArea(engine, a, err)
+	},
+	"find_area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		a, err := worldFor(engine).FindArea(stringArg(args, 0))
+
+		return pushArea(engine, a, err)
+	},
+	"areas": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+
+		var (
+			areas []*world.Area
+			err   error
+		)
+		if parent := idArg(args, 0); parent != "" {
+			areas, err = w.Subareas(parent)
+		} else {
+			areas, err = w.Areas()
+		}
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, a := range areas {
+			list.Append(areaToLua(engine, a))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"update_area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).UpdateArea(idArg(args, 0), propertiesArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"destroy_area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).DestroyArea(idArg(args, 0)))
+	},
+	"create_room": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		r, err := w.CreateRoom(stringArg(args, 0), idArg(args, 1), propertiesArg(args, 2))
+
+		return pushRoom(engine, r, err)
+	},
+	"room": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		r, err := worldFor(engine).Room(idArg(args, 0))
+
+		return pushRoom(engine, r, err)
+	},
+	"rooms": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		rooms, err := worldFor(engine).Rooms(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, r := range rooms {
+			list.Append(roomToLua(engine, r))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"update_room": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).UpdateRoom(idArg(args, 0), propertiesArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"set_area": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).SetRoomArea(idArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"destroy_room": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).DestroyRoom(idArg(args, 0)))
+	},
+	"link": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		exit, err := w.Link(idArg(args, 0), idArg(args, 1), stringArg(args, 2), linkOptionsArg(args, 3))
+
+		return pushExit(engine, exit, err)
+	},
+	"unlink": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).Unlink(idArg(args, 0)))
+	},
+	"exits": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		exits, err := worldFor(engine).Exits(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, e := range exits {
+			list.Append(exitToLua(engine, e))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"exit": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		exit, err := worldFor(engine).FindExit(idArg(args, 0), stringArg(args, 1))
+
+		return pushExit(engine, exit, err)
+	},
+	"open": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).OpenDoor(idArg(args, 0)))
+	},
+	"close": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).CloseDoor(idArg(args, 0)))
+	},
+	"lock": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).LockDoor(idArg(args, 0), stringArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"unlock": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).UnlockDoor(idArg(args, 0), stringArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"move": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		err := worldFor(engine).Move(idArg(args, 0), idArg(args, 1))
+
+		return pushWorldResult(engine, err)
+	},
+	"go": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		r, err := worldFor(engine).Go(idArg(args, 0), stringArg(args, 1))
+
+		return pushRoom(engine, r, err)
+	},
+	"location": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		r, err := worldFor(engine).Location(idArg(args, 0))
+
+		return pushRoom(engine, r, err)
+	},
+	"occupants": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		ids, err := worldFor(engine).Occupants(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(engine.TableFromSlice(ids))
+
+		return 1
+	},
+	"remove": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).Remove(idArg(args, 0)))
+	},
+	"path": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		p, err := findWorldPath(engine, args)
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		tbl := engine.NewTable()
+		tbl.Set("rooms", engine.TableFromSlice(p.Rooms))
+		exits := engine.NewTable()
+		for _, e := range p.Exits {
+			exits.Append(exitToLua(engine, e))
+		}
+		tbl.Set("exits", exits)
+		tbl.Set("steps", engine.TableFromSlice(p.Steps()))
+		tbl.Set("cost", p.Cost)
+		engine.PushValue(tbl)
+
+		return 1
+	},
+	"distance": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		p, err := findWorldPath(engine, args)
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(p.Cost)
+
+		return 1
+	},
+	"create_prototype": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		p, err := w.CreatePrototype(stringArg(args, 0), intArg(args, 1), stringArg(args, 2), idArg(args, 3), propertiesArg(args, 4))
+
+		return pushPrototype(engine, p, err)
+	},
+	"prototype": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		p, err := worldFor(engine).FindPrototype(stringArg(args, 0), intArg(args, 1))
+
+		return pushPrototype(engine, p, err)
+	},
+	"prototypes": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		protos, err := worldFor(engine).Prototypes(idArg(args, 0), stringArg(args, 1))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, p := range protos {
+			list.Append(prototypeToLua(engine, p))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"spawn": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		id, err := w.Spawn(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		if room := idArg(args, 1); room != "" {
+			if err := w.Move(id, room); err != nil {
+				return pushWorldError(engine, nil, err)
+			}
+		}
+		engine.PushValue(id)
+
+		return 1
+	},
+	"add_reset": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		w := worldFor(engine)
+		r, err := resetArg(w, args, 1)
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		added, err := w.AddReset(idArg(args, 0), r)
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+		engine.PushValue(resetToLua(engine, added))
+
+		return 1
+	},
+	"resets": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		resets, err := worldFor(engine).Resets(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		list := engine.NewTable()
+		for _, r := range resets {
+			list.Append(resetToLua(engine, r))
+		}
+		engine.PushValue(list)
+
+		return 1
+	},
+	"clear_resets": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+
+		return pushWorldResult(engine, worldFor(engine).ClearResets(idArg(args, 0)))
+	},
+	"reset": func(engine *lua.Engine) int {
+		args := popArgs(engine)
+		report, err := worldFor(engine).ResetArea(idArg(args, 0))
+		if err != nil {
+			return pushWorldError(engine, nil, err)
+		}
+
+		tbl := engine.NewTable()
+		tbl.Set("mobiles", engine.TableFromSlice(report.Mobiles))
+		tbl.Set("objects", engine.TableFromSlice(report.Objects))
+		tbl.Set("doors", report.Doors)
+		tbl.Set("warnings", engine.TableFromSlice(report.Warnings))
+		engine.PushValue(tbl)
+
+		return 1
+	},
+}
+
+var (
+	errMissingReset = errors.New("world: expected a table describing the reset")
+	errNoRoomVnum   = errors.New("world: the room has no vnum for resets to refer to it by")
+)
+
+// fetch the game's world, raising an error if the store can't be reached
+func worldFor(engine *lua.Engine) *world.World {
+	w, err := data.World()
+	if err != nil {
+		engine.RaiseError("%s", err.Error())
+	}
+
+	return w
+}
+
+// the id of the argument, which can be an id, an entity or a table with an id
+func idArg(args []*lua.Value, i int) string {
+	if i >= len(args) {
+		return ""
+	}
+
+	val := args[i]
+	switch {
+	case val.IsString():
+		return val.AsString()
+	case val.IsTable():
+		if id := val.Get("id"); id.IsString() {
+			return id.AsString()
+		}
+	default:
+		if e, ok := val.Interface().(*entity.Entity); ok {
+			return e.ID
+		}
+	}
+
+	return ""
+}
+
+func stringArg(args []*lua.Value, i int) string {
+	if i >= len(args) || !args[i].IsString() {
+		return ""
+	}
+
+	return args[i].AsString()
+}
+
+func intArg(args []*lua.Value, i int) int {
+	if i >= len(args) || !args[i].IsNumber() {
+		return 0
+	}
+
+	return int(args[i].AsNumber())
+}
+
+func propertiesArg(args []*lua.Value, i int) storage.Properties {
+	if i >= len(args) || !args[i].IsTable() {
+		return nil
+	}
+
+	return storage.Properties(args[i].AsMapStringInterface())
+}
+
+func linkOptionsArg(args []*lua.Value, i int) world.LinkOptions {
+	var opts world.LinkOptions
+	if i >= len(args) || !args[i].IsTable() {
+		return opts
+	}
+
+	tbl := args[i]
+	opts.OneWay = tbl.Get("one_way").IsTrue()
+	if back := tbl.Get("back"); back.IsString() {
+		opts.Back = back.AsString()
+	}
+	if door := tbl.Get("door"); door.IsTable() {
+		opts.Door = &world.Door{
+			Closed: door.Get("closed").IsTrue(),
+			Locked: door.Get("locked").IsTrue(),
+		}
+		if key := door.Get("key"); key.IsString() {
+			opts.Door.Key = key.AsString()
+		}
+	}
+	if props := tbl.Get("properties"); props.IsTable() {
+		opts.Properties = storage.Properties(props.AsMapStringInterface())
+	}
+
+	return opts
+}
+
+// the reset described by the table, rooms can be given as a vnum or as a room
+// with a vnum
+func resetArg(w *world.World, args []*lua.Value, i int) (world.Reset, error) {
+	var r world.Reset
+	if i >= len(args) || !args[i].IsTable() {
+		return r, errMissingReset
+	}
+
+	tbl := args[i]
+	field := func(key string) []*lua.Value {
+		return []*lua.Value{tbl.Get(key)}
+	}
+	r.Action = stringArg(field("action"), 0)
+	r.Vnum = intArg(field("vnum"), 0)
+	r.Container = intArg(field("container"), 0)
+	r.Limit = intArg(field("limit"), 0)
+	r.Count = intArg(field("count"), 0)
+	r.Wear = stringArg(field("wear"), 0)
+	r.Exit = world.ExitName(stringArg(field("exit"), 0))
+	r.State = stringArg(field("state"), 0)
+
+	room := field("room")
+	if room[0].IsNumber() {
+		r.Room = intArg(room, 0)
+	} else if id := idArg(room, 0); id != "" {
+		found, err := w.Room(id)
+		if err != nil {
+			return r, err
+		}
+		// vnums set from scripts are stored as floats
+		switch vnum := found.Properties[world.VnumProperty].(type) {
+		case int64:
+			r.Room = int(vnum)
+		case float64:
+			r.Room = int(vnum)
+		default:
+			return r, errNoRoomVnum
+		}
+	}
+
+	return r, nil
+}
+
+// find the path between the rooms given to path or distance
+func findWorldPath(engine *lua.Engine, args []*lua.Value) (*world.Path, error) {
+	var (
+		w        = worldFor(engine)
+		from, to = idArg(args, 0), idArg(args, 1)
+		opts     world.PathOptions
+		cached   bool
+		costErr  error
+	)
+	if len(args) > 2 && args[2].IsTable() {
+		tbl := args[2]
+		opts.Steps = tbl.Get("steps").IsTrue()
+		opts.AvoidClosedDoors = tbl.Get("avoid_closed_doors").IsTrue()
+		opts.AvoidLockedDoors = tbl.Get("avoid_locked_doors").IsTrue()
+		opts.Area = idArg([]*lua.Value{tbl.Get("area")}, 0)
+		if max := tbl.Get("max_cost"); max.IsNumber() {
+			opts.MaxCost = max.AsNumber()
+		}
+		if tbl.Get("coordinates").IsTrue() {
+			opts.Heuristic = world.CoordinateHeuristic
+		}
+		if fn := tbl.Get("cost"); fn.IsFunction() {
+			opts.Cost = func(e *world.Exit) float64 {
+				if costErr != nil {
+					return -1
+				}
+				ret, err := fn.Call(1, exitToLua(engine, e))
+				if err != nil {
+					costErr = err
+
+					return -1
+				}
+				if !ret[0].IsNumber() {
+					return -1
+				}
+
+				return ret[0].AsNumber()
+			}
+		}
+		cached = tbl.Get("cached").IsTrue()
+	}
+
+	if !cached {
+		p, err := w.Path(from, to, opts)
+		if costErr != nil {
+			engine.RaiseError("%s", costErr.Error())
+		}
+
+		return p, err
+	}
+
+	area := opts.Area
+	if area == "" {
+		r, err := w.Room(from)
+		if err != nil {
+			return nil, err
+		}
+		area = r.Area
+	}
+	t, err := w.AreaPaths(area, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Path(from, to)
+}
+
+// push false and the error message, or true if there wasn't an error
+func pushWorldResult(engine *lua.Engine, err error) int {
+	if err != nil {
+		return pushWorldError(engine, false, err)
+	}
+	engine.PushValue(true)
+
+	return 1
+}
+
+// push the failed value and the error message
+func pushWorldError(engine *lua.Engine, failed interface{}, err error) int {
+	engine.PushValue(failed)
+	engine.PushValue(err.Error())
+
+	return 2
+}
+
+func pushArea(engine *lua.Engine, a *world.Area, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(areaToLua(engine, a))
+
+	return 1
+}
+
+func pushRoom(engine *lua.Engine, r *world.Room, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(roomToLua(engine, r))
+
+	return 1
+}
+
+func pushExit(engine *lua.Engine, e *world.Exit, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(exitToLua(engine, e))
+
+	return 1
+}
+
+func pushPrototype(engine *lua.Engine, p *world.Prototype, err error) int {
+	if err != nil {
+		return pushWorldError(engine, nil, err)
+	}
+	engine.PushValue(prototypeToLua(engine, p))
+
+	return 1
+}
+
+func areaToLua(engine *lua.Engine, a *world.Area) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", a.ID)
+	tbl.Set("name", a.Name)
+	if a.Parent != "" {
+		tbl.Set("parent", a.Parent)
+	}
+	tbl.Set("properties", engine.TableFromMap(map[string]interface{}(a.Properties)))
+
+	return tbl
+}
+
+func roomToLua(engine *lua.Engine, r *world.Room) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", r.ID)
+	tbl.Set("name", r.Name)
+	if r.Area != "" {
+		tbl.Set("area", r.Area)
+	}
+	tbl.Set("properties", engine.TableFromMap(map[string]interface{}(r.Properties)))
+
+	return tbl
+}
+
+func exitToLua(engine *lua.Engine, e *world.Exit) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", e.ID)
+	tbl.Set("name", e.Name)
+	tbl.Set("from", e.From)
+	tbl.Set("to", e.To)
+	if e.Door != nil {
+		door := engine.NewTable()
+		door.Set("closed", e.Door.Closed)
+		door.Set("locked", e.Door.Locked)
+		if e.Door.Key != "" {
+			door.Set("key", e.Door.Key)
+		}
+		tbl.Set("door", door)
+	}
+	tbl.Set("properties", engine.TableFromMap(map[string]interface{}(e.Properties)))
+
+	return tbl
+}
+
+func prototypeToLua(engine *lua.Engine, p *world.Prototype) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", p.ID)
+	tbl.Set("kind", p.Kind)
+	tbl.Set("vnum", p.Vnum)
+	tbl.Set("name", p.Name)
+	if p.Area != "" {
+		tbl.Set("area", p.Area)
+	}
+	tbl.Set("properties", engine.TableFromMap(map[string]interface{}(p.Properties)))
+
+	return tbl
+}
+
+func resetToLua(engine *lua.Engine, r *world.Reset) *lua.Value {
+	tbl := engine.NewTable()
+	tbl.Set("id", r.ID)
+	tbl.Set("action", r.Action)
+	for k, v := range map[string]int{"vnum": r.Vnum, "room": r.Room, "container": r.Container, "limit": r.Limit, "count": r.Count} {
+		if v != 0 {
+			tbl.Set(k, v)
+		}
+	}
+	for k, v := range map[string]string{"wear": r.Wear, "exit": r.Exit, "state": r.State} {
+		if v != "" {
+			tbl.Set(k, v)
+		}
+	}
+
+	return tbl
+}
@@ -0,0 +1,262 @@
+package modules_test
+
+import (
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("World Module", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "world_test")
+		viper.Set("database.world_test.adapter", data.MemoryAdapter)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "world", "entity")
+		err := engine.DoString(`
+			world = require("world")
+			entity = require("entity")
+
+			town = world.create_area("Town")
+			square = world.create_room("Town Square", town, { description = "A busy square." })
+			inn = world.create_room("Inn", town.id)
+			north = world.link(square, inn, "n", { door = { closed = true, locked = true, key = "brass key" } })
+
+			Player = entity.define("Player", { properties = { name = "string" } })
+			bob = Player:new({ name = "bob" })
+			bob:save()
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("builds areas and rooms", func() {
+		err := engine.DoString(`
+			area_name = world.find_area("Town").name
+			room_count = #world.rooms(town)
+			room_area = world.room(square.id).area == town.id
+			description = square.properties.description
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("area_name").AsString()).Should(Equal("Town"))
+		Ω(engine.GetGlobal("room_count").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("room_area").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("description").AsString()).Should(Equal("A busy square."))
+	})
+
+	It("returns nil for missing rooms", func() {
+		err := engine.DoString(`room, err = world.room("missing")`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("room").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("err").AsString()).Should(Equal("world: room not found"))
+	})
+
+	It("links rooms in both directions", func() {
+		err := engine.DoString(`
+			exit_name = north.name
+			back = world.exit(inn, "s")
+			back_to = back.to == square.id
+			locked = back.door.locked
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("exit_name").AsString()).Should(Equal("north"))
+		Ω(engine.GetGlobal("back_to").AsBool()).Should(BeTrue())
+		Ω(engine.GetGlobal("locked").AsBool()).Should(BeTrue())
+	})
+
+	It("moves entities through doors", func() {
+		err := engine.DoString(`
+			world.move(bob, square)
+			blocked, blocked_err = world.go(bob, "north")
+			world.unlock(north, "brass key")
+			world.open(north)
+			room = world.go(bob.id, "north")
+			occupants = world.occupants(inn)
+			bob_id = bob.id
+			here = world.location(bob).name
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("blocked").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("blocked_err").AsString()).Should(Equal("world: the door is closed"))
+		Ω(engine.GetGlobal("room").Get("name").AsString()).Should(Equal("Inn"))
+		Ω(engine.GetGlobal("occupants").AsSliceInterface()).Should(Equal([]interface{}{
+			engine.GetGlobal("bob_id").AsString(),
+		}))
+		Ω(engine.GetGlobal("here").AsString()).Should(Equal("Inn"))
+	})
+
+	It("needs the right key", func() {
+		err := engine.DoString(`ok, err = world.unlock(north, "iron key")`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("ok").AsBool()).Should(BeFalse())
+		Ω(engine.GetGlobal("err").AsString()).Should(Equal("world: that's not the key for the door"))
+	})
+})
+
+var _ = Describe("World Module paths", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "world_path_test")
+		viper.Set("database.world_path_test.adapter", data.MemoryAdapter)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "world")
+		err := engine.DoString(`
+			world = require("world")
+
+			town = world.create_area("Town")
+			gate = world.create_room("Gate", town)
+			road = world.create_room("Road", town)
+			inn = world.create_room("Inn", town)
+			world.link(gate, road, "east")
+			world.link(road, inn, "east", { door = { closed = true, locked = true } })
+			world.link(gate, inn, "trail", { properties = { cost = 5 } })
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("finds paths", func() {
+		err := engine.DoString(`
+			p = world.path(gate, inn)
+			steps = table.concat(p.steps, ",")
+			cost = p.cost
+			first = p.rooms[1] == gate.id
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("steps").AsString()).Should(Equal("east,east"))
+		Ω(engine.GetGlobal("cost").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("first").AsBool()).Should(BeTrue())
+	})
+
+	It("takes options", func() {
+		err := engine.DoString(`
+			steps = table.concat(world.path(gate, inn, { avoid_locked_doors = true }).steps, ",")
+			fewest = world.distance(gate.id, inn.id, { steps = true })
+			costly = world.distance(gate, inn, {
+				cost = function(exit)
+					if exit.name == "trail" then return nil end
+					return 10
+				end,
+			})
+			none, err = world.path(inn, gate, { avoid_closed_doors = true, max_cost = 4 })
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("steps").AsString()).Should(Equal("trail"))
+		Ω(engine.GetGlobal("fewest").AsNumber()).Should(Equal(float64(1)))
+		Ω(engine.GetGlobal("costly").AsNumber()).Should(Equal(float64(20)))
+		Ω(engine.GetGlobal("none").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("err").AsString()).Should(Equal("world: there's no path between the rooms"))
+	})
+
+	It("finds cached paths in the area", func() {
+		err := engine.DoString(`
+			cost = world.distance(inn, gate, { cached = true })
+			_, err = world.path(inn, gate, { cached = true, max_cost = 1 })
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("cost").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("err").AsString()).Should(ContainSubstring("can't be built"))
+	})
+})
+
+var _ = Describe("World Module resets", func() {
+	var (
+		engine *lua.Engine
+		env    string
+	)
+
+	BeforeEach(func() {
+		env = viper.GetString("env")
+		viper.Set("env", "world_reset_test")
+		viper.Set("database.world_reset_test.adapter", data.MemoryAdapter)
+
+		engine = lua.NewEngine()
+		scripting.OpenLibs(engine, "world")
+		err := engine.DoString(`
+			world = require("world")
+
+			town = world.create_area("Town")
+			square = world.create_room("Square", town, { vnum = 3001 })
+			inn = world.create_room("Inn", town)
+			world.link(square, inn, "north", { door = {} })
+			goblin = world.create_prototype("mobile", 10, "a goblin", town, { level = 2 })
+		`)
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		engine.Close()
+		data.Close()
+		viper.Set("env", env)
+	})
+
+	It("defines and runs resets", func() {
+		err := engine.DoString(`
+			world.add_reset(town, { action = "mobile", vnum = 10, room = square, count = 2 })
+			world.add_reset(town.id, { action = "door", room = 3001, exit = "n", state = "closed" })
+			resets = #world.resets(town)
+			door_exit = world.resets(town)[2].exit
+
+			report = world.reset(town)
+			mobiles = #report.mobiles
+			doors = report.doors
+			occupants = #world.occupants(square)
+			closed = world.exit(square, "north").door.closed
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("resets").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("door_exit").AsString()).Should(Equal("north"))
+		Ω(engine.GetGlobal("mobiles").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("doors").AsNumber()).Should(Equal(float64(1)))
+		Ω(engine.GetGlobal("occupants").AsNumber()).Should(Equal(float64(2)))
+		Ω(engine.GetGlobal("closed").AsBool()).Should(BeTrue())
+	})
+
+	It("spawns prototypes", func() {
+		err := engine.DoString(`
+			found = world.prototype("mobile", 10).name
+			listed = #world.prototypes(town, "object")
+			id = world.spawn(goblin, inn)
+			here = world.location(id).id == inn.id
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("found").AsString()).Should(Equal("a goblin"))
+		Ω(engine.GetGlobal("listed").AsNumber()).Should(Equal(float64(0)))
+		Ω(engine.GetGlobal("here").AsBool()).Should(BeTrue())
+	})
+
+	It("needs rooms with vnums", func() {
+		err := engine.DoString(`
+			added, err = world.add_reset(town, { action = "object", vnum = 1, room = inn })
+		`)
+		Ω(err).Should(BeNil())
+		Ω(engine.GetGlobal("added").IsNil()).Should(BeTrue())
+		Ω(engine.GetGlobal("err").AsString()).Should(Equal("world: the room has no vnum for resets to refer to it by"))
+	})
+})
@@ -0,0 +1,183 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package scripting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bbuck/dragon-mud/scripting/lua"
+	"github.com/spf13/viper"
+)
+
+// SecurityLevel defines which tier an engine belongs to, each tier is given
+// access to a different set of modules and different resource budgets.
+type SecurityLevel uint8
+
+// Security levels, ordered from most to least trusted.
+const (
+	// ServerLevel engines run the game itself, they have access to every module
+	// and receive the most generous budgets.
+	ServerLevel SecurityLevel = 1 + iota
+
+	// ClientLevel engines are owned by a single connection, they can interact
+	// with the database but cannot define commands or touch the file system.
+	ClientLevel
+
+	// EntityLevel engines are attached to things in the world, potentially
+	// thousands of them, they are the most restricted and the most tightly
+	// budgeted.
+	EntityLevel
+)
+
+// String returns the name of the security level, as used in configuration.
+func (sl SecurityLevel) String() string {
+	switch sl {
+	case ServerLevel:
+		return "server"
+	case ClientLevel:
+		return "client"
+	case EntityLevel:
+		return "entity"
+	}
+
+	return fmt.Sprintf("unknown(%d)", uint8(sl))
+}
+
+// ParseSecurityLevel converts the name of a security level ("server", "client"
+// or "entity") into the SecurityLevel it represents.
+func ParseSecurityLevel(name string) (SecurityLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "server":
+		return ServerLevel, nil
+	case "client":
+		return ClientLevel, nil
+	case "entity":
+		return EntityLevel, nil
+	}
+
+	return 0, fmt.Errorf("%q is not a valid security level, expected server, client or entity", name)
+}
+
+// SecurityProfile describes everything that is allowed for engines of a given
+// security level.
+//   Modules are given to OpenLibs, so "*" and "-name" are valid entries.
+//   DisabledGlobals are removed from the engine after libraries are opened.
+//   InstructionLimit is the number of Lua instructions a single call may run,
+//     0 means unlimited.
+//   TimeLimit is the amount of wall clock time a single call may run, 0 means
+//     unlimited.
+//   MemoryLimit is the (estimated) number of bytes an engine may hold on to,
+//     0 means unlimited.
+type SecurityProfile struct {
+	Level            SecurityLevel
+	Modules          []string
+	DisabledGlobals  []string
+	InstructionLimit uint64
+	TimeLimit        time.Duration
+	MemoryLimit      uint64
+}
+
+// default profiles for each security level, the budgets here can be
+// overridden in the Dragonfile under scripting.<level>.
+var securityProfiles = map[SecurityLevel]SecurityProfile{
+	ServerLevel: {
+		Level:            ServerLevel,
+		Modules:          []string{"*"},
+		InstructionLimit: 10000000,
+		TimeLimit:        5 * time.Second,
+		MemoryLimit:      256 * 1024 * 1024,
+	},
+	ClientLevel: {
+		Level:            ClientLevel,
+		Modules:          []string{"*", "-cli"},
+		DisabledGlobals:  []string{"dofile", "loadfile"},
+		InstructionLimit: 1000000,
+		TimeLimit:        time.Second,
+		MemoryLimit:      16 * 1024 * 1024,
+	},
+	// entities are given an explicit list of modules rather than everything
+	// but a few, so new modules have to be granted to them on purpose. They
+	// get scripts so they can send each other events.
+	EntityLevel: {
+		Level:            EntityLevel,
+		Modules:          []string{"tmpl", "die", "events", "log", "sutil", "time", "uuid", "random", "fn", "scripts"},
+		DisabledGlobals:  []string{"dofile", "loadfile"},
+		InstructionLimit: 100000,
+		TimeLimit:        100 * time.Millisecond,
+		MemoryLimit:      1024 * 1024,
+	},
+}
+
+// Profile returns the security profile for the level, applying any budget
+// overrides found in the configuration.
+func (sl SecurityLevel) Profile() SecurityProfile {
+	profile, ok := securityProfiles[sl]
+	if !ok {
+		// unknown levels get the most restrictive treatment possible
+		profile = securityProfiles[EntityLevel]
+		profile.Level = sl
+	}
+
+	ikey := fmt.Sprintf("scripting.%s.instruction_limit", sl)
+	if viper.IsSet(ikey) {
+		profile.InstructionLimit = uint64(viper.GetInt64(ikey))
+	}
+
+	tkey := fmt.Sprintf("scripting.%s.time_limit", sl)
+	if viper.IsSet(tkey) {
+		profile.TimeLimit = viper.GetDuration(tkey)
+	}
+
+	mkey := fmt.Sprintf("scripting.%s.memory_limit", sl)
+	if viper.IsSet(mkey) {
+		profile.MemoryLimit = uint64(viper.GetInt64(mkey))
+	}
+
+	return profile
+}
+
+// Mutator returns the engine mutator that builds engines for this level.
+func (sl SecurityLevel) Mutator() lua.EngineMutator {
+	switch sl {
+	case ServerLevel:
+		return ServerEngineMutator
+	case ClientLevel:
+		return ClientEngineMutator
+	default:
+		return EntityEngineMutator
+	}
+}
+
+// Limits returns the execution limits applied to each call into engines with
+// this profile.
+func (sp SecurityProfile) Limits() lua.ExecutionLimits {
+	return lua.ExecutionLimits{
+		Instructions: sp.InstructionLimit,
+		Duration:     sp.TimeLimit,
+		Memory:       sp.MemoryLimit,
+	}
+}
+
+// Apply opens the modules the profile allows and strips out any globals it
+// forbids.
+func (sp SecurityProfile) Apply(eng *lua.Engine) {
+	OpenLibs(eng, sp.Modules...)
+
+	for _, name := range sp.DisabledGlobals {
+		eng.SetGlobal(name, eng.Nil())
+	}
+}
+
+// NewEngine creates a stand alone engine (one that does not belong to a pool)
+// for the given security level, fully mutated and ready to use.
+func NewEngine(sl SecurityLevel) *lua.Engine {
+	eng := lua.NewEngine(lua.EngineOptions{
+		FieldNaming:  lua.SnakeCaseNames,
+		MethodNaming: lua.SnakeCaseNames,
+	})
+	sl.Mutator()(eng)
+
+	return eng
+}
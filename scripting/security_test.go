@@ -0,0 +1,91 @@
+package scripting_test
+
+import (
+	. "github.com/bbuck/dragon-mud/scripting"
+	"github.com/spf13/viper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SecurityLevel", func() {
+	Describe("ParseSecurityLevel", func() {
+		It("parses known levels", func() {
+			for name, expected := range map[string]SecurityLevel{
+				"server":  ServerLevel,
+				"Client":  ClientLevel,
+				" entity": EntityLevel,
+			} {
+				sl, err := ParseSecurityLevel(name)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(sl).Should(Equal(expected))
+			}
+		})
+
+		It("fails for unknown levels", func() {
+			_, err := ParseSecurityLevel("admin")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Profile", func() {
+		It("gives entities the tightest budgets", func() {
+			server := ServerLevel.Profile()
+			entity := EntityLevel.Profile()
+
+			Ω(entity.InstructionLimit).Should(BeNumerically("<", server.InstructionLimit))
+			Ω(entity.MemoryLimit).Should(BeNumerically("<", server.MemoryLimit))
+		})
+
+		It("allows overriding budgets from configuration", func() {
+			viper.Set("scripting.client.instruction_limit", 42)
+			defer viper.Set("scripting.client.instruction_limit", nil)
+
+			Ω(ClientLevel.Profile().InstructionLimit).Should(Equal(uint64(42)))
+		})
+	})
+
+	Describe("NewEngine", func() {
+		BeforeEach(func() {
+			InitializeEmitters()
+		})
+
+		It("denies entity engines access to talon", func() {
+			eng := NewEngine(EntityLevel)
+			defer eng.Close()
+
+			Ω(eng.DoString(`require("log")`)).Should(Succeed())
+			Ω(eng.DoString(`require("talon")`)).ShouldNot(Succeed())
+			Ω(eng.GetGlobal("dofile").IsNil()).Should(BeTrue())
+		})
+
+		It("only gives entity engines the modules they're allowed", func() {
+			eng := NewEngine(EntityLevel)
+			defer eng.Close()
+
+			Ω(eng.DoString(`require("events")`)).Should(Succeed())
+			Ω(eng.DoString(`require("scripts")`)).Should(Succeed())
+			Ω(eng.DoString(`require("pool")`)).ShouldNot(Succeed())
+			Ω(eng.DoString(`require("talon")`)).ShouldNot(Succeed())
+		})
+
+		It("drops memory limits engines start out over", func() {
+			viper.Set("scripting.entity.memory_limit", 1)
+			defer viper.Set("scripting.entity.memory_limit", nil)
+
+			eng := NewEngine(EntityLevel)
+			defer eng.Close()
+
+			Ω(eng.ExecutionLimits().Memory).Should(BeZero())
+			Ω(eng.DoString(`x = 1`)).Should(Succeed())
+		})
+
+		It("gives server engines access to everything", func() {
+			eng := NewEngine(ServerLevel)
+			defer eng.Close()
+
+			Ω(eng.DoString(`require("talon")`)).Should(Succeed())
+			Ω(eng.DoString(`require("cli")`)).Should(Succeed())
+		})
+	})
+})
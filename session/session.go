@@ -0,0 +1,136 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package session keeps track of the connections players are playing through,
+// by the entity each one controls, so anything in the game can send text to a
+// player without knowing how they're connected.
+package session
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/ansi"
+)
+
+// ErrNotConnected is returned when sending text to an entity nobody is
+// playing.
+var ErrNotConnected = errors.New("session: not connected")
+
+// Session is a connection to a player.
+type Session interface {
+	Send(text string) error
+}
+
+// Online holds the sessions of everyone playing the game.
+var Online = NewRegistry()
+
+// Registry holds sessions by the ID of the entity they control.
+type Registry struct {
+	sessions map[string]Session
+	mutex    sync.RWMutex
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		sessions: make(map[string]Session),
+	}
+}
+
+// Attach connects the session to the entity, replacing any session it already
+// had.
+func (r *Registry) Attach(entity string, s Session) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sessions[entity] = s
+}
+
+// Detach disconnects the entity's session.
+func (r *Registry) Detach(entity string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.sessions, entity)
+}
+
+// Session fetches the entity's session.
+func (r *Registry) Session(entity string) (Session, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	s, ok := r.sessions[entity]
+
+	return s, ok
+}
+
+// Send sends the text to the entity's session.
+func (r *Registry) Send(entity, text string) error {
+	s, ok := r.Session(entity)
+	if !ok {
+		return ErrNotConnected
+	}
+
+	return s.Send(text)
+}
+
+// Connected lists the IDs of the entities with a session, sorted.
+func (r *Registry) Connected() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	ids := make([]string, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Release detaches the session from every entity it's attached to, returning
+// their IDs sorted. Used once the player has disconnected.
+func (r *Registry) Release(s Session) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var ids []string
+	for id, other := range r.sessions {
+		if other == s {
+			ids = append(ids, id)
+			delete(r.sessions, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Writer is a session writing to a connection, like a telnet connection.
+// Color codes are turned into ANSI codes and each line of text ends with
+// "\r\n".
+type Writer struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewWriter creates a session writing to the writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Send writes the text as a line, text sent at the same time isn't mixed
+// together.
+func (w *Writer) Send(text string) error {
+	text = strings.Replace(strings.TrimRight(text, "\r\n"), "\r\n", "\n", -1)
+	text = strings.Replace(text, "\n", "\r\n", -1)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err := io.WriteString(w.w, ansi.Colorize(text)+"\r\n")
+
+	return err
+}
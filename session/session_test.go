@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package session_test
+
+import (
+	"bytes"
+
+	. "github.com/bbuck/dragon-mud/session"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session", func() {
+	Describe("Registry", func() {
+		var (
+			r   *Registry
+			buf *bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			r = NewRegistry()
+			buf = new(bytes.Buffer)
+			r.Attach("bob", NewWriter(buf))
+		})
+
+		It("sends text to the entity's session", func() {
+			Ω(r.Send("bob", "Hello.")).Should(BeNil())
+			Ω(buf.String()).Should(Equal("Hello.\r\n"))
+		})
+
+		It("lists who's connected", func() {
+			r.Attach("alice", NewWriter(new(bytes.Buffer)))
+			Ω(r.Connected()).Should(Equal([]string{"alice", "bob"}))
+		})
+
+		It("doesn't send to entities without a session", func() {
+			r.Detach("bob")
+			Ω(r.Send("bob", "Hello.")).Should(Equal(ErrNotConnected))
+			Ω(buf.Len()).Should(Equal(0))
+		})
+
+		It("releases a session from every entity", func() {
+			s, _ := r.Session("bob")
+			r.Attach("alice", NewWriter(new(bytes.Buffer)))
+			r.Attach("bob's horse", s)
+			Ω(r.Release(s)).Should(Equal([]string{"bob", "bob's horse"}))
+			Ω(r.Connected()).Should(Equal([]string{"alice"}))
+		})
+	})
+
+	Describe("Writer", func() {
+		It("ends lines the way telnet expects", func() {
+			buf := new(bytes.Buffer)
+			w := NewWriter(buf)
+			Ω(w.Send("one\ntwo\r\nthree\n")).Should(BeNil())
+			Ω(buf.String()).Should(Equal("one\r\ntwo\r\nthree\r\n"))
+		})
+	})
+})
@@ -0,0 +1,432 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// buckets used by the embedded store. Nodes and relationships are stored as
+// JSON by ID, labels map to the IDs of nodes with the label and the out and
+// in buckets map a node ID to the IDs of it's relationships.
+var (
+	nodesBucket  = []byte("nodes")
+	relsBucket   = []byte("relationships")
+	labelsBucket = []byte("labels")
+	outBucket    = []byte("out")
+	inBucket     = []byte("in")
+)
+
+// the stored form of a node
+type storedNode struct {
+	Labels     []string   `json:"labels"`
+	Properties Properties `json:"properties"`
+}
+
+// the stored form of a relationship
+type storedRelationship struct {
+	Type       string     `json:"type"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Properties Properties `json:"properties"`
+}
+
+// EmbeddedStore keeps the graph in a single file on disk using bbolt, so a
+// game can run without any external database.
+type EmbeddedStore struct {
+	db *bolt.DB
+}
+
+// OpenEmbedded opens (or creates) the store at the given path.
+func OpenEmbedded(path string) (*EmbeddedStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{nodesBucket, relsBucket, labelsBucket, outBucket, inBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return &EmbeddedStore{db: db}, nil
+}
+
+// CreateNode saves a new node with the labels and properties.
+func (es *EmbeddedStore) CreateNode(labels []string, props Properties) (*Node, error) {
+	n := &Node{
+		ID:         uuid.NewV4().String(),
+		Labels:     append([]string(nil), labels...),
+		Properties: normalizeProperties(props),
+	}
+
+	err := es.db.Update(func(tx *bolt.Tx) error {
+		if err := putNode(tx, n); err != nil {
+			return err
+		}
+		for _, label := range n.Labels {
+			b, err := tx.Bucket(labelsBucket).CreateBucketIfNotExists([]byte(label))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(n.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// GetNode fetches the node with the ID.
+func (es *EmbeddedStore) GetNode(id string) (*Node, error) {
+	var n *Node
+	err := es.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = getNode(tx, id)
+
+		return err
+	})
+
+	return n, err
+}
+
+// UpdateNode merges the properties into the node's properties.
+func (es *EmbeddedStore) UpdateNode(id string, props Properties) error {
+	return es.db.Update(func(tx *bolt.Tx) error {
+		n, err := getNode(tx, id)
+		if err != nil {
+			return err
+		}
+		n.Properties = mergeProperties(n.Properties, props)
+
+		return putNode(tx, n)
+	})
+}
+
+// DeleteNode removes the node and all of it's relationships.
+func (es *EmbeddedStore) DeleteNode(id string) error {
+	return es.db.Update(func(tx *bolt.Tx) error {
+		n, err := getNode(tx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range [][]byte{outBucket, inBucket} {
+			for _, relID := range nestedKeys(tx.Bucket(name), id) {
+				if err := deleteRelationship(tx, relID); err != nil {
+					return err
+				}
+			}
+		}
+		for _, label := range n.Labels {
+			if b := tx.Bucket(labelsBucket).Bucket([]byte(label)); b != nil {
+				if err := b.Delete([]byte(id)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Bucket(nodesBucket).Delete([]byte(id))
+	})
+}
+
+// FindNodes fetches the nodes with the label and properties.
+func (es *EmbeddedStore) FindNodes(label string, props Properties) ([]*Node, error) {
+	var found []*Node
+	err := es.db.View(func(tx *bolt.Tx) error {
+		check := func(n *Node) {
+			if matchProperties(n.Properties, props) {
+				found = append(found, n)
+			}
+		}
+
+		if label == "" {
+			return tx.Bucket(nodesBucket).ForEach(func(k, v []byte) error {
+				n, err := decodeNode(k, v)
+				if err != nil {
+					return err
+				}
+				check(n)
+
+				return nil
+			})
+		}
+
+		for _, id := range nestedKeys(tx.Bucket(labelsBucket), label) {
+			n, err := getNode(tx, id)
+			if err != nil {
+				return err
+			}
+			check(n)
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// CreateRelationship connects the nodes with a new relationship.
+func (es *EmbeddedStore) CreateRelationship(from, to, typ string, props Properties) (*Relationship, error) {
+	if typ == "" {
+		return nil, ErrMissingType
+	}
+	r := &Relationship{
+		ID:         uuid.NewV4().String(),
+		Type:       typ,
+		From:       from,
+		To:         to,
+		Properties: normalizeProperties(props),
+	}
+
+	err := es.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range []string{from, to} {
+			if tx.Bucket(nodesBucket).Get([]byte(id)) == nil {
+				return fmt.Errorf("storage: cannot relate missing node %s", id)
+			}
+		}
+
+		if err := putRelationship(tx, r); err != nil {
+			return err
+		}
+		if err := putNested(tx.Bucket(outBucket), from, r.ID); err != nil {
+			return err
+		}
+
+		return putNested(tx.Bucket(inBucket), to, r.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetRelationship fetches the relationship with the ID.
+func (es *EmbeddedStore) GetRelationship(id string) (*Relationship, error) {
+	var r *Relationship
+	err := es.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = getRelationship(tx, id)
+
+		return err
+	})
+
+	return r, err
+}
+
+// UpdateRelationship merges the properties into the relationship's
+// properties.
+func (es *EmbeddedStore) UpdateRelationship(id string, props Properties) error {
+	return es.db.Update(func(tx *bolt.Tx) error {
+		r, err := getRelationship(tx, id)
+		if err != nil {
+			return err
+		}
+		r.Properties = mergeProperties(r.Properties, props)
+
+		return putRelationship(tx, r)
+	})
+}
+
+// DeleteRelationship removes the relationship.
+func (es *EmbeddedStore) DeleteRelationship(id string) error {
+	return es.db.Update(func(tx *bolt.Tx) error {
+		return deleteRelationship(tx, id)
+	})
+}
+
+// Relationships fetches the node's relationships in the direction.
+func (es *EmbeddedStore) Relationships(nodeID, typ string, dir Direction) ([]*Relationship, error) {
+	var found []*Relationship
+	err := es.db.View(func(tx *bolt.Tx) error {
+		seen := make(map[string]bool)
+		for _, d := range []Direction{Outgoing, Incoming} {
+			if dir&d == 0 {
+				continue
+			}
+			name := outBucket
+			if d == Incoming {
+				name = inBucket
+			}
+
+			for _, id := range nestedKeys(tx.Bucket(name), nodeID) {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				r, err := getRelationship(tx, id)
+				if err != nil {
+					return err
+				}
+				if typ == "" || r.Type == typ {
+					found = append(found, r)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return found, err
+}
+
+// Close closes the underlying file.
+func (es *EmbeddedStore) Close() error {
+	return es.db.Close()
+}
+
+func putNode(tx *bolt.Tx, n *Node) error {
+	bs, err := json.Marshal(storedNode{
+		Labels:     n.Labels,
+		Properties: n.Properties,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(nodesBucket).Put([]byte(n.ID), bs)
+}
+
+func getNode(tx *bolt.Tx, id string) (*Node, error) {
+	bs := tx.Bucket(nodesBucket).Get([]byte(id))
+	if bs == nil {
+		return nil, ErrNotFound
+	}
+
+	return decodeNode([]byte(id), bs)
+}
+
+func decodeNode(id, bs []byte) (*Node, error) {
+	var sn storedNode
+	if err := decodeJSON(bs, &sn); err != nil {
+		return nil, err
+	}
+
+	return &Node{
+		ID:         string(id),
+		Labels:     sn.Labels,
+		Properties: normalizeProperties(sn.Properties),
+	}, nil
+}
+
+func putRelationship(tx *bolt.Tx, r *Relationship) error {
+	bs, err := json.Marshal(storedRelationship{
+		Type:       r.Type,
+		From:       r.From,
+		To:         r.To,
+		Properties: r.Properties,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(relsBucket).Put([]byte(r.ID), bs)
+}
+
+func getRelationship(tx *bolt.Tx, id string) (*Relationship, error) {
+	bs := tx.Bucket(relsBucket).Get([]byte(id))
+	if bs == nil {
+		return nil, ErrNotFound
+	}
+
+	var sr storedRelationship
+	if err := decodeJSON(bs, &sr); err != nil {
+		return nil, err
+	}
+
+	return &Relationship{
+		ID:         id,
+		Type:       sr.Type,
+		From:       sr.From,
+		To:         sr.To,
+		Properties: normalizeProperties(sr.Properties),
+	}, nil
+}
+
+func deleteRelationship(tx *bolt.Tx, id string) error {
+	r, err := getRelationship(tx, id)
+	if err != nil {
+		return err
+	}
+
+	if b := tx.Bucket(outBucket).Bucket([]byte(r.From)); b != nil {
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+	}
+	if b := tx.Bucket(inBucket).Bucket([]byte(r.To)); b != nil {
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(relsBucket).Delete([]byte(id))
+}
+
+// add the key to the nested bucket, creating it if needed
+func putNested(parent *bolt.Bucket, name, key string) error {
+	b, err := parent.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), []byte{})
+}
+
+// list the keys of a nested bucket, copied since bolt's slices are only valid
+// for the life of the transaction
+func nestedKeys(parent *bolt.Bucket, name string) []string {
+	b := parent.Bucket([]byte(name))
+	if b == nil {
+		return nil
+	}
+
+	var keys []string
+	b.ForEach(func(k, _ []byte) error {
+		keys = append(keys, string(k))
+
+		return nil
+	})
+
+	return keys
+}
+
+// decode JSON keeping numbers precise so integers come back as integers
+func decodeJSON(bs []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
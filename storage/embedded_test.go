@@ -0,0 +1,51 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EmbeddedStore", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "storage")
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	behavesLikeAStore(func() Store {
+		es, err := OpenEmbedded(filepath.Join(dir, "game", "test.db"))
+		Ω(err).Should(BeNil())
+
+		return es
+	})
+
+	It("keeps data after being reopened", func() {
+		path := filepath.Join(dir, "reopen.db")
+		es, err := OpenEmbedded(path)
+		Ω(err).Should(BeNil())
+		n, err := es.CreateNode([]string{"Item"}, Properties{"tags": []string{"sharp"}})
+		Ω(err).Should(BeNil())
+		Ω(es.Close()).Should(BeNil())
+
+		es, err = OpenEmbedded(path)
+		Ω(err).Should(BeNil())
+		defer es.Close()
+		found, err := es.GetNode(n.ID)
+		Ω(err).Should(BeNil())
+		Ω(found.Properties["tags"]).Should(Equal([]interface{}{"sharp"}))
+	})
+})
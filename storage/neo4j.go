@@ -0,0 +1,313 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bbuck/dragon-mud/talon"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Neo4jStore keeps the graph in Neo4j through talon. Nodes and relationships
+// are identified by their IDProperty rather than Neo4j's internal IDs, which
+// can be reused after something is deleted.
+type Neo4jStore struct {
+	db *talon.DB
+}
+
+// NewNeo4jStore creates a store on top of the database. The store doesn't own
+// the database, closing the store leaves the database open.
+func NewNeo4jStore(db *talon.DB) *Neo4jStore {
+	return &Neo4jStore{db: db}
+}
+
+// CreateNode saves a new node with the labels and properties.
+func (ns *Neo4jStore) CreateNode(labels []string, props Properties) (*Node, error) {
+	id := uuid.NewV4().String()
+	props = normalizeProperties(props)
+	_, err := ns.db.Create(talon.N("n", labels...).Props(withID(props, id))).Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Node{
+		ID:         id,
+		Labels:     append([]string(nil), labels...),
+		Properties: props,
+	}, nil
+}
+
+// GetNode fetches the node with the ID.
+func (ns *Neo4jStore) GetNode(id string) (*Node, error) {
+	nodes, err := ns.nodes(ns.db.Match(nodeWithID("n", id)).Return("n"))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return nodes[0], nil
+}
+
+// UpdateNode merges the properties into the node's properties.
+func (ns *Neo4jStore) UpdateNode(id string, props Properties) error {
+	return ns.update(ns.db.Match(nodeWithID("n", id)), "n", props)
+}
+
+// DeleteNode removes the node and all of it's relationships.
+func (ns *Neo4jStore) DeleteNode(id string) error {
+	result, err := ns.db.Match(nodeWithID("n", id)).DetachDelete("n").Exec()
+	if err != nil {
+		return err
+	}
+	if result.Stats.NodesDeleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// FindNodes fetches the nodes with the label and properties.
+func (ns *Neo4jStore) FindNodes(label string, props Properties) ([]*Node, error) {
+	var labels []string
+	if label != "" {
+		labels = append(labels, label)
+	}
+
+	return ns.nodes(ns.db.Match(talon.N("n", labels...).Where(equalTo(props)...)).Return("n"))
+}
+
+// CreateRelationship connects the nodes with a new relationship.
+func (ns *Neo4jStore) CreateRelationship(from, to, typ string, props Properties) (*Relationship, error) {
+	if typ == "" {
+		return nil, ErrMissingType
+	}
+	id := uuid.NewV4().String()
+	props = normalizeProperties(props)
+	rows, err := ns.db.
+		Match(nodeWithID("a", from), nodeWithID("b", to)).
+		Create(talon.N("a").Out(talon.R("r", typ).Props(withID(props, id)), talon.N("b"))).
+		Return("a." + IDProperty).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found, err := rows.All()
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("storage: cannot relate %s and %s, one of them is missing", from, to)
+	}
+
+	return &Relationship{
+		ID:         id,
+		Type:       typ,
+		From:       from,
+		To:         to,
+		Properties: props,
+	}, nil
+}
+
+// GetRelationship fetches the relationship with the ID.
+func (ns *Neo4jStore) GetRelationship(id string) (*Relationship, error) {
+	rels, err := ns.relationships(ns.db.Match(relWithID(id)))
+	if err != nil {
+		return nil, err
+	}
+	if len(rels) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return rels[0], nil
+}
+
+// UpdateRelationship merges the properties into the relationship's
+// properties.
+func (ns *Neo4jStore) UpdateRelationship(id string, props Properties) error {
+	return ns.update(ns.db.Match(relWithID(id)), "r", props)
+}
+
+// DeleteRelationship removes the relationship.
+func (ns *Neo4jStore) DeleteRelationship(id string) error {
+	result, err := ns.db.Match(relWithID(id)).Delete("r").Exec()
+	if err != nil {
+		return err
+	}
+	if result.Stats.RelationshipsDeleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Relationships fetches the node's relationships in the direction.
+func (ns *Neo4jStore) Relationships(nodeID, typ string, dir Direction) ([]*Relationship, error) {
+	var types []string
+	if typ != "" {
+		types = append(types, typ)
+	}
+
+	n, r, m := nodeWithID("n", nodeID), talon.R("r", types...), talon.N("m")
+	var path talon.Pattern
+	switch dir {
+	case Outgoing:
+		path = n.Out(r, m)
+	case Incoming:
+		path = n.In(r, m)
+	default:
+		path = n.Both(r, m)
+	}
+
+	return ns.relationships(ns.db.Match(path))
+}
+
+// Close does nothing, the database belongs to whoever created the store.
+func (ns *Neo4jStore) Close() error {
+	return nil
+}
+
+// set the properties on the named node or relationship matched by the
+// builder, nil properties are removed.
+func (ns *Neo4jStore) update(b *talon.Builder, name string, props Properties) error {
+	set := make(talon.Properties, len(props))
+	for k, v := range props {
+		if k == IDProperty {
+			continue
+		}
+		if v != nil {
+			v = normalize(v)
+		}
+		set[k] = v
+	}
+	if len(set) > 0 {
+		b.Set(name, set)
+	}
+
+	rows, err := b.Return(name + "." + IDProperty).Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found, err := rows.All()
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// run the query, converting the nodes in the first column
+func (ns *Neo4jStore) nodes(b *talon.Builder) ([]*Node, error) {
+	rows, err := b.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*Node
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		val, _ := row.GetIndex(0)
+		tn, ok := val.(*talon.Node)
+		if !ok {
+			return nil, fmt.Errorf("storage: expected a node but got %T", val)
+		}
+		id, props := splitID(tn.Properties)
+		nodes = append(nodes, &Node{
+			ID:         id,
+			Labels:     tn.Labels,
+			Properties: props,
+		})
+	}
+}
+
+// run the query matching r, returning the relationships along with the IDs
+// of the nodes on either end
+func (ns *Neo4jStore) relationships(b *talon.Builder) ([]*Relationship, error) {
+	rows, err := b.
+		Return("DISTINCT r", "startNode(r)."+IDProperty, "endNode(r)."+IDProperty).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rels []*Relationship
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return rels, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		val, _ := row.GetIndex(0)
+		tr, ok := val.(*talon.Relationship)
+		if !ok {
+			return nil, fmt.Errorf("storage: expected a relationship but got %T", val)
+		}
+		from, _ := row.GetIndex(1)
+		to, _ := row.GetIndex(2)
+		id, props := splitID(tr.Properties)
+		rels = append(rels, &Relationship{
+			ID:         id,
+			Type:       tr.Name,
+			From:       fmt.Sprint(from),
+			To:         fmt.Sprint(to),
+			Properties: props,
+		})
+	}
+}
+
+// pattern matching a node by ID
+func nodeWithID(name, id string) *talon.NodePattern {
+	return talon.N(name).Where(talon.Eq(IDProperty, id))
+}
+
+// pattern matching a relationship, r, by ID
+func relWithID(id string) talon.Pattern {
+	return talon.N("").Out(talon.R("r").Where(talon.Eq(IDProperty, id)), talon.N(""))
+}
+
+// conditions requiring each property to equal the value given
+func equalTo(props Properties) []talon.Condition {
+	var conds []talon.Condition
+	for _, k := range talon.Properties(props).Keys() {
+		conds = append(conds, talon.Eq(k, normalize(props[k])))
+	}
+
+	return conds
+}
+
+func withID(props Properties, id string) talon.Properties {
+	return talon.Properties(props).Merge(talon.Properties{IDProperty: id})
+}
+
+// pull the ID out of the properties read from the database
+func splitID(props talon.Properties) (string, Properties) {
+	id, _ := props[IDProperty].(string)
+	rest := make(Properties, len(props))
+	for k, v := range props {
+		if k != IDProperty {
+			rest[k] = normalize(v)
+		}
+	}
+
+	return id, rest
+}
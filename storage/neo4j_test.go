@@ -0,0 +1,18 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage_test
+
+import (
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/onsi/ginkgo"
+)
+
+var _ = Describe("Neo4jStore", func() {
+	behavesLikeAStore(func() Store {
+		return NewNeo4jStore(talon.NewDB(memory.NewDriver()))
+	})
+})
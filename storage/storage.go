@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package storage defines how game data is persisted independent of any one
+// database. Data is stored as a graph of labeled nodes connected by typed
+// relationships, both of which hold properties. The game can be backed by
+// Neo4j (through talon) or by an embedded on-disk store that needs no
+// external services.
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// IDProperty is the property stores use to identify nodes and relationships.
+const IDProperty = "uuid"
+
+// ErrNotFound is returned when looking up a node or relationship by an ID
+// that doesn't exist.
+var ErrNotFound = errors.New("storage: not found")
+
+// ErrMissingType is returned when creating a relationship without a type.
+var ErrMissingType = errors.New("storage: relationships must have a type")
+
+// Properties are the values held by a node or relationship. Values should be
+// strings, booleans, numbers or lists of those. Integers are always read back
+// as int64 and other numbers as float64.
+type Properties map[string]interface{}
+
+// Node is a single labeled entity in the graph.
+type Node struct {
+	ID         string
+	Labels     []string
+	Properties Properties
+}
+
+// HasLabel determines if the node has the given label.
+func (n *Node) HasLabel(label string) bool {
+	for _, l := range n.Labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Relationship is a typed, directed connection from one node to another.
+type Relationship struct {
+	ID         string
+	Type       string
+	From       string
+	To         string
+	Properties Properties
+}
+
+// Direction picks which relationships of a node to fetch.
+type Direction uint8
+
+// Directions relationships can be fetched in, relative to the node.
+const (
+	Outgoing Direction = 1 << iota
+	Incoming
+	Both = Outgoing | Incoming
+)
+
+// Store is a graph of nodes and relationships.
+//   CreateNode/CreateRelationship assign a new ID and save the value.
+//   GetNode/GetRelationship return ErrNotFound for unknown IDs.
+//   UpdateNode/UpdateRelationship merge the properties into the existing
+//     properties, a nil value removes the property.
+//   DeleteNode removes the node along with all of it's relationships.
+//   FindNodes fetches nodes with the label whose properties equal all of the
+//     given properties, an empty label matches nodes with any label.
+//   Relationships fetches the relationships of a node in the given direction,
+//     an empty type matches relationships of any type.
+type Store interface {
+	CreateNode(labels []string, props Properties) (*Node, error)
+	GetNode(id string) (*Node, error)
+	UpdateNode(id string, props Properties) error
+	DeleteNode(id string) error
+	FindNodes(label string, props Properties) ([]*Node, error)
+
+	CreateRelationship(from, to, typ string, props Properties) (*Relationship, error)
+	GetRelationship(id string) (*Relationship, error)
+	UpdateRelationship(id string, props Properties) error
+	DeleteRelationship(id string) error
+	Relationships(nodeID, typ string, dir Direction) ([]*Relationship, error)
+
+	Close() error
+}
+
+// Backend names, used to pick a store in the Dragonfile.
+const (
+	Neo4jBackend    = "neo4j"
+	EmbeddedBackend = "embedded"
+)
+
+// UnknownBackendError is returned when asked for a backend that doesn't
+// exist.
+type UnknownBackendError string
+
+// Error describes the backend requested.
+func (ube UnknownBackendError) Error() string {
+	return fmt.Sprintf("storage: unknown backend %q, expected %q or %q", string(ube), Neo4jBackend, EmbeddedBackend)
+}
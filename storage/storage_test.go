@@ -0,0 +1,148 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage_test
+
+import (
+	. "github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// behavior every store should share, open should return a new empty store.
+func behavesLikeAStore(open func() Store) {
+	var (
+		store Store
+		bob   *Node
+		room  *Node
+	)
+
+	BeforeEach(func() {
+		store = open()
+
+		var err error
+		bob, err = store.CreateNode([]string{"Player"}, Properties{"name": "bob", "level": 1})
+		Ω(err).Should(BeNil())
+		room, err = store.CreateNode([]string{"Room"}, Properties{"name": "hall"})
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		store.Close()
+	})
+
+	Describe("nodes", func() {
+		It("assigns IDs", func() {
+			Ω(bob.ID).ShouldNot(BeEmpty())
+			Ω(bob.ID).ShouldNot(Equal(room.ID))
+		})
+
+		It("fetches nodes by ID", func() {
+			n, err := store.GetNode(bob.ID)
+			Ω(err).Should(BeNil())
+			Ω(n.Labels).Should(Equal([]string{"Player"}))
+			Ω(n.Properties).Should(Equal(Properties{"name": "bob", "level": int64(1)}))
+		})
+
+		It("returns ErrNotFound for unknown IDs", func() {
+			_, err := store.GetNode("missing")
+			Ω(err).Should(Equal(ErrNotFound))
+		})
+
+		It("merges updates and removes nil properties", func() {
+			Ω(store.UpdateNode(bob.ID, Properties{"level": 2, "name": nil})).Should(BeNil())
+
+			n, _ := store.GetNode(bob.ID)
+			Ω(n.Properties).Should(Equal(Properties{"level": int64(2)}))
+		})
+
+		It("finds nodes by label and property", func() {
+			store.CreateNode([]string{"Player"}, Properties{"name": "alice", "level": 1})
+
+			found, err := store.FindNodes("Player", Properties{"level": 1.0})
+			Ω(err).Should(BeNil())
+			Ω(found).Should(HaveLen(2))
+
+			found, err = store.FindNodes("Player", Properties{"name": "alice"})
+			Ω(err).Should(BeNil())
+			Ω(found).Should(HaveLen(1))
+			Ω(found[0].Properties["name"]).Should(Equal("alice"))
+
+			found, err = store.FindNodes("", Properties{"name": "hall"})
+			Ω(err).Should(BeNil())
+			Ω(found).Should(HaveLen(1))
+			Ω(found[0].ID).Should(Equal(room.ID))
+		})
+	})
+
+	Describe("relationships", func() {
+		var in *Relationship
+
+		BeforeEach(func() {
+			var err error
+			in, err = store.CreateRelationship(bob.ID, room.ID, "IN", Properties{"since": 10})
+			Ω(err).Should(BeNil())
+		})
+
+		It("fetches relationships by ID", func() {
+			r, err := store.GetRelationship(in.ID)
+			Ω(err).Should(BeNil())
+			Ω(r.Type).Should(Equal("IN"))
+			Ω(r.From).Should(Equal(bob.ID))
+			Ω(r.To).Should(Equal(room.ID))
+			Ω(r.Properties).Should(Equal(Properties{"since": int64(10)}))
+		})
+
+		It("fetches a node's relationships by direction", func() {
+			out, err := store.Relationships(bob.ID, "", Outgoing)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(HaveLen(1))
+
+			out, err = store.Relationships(bob.ID, "", Incoming)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(BeEmpty())
+
+			out, err = store.Relationships(room.ID, "IN", Both)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(HaveLen(1))
+
+			out, err = store.Relationships(room.ID, "OWNS", Both)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(BeEmpty())
+		})
+
+		It("updates relationships", func() {
+			Ω(store.UpdateRelationship(in.ID, Properties{"since": 11})).Should(BeNil())
+
+			r, _ := store.GetRelationship(in.ID)
+			Ω(r.Properties["since"]).Should(Equal(int64(11)))
+		})
+
+		It("deletes relationships", func() {
+			Ω(store.DeleteRelationship(in.ID)).Should(BeNil())
+
+			_, err := store.GetRelationship(in.ID)
+			Ω(err).Should(Equal(ErrNotFound))
+		})
+
+		It("deletes relationships along with their nodes", func() {
+			Ω(store.DeleteNode(bob.ID)).Should(BeNil())
+
+			_, err := store.GetRelationship(in.ID)
+			Ω(err).Should(Equal(ErrNotFound))
+			out, err := store.Relationships(room.ID, "", Both)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(BeEmpty())
+		})
+
+		It("requires a type", func() {
+			_, err := store.CreateRelationship(bob.ID, room.ID, "", nil)
+			Ω(err).Should(Equal(ErrMissingType))
+		})
+
+		It("can't relate missing nodes", func() {
+			_, err := store.CreateRelationship(bob.ID, "missing", "IN", nil)
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// normalize a value into the types stores hand back, integers become int64,
+// other numbers float64 and lists []interface{}.
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+
+		return f
+	case nil, string, bool, int64, float64:
+		return v
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = normalize(rv.Index(i).Interface())
+		}
+
+		return list
+	}
+
+	return val
+}
+
+// normalize every property value, dropping nil values.
+func normalizeProperties(props Properties) Properties {
+	np := make(Properties, len(props))
+	for k, v := range props {
+		if v != nil {
+			np[k] = normalize(v)
+		}
+	}
+
+	return np
+}
+
+// merge the updates into the properties, nil values remove the property.
+func mergeProperties(props, updates Properties) Properties {
+	merged := make(Properties, len(props)+len(updates))
+	for k, v := range props {
+		merged[k] = v
+	}
+	for k, v := range updates {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = normalize(v)
+		}
+	}
+
+	return merged
+}
+
+// determine if the properties contain all of the wanted values, numbers are
+// compared by value regardless of their type.
+func matchProperties(props, want Properties) bool {
+	for k, w := range want {
+		if !valuesEqual(normalize(props[k]), normalize(w)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if af, ok := asFloat(a); ok {
+		bf, ok := asFloat(b)
+
+		return ok && af == bf
+	}
+
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok {
+		if len(al) != len(bl) {
+			return false
+		}
+		for i := range al {
+			if !valuesEqual(al[i], bl[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func asFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+const (
+	// DefaultBatchSize is the number of rows sent with each query in a batch.
+	DefaultBatchSize = 1000
+
+	// the number of chunks of a batch sent to the server before waiting on
+	// their results
+	batchPipelineDepth = 8
+)
+
+// Batch runs the cypher once for every row given, with the row available to
+// the query as `row`. Rows are sent in chunks of DefaultBatchSize using
+// UNWIND and the chunks are pipelined over a single connection, which is
+// far faster than running a query per row.
+//   db.Batch("CREATE (:Room {id: row.id, name: row.name})", rooms)
+// The result holds the stats for every chunk combined. Chunks that were run
+// before one fails are not undone, run the batch in a transaction if the
+// rows should succeed or fail together.
+func (d *DB) Batch(cypher string, rows []Properties) (*Result, error) {
+	return d.BatchSize(cypher, rows, DefaultBatchSize)
+}
+
+// BatchSize performs the same job as Batch, sending size rows with each
+// query.
+func (d *DB) BatchSize(cypher string, rows []Properties, size int) (*Result, error) {
+	conn, err := d.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return execBatch(conn, cypher, rows, size)
+}
+
+// Batch runs the cypher for every row within the transaction, see DB.Batch.
+func (t *Tx) Batch(cypher string, rows []Properties) (*Result, error) {
+	return t.BatchSize(cypher, rows, DefaultBatchSize)
+}
+
+// BatchSize performs the same job as Batch, sending size rows with each
+// query.
+func (t *Tx) BatchSize(cypher string, rows []Properties, size int) (*Result, error) {
+	if t.finished {
+		return nil, ErrTxFinished
+	}
+
+	return execBatch(t.conn, cypher, rows, size)
+}
+
+// run the batch on the connection, combining the results from each chunk
+func execBatch(conn bolt.Conn, cypher string, rows []Properties, size int) (*Result, error) {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	params, err := batchParams(rows, size)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "UNWIND {rows} AS row " + cypher
+	total := &Result{}
+	for len(params) > 0 {
+		n := batchPipelineDepth
+		if n > len(params) {
+			n = len(params)
+		}
+
+		queries := make([]string, n)
+		for i := range queries {
+			queries[i] = query
+		}
+
+		results, err := conn.ExecPipeline(queries, params[:n]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range results {
+			res := wrapBoltResult(r)
+			total.Stats.add(res.Stats)
+			if res.Type != "" {
+				total.Type = res.Type
+			}
+		}
+		params = params[n:]
+	}
+
+	return total, nil
+}
+
+// split the rows into chunks of size, each chunk is the parameters for one
+// query. Rows are marshaled one at a time so their values are stored just as
+// they would be by CypherP.
+func batchParams(rows []Properties, size int) ([]map[string]interface{}, error) {
+	var params []map[string]interface{}
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		chunk := make([]interface{}, 0, end-start)
+		for _, row := range rows[start:end] {
+			mp, err := row.MarshaledProperties()
+			if err != nil {
+				return nil, err
+			}
+			chunk = append(chunk, map[string]interface{}(mp))
+		}
+		params = append(params, map[string]interface{}{"rows": chunk})
+	}
+
+	return params, nil
+}
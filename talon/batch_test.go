@@ -0,0 +1,122 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	. "github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// counts the pipelines sent over connections from the driver
+type pipelineCounter struct {
+	Driver
+	pipelines *[]int
+}
+
+func (d pipelineCounter) Conn() (bolt.Conn, error) {
+	conn, err := d.Driver.Conn()
+	if err != nil {
+		return nil, err
+	}
+
+	return pipelineCountingConn{conn, d.pipelines}, nil
+}
+
+type pipelineCountingConn struct {
+	bolt.Conn
+	pipelines *[]int
+}
+
+func (c pipelineCountingConn) ExecPipeline(queries []string, params ...map[string]interface{}) ([]bolt.Result, error) {
+	*c.pipelines = append(*c.pipelines, len(queries))
+
+	return c.Conn.ExecPipeline(queries, params...)
+}
+
+var _ = Describe("Batch", func() {
+	var (
+		db        *DB
+		pipelines []int
+		rooms     []Properties
+	)
+
+	BeforeEach(func() {
+		pipelines = nil
+		db = NewDB(pipelineCounter{memory.NewDriver(), &pipelines})
+
+		rooms = make([]Properties, 25)
+		for i := range rooms {
+			rooms[i] = Properties{"id": i, "name": "room"}
+		}
+	})
+
+	count := func() int64 {
+		rows, err := db.Cypher("MATCH (r:Room) RETURN count(r)").Query()
+		Ω(err).Should(BeNil())
+		defer rows.Close()
+		row, err := rows.Next()
+		Ω(err).Should(BeNil())
+		n, _ := row.GetIndex(0)
+
+		return n.(int64)
+	}
+
+	It("runs the query for every row", func() {
+		result, err := db.Batch("CREATE (:Room {id: row.id, name: row.name})", rooms)
+		Ω(err).Should(BeNil())
+		Ω(result.Stats.NodesCreated).Should(Equal(int64(25)))
+		Ω(result.Stats.PropertiesSet).Should(Equal(int64(50)))
+		Ω(result.Stats.LabelsAdded).Should(Equal(int64(25)))
+		Ω(count()).Should(Equal(int64(25)))
+	})
+
+	It("sends the rows in pipelined chunks", func() {
+		result, err := db.BatchSize("CREATE (:Room {id: row.id})", rooms, 2)
+		Ω(err).Should(BeNil())
+		Ω(result.Stats.NodesCreated).Should(Equal(int64(25)))
+		Ω(pipelines).Should(Equal([]int{8, 5}))
+	})
+
+	It("does nothing without rows", func() {
+		result, err := db.Batch("CREATE (:Room {id: row.id})", nil)
+		Ω(err).Should(BeNil())
+		Ω(result.Stats).Should(Equal(ResultStats{}))
+		Ω(pipelines).Should(BeEmpty())
+	})
+
+	It("stores values just as CypherP would", func() {
+		_, err := db.Batch("CREATE (:Room {id: row.id, exits: row.exits})", []Properties{
+			{"id": 1, "exits": []string{"north"}},
+		})
+		Ω(err).Should(BeNil())
+
+		rows, err := db.Cypher("MATCH (r:Room) RETURN r.exits").Query()
+		Ω(err).Should(BeNil())
+		defer rows.Close()
+		row, err := rows.Next()
+		Ω(err).Should(BeNil())
+		exits, _ := row.GetIndex(0)
+		Ω(exits).Should(Equal([]interface{}{"north"}))
+	})
+
+	It("succeeds or fails with the transaction", func() {
+		tx, err := db.Begin()
+		Ω(err).Should(BeNil())
+		_, err = tx.BatchSize("CREATE (:Room {id: row.id})", rooms, 10)
+		Ω(err).Should(BeNil())
+		Ω(tx.Rollback()).Should(BeNil())
+		Ω(count()).Should(Equal(int64(0)))
+
+		_, err = tx.Batch("CREATE (:Room {id: row.id})", rooms)
+		Ω(err).Should(Equal(ErrTxFinished))
+	})
+
+	It("fails when a chunk fails", func() {
+		_, err := db.Batch("CREATE (:Room {id: row.id / 0})", rooms)
+		Ω(err).ShouldNot(BeNil())
+	})
+})
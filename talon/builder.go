@@ -0,0 +1,338 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrMisplacedWhere is returned when a WHERE is added to a query somewhere
+// it's not allowed, conditions can only follow MATCH, OPTIONAL MATCH or WITH.
+var ErrMisplacedWhere = errors.New("where can only follow match, optional match or with")
+
+// ErrUnnamedWhere is the error given when conditions are added to a node or
+// relationship without a name, there's nothing to scope them to.
+var ErrUnnamedWhere = errors.New("where can only be used on named nodes and relationships")
+
+// a single clause of a query, like MATCH (p:Player) WHERE p.name = {p0}
+type clause struct {
+	keyword string
+	body    string
+	where   []string
+}
+
+// Builder constructs Cypher queries clause by clause, any values given to it
+// are passed as parameters rather than written into the query. Builders are
+// started from a DB (or a Tx):
+//   db.Match(talon.N("p", "Player").Where(talon.Eq("name", name))).Return("p")
+// produces
+//   MATCH (p:Player) WHERE p.name = {p0} RETURN p
+// with the properties {"p0": name}.
+type Builder struct {
+	querier Querier
+	clauses []*clause
+	params  Properties
+	next    int
+	err     error
+}
+
+// Match starts a query matching the given patterns.
+func (d *DB) Match(patterns ...Pattern) *Builder {
+	return newBuilder(d).Match(patterns...)
+}
+
+// OptionalMatch starts a query optionally matching the given patterns.
+func (d *DB) OptionalMatch(patterns ...Pattern) *Builder {
+	return newBuilder(d).OptionalMatch(patterns...)
+}
+
+// Create starts a query that creates the given patterns.
+func (d *DB) Create(patterns ...Pattern) *Builder {
+	return newBuilder(d).Create(patterns...)
+}
+
+// Merge starts a query that matches the pattern or creates it if it doesn't
+// exist.
+func (d *DB) Merge(pattern Pattern) *Builder {
+	return newBuilder(d).Merge(pattern)
+}
+
+func newBuilder(q Querier) *Builder {
+	return &Builder{
+		querier: q,
+		params:  make(Properties),
+	}
+}
+
+// Match adds a MATCH clause for the patterns, any conditions given to the
+// patterns are added as a WHERE.
+func (b *Builder) Match(patterns ...Pattern) *Builder {
+	return b.addPatterns("MATCH", true, patterns)
+}
+
+// OptionalMatch adds an OPTIONAL MATCH clause for the patterns, any
+// conditions given to the patterns are added as a WHERE.
+func (b *Builder) OptionalMatch(patterns ...Pattern) *Builder {
+	return b.addPatterns("OPTIONAL MATCH", true, patterns)
+}
+
+// Create adds a CREATE clause for the patterns.
+func (b *Builder) Create(patterns ...Pattern) *Builder {
+	return b.addPatterns("CREATE", false, patterns)
+}
+
+// Merge adds a MERGE clause for the pattern.
+func (b *Builder) Merge(pattern Pattern) *Builder {
+	return b.addPatterns("MERGE", false, []Pattern{pattern})
+}
+
+// Where adds conditions to the last MATCH, OPTIONAL MATCH or WITH clause.
+// Fields given to the conditions should reference a variable, such as
+// Eq("p.name", name), anything more complex has to be given with Raw.
+func (b *Builder) Where(conds ...Condition) *Builder {
+	last := b.last()
+	if last == nil || (last.keyword != "MATCH" && last.keyword != "OPTIONAL MATCH" && last.keyword != "WITH") {
+		b.fail(ErrMisplacedWhere)
+
+		return b
+	}
+
+	for _, cond := range conds {
+		last.where = append(last.where, cond.condition(b, ""))
+	}
+
+	return b
+}
+
+// Set adds a SET clause assigning each of the properties to the variable
+// given.
+func (b *Builder) Set(name string, props Properties) *Builder {
+	return b.add("SET", b.assignments(name, props))
+}
+
+// OnCreateSet adds an ON CREATE SET clause to a MERGE, the properties are only
+// assigned if the MERGE created the pattern.
+func (b *Builder) OnCreateSet(name string, props Properties) *Builder {
+	return b.add("ON CREATE SET", b.assignments(name, props))
+}
+
+// OnMatchSet adds an ON MATCH SET clause to a MERGE, the properties are only
+// assigned if the MERGE matched an existing pattern.
+func (b *Builder) OnMatchSet(name string, props Properties) *Builder {
+	return b.add("ON MATCH SET", b.assignments(name, props))
+}
+
+// Delete adds a DELETE clause for the given variables.
+func (b *Builder) Delete(names ...string) *Builder {
+	return b.add("DELETE", variables(names))
+}
+
+// DetachDelete adds a DETACH DELETE clause for the given variables, deleting
+// any relationships they have as well.
+func (b *Builder) DetachDelete(names ...string) *Builder {
+	return b.add("DETACH DELETE", variables(names))
+}
+
+// With adds a WITH clause, passing the expressions on to the rest of the
+// query.
+func (b *Builder) With(exprs ...string) *Builder {
+	return b.add("WITH", strings.Join(exprs, ", "))
+}
+
+// Return adds a RETURN clause for the given expressions.
+func (b *Builder) Return(exprs ...string) *Builder {
+	return b.add("RETURN", strings.Join(exprs, ", "))
+}
+
+// OrderBy adds an ORDER BY clause for the expressions, like "p.name DESC".
+func (b *Builder) OrderBy(exprs ...string) *Builder {
+	return b.add("ORDER BY", strings.Join(exprs, ", "))
+}
+
+// Skip adds a SKIP clause.
+func (b *Builder) Skip(n int) *Builder {
+	return b.add("SKIP", strconv.Itoa(n))
+}
+
+// Limit adds a LIMIT clause.
+func (b *Builder) Limit(n int) *Builder {
+	return b.add("LIMIT", strconv.Itoa(n))
+}
+
+// ToCypher returns the Cypher built so far.
+func (b *Builder) ToCypher() string {
+	var buf bytes.Buffer
+	for i, c := range b.clauses {
+		if i > 0 {
+			buf.WriteRune(' ')
+		}
+		buf.WriteString(c.keyword)
+		if c.body != "" {
+			buf.WriteRune(' ')
+			buf.WriteString(c.body)
+		}
+		if len(c.where) > 0 {
+			buf.WriteString(" WHERE ")
+			buf.WriteString(strings.Join(c.where, " AND "))
+		}
+	}
+
+	return buf.String()
+}
+
+// Properties returns the parameters collected for the query so far.
+func (b *Builder) Properties() Properties {
+	return b.params
+}
+
+// Err returns the first error encountered while building the query.
+func (b *Builder) Err() error {
+	return b.err
+}
+
+// Build converts the builder into a Query that can be executed.
+func (b *Builder) Build() (*Query, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	return b.querier.CypherP(b.ToCypher(), b.params)
+}
+
+// Query builds and executes the query, expecting rows to be returned.
+func (b *Builder) Query() (*Rows, error) {
+	q, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Query()
+}
+
+// Exec builds and executes the query, not expecting rows to be returned.
+func (b *Builder) Exec() (*Result, error) {
+	q, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Exec()
+}
+
+// param adds the value to the query's parameters, returning the placeholder
+// that references it.
+func (b *Builder) param(value interface{}) string {
+	for {
+		name := "p" + strconv.Itoa(b.next)
+		b.next++
+		// skip over any names already given by Raw conditions
+		if _, exists := b.params[name]; !exists {
+			b.params[name] = value
+
+			return "{" + name + "}"
+		}
+	}
+}
+
+// addParams adds named parameters (from Raw conditions) to the query.
+func (b *Builder) addParams(props Properties) {
+	for key, val := range props {
+		if existing, ok := b.params[key]; ok && !reflect.DeepEqual(existing, val) {
+			b.fail(fmt.Errorf("parameter %q is given more than once with different values", key))
+
+			continue
+		}
+		b.params[key] = val
+	}
+}
+
+// quote and join a list of variable names
+func variables(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// inlineProps produces a property map for a pattern, like {name: {p0}}.
+func (b *Builder) inlineProps(props Properties) string {
+	keys := props.Keys()
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = quoteIdentifier(key) + ": " + b.param(props[key])
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// assignments produces a list of property assignments for a SET clause
+func (b *Builder) assignments(name string, props Properties) string {
+	keys := props.Keys()
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = quoteIdentifier(name) + "." + quoteIdentifier(key) + " = " + b.param(props[key])
+	}
+
+	return strings.Join(pairs, ", ")
+}
+
+func (b *Builder) addPatterns(keyword string, allowConditions bool, patterns []Pattern) *Builder {
+	parts := make([]string, len(patterns))
+	var where []string
+	for i, p := range patterns {
+		parts[i] = p.pattern(b)
+		conds := p.conditions()
+		if len(conds) > 0 && !allowConditions {
+			b.fail(fmt.Errorf("conditions can't be used in a %s, use Props instead", keyword))
+
+			continue
+		}
+		for _, cond := range conds {
+			if s, ok := cond.(scoped); ok && s.scope == "" {
+				b.fail(ErrUnnamedWhere)
+
+				continue
+			}
+			where = append(where, cond.condition(b, ""))
+		}
+	}
+
+	b.clauses = append(b.clauses, &clause{
+		keyword: keyword,
+		body:    strings.Join(parts, ", "),
+		where:   where,
+	})
+
+	return b
+}
+
+func (b *Builder) add(keyword, body string) *Builder {
+	b.clauses = append(b.clauses, &clause{
+		keyword: keyword,
+		body:    body,
+	})
+
+	return b
+}
+
+func (b *Builder) last() *clause {
+	if len(b.clauses) == 0 {
+		return nil
+	}
+
+	return b.clauses[len(b.clauses)-1]
+}
+
+// record the first error encountered
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	. "github.com/bbuck/dragon-mud/talon"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Builder", func() {
+	var db *DB
+
+	BeforeEach(func() {
+		var err error
+		db, err = ConnectOptions{}.Connect()
+		Ω(err).Should(BeNil())
+	})
+
+	Context("matching nodes with conditions", func() {
+		var b *Builder
+
+		BeforeEach(func() {
+			b = db.Match(N("p", "Player").Where(Eq("name", "bob"), Gte("level", 5))).Return("p")
+		})
+
+		It("scopes the conditions to the node", func() {
+			Ω(b.ToCypher()).Should(Equal("MATCH (p:Player) WHERE p.name = {p0} AND p.level >= {p1} RETURN p"))
+		})
+
+		It("collects the values as properties", func() {
+			Ω(b.Properties()).Should(Equal(Properties{"p0": "bob", "p1": 5}))
+		})
+
+		It("builds a query", func() {
+			q, err := b.Build()
+			Ω(err).Should(BeNil())
+			Ω(q.ToCypher()).Should(Equal(b.ToCypher()))
+		})
+
+		It("passes the values given to In as a list", func() {
+			b := db.Match(N("p", "Player").Where(In("level", []int{1, 2}))).Return("p")
+
+			Ω(b.ToCypher()).Should(Equal("MATCH (p:Player) WHERE p.level IN {p0} RETURN p"))
+			props, err := b.Properties().MarshaledProperties()
+			Ω(err).Should(BeNil())
+			Ω(props["p0"]).Should(Equal([]interface{}{1, 2}))
+		})
+
+		It("quotes hostile field names", func() {
+			b := db.Match(N("p", "Player").Where(Eq("name = 'x' OR true OR p.`name", "bob"))).
+				Where(IsNull("p.title) OR (true")).
+				Return("p")
+
+			Ω(b.ToCypher()).Should(Equal("MATCH (p:Player) WHERE p.`name = 'x' OR true OR p.``name` = {p0} AND p.`title) OR (true` IS NULL RETURN p"))
+		})
+	})
+
+	It("builds paths with relationships", func() {
+		b := db.Match(N("p", "Player").Out(R("", "IN"), N("r", "Room"))).
+			OptionalMatch(N("r").In(R("i", "IN"), N("i", "Item"))).
+			Return("r", "collect(i) AS items")
+
+		Ω(b.ToCypher()).Should(Equal("MATCH (p:Player)-[:IN]->(r:Room) OPTIONAL MATCH (r)<-[i:IN]-(i:Item) RETURN r, collect(i) AS items"))
+	})
+
+	It("combines conditions given to the builder", func() {
+		b := db.Match(N("p", "Player")).
+			Where(Any(Eq("p.name", "bob"), None(IsNull("p.title")))).
+			Where(Raw("size((p)-[:OWNS]->()) > {count}", Properties{"count": 3})).
+			Return("p").
+			OrderBy("p.name").
+			Skip(10).
+			Limit(5)
+
+		Ω(b.ToCypher()).Should(Equal("MATCH (p:Player) WHERE (p.name = {p0} OR NOT (p.title IS NULL)) AND size((p)-[:OWNS]->()) > {count} RETURN p ORDER BY p.name SKIP 10 LIMIT 5"))
+		Ω(b.Properties()).Should(Equal(Properties{"p0": "bob", "count": 3}))
+	})
+
+	It("creates nodes with properties", func() {
+		b := db.Create(N("p", "Player").Props(Properties{"name": "bob", "level": 1})).Return("p")
+
+		Ω(b.ToCypher()).Should(Equal("CREATE (p:Player {level: {p0}, name: {p1}}) RETURN p"))
+		Ω(b.Properties()).Should(Equal(Properties{"p0": 1, "p1": "bob"}))
+	})
+
+	It("merges and sets properties", func() {
+		b := db.Merge(N("p", "Player").Props(Properties{"name": "bob"})).
+			OnCreateSet("p", Properties{"level": 1}).
+			Set("p", Properties{"online": true})
+
+		Ω(b.ToCypher()).Should(Equal("MERGE (p:Player {name: {p0}}) ON CREATE SET p.level = {p1} SET p.online = {p2}"))
+	})
+
+	It("deletes matched nodes", func() {
+		b := db.Match(N("p", "Player").Where(Eq("name", "bob"))).DetachDelete("p")
+
+		Ω(b.ToCypher()).Should(Equal("MATCH (p:Player) WHERE p.name = {p0} DETACH DELETE p"))
+	})
+
+	It("quotes labels that aren't plain identifiers", func() {
+		b := db.Match(N("n", "Some Label")).Return("n")
+
+		Ω(b.ToCypher()).Should(Equal("MATCH (n:`Some Label`) RETURN n"))
+	})
+
+	It("quotes variable names that aren't plain identifiers", func() {
+		b := db.Match(N("p) DETACH DELETE (x", "Player").Where(Eq("name", "bob"))).
+			Set("p) DETACH DELETE (x", Properties{"online": true}).
+			Delete("p) DETACH DELETE (x")
+
+		Ω(b.ToCypher()).Should(Equal("MATCH (`p) DETACH DELETE (x`:Player) WHERE `p) DETACH DELETE (x`.name = {p0} SET `p) DETACH DELETE (x`.online = {p1} DELETE `p) DETACH DELETE (x`"))
+	})
+
+	It("fails when conditions are given to unnamed nodes", func() {
+		_, err := db.Match(N("", "Player").Where(Eq("name", "bob"))).Return("count(*)").Build()
+
+		Ω(err).Should(Equal(ErrUnnamedWhere))
+	})
+
+	It("fails when conditions are used in a create", func() {
+		_, err := db.Create(N("p", "Player").Where(Eq("name", "bob"))).Build()
+
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("fails when where doesn't follow a match", func() {
+		_, err := db.Create(N("p", "Player")).Where(Eq("p.name", "bob")).Build()
+
+		Ω(err).Should(Equal(ErrMisplacedWhere))
+	})
+})
@@ -0,0 +1,184 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	"strings"
+)
+
+// Condition is a predicate used in a WHERE clause. Values given to conditions
+// are always passed to the query as parameters, never written into the Cypher.
+type Condition interface {
+	condition(b *Builder, scope string) string
+}
+
+// resolve the field against the scope. Within a scope the field is a property
+// name, without one it references a variable and (optionally) a property of
+// it, such as "p.name". Names are quoted as needed so they can never break out
+// of the query, expressions have to be given with Raw.
+func scopeField(scope, field string) string {
+	if scope != "" {
+		return quoteIdentifier(scope) + "." + quoteIdentifier(field)
+	}
+
+	parts := strings.SplitN(field, ".", 2)
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// scoped binds a condition to the variable of the pattern it was given to
+type scoped struct {
+	scope string
+	cond  Condition
+}
+
+func (s scoped) condition(b *Builder, _ string) string {
+	return s.cond.condition(b, s.scope)
+}
+
+type comparison struct {
+	field string
+	op    string
+	value interface{}
+}
+
+func (c comparison) condition(b *Builder, scope string) string {
+	return scopeField(scope, c.field) + " " + c.op + " " + b.param(c.value)
+}
+
+// Eq matches when the field is equal to the value.
+func Eq(field string, value interface{}) Condition {
+	return comparison{field, "=", value}
+}
+
+// Ne matches when the field is not equal to the value.
+func Ne(field string, value interface{}) Condition {
+	return comparison{field, "<>", value}
+}
+
+// Gt matches when the field is greater than the value.
+func Gt(field string, value interface{}) Condition {
+	return comparison{field, ">", value}
+}
+
+// Gte matches when the field is greater than or equal to the value.
+func Gte(field string, value interface{}) Condition {
+	return comparison{field, ">=", value}
+}
+
+// Lt matches when the field is less than the value.
+func Lt(field string, value interface{}) Condition {
+	return comparison{field, "<", value}
+}
+
+// Lte matches when the field is less than or equal to the value.
+func Lte(field string, value interface{}) Condition {
+	return comparison{field, "<=", value}
+}
+
+// In matches when the field is one of the values in the list given, values
+// can be any slice or array.
+func In(field string, values interface{}) Condition {
+	return comparison{field, "IN", ListOf(values)}
+}
+
+// Contains matches when the (string) field contains the value.
+func Contains(field string, value string) Condition {
+	return comparison{field, "CONTAINS", value}
+}
+
+// StartsWith matches when the (string) field starts with the value.
+func StartsWith(field string, value string) Condition {
+	return comparison{field, "STARTS WITH", value}
+}
+
+// EndsWith matches when the (string) field ends with the value.
+func EndsWith(field string, value string) Condition {
+	return comparison{field, "ENDS WITH", value}
+}
+
+type nullCheck struct {
+	field string
+	not   bool
+}
+
+func (n nullCheck) condition(_ *Builder, scope string) string {
+	if n.not {
+		return scopeField(scope, n.field) + " IS NOT NULL"
+	}
+
+	return scopeField(scope, n.field) + " IS NULL"
+}
+
+// IsNull matches when the field is not set.
+func IsNull(field string) Condition {
+	return nullCheck{field, false}
+}
+
+// IsNotNull matches when the field is set.
+func IsNotNull(field string) Condition {
+	return nullCheck{field, true}
+}
+
+type junction struct {
+	op    string
+	conds []Condition
+}
+
+func (j junction) condition(b *Builder, scope string) string {
+	parts := make([]string, len(j.conds))
+	for i, cond := range j.conds {
+		parts[i] = cond.condition(b, scope)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return "(" + strings.Join(parts, " "+j.op+" ") + ")"
+}
+
+// All matches when all of the conditions match.
+func All(conds ...Condition) Condition {
+	return junction{"AND", conds}
+}
+
+// Any matches when any of the conditions match.
+func Any(conds ...Condition) Condition {
+	return junction{"OR", conds}
+}
+
+type negation struct {
+	cond Condition
+}
+
+func (n negation) condition(b *Builder, scope string) string {
+	return "NOT (" + n.cond.condition(b, scope) + ")"
+}
+
+// None matches when none of the conditions match.
+func None(conds ...Condition) Condition {
+	return negation{Any(conds...)}
+}
+
+type rawCondition struct {
+	expr  string
+	props Properties
+}
+
+func (r rawCondition) condition(b *Builder, _ string) string {
+	b.addParams(r.props)
+
+	return r.expr
+}
+
+// Raw is an escape hatch for conditions the builder can't express, the
+// expression is used as is and the properties are added to the query's
+// parameters. This is the only way to write an expression into a condition,
+// never build one from user input.
+//   Raw("size((p)-[:OWNS]->()) > {count}", Properties{"count": 3})
+func Raw(expr string, props Properties) Condition {
+	return rawCondition{expr, props}
+}
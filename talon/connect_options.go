@@ -5,18 +5,36 @@ package talon
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
 )
 
 // ConnectOptions allows customiztaino of how to connect to a Neo4j database
 // with talon.
+//   Pool is the most connections that can be open at once, defaults to
+//     DefaultPoolSize.
+//   Timeout is how long a query can wait on the database before failing, 0
+//     uses the bolt driver's default.
+//   WaitTimeout is how long to wait for a connection when all of them are in
+//     use, 0 waits forever.
+//   HealthCheckInterval is how long a connection can sit idle before it's
+//     checked before being reused, defaults to DefaultHealthCheckInterval. A
+//     negative interval disables health checks.
+//   MaxRetries is how many more times to try opening a connection after the
+//     first attempt fails, waiting RetryBackoff (doubling each time) between
+//     attempts.
 type ConnectOptions struct {
-	User string
-	Pass string
-	Host string
-	Port uint16
-	Pool uint16
+	User                string
+	Pass                string
+	Host                string
+	Port                uint16
+	Pool                uint16
+	Timeout             time.Duration
+	WaitTimeout         time.Duration
+	HealthCheckInterval time.Duration
+	MaxRetries          int
+	RetryBackoff        time.Duration
 }
 
 // URL takes the options set for connection and generates a bolt connection
@@ -41,22 +59,19 @@ func (co *ConnectOptions) URL() string {
 	return buf.String()
 }
 
-// Connect will take the provided connection options and attempt to establish
-// a connection to a Neo4j database.
-func (co ConnectOptions) Connect() (db *DB, err error) {
-	db = new(DB)
-	if co.Pool == 0 {
-		db.driver = &driver{
-			Driver:         bolt.NewDriver(),
-			connectOptions: co,
-		}
-	} else {
-		var pool bolt.DriverPool
-		pool, err = bolt.NewDriverPool(co.URL(), int(co.Pool))
-		db.driver = &driverPool{
-			pool: pool,
-		}
+// Connect will take the provided connection options and prepare a pool of
+// connections to a Neo4j database. Connections are opened as they're needed,
+// use Ping to make sure the database can be reached.
+func (co ConnectOptions) Connect() (*DB, error) {
+	if co.MaxRetries < 0 {
+		return nil, fmt.Errorf("talon: max retries cannot be negative, got %d", co.MaxRetries)
+	}
+
+	url := co.URL()
+	boltDriver := bolt.NewDriver()
+	dial := func() (bolt.Conn, error) {
+		return boltDriver.OpenNeo(url)
 	}
 
-	return
+	return NewDB(NewPool(dial, co)), nil
 }
@@ -3,6 +3,8 @@
 package talon
 
 import (
+	"io"
+
 	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
 )
 
@@ -12,6 +14,12 @@ type DB struct {
 	driver Driver
 }
 
+// NewDB creates a DB that fetches it's connections from the given driver,
+// ConnectOptions.Connect should be preferred for connecting to Neo4j.
+func NewDB(d Driver) *DB {
+	return &DB{driver: d}
+}
+
 // CypherP performs the same job as Cypher, it just allows the user to pass in
 // a set of properties.
 func (d *DB) CypherP(cypher string, p Properties) (*Query, error) {
@@ -47,8 +55,41 @@ func (d *DB) Cypher(cypher string) *Query {
 	return q
 }
 
-func (d *DB) conn() (bolt.Conn, error) {
-	c, err := d.driver.Conn()
+// Ping checks that the database can be reached.
+func (d *DB) Ping() error {
+	conn, err := d.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecNeo(healthCheckQuery, nil)
+
+	return err
+}
+
+// Stats reports on the connections held by the database, this is empty if
+// the driver is not a Pool.
+func (d *DB) Stats() PoolStats {
+	if p, ok := d.driver.(*Pool); ok {
+		return p.Stats()
+	}
+
+	return PoolStats{}
+}
+
+// Close releases the connections held by the database, if the driver holds
+// on to any. The database can't be used after it has been closed.
+func (d *DB) Close() error {
+	if c, ok := d.driver.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
 
-	return c, err
+// Conn fetches a connection from the database's driver, the connection must be
+// closed when it's no longer needed. This makes a DB usable as a Driver.
+func (d *DB) Conn() (bolt.Conn, error) {
+	return d.driver.Conn()
 }
@@ -0,0 +1,372 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// ErrInvalidDecodeTarget is returned when the value to decode into is not a
+// non-nil pointer.
+var ErrInvalidDecodeTarget = errors.New("talon: decode target must be a non-nil pointer")
+
+// DecodeError describes a value that could not be converted to the type of
+// the field it was being decoded into.
+type DecodeError struct {
+	Field string
+	Value interface{}
+	Type  reflect.Type
+}
+
+// Error describes the field and the types involved.
+func (de *DecodeError) Error() string {
+	if de.Field == "" {
+		return fmt.Sprintf("talon: cannot decode %T into a value of type %s", de.Value, de.Type)
+	}
+
+	return fmt.Sprintf("talon: cannot decode %T into field %q of type %s", de.Value, de.Field, de.Type)
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	jsonType        = reflect.TypeOf(JSON{})
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// Decode copies the node's properties into the struct (or map) dest points
+// to. Fields are matched to properties using their `talon:"name"` tag, or
+// their name if they have no tag, the same way structs are turned into
+// properties. Fields tagged with "-" are skipped and properties without a
+// matching field are ignored.
+func (n *Node) Decode(dest interface{}) error {
+	return decodeInto(n.Properties, dest)
+}
+
+// Decode copies the relationship's properties into the struct (or map) dest
+// points to, the same as Node.Decode.
+func (r *Relationship) Decode(dest interface{}) error {
+	return decodeInto(r.Properties, dest)
+}
+
+// Scan decodes the row into dest. If dest points to a struct, columns are
+// matched to fields by their talon tag (or name). If no field matches any
+// column and the row has a single column, that column is decoded into dest
+// itself, so a row holding one node can be scanned straight into a struct.
+// Any other kind of dest receives the row's only column.
+func (r *Row) Scan(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrInvalidDecodeTarget
+	}
+
+	target := rv.Elem()
+	for target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+
+	if target.Kind() == reflect.Struct && target.Type() != timeType {
+		columns := make(Properties)
+		for label, idx := range r.Metadata.fieldMap {
+			columns[label] = r.fields[idx]
+		}
+		if len(r.fields) != 1 || hasFieldFor(target.Type(), columns) {
+			return decodeValue(target, columns, "")
+		}
+	}
+
+	if len(r.fields) != 1 {
+		return fmt.Errorf("talon: cannot scan a row with %d columns into a %s", len(r.fields), target.Type())
+	}
+
+	return decodeValue(target, r.fields[0], "")
+}
+
+// Scan reads rows into dest. If dest points to a slice, every remaining row
+// is decoded and appended to the slice and the rows are closed. Otherwise
+// the next row is decoded into dest, see Row.Scan, and io.EOF is returned
+// when there are no more rows.
+func (r *Rows) Scan(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrInvalidDecodeTarget
+	}
+
+	if slice := rv.Elem(); slice.Kind() == reflect.Slice {
+		defer r.Close()
+
+		for {
+			row, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			elem := reflect.New(slice.Type().Elem())
+			if err := row.Scan(elem.Interface()); err != nil {
+				return err
+			}
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+
+	row, err := r.Next()
+	if err != nil {
+		return err
+	}
+
+	return row.Scan(dest)
+}
+
+// decode the value into the value dest points to
+func decodeInto(val interface{}, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrInvalidDecodeTarget
+	}
+
+	return decodeValue(rv.Elem(), val, "")
+}
+
+// the property name for a struct field, or "" if it should be skipped
+func fieldKey(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+
+	key := field.Name
+	if tag, ok := field.Tag.Lookup("talon"); ok {
+		key = tag
+	}
+	if key == "-" {
+		return ""
+	}
+
+	return key
+}
+
+// determine if any of the struct's fields match a key in the properties
+func hasFieldFor(typ reflect.Type, props Properties) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if key := fieldKey(typ.Field(i)); key != "" {
+			if _, ok := props[key]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// convert src to the type of dst and assign it, path names the field being
+// decoded for errors.
+func decodeValue(dst reflect.Value, src interface{}, path string) error {
+	mismatch := func() error {
+		return &DecodeError{Field: path, Value: src, Type: dst.Type()}
+	}
+
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
+		return decodeValue(dst.Elem(), src, path)
+	case reflect.Interface:
+		sv := reflect.ValueOf(src)
+		if !sv.Type().AssignableTo(dst.Type()) {
+			return mismatch()
+		}
+		dst.Set(sv)
+
+		return nil
+	}
+
+	// values marshaled with a type that has no registered unmarshaler are
+	// left as strings, let the field's type unmarshal them.
+	if str, ok := src.(string); ok && dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) {
+		return dst.Addr().Interface().(Unmarshaler).UnmarshalTalon([]byte(str))
+	}
+
+	switch dst.Type() {
+	case timeType:
+		return decodeTime(dst, src, mismatch)
+	case jsonType:
+		dst.Set(reflect.ValueOf(JSON{Data: src}))
+
+		return nil
+	}
+
+	switch s := src.(type) {
+	case *Node:
+		src = s.Properties
+	case *Relationship:
+		src = s.Properties
+	}
+
+	sv := reflect.ValueOf(src)
+	switch dst.Kind() {
+	case reflect.Bool:
+		if sv.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		dst.SetBool(sv.Bool())
+	case reflect.String:
+		if sv.Kind() != reflect.String {
+			return mismatch()
+		}
+		dst.SetString(sv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt64(sv)
+		if !ok || dst.OverflowInt(i) {
+			return mismatch()
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := toInt64(sv)
+		if !ok || i < 0 || dst.OverflowUint(uint64(i)) {
+			return mismatch()
+		}
+		dst.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		switch sv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(sv.Float())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst.SetFloat(float64(sv.Int()))
+		default:
+			return mismatch()
+		}
+	case reflect.Complex64, reflect.Complex128:
+		switch sv.Kind() {
+		case reflect.Complex64, reflect.Complex128:
+			dst.SetComplex(sv.Complex())
+		default:
+			return mismatch()
+		}
+	case reflect.Slice, reflect.Array:
+		if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+			return mismatch()
+		}
+		n := sv.Len()
+		if dst.Kind() == reflect.Array {
+			if n > dst.Len() {
+				return mismatch()
+			}
+		} else {
+			dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+		}
+		for i := 0; i < n; i++ {
+			if err := decodeValue(dst.Index(i), sv.Index(i).Interface(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if sv.Kind() != reflect.Map || dst.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), sv.Len())
+		for _, key := range sv.MapKeys() {
+			if key.Kind() != reflect.String {
+				return mismatch()
+			}
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(elem, sv.MapIndex(key).Interface(), joinPath(path, key.String())); err != nil {
+				return err
+			}
+			m.SetMapIndex(key.Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		if sv.Kind() != reflect.Map || sv.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		typ := dst.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			key := fieldKey(typ.Field(i))
+			if key == "" {
+				continue
+			}
+			val := sv.MapIndex(reflect.ValueOf(key).Convert(sv.Type().Key()))
+			if !val.IsValid() {
+				continue
+			}
+			if err := decodeValue(dst.Field(i), val.Interface(), joinPath(path, typ.Field(i).Name)); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+// times are stored as unix timestamps, but strings in RFC 3339 format are
+// accepted as well.
+func decodeTime(dst reflect.Value, src interface{}, mismatch func() error) error {
+	sv := reflect.ValueOf(src)
+	switch sv.Kind() {
+	case reflect.String:
+		t, err := time.Parse(time.RFC3339, sv.String())
+		if err != nil {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(t))
+	default:
+		secs, ok := toInt64(sv)
+		if !ok {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(time.Unix(secs, 0)))
+	}
+
+	return nil
+}
+
+// convert an integer value, or a float without a fractional part, to an
+// int64.
+func toInt64(sv reflect.Value) (int64, bool) {
+	switch sv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if sv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+
+		return int64(sv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := sv.Float()
+		if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return 0, false
+		}
+
+		return int64(f), true
+	}
+
+	return 0, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	"io"
+	"time"
+
+	. "github.com/bbuck/dragon-mud/talon"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	"github.com/johnnadratowski/golang-neo4j-bolt-driver/structures/graph"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// rows returned from a query, one column for each field
+type fakeRows struct {
+	bolt.Rows
+	fields []interface{}
+	rows   [][]interface{}
+	closed bool
+}
+
+func (r *fakeRows) Metadata() map[string]interface{} {
+	return map[string]interface{}{"fields": r.fields}
+}
+
+func (r *fakeRows) NextNeo() ([]interface{}, map[string]interface{}, error) {
+	if len(r.rows) == 0 {
+		return nil, nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+
+	return row, nil, nil
+}
+
+func (r *fakeRows) Close() error {
+	r.closed = true
+
+	return nil
+}
+
+type stats struct {
+	Health int
+	Mana   int `talon:"mp"`
+}
+
+type player struct {
+	Name     string    `talon:"name"`
+	Level    uint8     `talon:"level"`
+	Titles   []string  `talon:"titles"`
+	Stats    stats     `talon:"stats"`
+	Joined   time.Time `talon:"joined"`
+	Position Complex   `talon:"position"`
+	Guild    *string   `talon:"guild"`
+	Secret   string    `talon:"-"`
+}
+
+var _ = Describe("Decoding", func() {
+	Describe("Node.Decode", func() {
+		var (
+			node *Node
+			p    player
+			err  error
+		)
+
+		BeforeEach(func() {
+			p = player{Secret: "kept"}
+			node = &Node{Properties: Properties{
+				"name":     "bob",
+				"level":    int64(3),
+				"titles":   []interface{}{"the brave"},
+				"stats":    map[string]interface{}{"Health": float64(10), "mp": float64(4)},
+				"joined":   int64(1500000000),
+				"position": complex(1, 2),
+				"guild":    "dragons",
+				"Secret":   "overwritten",
+			}}
+		})
+
+		JustBeforeEach(func() {
+			err = node.Decode(&p)
+		})
+
+		It("doesn't fail", func() {
+			Ω(err).Should(BeNil())
+		})
+
+		It("decodes tagged fields", func() {
+			Ω(p.Name).Should(Equal("bob"))
+			Ω(p.Level).Should(Equal(uint8(3)))
+			Ω(p.Titles).Should(Equal([]string{"the brave"}))
+			Ω(*p.Guild).Should(Equal("dragons"))
+		})
+
+		It("decodes nested JSON values", func() {
+			Ω(p.Stats).Should(Equal(stats{Health: 10, Mana: 4}))
+		})
+
+		It("decodes times and complex values", func() {
+			Ω(p.Joined.Equal(time.Unix(1500000000, 0))).Should(BeTrue())
+			Ω(p.Position).Should(Equal(Complex(complex(1, 2))))
+		})
+
+		It("skips ignored fields", func() {
+			Ω(p.Secret).Should(Equal("kept"))
+		})
+
+		Context("with a mismatched type", func() {
+			BeforeEach(func() {
+				node.Properties["stats"] = map[string]interface{}{"mp": "lots"}
+			})
+
+			It("names the field", func() {
+				Ω(err).Should(MatchError(`talon: cannot decode string into field "Stats.Mana" of type int`))
+			})
+		})
+
+		Context("with a number that doesn't fit", func() {
+			BeforeEach(func() {
+				node.Properties["level"] = int64(300)
+			})
+
+			It("fails", func() {
+				Ω(err).Should(BeAssignableToTypeOf(&DecodeError{}))
+			})
+		})
+
+		Context("without a pointer", func() {
+			It("fails", func() {
+				Ω(node.Decode(p)).Should(Equal(ErrInvalidDecodeTarget))
+			})
+		})
+	})
+
+	Describe("Rows.Scan", func() {
+		var (
+			conn *fakeConn
+			rows *Rows
+		)
+
+		node := func(name string, level int64) graph.Node {
+			return graph.Node{Properties: map[string]interface{}{
+				"name":  name,
+				"level": level,
+			}}
+		}
+
+		JustBeforeEach(func() {
+			var err error
+			rows, err = NewDB(fakeDriver{conn}).Cypher("MATCH (n) RETURN n").Query()
+			Ω(err).Should(BeNil())
+		})
+
+		Context("with a node column", func() {
+			BeforeEach(func() {
+				conn = &fakeConn{rows: &fakeRows{
+					fields: []interface{}{"n"},
+					rows: [][]interface{}{
+						{node("bob", 1)},
+						{node("alice", 2)},
+					},
+				}}
+			})
+
+			It("scans a row at a time", func() {
+				var p player
+				Ω(rows.Scan(&p)).Should(BeNil())
+				Ω(p.Name).Should(Equal("bob"))
+				Ω(rows.Scan(&p)).Should(BeNil())
+				Ω(p.Name).Should(Equal("alice"))
+				Ω(rows.Scan(&p)).Should(Equal(io.EOF))
+			})
+
+			It("scans every row into a slice and closes the rows", func() {
+				var ps []*player
+				Ω(rows.Scan(&ps)).Should(BeNil())
+				Ω(ps).Should(HaveLen(2))
+				Ω(ps[1].Level).Should(Equal(uint8(2)))
+				Ω(rows.IsOpen()).Should(BeFalse())
+				Ω(conn.events).Should(Equal([]string{"close"}))
+			})
+		})
+
+		Context("with value columns", func() {
+			BeforeEach(func() {
+				conn = &fakeConn{rows: &fakeRows{
+					fields: []interface{}{"name", "level"},
+					rows:   [][]interface{}{{"bob", int64(5)}},
+				}}
+			})
+
+			It("matches columns to fields", func() {
+				var p player
+				Ω(rows.Scan(&p)).Should(BeNil())
+				Ω(p.Name).Should(Equal("bob"))
+				Ω(p.Level).Should(Equal(uint8(5)))
+			})
+
+			It("can't scan multiple columns into a single value", func() {
+				var name string
+				Ω(rows.Scan(&name)).ShouldNot(BeNil())
+			})
+		})
+	})
+})
@@ -0,0 +1,1126 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scope binds variable names to their values for a single row
+type scope map[string]interface{}
+
+func (s scope) copy() scope {
+	cp := make(scope, len(s))
+	for k, v := range s {
+		cp[k] = v
+	}
+
+	return cp
+}
+
+// evaluator evaluates expressions against a row. When group is set aggregate
+// functions are calculated across the rows in it.
+type evaluator struct {
+	params map[string]interface{}
+	group  []scope
+}
+
+var aggregates = map[string]bool{
+	"count":   true,
+	"collect": true,
+	"sum":     true,
+	"avg":     true,
+	"min":     true,
+	"max":     true,
+}
+
+// determine if the expression aggregates rows
+func isAggregate(e expr) bool {
+	switch v := e.(type) {
+	case *call:
+		if aggregates[v.name] {
+			return true
+		}
+		for _, arg := range v.args {
+			if isAggregate(arg) {
+				return true
+			}
+		}
+	case *binary:
+		return isAggregate(v.left) || isAggregate(v.right)
+	case *unary:
+		return isAggregate(v.operand)
+	case *isNull:
+		return isAggregate(v.operand)
+	case *property:
+		return isAggregate(v.subject)
+	case *index:
+		return isAggregate(v.subject) || isAggregate(v.index)
+	case *listExpr:
+		for _, item := range v.items {
+			if isAggregate(item) {
+				return true
+			}
+		}
+	case *mapExpr:
+		for _, val := range v.vals {
+			if isAggregate(val) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (ev *evaluator) eval(e expr, row scope) (interface{}, error) {
+	switch v := e.(type) {
+	case *literal:
+		return v.val, nil
+	case *param:
+		val, ok := ev.params[v.name]
+		if !ok {
+			return nil, fmt.Errorf("memory: expected parameter %q", v.name)
+		}
+
+		return val, nil
+	case *variable:
+		val, ok := row[v.name]
+		if !ok {
+			return nil, fmt.Errorf("memory: variable %q is not defined", v.name)
+		}
+
+		return val, nil
+	case *property:
+		subject, err := ev.eval(v.subject, row)
+		if err != nil {
+			return nil, err
+		}
+
+		return propertyOf(subject, v.key)
+	case *index:
+		return ev.index(v, row)
+	case *listExpr:
+		list := make([]interface{}, len(v.items))
+		for i, item := range v.items {
+			val, err := ev.eval(item, row)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+
+		return list, nil
+	case *mapExpr:
+		m := make(map[string]interface{}, len(v.keys))
+		for i, k := range v.keys {
+			val, err := ev.eval(v.vals[i], row)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = val
+		}
+
+		return m, nil
+	case *call:
+		if aggregates[v.name] {
+			return ev.aggregate(v)
+		}
+
+		return ev.call(v, row)
+	case *binary:
+		return ev.binary(v, row)
+	case *unary:
+		val, err := ev.eval(v.operand, row)
+		if err != nil || val == nil {
+			return nil, err
+		}
+		if v.op == "NOT" {
+			b, ok := val.(bool)
+			if !ok {
+				return nil, fmt.Errorf("memory: NOT expects a boolean but got %s", typeName(val))
+			}
+
+			return !b, nil
+		}
+		switch n := val.(type) {
+		case int64:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+
+		return nil, fmt.Errorf("memory: can't negate %s", typeName(val))
+	case *isNull:
+		val, err := ev.eval(v.operand, row)
+		if err != nil {
+			return nil, err
+		}
+
+		return (val == nil) != v.not, nil
+	case *labelCheck:
+		val, err := ev.eval(v.subject, row)
+		if err != nil || val == nil {
+			return nil, err
+		}
+		n, ok := val.(*node)
+		if !ok {
+			return nil, fmt.Errorf("memory: only nodes have labels, not %s", typeName(val))
+		}
+		for _, l := range v.labels {
+			if !n.hasLabel(l) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+
+	return nil, fmt.Errorf("memory: unsupported expression %T", e)
+}
+
+// evaluate an expression that should produce a boolean, null counts as false
+func (ev *evaluator) test(e expr, row scope) (bool, error) {
+	val, err := ev.eval(e, row)
+	if err != nil {
+		return false, err
+	}
+	switch b := val.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	}
+
+	return false, fmt.Errorf("memory: expected a boolean but got %s", typeName(val))
+}
+
+func propertyOf(subject interface{}, key string) (interface{}, error) {
+	switch s := subject.(type) {
+	case nil:
+		return nil, nil
+	case *node:
+		return s.props[key], nil
+	case *rel:
+		return s.props[key], nil
+	case map[string]interface{}:
+		return s[key], nil
+	}
+
+	return nil, fmt.Errorf("memory: can't read property %q of %s", key, typeName(subject))
+}
+
+func (ev *evaluator) index(v *index, row scope) (interface{}, error) {
+	subject, err := ev.eval(v.subject, row)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := ev.eval(v.index, row)
+	if err != nil || subject == nil || idx == nil {
+		return nil, err
+	}
+
+	switch s := subject.(type) {
+	case []interface{}:
+		i, ok := idx.(int64)
+		if !ok {
+			return nil, fmt.Errorf("memory: lists are indexed by integers, not %s", typeName(idx))
+		}
+		if i < 0 {
+			i += int64(len(s))
+		}
+		if i < 0 || i >= int64(len(s)) {
+			return nil, nil
+		}
+
+		return s[i], nil
+	case map[string]interface{}, *node, *rel:
+		k, ok := idx.(string)
+		if !ok {
+			return nil, fmt.Errorf("memory: properties are indexed by strings, not %s", typeName(idx))
+		}
+
+		return propertyOf(s, k)
+	}
+
+	return nil, fmt.Errorf("memory: can't index %s", typeName(subject))
+}
+
+func (ev *evaluator) binary(v *binary, row scope) (interface{}, error) {
+	left, err := ev.eval(v.left, row)
+	if err != nil {
+		return nil, err
+	}
+
+	// boolean operators use three valued logic and short circuit when they
+	// can
+	switch v.op {
+	case "AND", "OR", "XOR":
+		l, err := asBool(v.op, left)
+		if err != nil {
+			return nil, err
+		}
+		if v.op == "AND" && l != nil && !l.(bool) {
+			return false, nil
+		}
+		if v.op == "OR" && l != nil && l.(bool) {
+			return true, nil
+		}
+
+		right, err := ev.eval(v.right, row)
+		if err != nil {
+			return nil, err
+		}
+		r, err := asBool(v.op, right)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v.op {
+		case "AND":
+			if r != nil && !r.(bool) {
+				return false, nil
+			}
+			if l == nil || r == nil {
+				return nil, nil
+			}
+
+			return true, nil
+		case "OR":
+			if r != nil && r.(bool) {
+				return true, nil
+			}
+			if l == nil || r == nil {
+				return nil, nil
+			}
+
+			return false, nil
+		default:
+			if l == nil || r == nil {
+				return nil, nil
+			}
+
+			return l.(bool) != r.(bool), nil
+		}
+	}
+
+	right, err := ev.eval(v.right, row)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v.op {
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		eq := equal(left, right)
+		if eq == nil {
+			return nil, nil
+		}
+
+		return !eq.(bool), nil
+	case "<", "<=", ">", ">=":
+		c, ok := compare(left, right)
+		if !ok {
+			return nil, nil
+		}
+		switch v.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+
+		return c >= 0, nil
+	case "IN":
+		if right == nil {
+			return nil, nil
+		}
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("memory: IN expects a list but got %s", typeName(right))
+		}
+		var result interface{} = false
+		for _, item := range list {
+			switch equal(left, item) {
+			case true:
+				return true, nil
+			case nil:
+				result = nil
+			}
+		}
+
+		return result, nil
+	case "CONTAINS", "STARTS WITH", "ENDS WITH":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return nil, nil
+		}
+		switch v.op {
+		case "CONTAINS":
+			return strings.Contains(ls, rs), nil
+		case "STARTS WITH":
+			return strings.HasPrefix(ls, rs), nil
+		}
+
+		return strings.HasSuffix(ls, rs), nil
+	}
+
+	return arithmetic(v.op, left, right)
+}
+
+func asBool(op string, val interface{}) (interface{}, error) {
+	switch val.(type) {
+	case nil, bool:
+		return val, nil
+	}
+
+	return nil, fmt.Errorf("memory: %s expects booleans but got %s", op, typeName(val))
+}
+
+var errDivideByZero = errors.New("memory: / by zero")
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if op == "+" {
+		ll, lok := left.([]interface{})
+		rl, rok := right.([]interface{})
+		switch {
+		case lok && rok:
+			return append(append([]interface{}(nil), ll...), rl...), nil
+		case lok:
+			return append(append([]interface{}(nil), ll...), right), nil
+		case rok:
+			return append([]interface{}{left}, rl...), nil
+		}
+
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		switch {
+		case lok && rok:
+			return ls + rs, nil
+		case lok:
+			return ls + toString(right), nil
+		case rok:
+			return toString(left) + rs, nil
+		}
+	}
+
+	li, lint := left.(int64)
+	ri, rint := right.(int64)
+	if lint && rint {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, errDivideByZero
+			}
+
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, errDivideByZero
+			}
+
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("memory: can't use %s with %s and %s", op, typeName(left), typeName(right))
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	case "%":
+		return math.Mod(lf, rf), nil
+	}
+
+	return math.Pow(lf, rf), nil
+}
+
+func toString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprint(val)
+}
+
+// calculate an aggregate function across the rows in the group
+func (ev *evaluator) aggregate(c *call) (interface{}, error) {
+	if ev.group == nil {
+		return nil, fmt.Errorf("memory: %s can only be used in RETURN or WITH", c.name)
+	}
+	if c.star {
+		if c.name != "count" {
+			return nil, fmt.Errorf("memory: %s(*) is not allowed", c.name)
+		}
+
+		return int64(len(ev.group)), nil
+	}
+	if len(c.args) != 1 {
+		return nil, fmt.Errorf("memory: %s expects 1 argument", c.name)
+	}
+
+	// the rows in the group are evaluated without aggregation
+	inner := &evaluator{params: ev.params}
+	var (
+		values []interface{}
+		seen   = make(map[string]bool)
+	)
+	for _, row := range ev.group {
+		val, err := inner.eval(c.args[0], row)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		if c.distinct {
+			k := key(val)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		values = append(values, val)
+	}
+
+	switch c.name {
+	case "count":
+		return int64(len(values)), nil
+	case "collect":
+		if values == nil {
+			values = []interface{}{}
+		}
+
+		return values, nil
+	case "min", "max":
+		var result interface{}
+		for _, val := range values {
+			if result == nil {
+				result = val
+
+				continue
+			}
+			o := order(val, result)
+			if (c.name == "min" && o < 0) || (c.name == "max" && o > 0) {
+				result = val
+			}
+		}
+
+		return result, nil
+	}
+
+	// sum and avg
+	var (
+		isum    int64
+		fsum    float64
+		isFloat bool
+	)
+	for _, val := range values {
+		switch n := val.(type) {
+		case int64:
+			isum += n
+		case float64:
+			fsum += n
+			isFloat = true
+		default:
+			return nil, fmt.Errorf("memory: %s expects numbers but got %s", c.name, typeName(val))
+		}
+	}
+	if c.name == "avg" {
+		if len(values) == 0 {
+			return nil, nil
+		}
+
+		return (float64(isum) + fsum) / float64(len(values)), nil
+	}
+	if isFloat {
+		return float64(isum) + fsum, nil
+	}
+
+	return isum, nil
+}
+
+func (ev *evaluator) call(c *call, row scope) (interface{}, error) {
+	fn, ok := functions[c.name]
+	if !ok {
+		return nil, fmt.Errorf("memory: unknown function %s", c.name)
+	}
+	if c.star || c.distinct {
+		return nil, fmt.Errorf("memory: %s is not an aggregate function", c.name)
+	}
+
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		val, err := ev.eval(arg, row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	return fn(args)
+}
+
+// a function callable from queries, the arguments have been evaluated
+type function func(args []interface{}) (interface{}, error)
+
+// functions available to queries by their lower case names
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"id":            fnID,
+		"labels":        fnLabels,
+		"type":          fnType,
+		"startnode":     relEnd(true),
+		"endnode":       relEnd(false),
+		"keys":          fnKeys,
+		"properties":    fnProperties,
+		"exists":        oneArg(func(v interface{}) (interface{}, error) { return v != nil, nil }),
+		"coalesce":      fnCoalesce,
+		"size":          fnSize,
+		"length":        fnSize,
+		"nodes":         fnNodes,
+		"relationships": fnRelationships,
+		"rels":          fnRelationships,
+		"head":          listFn(func(l []interface{}) interface{} { return index0(l, 0) }),
+		"last":          listFn(func(l []interface{}) interface{} { return index0(l, len(l)-1) }),
+		"tail": listFn(func(l []interface{}) interface{} {
+			if len(l) == 0 {
+				return []interface{}{}
+			}
+
+			return append([]interface{}(nil), l[1:]...)
+		}),
+		"reverse":   fnReverse,
+		"range":     fnRange,
+		"tolower":   stringFn(strings.ToLower),
+		"toupper":   stringFn(strings.ToUpper),
+		"trim":      stringFn(strings.TrimSpace),
+		"ltrim":     stringFn(func(s string) string { return strings.TrimLeft(s, " \t\r\n") }),
+		"rtrim":     stringFn(func(s string) string { return strings.TrimRight(s, " \t\r\n") }),
+		"replace":   fnReplace,
+		"split":     fnSplit,
+		"substring": fnSubstring,
+		"tostring":  oneArg(fnToString),
+		"tointeger": oneArg(fnToInteger),
+		"toint":     oneArg(fnToInteger),
+		"tofloat":   oneArg(fnToFloat),
+		"toboolean": oneArg(fnToBoolean),
+		"abs": numberFn(func(i int64) interface{} {
+			if i < 0 {
+				return -i
+			}
+
+			return i
+		}, math.Abs),
+		"ceil":  floatFn(math.Ceil),
+		"floor": floatFn(math.Floor),
+		"round": floatFn(func(f float64) float64 { return math.Floor(f + 0.5) }),
+		"sqrt":  floatFn(math.Sqrt),
+		"sign": numberFn(func(i int64) interface{} {
+			switch {
+			case i < 0:
+				return int64(-1)
+			case i > 0:
+				return int64(1)
+			}
+
+			return int64(0)
+		}, func(f float64) float64 {
+			switch {
+			case f < 0:
+				return -1
+			case f > 0:
+				return 1
+			}
+
+			return 0
+		}),
+		"rand": func([]interface{}) (interface{}, error) {
+			return rand.Float64(), nil
+		},
+		"timestamp": func([]interface{}) (interface{}, error) {
+			return time.Now().UnixNano() / int64(time.Millisecond), nil
+		},
+	}
+}
+
+func argCount(name string, args []interface{}, counts ...int) error {
+	for _, c := range counts {
+		if len(args) == c {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("memory: wrong number of arguments to %s", name)
+}
+
+func oneArg(fn func(interface{}) (interface{}, error)) function {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("memory: function expects 1 argument")
+		}
+
+		return fn(args[0])
+	}
+}
+
+func index0(l []interface{}, i int) interface{} {
+	if i < 0 || i >= len(l) {
+		return nil
+	}
+
+	return l[i]
+}
+
+func listFn(fn func([]interface{}) interface{}) function {
+	return oneArg(func(v interface{}) (interface{}, error) {
+		switch l := v.(type) {
+		case nil:
+			return nil, nil
+		case []interface{}:
+			return fn(l), nil
+		}
+
+		return nil, fmt.Errorf("memory: expected a list but got %s", typeName(v))
+	})
+}
+
+func stringFn(fn func(string) string) function {
+	return oneArg(func(v interface{}) (interface{}, error) {
+		switch s := v.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return fn(s), nil
+		}
+
+		return nil, fmt.Errorf("memory: expected a string but got %s", typeName(v))
+	})
+}
+
+func numberFn(ifn func(int64) interface{}, ffn func(float64) float64) function {
+	return oneArg(func(v interface{}) (interface{}, error) {
+		switch n := v.(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			return ifn(n), nil
+		case float64:
+			return ffn(n), nil
+		}
+
+		return nil, fmt.Errorf("memory: expected a number but got %s", typeName(v))
+	})
+}
+
+func floatFn(fn func(float64) float64) function {
+	return oneArg(func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			return nil, fmt.Errorf("memory: expected a number but got %s", typeName(v))
+		}
+
+		return fn(f), nil
+	})
+}
+
+func fnID(args []interface{}) (interface{}, error) {
+	if err := argCount("id", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case *node:
+		return v.id, nil
+	case *rel:
+		return v.id, nil
+	}
+
+	return nil, fmt.Errorf("memory: id expects a node or relationship but got %s", typeName(args[0]))
+}
+
+func fnLabels(args []interface{}) (interface{}, error) {
+	if err := argCount("labels", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case *node:
+		labels := make([]interface{}, len(v.labels))
+		for i, l := range v.labels {
+			labels[i] = l
+		}
+
+		return labels, nil
+	}
+
+	return nil, fmt.Errorf("memory: labels expects a node but got %s", typeName(args[0]))
+}
+
+func fnType(args []interface{}) (interface{}, error) {
+	if err := argCount("type", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case *rel:
+		return v.typ, nil
+	}
+
+	return nil, fmt.Errorf("memory: type expects a relationship but got %s", typeName(args[0]))
+}
+
+func relEnd(start bool) function {
+	return oneArg(func(v interface{}) (interface{}, error) {
+		switch r := v.(type) {
+		case nil:
+			return nil, nil
+		case *rel:
+			if start {
+				return r.start, nil
+			}
+
+			return r.end, nil
+		}
+
+		return nil, fmt.Errorf("memory: expected a relationship but got %s", typeName(v))
+	})
+}
+
+func propsOf(v interface{}) (map[string]interface{}, error) {
+	switch e := v.(type) {
+	case *node:
+		return e.props, nil
+	case *rel:
+		return e.props, nil
+	case map[string]interface{}:
+		return e, nil
+	}
+
+	return nil, fmt.Errorf("memory: expected a node, relationship or map but got %s", typeName(v))
+}
+
+func fnKeys(args []interface{}) (interface{}, error) {
+	if err := argCount("keys", args, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	props, err := propsOf(args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]interface{}, 0, len(props))
+	for _, k := range sortedKeys(props) {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func fnProperties(args []interface{}) (interface{}, error) {
+	if err := argCount("properties", args, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	props, err := propsOf(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return copyProps(props), nil
+}
+
+func fnCoalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func fnSize(args []interface{}) (interface{}, error) {
+	if err := argCount("size", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return int64(len([]rune(v))), nil
+	case []interface{}:
+		return int64(len(v)), nil
+	case *path:
+		return int64(len(v.rels)), nil
+	}
+
+	return nil, fmt.Errorf("memory: can't find the size of %s", typeName(args[0]))
+}
+
+func fnNodes(args []interface{}) (interface{}, error) {
+	if err := argCount("nodes", args, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	p, ok := args[0].(*path)
+	if !ok {
+		return nil, fmt.Errorf("memory: nodes expects a path but got %s", typeName(args[0]))
+	}
+	nodes := make([]interface{}, len(p.nodes))
+	for i, n := range p.nodes {
+		nodes[i] = n
+	}
+
+	return nodes, nil
+}
+
+func fnRelationships(args []interface{}) (interface{}, error) {
+	if err := argCount("relationships", args, 1); err != nil || args[0] == nil {
+		return nil, err
+	}
+	p, ok := args[0].(*path)
+	if !ok {
+		return nil, fmt.Errorf("memory: relationships expects a path but got %s", typeName(args[0]))
+	}
+	rels := make([]interface{}, len(p.rels))
+	for i, r := range p.rels {
+		rels[i] = r
+	}
+
+	return rels, nil
+}
+
+func fnReverse(args []interface{}) (interface{}, error) {
+	if err := argCount("reverse", args, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		rs := []rune(v)
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+
+		return string(rs), nil
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[len(v)-1-i] = item
+		}
+
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("memory: can't reverse %s", typeName(args[0]))
+}
+
+func fnRange(args []interface{}) (interface{}, error) {
+	if err := argCount("range", args, 2, 3); err != nil {
+		return nil, err
+	}
+	ints := make([]int64, len(args))
+	for i, arg := range args {
+		n, ok := arg.(int64)
+		if !ok {
+			return nil, fmt.Errorf("memory: range expects integers but got %s", typeName(arg))
+		}
+		ints[i] = n
+	}
+	step := int64(1)
+	if len(ints) == 3 {
+		step = ints[2]
+	}
+	if step == 0 {
+		return nil, errors.New("memory: range step can't be 0")
+	}
+
+	list := []interface{}{}
+	for i := ints[0]; (step > 0 && i <= ints[1]) || (step < 0 && i >= ints[1]); i += step {
+		list = append(list, i)
+	}
+
+	return list, nil
+}
+
+func fnReplace(args []interface{}) (interface{}, error) {
+	if err := argCount("replace", args, 3); err != nil {
+		return nil, err
+	}
+	strs, err := strings3(args)
+	if err != nil || strs == nil {
+		return nil, err
+	}
+
+	return strings.Replace(strs[0], strs[1], strs[2], -1), nil
+}
+
+func fnSplit(args []interface{}) (interface{}, error) {
+	if err := argCount("split", args, 2); err != nil {
+		return nil, err
+	}
+	strs, err := strings3(args)
+	if err != nil || strs == nil {
+		return nil, err
+	}
+	parts := strings.Split(strs[0], strs[1])
+	list := make([]interface{}, len(parts))
+	for i, p := range parts {
+		list[i] = p
+	}
+
+	return list, nil
+}
+
+// all of the arguments as strings, nil if any of them are null
+func strings3(args []interface{}) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+		s, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("memory: expected a string but got %s", typeName(arg))
+		}
+		strs[i] = s
+	}
+
+	return strs, nil
+}
+
+func fnSubstring(args []interface{}) (interface{}, error) {
+	if err := argCount("substring", args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("memory: substring expects a string but got %s", typeName(args[0]))
+	}
+	rs := []rune(s)
+	start, ok := args[1].(int64)
+	if !ok || start < 0 {
+		return nil, errors.New("memory: substring expects a positive start")
+	}
+	if start > int64(len(rs)) {
+		start = int64(len(rs))
+	}
+	end := int64(len(rs))
+	if len(args) == 3 {
+		length, ok := args[2].(int64)
+		if !ok || length < 0 {
+			return nil, errors.New("memory: substring expects a positive length")
+		}
+		if start+length < end {
+			end = start + length
+		}
+	}
+
+	return string(rs[start:end]), nil
+}
+
+func fnToString(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil:
+		return nil, nil
+	case string, int64, float64, bool:
+		return toString(v), nil
+	}
+
+	return nil, fmt.Errorf("memory: can't convert %s to a string", typeName(v))
+}
+
+func fnToInteger(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+			return int64(f), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func fnToFloat(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func fnToBoolean(v interface{}) (interface{}, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(b)) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+
+	return nil, nil
+}
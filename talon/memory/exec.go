@@ -0,0 +1,969 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// execution runs the clauses of a single query against the graph, recording
+// it's changes in the journal.
+type execution struct {
+	g  *graph
+	j  *journal
+	ev *evaluator
+}
+
+// execute the query returning the names of the columns and the values of the
+// rows returned, if it had a RETURN.
+func execute(j *journal, stmt *statement, params map[string]interface{}) ([]string, [][]interface{}, error) {
+	for _, name := range stmt.params {
+		if _, ok := params[name]; !ok {
+			return nil, nil, fmt.Errorf("memory: expected parameter %q", name)
+		}
+	}
+
+	x := &execution{
+		g:  j.g,
+		j:  j,
+		ev: &evaluator{params: params},
+	}
+
+	var (
+		rows = []scope{{}}
+		err  error
+	)
+	for i, c := range stmt.clauses {
+		switch c := c.(type) {
+		case *matchClause:
+			rows, err = x.match(c, rows)
+		case *createClause:
+			rows, err = x.create(c, rows)
+		case *mergeClause:
+			rows, err = x.merge(c, rows)
+		case *setClause:
+			err = x.set(c.items, rows)
+		case *removeClause:
+			err = x.remove(c.items, rows)
+		case *deleteClause:
+			err = x.delete(c, rows)
+		case *unwindClause:
+			rows, err = x.unwind(c, rows)
+		case *withClause:
+			_, rows, err = x.project(&c.projection, rows)
+		case *returnClause:
+			if i != len(stmt.clauses)-1 {
+				return nil, nil, errors.New("memory: RETURN can only be used at the end of a query")
+			}
+
+			return x.returnRows(&c.projection, rows)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return nil, nil, nil
+}
+
+func (x *execution) returnRows(p *projection, rows []scope) ([]string, [][]interface{}, error) {
+	fields, projected, err := x.project(p, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := make([][]interface{}, len(projected))
+	for i, row := range projected {
+		record := make([]interface{}, len(fields))
+		for k, f := range fields {
+			record[k] = toBolt(row[f])
+		}
+		records[i] = record
+	}
+
+	return fields, records, nil
+}
+
+// UNWIND
+
+// produce a row for every item in the list, null produces no rows and any
+// other value is treated as a list of one.
+func (x *execution) unwind(c *unwindClause, rows []scope) ([]scope, error) {
+	var out []scope
+	for _, row := range rows {
+		val, err := x.ev.eval(c.list, row)
+		if err != nil {
+			return nil, err
+		}
+
+		var items []interface{}
+		switch v := val.(type) {
+		case nil:
+		case []interface{}:
+			items = v
+		default:
+			items = []interface{}{v}
+		}
+
+		for _, item := range items {
+			s := row.copy()
+			s[c.name] = item
+			out = append(out, s)
+		}
+	}
+
+	return out, nil
+}
+
+// MATCH and OPTIONAL MATCH
+
+func (x *execution) match(c *matchClause, rows []scope) ([]scope, error) {
+	var out []scope
+	for _, row := range rows {
+		var (
+			s       = row.copy()
+			matched []scope
+		)
+		err := x.matchPaths(c.patterns, s, make(map[*rel]bool), func() error {
+			if c.where != nil {
+				ok, err := x.ev.test(c.where, s)
+				if err != nil || !ok {
+					return err
+				}
+			}
+			matched = append(matched, s.copy())
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matched) == 0 && c.optional {
+			s := row.copy()
+			for _, name := range patternVariables(c.patterns) {
+				if _, ok := s[name]; !ok {
+					s[name] = nil
+				}
+			}
+			matched = append(matched, s)
+		}
+		out = append(out, matched...)
+	}
+
+	return out, nil
+}
+
+// the names of every variable introduced in the patterns
+func patternVariables(paths []*pathPattern) []string {
+	var names []string
+	for _, p := range paths {
+		if p.name != "" {
+			names = append(names, p.name)
+		}
+		for _, n := range p.nodes {
+			if n.name != "" {
+				names = append(names, n.name)
+			}
+		}
+		for _, r := range p.rels {
+			if r.name != "" {
+				names = append(names, r.name)
+			}
+		}
+	}
+
+	return names
+}
+
+// find every way the paths can be matched, binding their variables in the
+// scope and calling emit for each. Relationships can only be used once in a
+// match.
+func (x *execution) matchPaths(paths []*pathPattern, s scope, used map[*rel]bool, emit func() error) error {
+	if len(paths) == 0 {
+		return emit()
+	}
+
+	p := paths[0]
+	trail := &path{}
+	next := func() error {
+		if p.name == "" {
+			return x.matchPaths(paths[1:], s, used, emit)
+		}
+
+		return x.bind(s, p.name, &path{
+			nodes: append([]*node(nil), trail.nodes...),
+			rels:  append([]*rel(nil), trail.rels...),
+		}, func() error {
+			return x.matchPaths(paths[1:], s, used, emit)
+		})
+	}
+
+	var candidates []*node
+	start := p.nodes[0]
+	if val, ok := s[start.name]; ok && start.name != "" {
+		n, isNode := val.(*node)
+		if val != nil && !isNode {
+			return fmt.Errorf("memory: variable %q is %s, not a node", start.name, typeName(val))
+		}
+		if n != nil && !n.deleted {
+			candidates = append(candidates, n)
+		}
+	} else {
+		candidates = x.g.allNodes()
+	}
+
+	for _, n := range candidates {
+		err := x.matchNode(start, n, s, func() error {
+			trail.nodes = append(trail.nodes, n)
+			err := x.matchSteps(p, 0, n, trail, s, used, next)
+			trail.nodes = trail.nodes[:len(trail.nodes)-1]
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// follow the path from the node through it's remaining relationships
+func (x *execution) matchSteps(p *pathPattern, i int, from *node, trail *path, s scope, used map[*rel]bool, done func() error) error {
+	if i == len(p.rels) {
+		return done()
+	}
+
+	rp, np := p.rels[i], p.nodes[i+1]
+	for _, r := range x.g.relsOf(from, rp.dir) {
+		if used[r] {
+			continue
+		}
+		to := r.other(from)
+
+		err := x.matchRel(rp, r, s, func() error {
+			return x.matchNode(np, to, s, func() error {
+				used[r] = true
+				trail.rels = append(trail.rels, r)
+				trail.nodes = append(trail.nodes, to)
+
+				err := x.matchSteps(p, i+1, to, trail, s, used, done)
+
+				trail.rels = trail.rels[:len(trail.rels)-1]
+				trail.nodes = trail.nodes[:len(trail.nodes)-1]
+				delete(used, r)
+
+				return err
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check the node matches the pattern, binding it's variable while calling
+// fn
+func (x *execution) matchNode(np *nodePattern, n *node, s scope, fn func() error) error {
+	for _, l := range np.labels {
+		if !n.hasLabel(l) {
+			return nil
+		}
+	}
+	ok, err := x.matchProps(np.props, n.props, s)
+	if err != nil || !ok {
+		return err
+	}
+
+	return x.bind(s, np.name, n, fn)
+}
+
+// check the relationship matches the pattern, binding it's variable while
+// calling fn
+func (x *execution) matchRel(rp *relPattern, r *rel, s scope, fn func() error) error {
+	if len(rp.types) > 0 {
+		found := false
+		for _, t := range rp.types {
+			if r.typ == t {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	ok, err := x.matchProps(rp.props, r.props, s)
+	if err != nil || !ok {
+		return err
+	}
+
+	return x.bind(s, rp.name, r, fn)
+}
+
+func (x *execution) matchProps(e expr, props map[string]interface{}, s scope) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	want, err := x.propertyMap(e, s)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range want {
+		if equal(props[k], v) != true {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// bind the variable to the value while calling fn, if the variable is
+// already bound fn is only called if it's bound to the same value.
+func (x *execution) bind(s scope, name string, val interface{}, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	if existing, ok := s[name]; ok {
+		if existing == nil || key(existing) != key(val) {
+			return nil
+		}
+
+		return fn()
+	}
+
+	s[name] = val
+	err := fn()
+	delete(s, name)
+
+	return err
+}
+
+// CREATE
+
+func (x *execution) create(c *createClause, rows []scope) ([]scope, error) {
+	for _, s := range rows {
+		for _, p := range c.patterns {
+			if err := x.createPath(p, s, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// create the path binding it's variables in the scope, nodes bound to a
+// variable already are reused. Relationships without a direction are only
+// allowed when merging, they're created left to right.
+func (x *execution) createPath(p *pathPattern, s scope, merging bool) error {
+	trail := &path{}
+	for i, np := range p.nodes {
+		n, err := x.createNode(np, s)
+		if err != nil {
+			return err
+		}
+		trail.nodes = append(trail.nodes, n)
+
+		if i == 0 {
+			continue
+		}
+
+		rp := p.rels[i-1]
+		if len(rp.types) != 1 {
+			return errors.New("memory: relationships must be created with exactly one type")
+		}
+		if rp.dir == either && !merging {
+			return errors.New("memory: relationships must be created with a direction")
+		}
+		if _, ok := s[rp.name]; ok && rp.name != "" {
+			return fmt.Errorf("memory: variable %q is already defined", rp.name)
+		}
+		props, err := x.properties(rp.props, s)
+		if err != nil {
+			return err
+		}
+
+		start, end := trail.nodes[i-1], n
+		if rp.dir == incoming {
+			start, end = end, start
+		}
+		r := x.j.createRel(rp.types[0], start, end, props)
+		if rp.name != "" {
+			s[rp.name] = r
+		}
+		trail.rels = append(trail.rels, r)
+	}
+
+	if p.name != "" {
+		s[p.name] = trail
+	}
+
+	return nil
+}
+
+func (x *execution) createNode(np *nodePattern, s scope) (*node, error) {
+	if val, ok := s[np.name]; ok && np.name != "" {
+		if len(np.labels) > 0 || np.props != nil {
+			return nil, fmt.Errorf("memory: can't create node %q with labels or properties, it is already defined", np.name)
+		}
+		n, isNode := val.(*node)
+		if !isNode {
+			return nil, fmt.Errorf("memory: can't create a relationship with %s", typeName(val))
+		}
+		if n.deleted {
+			return nil, fmt.Errorf("memory: node %d has been deleted", n.id)
+		}
+
+		return n, nil
+	}
+
+	props, err := x.properties(np.props, s)
+	if err != nil {
+		return nil, err
+	}
+	n := x.j.createNode(np.labels, props)
+	if np.name != "" {
+		s[np.name] = n
+	}
+
+	return n, nil
+}
+
+// evaluate the property map of a pattern, checking the values can be stored
+func (x *execution) properties(e expr, s scope) (map[string]interface{}, error) {
+	props := make(map[string]interface{})
+	if e == nil {
+		return props, nil
+	}
+	m, err := x.propertyMap(e, s)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		if err := checkProperty(k, v); err != nil {
+			return nil, err
+		}
+		if v != nil {
+			props[k] = v
+		}
+	}
+
+	return props, nil
+}
+
+// evaluate an expression that should result in a map of properties
+func (x *execution) propertyMap(e expr, s scope) (map[string]interface{}, error) {
+	val, err := x.ev.eval(e, s)
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	case *node:
+		return v.props, nil
+	case *rel:
+		return v.props, nil
+	}
+
+	return nil, fmt.Errorf("memory: expected a map of properties but got %s", typeName(val))
+}
+
+// MERGE
+
+func (x *execution) merge(c *mergeClause, rows []scope) ([]scope, error) {
+	var out []scope
+	for _, row := range rows {
+		var (
+			s       = row.copy()
+			matched []scope
+		)
+		err := x.matchPaths([]*pathPattern{c.pattern}, s, make(map[*rel]bool), func() error {
+			matched = append(matched, s.copy())
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matched) > 0 {
+			if err := x.set(c.onMatch, matched); err != nil {
+				return nil, err
+			}
+			out = append(out, matched...)
+
+			continue
+		}
+
+		if err := x.createPath(c.pattern, s, true); err != nil {
+			return nil, err
+		}
+		if err := x.set(c.onCreate, []scope{s}); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+
+	return out, nil
+}
+
+// SET and REMOVE
+
+func (x *execution) set(items []setItem, rows []scope) error {
+	for _, s := range rows {
+		for _, item := range items {
+			if err := x.setOne(item, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (x *execution) setOne(item setItem, s scope) error {
+	target, ok := s[item.name]
+	if !ok {
+		return fmt.Errorf("memory: variable %q is not defined", item.name)
+	}
+	if target == nil {
+		return nil
+	}
+
+	if item.kind == setLabels {
+		n, ok := target.(*node)
+		if !ok {
+			return fmt.Errorf("memory: only nodes have labels, not %s", typeName(target))
+		}
+		for _, l := range item.labels {
+			x.j.addLabel(n, l)
+		}
+
+		return nil
+	}
+
+	if _, isMap := target.(map[string]interface{}); isMap {
+		return errors.New("memory: can't set properties on a map")
+	}
+	props, err := propsOf(target)
+	if err != nil {
+		return err
+	}
+
+	if item.kind == setProperty {
+		val, err := x.ev.eval(item.value, s)
+		if err != nil {
+			return err
+		}
+		if err := checkProperty(item.key, val); err != nil {
+			return err
+		}
+		x.j.setProp(props, item.key, val)
+
+		return nil
+	}
+
+	m, err := x.propertyMap(item.value, s)
+	if err != nil {
+		return err
+	}
+	for k, v := range m {
+		if err := checkProperty(k, v); err != nil {
+			return err
+		}
+	}
+	// copy the values, they may be the properties of the target
+	values := copyProps(m)
+	if item.kind == setReplace {
+		for _, k := range sortedKeys(props) {
+			if _, keep := values[k]; !keep {
+				x.j.setProp(props, k, nil)
+			}
+		}
+	}
+	for _, k := range sortedKeys(values) {
+		x.j.setProp(props, k, values[k])
+	}
+
+	return nil
+}
+
+func (x *execution) remove(items []setItem, rows []scope) error {
+	for _, s := range rows {
+		for _, item := range items {
+			target, ok := s[item.name]
+			if !ok {
+				return fmt.Errorf("memory: variable %q is not defined", item.name)
+			}
+			if target == nil {
+				continue
+			}
+
+			if item.kind == setLabels {
+				n, ok := target.(*node)
+				if !ok {
+					return fmt.Errorf("memory: only nodes have labels, not %s", typeName(target))
+				}
+				for _, l := range item.labels {
+					x.j.removeLabel(n, l)
+				}
+
+				continue
+			}
+
+			props, err := propsOf(target)
+			if err != nil {
+				return err
+			}
+			x.j.setProp(props, item.key, nil)
+		}
+	}
+
+	return nil
+}
+
+// DELETE and DETACH DELETE
+
+func (x *execution) delete(c *deleteClause, rows []scope) error {
+	var (
+		nodes []*node
+		rels  []*rel
+	)
+	for _, s := range rows {
+		for _, e := range c.exprs {
+			val, err := x.ev.eval(e, s)
+			if err != nil {
+				return err
+			}
+			switch v := val.(type) {
+			case nil:
+			case *node:
+				nodes = append(nodes, v)
+			case *rel:
+				rels = append(rels, v)
+			case *path:
+				nodes = append(nodes, v.nodes...)
+				rels = append(rels, v.rels...)
+			default:
+				return fmt.Errorf("memory: can't delete %s", typeName(val))
+			}
+		}
+	}
+
+	// relationships go first so nodes deleted alongside their relationships
+	// don't need to be detached
+	for _, r := range rels {
+		x.j.deleteRel(r)
+	}
+	for _, n := range nodes {
+		if n.deleted {
+			continue
+		}
+		if c.detach {
+			for _, r := range x.g.relsOf(n, either) {
+				x.j.deleteRel(r)
+			}
+		} else if len(n.out) > 0 || len(n.in) > 0 {
+			return fmt.Errorf("memory: can't delete node %d, it still has relationships, use DETACH DELETE", n.id)
+		}
+		x.j.deleteNode(n)
+	}
+
+	return nil
+}
+
+// WITH and RETURN
+
+// project the rows into new rows with only the items in the projection,
+// returning the names of the columns and the new rows.
+func (x *execution) project(p *projection, rows []scope) ([]string, []scope, error) {
+	items := p.items
+	if p.star {
+		var names []string
+		if len(rows) > 0 {
+			names = sortedKeys(rows[0])
+		}
+		star := make([]projectionItem, len(names))
+		for i, name := range names {
+			star[i] = projectionItem{expr: &variable{name}, alias: name}
+		}
+		items = append(star, items...)
+	}
+
+	fields := make([]string, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		if seen[item.alias] {
+			return nil, nil, fmt.Errorf("memory: multiple columns named %q", item.alias)
+		}
+		seen[item.alias] = true
+		fields[i] = item.alias
+	}
+
+	projected, sortScopes, err := x.projectRows(items, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.distinct {
+		var (
+			distinct       []scope
+			distinctScopes []scope
+			keys           = make(map[string]bool)
+		)
+		for _, row := range projected {
+			k := rowKey(fields, row)
+			if keys[k] {
+				continue
+			}
+			keys[k] = true
+			distinct = append(distinct, row)
+			// after DISTINCT only the projected values can be sorted on
+			distinctScopes = append(distinctScopes, row)
+		}
+		projected, sortScopes = distinct, distinctScopes
+	}
+
+	if len(p.order) > 0 {
+		if err := x.sort(p.order, projected, sortScopes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if p.skip != nil {
+		n, err := x.count("SKIP", p.skip)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n > len(projected) {
+			n = len(projected)
+		}
+		projected = projected[n:]
+	}
+	if p.limit != nil {
+		n, err := x.count("LIMIT", p.limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n < len(projected) {
+			projected = projected[:n]
+		}
+	}
+
+	if p.where != nil {
+		var filtered []scope
+		for _, row := range projected {
+			ok, err := x.ev.test(p.where, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				filtered = append(filtered, row)
+			}
+		}
+		projected = filtered
+	}
+
+	return fields, projected, nil
+}
+
+// evaluate the items for each row, grouping rows when any of the items
+// aggregate. Along with the projected rows the scopes ORDER BY can use for
+// each are returned.
+func (x *execution) projectRows(items []projectionItem, rows []scope) ([]scope, []scope, error) {
+	aggregating := false
+	for _, item := range items {
+		if isAggregate(item.expr) {
+			aggregating = true
+
+			break
+		}
+	}
+
+	if !aggregating {
+		projected := make([]scope, len(rows))
+		sortScopes := make([]scope, len(rows))
+		for i, row := range rows {
+			out := make(scope, len(items))
+			for _, item := range items {
+				val, err := x.ev.eval(item.expr, row)
+				if err != nil {
+					return nil, nil, err
+				}
+				out[item.alias] = val
+			}
+			projected[i] = out
+			sortScopes[i] = merged(row, out)
+		}
+
+		return projected, sortScopes, nil
+	}
+
+	// group rows by the values of the items that don't aggregate
+	type group struct {
+		keys scope
+		rows []scope
+	}
+	var (
+		groups []*group
+		byKey  = make(map[string]*group)
+	)
+	for _, row := range rows {
+		keys := make(scope)
+		var keyFields []string
+		for _, item := range items {
+			if isAggregate(item.expr) {
+				continue
+			}
+			val, err := x.ev.eval(item.expr, row)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys[item.alias] = val
+			keyFields = append(keyFields, item.alias)
+		}
+		k := rowKey(keyFields, keys)
+		g, ok := byKey[k]
+		if !ok {
+			g = &group{keys: keys}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, row)
+	}
+	// aggregating nothing still produces a row, unless there are grouping
+	// keys
+	if len(groups) == 0 {
+		grouped := false
+		for _, item := range items {
+			if !isAggregate(item.expr) {
+				grouped = true
+			}
+		}
+		if !grouped {
+			groups = append(groups, &group{keys: scope{}})
+		}
+	}
+
+	projected := make([]scope, len(groups))
+	sortScopes := make([]scope, len(groups))
+	for i, g := range groups {
+		first := scope{}
+		if len(g.rows) > 0 {
+			first = g.rows[0]
+		}
+		ev := &evaluator{params: x.ev.params, group: g.rows}
+		if ev.group == nil {
+			ev.group = []scope{}
+		}
+
+		out := g.keys.copy()
+		for _, item := range items {
+			if !isAggregate(item.expr) {
+				continue
+			}
+			val, err := ev.eval(item.expr, first)
+			if err != nil {
+				return nil, nil, err
+			}
+			out[item.alias] = val
+		}
+		projected[i] = out
+		sortScopes[i] = merged(first, out)
+	}
+
+	return projected, sortScopes, nil
+}
+
+func (x *execution) sort(by []sortItem, rows, scopes []scope) error {
+	type sortable struct {
+		row    scope
+		values []interface{}
+	}
+	items := make([]sortable, len(rows))
+	for i, row := range rows {
+		values := make([]interface{}, len(by))
+		for k, o := range by {
+			val, err := x.ev.eval(o.expr, scopes[i])
+			if err != nil {
+				return err
+			}
+			values[k] = val
+		}
+		items[i] = sortable{row, values}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		for k, o := range by {
+			c := order(items[i].values[k], items[j].values[k])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+	for i, item := range items {
+		rows[i] = item.row
+	}
+
+	return nil
+}
+
+// evaluate a SKIP or LIMIT
+func (x *execution) count(clause string, e expr) (int, error) {
+	val, err := x.ev.eval(e, scope{})
+	if err != nil {
+		return 0, err
+	}
+	n, ok := val.(int64)
+	if !ok || n < 0 {
+		return 0, fmt.Errorf("memory: %s expects a positive integer", clause)
+	}
+
+	return int(n), nil
+}
+
+// the new values over the old ones in a new scope
+func merged(old, new scope) scope {
+	s := old.copy()
+	for k, v := range new {
+		s[k] = v
+	}
+
+	return s
+}
+
+func rowKey(fields []string, row scope) string {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		values[i] = row[f]
+	}
+
+	return key(values)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
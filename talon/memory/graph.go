@@ -0,0 +1,301 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"sort"
+	"sync"
+)
+
+type node struct {
+	id      int64
+	labels  []string
+	props   map[string]interface{}
+	out     map[int64]*rel
+	in      map[int64]*rel
+	deleted bool
+}
+
+func (n *node) hasLabel(label string) bool {
+	for _, l := range n.labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+type rel struct {
+	id      int64
+	typ     string
+	start   *node
+	end     *node
+	props   map[string]interface{}
+	deleted bool
+}
+
+// the other end of the relationship from the node given
+func (r *rel) other(n *node) *node {
+	if r.start == n {
+		return r.end
+	}
+
+	return r.start
+}
+
+type path struct {
+	nodes []*node
+	rels  []*rel
+}
+
+// stats counts the changes made by a query, they're reported with the names
+// Neo4j uses.
+type stats struct {
+	nodesCreated         int64
+	nodesDeleted         int64
+	relationshipsCreated int64
+	relationshipsDeleted int64
+	propertiesSet        int64
+	labelsAdded          int64
+	labelsRemoved        int64
+}
+
+func (s stats) metadata() map[string]interface{} {
+	md := make(map[string]interface{})
+	add := func(name string, count int64) {
+		if count > 0 {
+			md[name] = count
+		}
+	}
+	add("nodes-created", s.nodesCreated)
+	add("nodes-deleted", s.nodesDeleted)
+	add("relationships-created", s.relationshipsCreated)
+	add("relationships-deleted", s.relationshipsDeleted)
+	add("properties-set", s.propertiesSet)
+	add("labels-added", s.labelsAdded)
+	add("labels-removed", s.labelsRemoved)
+
+	return md
+}
+
+func (s stats) writes() bool {
+	return s != stats{}
+}
+
+// graph holds every node and relationship, it must be locked while a query
+// runs against it.
+type graph struct {
+	sync.Mutex
+	nextNode int64
+	nextRel  int64
+	nodes    map[int64]*node
+	rels     map[int64]*rel
+}
+
+func newGraph() *graph {
+	return &graph{
+		nodes: make(map[int64]*node),
+		rels:  make(map[int64]*rel),
+	}
+}
+
+// every node in the order they were created
+func (g *graph) allNodes() []*node {
+	nodes := make([]*node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].id < nodes[j].id
+	})
+
+	return nodes
+}
+
+// the node's relationships in the direction given, in the order they were
+// created
+func (g *graph) relsOf(n *node, dir direction) []*rel {
+	var rels []*rel
+	if dir == outgoing || dir == either {
+		for _, r := range n.out {
+			rels = append(rels, r)
+		}
+	}
+	if dir == incoming || dir == either {
+		for _, r := range n.in {
+			// relationships from a node to itself are only included once
+			if dir == either && r.start == n {
+				continue
+			}
+			rels = append(rels, r)
+		}
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		return rels[i].id < rels[j].id
+	})
+
+	return rels
+}
+
+// journal records the changes made to the graph so they can be undone, along
+// with the stats for the changes.
+type journal struct {
+	g     *graph
+	undo  []func()
+	stats stats
+}
+
+func (g *graph) journal() *journal {
+	return &journal{g: g}
+}
+
+// rollback undoes every change in the journal, most recent first.
+func (j *journal) rollback() {
+	for i := len(j.undo) - 1; i >= 0; i-- {
+		j.undo[i]()
+	}
+	j.undo = nil
+}
+
+func (j *journal) createNode(labels []string, props map[string]interface{}) *node {
+	j.g.nextNode++
+	n := &node{
+		id:     j.g.nextNode,
+		labels: uniqueLabels(labels),
+		props:  props,
+		out:    make(map[int64]*rel),
+		in:     make(map[int64]*rel),
+	}
+	j.g.nodes[n.id] = n
+	j.undo = append(j.undo, func() {
+		delete(j.g.nodes, n.id)
+		n.deleted = true
+	})
+	j.stats.nodesCreated++
+	j.stats.labelsAdded += int64(len(n.labels))
+	j.stats.propertiesSet += int64(len(props))
+
+	return n
+}
+
+func (j *journal) createRel(typ string, start, end *node, props map[string]interface{}) *rel {
+	j.g.nextRel++
+	r := &rel{
+		id:    j.g.nextRel,
+		typ:   typ,
+		start: start,
+		end:   end,
+		props: props,
+	}
+	j.link(r)
+	j.undo = append(j.undo, func() {
+		j.unlink(r)
+		r.deleted = true
+	})
+	j.stats.relationshipsCreated++
+	j.stats.propertiesSet += int64(len(props))
+
+	return r
+}
+
+func (j *journal) link(r *rel) {
+	j.g.rels[r.id] = r
+	r.start.out[r.id] = r
+	r.end.in[r.id] = r
+}
+
+func (j *journal) unlink(r *rel) {
+	delete(j.g.rels, r.id)
+	delete(r.start.out, r.id)
+	delete(r.end.in, r.id)
+}
+
+func (j *journal) deleteRel(r *rel) {
+	if r.deleted {
+		return
+	}
+	j.unlink(r)
+	r.deleted = true
+	j.undo = append(j.undo, func() {
+		j.link(r)
+		r.deleted = false
+	})
+	j.stats.relationshipsDeleted++
+}
+
+func (j *journal) deleteNode(n *node) {
+	if n.deleted {
+		return
+	}
+	delete(j.g.nodes, n.id)
+	n.deleted = true
+	j.undo = append(j.undo, func() {
+		j.g.nodes[n.id] = n
+		n.deleted = false
+	})
+	j.stats.nodesDeleted++
+}
+
+// set the property, a nil value removes it
+func (j *journal) setProp(props map[string]interface{}, key string, val interface{}) {
+	old, existed := props[key]
+	if val == nil {
+		if !existed {
+			return
+		}
+		delete(props, key)
+	} else {
+		props[key] = val
+	}
+	j.undo = append(j.undo, func() {
+		if existed {
+			props[key] = old
+		} else {
+			delete(props, key)
+		}
+	})
+	j.stats.propertiesSet++
+}
+
+func (j *journal) addLabel(n *node, label string) {
+	if n.hasLabel(label) {
+		return
+	}
+	old := n.labels
+	n.labels = append(append([]string(nil), old...), label)
+	j.undo = append(j.undo, func() {
+		n.labels = old
+	})
+	j.stats.labelsAdded++
+}
+
+func (j *journal) removeLabel(n *node, label string) {
+	if !n.hasLabel(label) {
+		return
+	}
+	old := n.labels
+	n.labels = nil
+	for _, l := range old {
+		if l != label {
+			n.labels = append(n.labels, l)
+		}
+	}
+	j.undo = append(j.undo, func() {
+		n.labels = old
+	})
+	j.stats.labelsRemoved++
+}
+
+func uniqueLabels(labels []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, l := range labels {
+		if !seen[l] {
+			seen[l] = true
+			unique = append(unique, l)
+		}
+	}
+
+	return unique
+}
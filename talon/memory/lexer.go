@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuoted // `quoted identifier`
+	tokString
+	tokInt
+	tokFloat
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+// is determines if the token is the given symbol
+func (t token) is(sym string) bool {
+	return t.kind == tokSymbol && t.text == sym
+}
+
+// keyword determines if the token is the given keyword, keywords are not
+// case sensitive.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+// SyntaxError is returned for queries that can't be parsed, or that use
+// parts of Cypher the memory driver doesn't understand.
+type SyntaxError struct {
+	Query  string
+	Offset int
+	Msg    string
+}
+
+// Error describes where in the query the error is.
+func (se *SyntaxError) Error() string {
+	return fmt.Sprintf("memory: invalid cypher at offset %d: %s", se.Offset, se.Msg)
+}
+
+// symbols made of two characters, checked before single characters
+var twoCharSymbols = []string{"<>", "<=", ">=", "+=", ".."}
+
+// split the query into tokens
+func lex(query string) ([]token, error) {
+	var (
+		tokens []token
+		rs     = []rune(query)
+		i      = 0
+	)
+
+	fail := func(pos int, format string, args ...interface{}) error {
+		return &SyntaxError{Query: query, Offset: pos, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	for i < len(rs) {
+		r := rs[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+			continue
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+
+			continue
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == '/') {
+				i++
+			}
+			if i+1 >= len(rs) {
+				return nil, fail(start, "unterminated comment")
+			}
+			i += 2
+
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(rs) && (rs[i] == '_' || unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(rs[start:i]), start, i})
+		case unicode.IsDigit(r):
+			kind := tokInt
+			for i < len(rs) && unicode.IsDigit(rs[i]) {
+				i++
+			}
+			// a dot followed by a digit makes a float, otherwise it's a
+			// range or property access
+			if i+1 < len(rs) && rs[i] == '.' && unicode.IsDigit(rs[i+1]) {
+				kind = tokFloat
+				i++
+				for i < len(rs) && unicode.IsDigit(rs[i]) {
+					i++
+				}
+			}
+			if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+				kind = tokFloat
+				i++
+				if i < len(rs) && (rs[i] == '-' || rs[i] == '+') {
+					i++
+				}
+				for i < len(rs) && unicode.IsDigit(rs[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind, string(rs[start:i]), start, i})
+		case r == '\'' || r == '"':
+			var buf bytes.Buffer
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, fail(start, "unterminated string")
+				}
+				c := rs[i]
+				if c == r {
+					i++
+
+					break
+				}
+				if c == '\\' && i+1 < len(rs) {
+					i++
+					switch rs[i] {
+					case 'n':
+						buf.WriteRune('\n')
+					case 't':
+						buf.WriteRune('\t')
+					case 'r':
+						buf.WriteRune('\r')
+					default:
+						buf.WriteRune(rs[i])
+					}
+					i++
+
+					continue
+				}
+				buf.WriteRune(c)
+				i++
+			}
+			tokens = append(tokens, token{tokString, buf.String(), start, i})
+		case r == '`':
+			var buf bytes.Buffer
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, fail(start, "unterminated identifier")
+				}
+				if rs[i] == '`' {
+					// doubled backticks are an escaped backtick
+					if i+1 < len(rs) && rs[i+1] == '`' {
+						buf.WriteRune('`')
+						i += 2
+
+						continue
+					}
+					i++
+
+					break
+				}
+				buf.WriteRune(rs[i])
+				i++
+			}
+			tokens = append(tokens, token{tokQuoted, buf.String(), start, i})
+		default:
+			sym := ""
+			if i+1 < len(rs) {
+				two := string(rs[i : i+2])
+				for _, s := range twoCharSymbols {
+					if two == s {
+						sym = s
+					}
+				}
+			}
+			if sym == "" {
+				if !strings.ContainsRune("()[]{},:.|=<>+-*/%^;$", r) {
+					return nil, fail(i, "unexpected character %q", r)
+				}
+				sym = string(r)
+			}
+			i += len([]rune(sym))
+			tokens = append(tokens, token{tokSymbol, sym, start, i})
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(rs), end: len(rs)})
+
+	return tokens, nil
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package memory is a talon Driver that keeps the graph in memory, so code
+// that runs queries can be tested without Neo4j. It understands a practical
+// subset of Cypher:
+//   MATCH, OPTIONAL MATCH and WHERE
+//   CREATE, MERGE (with ON CREATE SET and ON MATCH SET)
+//   SET, REMOVE, DELETE and DETACH DELETE
+//   UNWIND
+//   WITH and RETURN, with DISTINCT, ORDER BY, SKIP and LIMIT
+// Patterns can use labels, relationship types and property maps but not
+// variable length relationships. Expressions support parameters (either
+// {name} or $name), the usual operators, common functions and the count,
+// collect, sum, avg, min and max aggregates.
+//
+// Queries run one at a time. Changes made in a transaction are visible to
+// other connections before it's committed, rolling back undoes them.
+package memory
+
+import (
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"time"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+var (
+	// ErrConnClosed is returned when using a connection that has been
+	// closed.
+	ErrConnClosed = errors.New("memory: connection has been closed")
+
+	// ErrTxOpen is returned when beginning a transaction on a connection that
+	// already has one open.
+	ErrTxOpen = errors.New("memory: connection already has an open transaction")
+
+	// ErrPipelineUnsupported is returned from the pipeline methods that
+	// return rows, which the memory driver doesn't support.
+	ErrPipelineUnsupported = errors.New("memory: pipelined queries can't return rows")
+)
+
+// Driver hands out connections to a graph held in memory, every connection
+// from the same driver sees the same graph.
+type Driver struct {
+	g *graph
+}
+
+// NewDriver creates a driver with an empty graph.
+//   db := talon.NewDB(memory.NewDriver())
+func NewDriver() *Driver {
+	return &Driver{g: newGraph()}
+}
+
+// Conn opens a new connection to the graph.
+func (d *Driver) Conn() (bolt.Conn, error) {
+	return &conn{g: d.g}, nil
+}
+
+// Reset removes every node and relationship from the graph.
+func (d *Driver) Reset() {
+	d.g.Lock()
+	defer d.g.Unlock()
+
+	d.g.nodes = make(map[int64]*node)
+	d.g.rels = make(map[int64]*rel)
+}
+
+type conn struct {
+	g      *graph
+	tx     *tx
+	closed bool
+}
+
+// run the query, returning the columns and rows it returns along with the
+// stats for it's changes. Any changes are undone if the query fails.
+func (c *conn) run(query string, params map[string]interface{}) ([]string, [][]interface{}, stats, error) {
+	if c.closed {
+		return nil, nil, stats{}, ErrConnClosed
+	}
+
+	stmt, err := parse(query)
+	if err != nil {
+		return nil, nil, stats{}, err
+	}
+
+	c.g.Lock()
+	defer c.g.Unlock()
+
+	j := c.g.journal()
+	fields, records, err := execute(j, stmt, normalizeParams(params))
+	if err != nil {
+		j.rollback()
+
+		return nil, nil, stats{}, err
+	}
+	if c.tx != nil {
+		c.tx.undo = append(c.tx.undo, j.undo...)
+	}
+
+	return fields, records, j.stats, nil
+}
+
+func (c *conn) ExecNeo(query string, params map[string]interface{}) (bolt.Result, error) {
+	fields, _, st, err := c.run(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return result{summary(fields, st)}, nil
+}
+
+func (c *conn) QueryNeo(query string, params map[string]interface{}) (bolt.Rows, error) {
+	fields, records, st, err := c.run(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRows(fields, records, st), nil
+}
+
+func (c *conn) QueryNeoAll(query string, params map[string]interface{}) ([][]interface{}, map[string]interface{}, map[string]interface{}, error) {
+	fields, records, st, err := c.run(query, params)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r := newRows(fields, records, st)
+
+	return records, r.Metadata(), r.summary, nil
+}
+
+func (c *conn) ExecPipeline(queries []string, params ...map[string]interface{}) ([]bolt.Result, error) {
+	results := make([]bolt.Result, len(queries))
+	for i, q := range queries {
+		var p map[string]interface{}
+		if i < len(params) {
+			p = params[i]
+		}
+		r, err := c.ExecNeo(q, p)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = r
+	}
+
+	return results, nil
+}
+
+func (c *conn) QueryPipeline([]string, ...map[string]interface{}) (bolt.PipelineRows, error) {
+	return nil, ErrPipelineUnsupported
+}
+
+func (c *conn) PrepareNeo(query string) (bolt.Stmt, error) {
+	return &stmt{c, query}, nil
+}
+
+func (c *conn) PreparePipeline(queries ...string) (bolt.PipelineStmt, error) {
+	return &pipelineStmt{c, queries}, nil
+}
+
+func (c *conn) Begin() (sqldriver.Tx, error) {
+	if c.closed {
+		return nil, ErrConnClosed
+	}
+	if c.tx != nil {
+		return nil, ErrTxOpen
+	}
+	c.tx = &tx{conn: c}
+
+	return c.tx, nil
+}
+
+// Close rolls back any open transaction.
+func (c *conn) Close() error {
+	if c.closed {
+		return nil
+	}
+	if c.tx != nil {
+		c.tx.Rollback()
+	}
+	c.closed = true
+
+	return nil
+}
+
+func (c *conn) SetChunkSize(uint16) {}
+
+func (c *conn) SetTimeout(time.Duration) {}
+
+type tx struct {
+	conn *conn
+	undo []func()
+}
+
+func (t *tx) Commit() error {
+	t.conn.tx = nil
+	t.undo = nil
+
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	g := t.conn.g
+	g.Lock()
+	defer g.Unlock()
+
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.conn.tx = nil
+	t.undo = nil
+
+	return nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) ExecNeo(params map[string]interface{}) (bolt.Result, error) {
+	return s.conn.ExecNeo(s.query, params)
+}
+
+func (s *stmt) QueryNeo(params map[string]interface{}) (bolt.Rows, error) {
+	return s.conn.QueryNeo(s.query, params)
+}
+
+type pipelineStmt struct {
+	conn    *conn
+	queries []string
+}
+
+func (s *pipelineStmt) Close() error {
+	return nil
+}
+
+func (s *pipelineStmt) ExecPipeline(params ...map[string]interface{}) ([]bolt.Result, error) {
+	return s.conn.ExecPipeline(s.queries, params...)
+}
+
+func (s *pipelineStmt) QueryPipeline(...map[string]interface{}) (bolt.PipelineRows, error) {
+	return nil, ErrPipelineUnsupported
+}
+
+// the metadata bolt sends once a query has finished
+func summary(fields []string, st stats) map[string]interface{} {
+	typ := "r"
+	switch {
+	case st.writes() && fields != nil:
+		typ = "rw"
+	case st.writes():
+		typ = "w"
+	}
+
+	return map[string]interface{}{
+		"type":  typ,
+		"stats": st.metadata(),
+	}
+}
+
+type result struct {
+	metadata map[string]interface{}
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return -1, errors.New("memory: LastInsertId is not supported")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return -1, errors.New("memory: RowsAffected is not supported")
+}
+
+func (r result) Metadata() map[string]interface{} {
+	return r.metadata
+}
+
+type rows struct {
+	fields  []string
+	records [][]interface{}
+	summary map[string]interface{}
+	pos     int
+	closed  bool
+}
+
+func newRows(fields []string, records [][]interface{}, st stats) *rows {
+	r := &rows{
+		fields:  fields,
+		records: records,
+		summary: summary(fields, st),
+	}
+	if r.fields == nil {
+		r.fields = []string{}
+	}
+
+	return r
+}
+
+func (r *rows) Columns() []string {
+	return r.fields
+}
+
+func (r *rows) Metadata() map[string]interface{} {
+	fields := make([]interface{}, len(r.fields))
+	for i, f := range r.fields {
+		fields[i] = f
+	}
+
+	return map[string]interface{}{"fields": fields}
+}
+
+func (r *rows) Close() error {
+	r.closed = true
+
+	return nil
+}
+
+func (r *rows) NextNeo() ([]interface{}, map[string]interface{}, error) {
+	if r.closed || r.pos >= len(r.records) {
+		return nil, r.summary, io.EOF
+	}
+	record := r.records[r.pos]
+	r.pos++
+
+	return record, nil, nil
+}
+
+func (r *rows) All() ([][]interface{}, map[string]interface{}, error) {
+	if r.closed {
+		return nil, r.summary, nil
+	}
+	all := r.records[r.pos:]
+	r.pos = len(r.records)
+
+	return all, r.summary, nil
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory_test
+
+import (
+	"github.com/bbuck/dragon-mud/talon"
+	. "github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type player struct {
+	Name  string `talon:"name"`
+	Level int    `talon:"level"`
+}
+
+var _ = Describe("Driver", func() {
+	var (
+		driver *Driver
+		db     *talon.DB
+	)
+
+	BeforeEach(func() {
+		driver = NewDriver()
+		db = talon.NewDB(driver)
+	})
+
+	// run the query returning every value in the first column
+	column := func(cypher string, props talon.Properties) []interface{} {
+		q, err := db.CypherP(cypher, props)
+		Ω(err).Should(BeNil())
+		rows, err := q.Query()
+		Ω(err).Should(BeNil())
+		all, err := rows.All()
+		Ω(err).Should(BeNil())
+
+		values := []interface{}{}
+		for _, row := range all {
+			val, _ := row.GetIndex(0)
+			values = append(values, val)
+		}
+
+		return values
+	}
+
+	exec := func(cypher string, props talon.Properties) (*talon.Result, error) {
+		q, err := db.CypherP(cypher, props)
+		Ω(err).Should(BeNil())
+
+		return q.Exec()
+	}
+
+	mustExec := func(cypher string) *talon.Result {
+		result, err := exec(cypher, nil)
+		Ω(err).Should(BeNil())
+
+		return result
+	}
+
+	It("can be pinged", func() {
+		Ω(db.Ping()).Should(BeNil())
+	})
+
+	Describe("CREATE and MATCH", func() {
+		BeforeEach(func() {
+			result := mustExec(`
+				CREATE (b:Player:Admin {name: "bob", level: 3}),
+				       (a:Player {name: 'alice', level: 5}),
+				       (r:Room {name: "hall"}),
+				       (b)-[:IN {since: 1}]->(r),
+				       (a)-[:IN]->(r),
+				       (a)-[:FRIEND]->(b)
+			`)
+			Ω(result.Stats.NodesCreated).Should(Equal(int64(3)))
+			Ω(result.Stats.RelationshipsCreated).Should(Equal(int64(3)))
+			Ω(result.Stats.LabelsAdded).Should(Equal(int64(4)))
+			Ω(result.Stats.PropertiesSet).Should(Equal(int64(6)))
+		})
+
+		It("returns nodes with their labels and properties", func() {
+			nodes := column("MATCH (n:Player {name: 'bob'}) RETURN n", nil)
+			Ω(nodes).Should(HaveLen(1))
+
+			n := nodes[0].(*talon.Node)
+			Ω(n.Labels).Should(Equal([]string{"Player", "Admin"}))
+			Ω(n.Properties).Should(Equal(talon.Properties{"name": "bob", "level": int64(3)}))
+		})
+
+		It("filters with WHERE and parameters", func() {
+			names := column("MATCH (n:Player) WHERE n.level > {level} RETURN n.name", talon.Properties{"level": 4})
+			Ω(names).Should(Equal([]interface{}{"alice"}))
+
+			names = column("MATCH (n) WHERE n:Admin OR n.name STARTS WITH $prefix RETURN n.name ORDER BY n.name", talon.Properties{"prefix": "h"})
+			Ω(names).Should(Equal([]interface{}{"bob", "hall"}))
+		})
+
+		It("follows relationships in the direction given", func() {
+			Ω(column("MATCH (:Player {name: 'alice'})-[:FRIEND]->(f) RETURN f.name", nil)).Should(Equal([]interface{}{"bob"}))
+			Ω(column("MATCH (:Player {name: 'alice'})<-[:FRIEND]-(f) RETURN f.name", nil)).Should(BeEmpty())
+			Ω(column("MATCH (:Player {name: 'bob'})-[:FRIEND]-(f) RETURN f.name", nil)).Should(Equal([]interface{}{"alice"}))
+			Ω(column("MATCH (p)-[:IN|FRIEND]->(:Room) RETURN p.name ORDER BY p.name DESC", nil)).Should(Equal([]interface{}{"bob", "alice"}))
+		})
+
+		It("returns relationships", func() {
+			rels := column("MATCH (:Player {name: 'bob'})-[r]->() RETURN r", nil)
+			Ω(rels).Should(HaveLen(1))
+
+			r := rels[0].(*talon.Relationship)
+			Ω(r.Name).Should(Equal("IN"))
+			Ω(r.Properties).Should(Equal(talon.Properties{"since": int64(1)}))
+		})
+
+		It("returns paths", func() {
+			paths := column("MATCH p = (:Player {name: 'alice'})-[:FRIEND]->()-[:IN]->() RETURN p", nil)
+			Ω(paths).Should(HaveLen(1))
+
+			p := paths[0].(talon.Path)
+			Ω(p).Should(HaveLen(5))
+			Ω(p[0].(*talon.Node).Get("name")).Should(Equal("alice"))
+			Ω(p[1].(*talon.Relationship).Name).Should(Equal("FRIEND"))
+			Ω(p[4].(*talon.Node).Get("name")).Should(Equal("hall"))
+		})
+
+		It("joins patterns sharing variables", func() {
+			names := column("MATCH (a:Player)-[:IN]->(r), (b:Player)-[:IN]->(r) WHERE a.name < b.name RETURN a.name + ' & ' + b.name", nil)
+			Ω(names).Should(Equal([]interface{}{"alice & bob"}))
+		})
+
+		It("returns nulls for optional matches that don't match", func() {
+			rows, err := db.Cypher("MATCH (n:Room) OPTIONAL MATCH (n)-[r:FRIEND]->(m) RETURN n.name, r, m").Query()
+			Ω(err).Should(BeNil())
+			all, err := rows.All()
+			Ω(err).Should(BeNil())
+			Ω(all).Should(HaveLen(1))
+			r, _ := all[0].GetColumn("r")
+			Ω(r).Should(BeNil())
+		})
+
+		It("builds queries with the talon builder", func() {
+			rows, err := db.
+				Match(talon.N("p", "Player").Where(talon.Gte("level", 3))).
+				Return("p").
+				OrderBy("p.level DESC").
+				Limit(1).
+				Query()
+			Ω(err).Should(BeNil())
+
+			var players []player
+			Ω(rows.Scan(&players)).Should(BeNil())
+			Ω(players).Should(Equal([]player{{"alice", 5}}))
+		})
+
+		It("matches lists given to In", func() {
+			rows, err := db.
+				Match(talon.N("p", "Player").Where(talon.In("name", []string{"alice", "carol"}))).
+				Return("p").
+				Query()
+			Ω(err).Should(BeNil())
+
+			var players []player
+			Ω(rows.Scan(&players)).Should(BeNil())
+			Ω(players).Should(Equal([]player{{"alice", 5}}))
+		})
+
+		It("aggregates", func() {
+			counts := column("MATCH (p:Player)-[:IN]->(r:Room) RETURN {room: r.name, players: count(p), names: collect(p.name)}", nil)
+			Ω(counts).Should(HaveLen(1))
+			Ω(counts[0]).Should(Equal(map[string]interface{}{
+				"room":    "hall",
+				"players": int64(2),
+				"names":   []interface{}{"bob", "alice"},
+			}))
+
+			Ω(column("MATCH (p:Player) RETURN sum(p.level)", nil)).Should(Equal([]interface{}{int64(8)}))
+			Ω(column("MATCH (p:Player) RETURN avg(p.level)", nil)).Should(Equal([]interface{}{4.0}))
+			Ω(column("MATCH (p:Missing) RETURN count(*)", nil)).Should(Equal([]interface{}{int64(0)}))
+		})
+
+		It("supports DISTINCT, SKIP and LIMIT", func() {
+			Ω(column("MATCH (p:Player)-->(r) RETURN DISTINCT labels(r)", nil)).Should(HaveLen(2))
+			Ω(column("MATCH (n) RETURN n.name ORDER BY n.name SKIP 1 LIMIT {limit}", talon.Properties{"limit": 1})).Should(Equal([]interface{}{"bob"}))
+		})
+
+		It("passes rows along with WITH", func() {
+			names := column(`
+				MATCH (p:Player)-[:IN]->(r)
+				WITH r, count(p) AS players
+				WHERE players > 1
+				RETURN r.name
+			`, nil)
+			Ω(names).Should(Equal([]interface{}{"hall"}))
+		})
+	})
+
+	It("produces a row for each item with UNWIND", func() {
+		result, err := db.Batch("CREATE (:Room {name: row.name})", []talon.Properties{
+			{"name": "hall"},
+			{"name": "kitchen"},
+		})
+		Ω(err).Should(BeNil())
+		Ω(result.Stats.NodesCreated).Should(Equal(int64(2)))
+
+		Ω(column("UNWIND [3, 1, 2] AS n RETURN n ORDER BY n", nil)).Should(Equal([]interface{}{int64(1), int64(2), int64(3)}))
+		Ω(column("UNWIND null AS n RETURN n", nil)).Should(BeEmpty())
+	})
+
+	Describe("MERGE", func() {
+		It("only creates patterns that don't exist", func() {
+			query := `
+				MERGE (n:Item {name: {name}})
+				ON CREATE SET n.created = true
+				ON MATCH SET n.matched = true
+			`
+			result, err := exec(query, talon.Properties{"name": "sword"})
+			Ω(err).Should(BeNil())
+			Ω(result.Stats.NodesCreated).Should(Equal(int64(1)))
+			result, err = exec(query, talon.Properties{"name": "sword"})
+			Ω(err).Should(BeNil())
+			Ω(result.Stats.NodesCreated).Should(BeZero())
+
+			items := column("MATCH (n:Item) RETURN n", nil)
+			Ω(items).Should(HaveLen(1))
+			Ω(items[0].(*talon.Node).Properties).Should(Equal(talon.Properties{
+				"name":    "sword",
+				"created": true,
+				"matched": true,
+			}))
+		})
+
+		It("merges relationships between existing nodes", func() {
+			mustExec("CREATE (:A), (:B)")
+			for i := 0; i < 2; i++ {
+				mustExec("MATCH (a:A), (b:B) MERGE (a)-[:LINK]->(b)")
+			}
+
+			Ω(column("MATCH (:A)-[r:LINK]->(:B) RETURN r", nil)).Should(HaveLen(1))
+		})
+	})
+
+	Describe("SET and REMOVE", func() {
+		BeforeEach(func() {
+			mustExec("CREATE (:Player {name: 'bob', level: 1, tags: ['new']})")
+		})
+
+		get := func() *talon.Node {
+			nodes := column("MATCH (n:Player) RETURN n", nil)
+			Ω(nodes).Should(HaveLen(1))
+
+			return nodes[0].(*talon.Node)
+		}
+
+		It("sets properties and labels", func() {
+			result := mustExec("MATCH (n:Player) SET n.level = n.level + 1, n:Admin, n += {title: 'sir'}")
+			Ω(result.Stats.PropertiesSet).Should(Equal(int64(2)))
+			Ω(result.Stats.LabelsAdded).Should(Equal(int64(1)))
+
+			n := get()
+			Ω(n.Labels).Should(ConsistOf("Player", "Admin"))
+			Ω(n.Properties).Should(Equal(talon.Properties{
+				"name":  "bob",
+				"level": int64(2),
+				"tags":  []interface{}{"new"},
+				"title": "sir",
+			}))
+		})
+
+		It("replaces properties", func() {
+			mustExec("MATCH (n:Player) SET n = {name: 'robert'}")
+			Ω(get().Properties).Should(Equal(talon.Properties{"name": "robert"}))
+		})
+
+		It("removes properties and labels", func() {
+			mustExec("MATCH (n:Player) SET n.level = null REMOVE n.tags, n:Player SET n:Former")
+			nodes := column("MATCH (n:Former) RETURN n", nil)
+			Ω(nodes).Should(HaveLen(1))
+			Ω(nodes[0].(*talon.Node).Properties).Should(Equal(talon.Properties{"name": "bob"}))
+		})
+
+		It("only stores primitive values", func() {
+			_, err := exec("MATCH (n:Player) SET n.stats = {stats}", talon.Properties{
+				"stats": talon.Properties{"str": 10},
+			})
+			// talon sends the properties as a JSON string
+			Ω(err).Should(BeNil())
+
+			_, err = exec("MATCH (n:Player) SET n.stats = {str: 10}", nil)
+			Ω(err).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("DELETE", func() {
+		BeforeEach(func() {
+			mustExec("CREATE (a:Player {name: 'bob'})-[:IN]->(:Room), (:Player {name: 'alice'})")
+		})
+
+		It("won't delete nodes with relationships", func() {
+			_, err := exec("MATCH (n:Room) DELETE n", nil)
+			Ω(err).ShouldNot(BeNil())
+			Ω(column("MATCH (n:Room) RETURN n", nil)).Should(HaveLen(1))
+		})
+
+		It("deletes nodes along with their relationships", func() {
+			result := mustExec("MATCH (n:Room)<-[r]-(p) DELETE n, r")
+			Ω(result.Stats.NodesDeleted).Should(Equal(int64(1)))
+			Ω(result.Stats.RelationshipsDeleted).Should(Equal(int64(1)))
+
+			result = mustExec("MATCH (n:Player) DETACH DELETE n")
+			Ω(result.Stats.NodesDeleted).Should(Equal(int64(2)))
+			Ω(column("MATCH (n) RETURN count(n)", nil)).Should(Equal([]interface{}{int64(0)}))
+		})
+
+		It("ignores nulls", func() {
+			mustExec("MATCH (n:Player) OPTIONAL MATCH (n)-[r]->() DELETE r, n")
+			Ω(column("MATCH (n) RETURN n", nil)).Should(HaveLen(1))
+		})
+	})
+
+	It("undoes the changes of queries that fail", func() {
+		_, err := exec("CREATE (n:Temp) WITH n RETURN n, 1 / 0", nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(column("MATCH (n:Temp) RETURN n", nil)).Should(BeEmpty())
+	})
+
+	It("reports queries it can't parse", func() {
+		_, err := exec("MATCH (n RETURN n", nil)
+		Ω(err).Should(BeAssignableToTypeOf(&SyntaxError{}))
+
+		_, err = exec("MATCH (n)-[*1..3]->(m) RETURN n", nil)
+		Ω(err).Should(BeAssignableToTypeOf(&SyntaxError{}))
+	})
+
+	It("reports missing parameters", func() {
+		_, err := exec("MATCH (n {name: {name}}) RETURN n", nil)
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	Describe("transactions", func() {
+		It("keeps changes that are committed", func() {
+			tx, err := db.Begin()
+			Ω(err).Should(BeNil())
+			_, err = tx.Create(talon.N("n", "Test")).Exec()
+			Ω(err).Should(BeNil())
+			Ω(tx.Commit()).Should(BeNil())
+
+			Ω(column("MATCH (n:Test) RETURN n", nil)).Should(HaveLen(1))
+		})
+
+		It("undoes changes that are rolled back", func() {
+			mustExec("CREATE (:Test {name: 'kept'})")
+
+			tx, err := db.Begin()
+			Ω(err).Should(BeNil())
+			_, err = tx.Cypher("MATCH (n:Test) SET n.name = 'changed' CREATE (:Test)").Exec()
+			Ω(err).Should(BeNil())
+			_, err = tx.Cypher("MATCH (n:Test) DETACH DELETE n").Exec()
+			Ω(err).Should(BeNil())
+			Ω(tx.Rollback()).Should(BeNil())
+
+			Ω(column("MATCH (n:Test) RETURN n.name", nil)).Should(Equal([]interface{}{"kept"}))
+		})
+	})
+
+	It("can be reset", func() {
+		mustExec("CREATE (:Test)")
+		driver.Reset()
+		Ω(column("MATCH (n) RETURN n", nil)).Should(BeEmpty())
+	})
+})
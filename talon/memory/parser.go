@@ -0,0 +1,837 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expressions
+
+type expr interface{}
+
+type literal struct {
+	val interface{}
+}
+
+type param struct {
+	name string
+}
+
+type variable struct {
+	name string
+}
+
+type property struct {
+	subject expr
+	key     string
+}
+
+type index struct {
+	subject expr
+	index   expr
+}
+
+type listExpr struct {
+	items []expr
+}
+
+type mapExpr struct {
+	keys []string
+	vals []expr
+}
+
+type call struct {
+	name     string
+	distinct bool
+	star     bool
+	args     []expr
+}
+
+type binary struct {
+	op          string
+	left, right expr
+}
+
+type unary struct {
+	op      string
+	operand expr
+}
+
+type isNull struct {
+	operand expr
+	not     bool
+}
+
+type labelCheck struct {
+	subject expr
+	labels  []string
+}
+
+// patterns
+
+type direction int
+
+const (
+	either direction = iota
+	outgoing
+	incoming
+)
+
+type nodePattern struct {
+	name   string
+	labels []string
+	props  expr
+}
+
+type relPattern struct {
+	name  string
+	types []string
+	props expr
+	dir   direction
+}
+
+// a path is a chain of nodes joined by relationships, rels[i] connects
+// nodes[i] and nodes[i+1]
+type pathPattern struct {
+	name  string
+	nodes []*nodePattern
+	rels  []*relPattern
+}
+
+// clauses
+
+type clause interface{}
+
+type matchClause struct {
+	optional bool
+	patterns []*pathPattern
+	where    expr
+}
+
+type createClause struct {
+	patterns []*pathPattern
+}
+
+type mergeClause struct {
+	pattern  *pathPattern
+	onCreate []setItem
+	onMatch  []setItem
+}
+
+type setKind int
+
+const (
+	setProperty setKind = iota
+	setReplace
+	setMerge
+	setLabels
+)
+
+type setItem struct {
+	kind   setKind
+	name   string
+	key    string
+	value  expr
+	labels []string
+}
+
+type setClause struct {
+	items []setItem
+}
+
+type removeClause struct {
+	items []setItem
+}
+
+type deleteClause struct {
+	detach bool
+	exprs  []expr
+}
+
+type projectionItem struct {
+	expr  expr
+	alias string
+}
+
+type sortItem struct {
+	expr expr
+	desc bool
+}
+
+type projection struct {
+	distinct bool
+	star     bool
+	items    []projectionItem
+	order    []sortItem
+	skip     expr
+	limit    expr
+	where    expr
+}
+
+type unwindClause struct {
+	list expr
+	name string
+}
+
+type withClause struct {
+	projection
+}
+
+type returnClause struct {
+	projection
+}
+
+type parser struct {
+	query  string
+	runes  []rune
+	tokens []token
+	pos    int
+	params []string
+}
+
+// statement is a parsed query along with the names of the parameters it uses
+type statement struct {
+	clauses []clause
+	params  []string
+}
+
+// parse the query into it's clauses
+func parse(query string) (*statement, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		query:  query,
+		runes:  []rune(query),
+		tokens: tokens,
+	}
+
+	var clauses []clause
+	err = p.guard(func() {
+		for p.peek().kind != tokEOF {
+			if p.accept(";") {
+				if p.peek().kind != tokEOF {
+					p.fail(p.peek(), "only one statement can be run at a time")
+				}
+
+				break
+			}
+			clauses = append(clauses, p.clause())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 0 {
+		return nil, &SyntaxError{Query: query, Msg: "empty query"}
+	}
+
+	return &statement{clauses, p.params}, nil
+}
+
+// run fn turning any syntax errors raised into errors
+func (p *parser) guard(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			se, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = se
+		}
+	}()
+	fn()
+
+	return nil
+}
+
+func (p *parser) fail(t token, format string, args ...interface{}) {
+	panic(&SyntaxError{
+		Query:  p.query,
+		Offset: t.pos,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// consume the symbol if it's next
+func (p *parser) accept(sym string) bool {
+	if p.peek().is(sym) {
+		p.pos++
+
+		return true
+	}
+
+	return false
+}
+
+// consume the keywords if they're next
+func (p *parser) acceptKeyword(kws ...string) bool {
+	for i, kw := range kws {
+		if !p.peekAt(i).keyword(kw) {
+			return false
+		}
+	}
+	p.pos += len(kws)
+
+	return true
+}
+
+func (p *parser) expect(sym string) token {
+	t := p.next()
+	if !t.is(sym) {
+		p.fail(t, "expected %q but found %s", sym, describe(t))
+	}
+
+	return t
+}
+
+// a name, which may be quoted
+func (p *parser) name() string {
+	t := p.next()
+	if t.kind != tokIdent && t.kind != tokQuoted {
+		p.fail(t, "expected a name but found %s", describe(t))
+	}
+
+	return t.text
+}
+
+func describe(t token) string {
+	if t.kind == tokEOF {
+		return "the end of the query"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+func (p *parser) clause() clause {
+	t := p.peek()
+	switch {
+	case p.acceptKeyword("MATCH"):
+		return p.match(false)
+	case p.acceptKeyword("OPTIONAL", "MATCH"):
+		return p.match(true)
+	case p.acceptKeyword("CREATE"):
+		return &createClause{patterns: p.patterns()}
+	case p.acceptKeyword("MERGE"):
+		return p.merge()
+	case p.acceptKeyword("SET"):
+		return &setClause{items: p.setItems()}
+	case p.acceptKeyword("REMOVE"):
+		return &removeClause{items: p.removeItems()}
+	case p.acceptKeyword("DETACH", "DELETE"):
+		return &deleteClause{detach: true, exprs: p.exprList()}
+	case p.acceptKeyword("DELETE"):
+		return &deleteClause{exprs: p.exprList()}
+	case p.acceptKeyword("UNWIND"):
+		uc := &unwindClause{list: p.expr()}
+		if !p.acceptKeyword("AS") {
+			p.fail(p.peek(), "expected AS but found %s", describe(p.peek()))
+		}
+		uc.name = p.name()
+
+		return uc
+	case p.acceptKeyword("WITH"):
+		return &withClause{p.projection(true)}
+	case p.acceptKeyword("RETURN"):
+		return &returnClause{p.projection(false)}
+	}
+
+	p.fail(t, "unsupported clause %s", describe(t))
+
+	return nil
+}
+
+func (p *parser) match(optional bool) clause {
+	mc := &matchClause{
+		optional: optional,
+		patterns: p.patterns(),
+	}
+	if p.acceptKeyword("WHERE") {
+		mc.where = p.expr()
+	}
+
+	return mc
+}
+
+func (p *parser) merge() clause {
+	mc := &mergeClause{pattern: p.path()}
+	for {
+		switch {
+		case p.acceptKeyword("ON", "CREATE", "SET"):
+			mc.onCreate = append(mc.onCreate, p.setItems()...)
+		case p.acceptKeyword("ON", "MATCH", "SET"):
+			mc.onMatch = append(mc.onMatch, p.setItems()...)
+		default:
+			return mc
+		}
+	}
+}
+
+func (p *parser) setItems() []setItem {
+	var items []setItem
+	for {
+		name := p.name()
+		item := setItem{name: name}
+		switch {
+		case p.accept("."):
+			item.kind = setProperty
+			item.key = p.name()
+			p.expect("=")
+			item.value = p.expr()
+		case p.accept("="):
+			item.kind = setReplace
+			item.value = p.expr()
+		case p.accept("+="):
+			item.kind = setMerge
+			item.value = p.expr()
+		case p.peek().is(":"):
+			item.kind = setLabels
+			item.labels = p.labels()
+		default:
+			p.fail(p.peek(), "expected a property or label to set but found %s", describe(p.peek()))
+		}
+		items = append(items, item)
+
+		if !p.accept(",") {
+			return items
+		}
+	}
+}
+
+func (p *parser) removeItems() []setItem {
+	var items []setItem
+	for {
+		item := setItem{name: p.name()}
+		if p.accept(".") {
+			item.kind = setProperty
+			item.key = p.name()
+		} else {
+			item.kind = setLabels
+			item.labels = p.labels()
+		}
+		items = append(items, item)
+
+		if !p.accept(",") {
+			return items
+		}
+	}
+}
+
+func (p *parser) projection(with bool) projection {
+	var proj projection
+	proj.distinct = p.acceptKeyword("DISTINCT")
+	proj.star = p.accept("*")
+	if !proj.star || p.accept(",") {
+		for {
+			start := p.peek()
+			item := projectionItem{expr: p.expr()}
+			if p.acceptKeyword("AS") {
+				item.alias = p.name()
+			} else if v, ok := item.expr.(*variable); ok {
+				item.alias = v.name
+			} else {
+				item.alias = p.text(start, p.tokens[p.pos-1])
+			}
+			proj.items = append(proj.items, item)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			item := sortItem{expr: p.expr()}
+			if p.acceptKeyword("DESC") || p.acceptKeyword("DESCENDING") {
+				item.desc = true
+			} else if !p.acceptKeyword("ASC") {
+				p.acceptKeyword("ASCENDING")
+			}
+			proj.order = append(proj.order, item)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("SKIP") {
+		proj.skip = p.expr()
+	}
+	if p.acceptKeyword("LIMIT") {
+		proj.limit = p.expr()
+	}
+	if with && p.acceptKeyword("WHERE") {
+		proj.where = p.expr()
+	}
+
+	return proj
+}
+
+// the text of the query from the start of one token to the end of another
+func (p *parser) text(from, to token) string {
+	return string(p.runes[from.pos:to.end])
+}
+
+func (p *parser) patterns() []*pathPattern {
+	paths := []*pathPattern{p.path()}
+	for p.accept(",") {
+		paths = append(paths, p.path())
+	}
+
+	return paths
+}
+
+func (p *parser) path() *pathPattern {
+	path := new(pathPattern)
+	if (p.peek().kind == tokIdent || p.peek().kind == tokQuoted) && p.peekAt(1).is("=") {
+		path.name = p.name()
+		p.expect("=")
+	}
+
+	path.nodes = append(path.nodes, p.node())
+	for p.peek().is("-") || p.peek().is("<") {
+		path.rels = append(path.rels, p.rel())
+		path.nodes = append(path.nodes, p.node())
+	}
+
+	return path
+}
+
+func (p *parser) node() *nodePattern {
+	p.expect("(")
+	n := new(nodePattern)
+	if t := p.peek(); t.kind == tokIdent || t.kind == tokQuoted {
+		n.name = p.name()
+	}
+	if p.peek().is(":") {
+		n.labels = p.labels()
+	}
+	if p.peek().is("{") || p.peek().is("$") {
+		n.props = p.atom()
+	}
+	p.expect(")")
+
+	return n
+}
+
+func (p *parser) rel() *relPattern {
+	r := new(relPattern)
+	left := p.accept("<")
+	p.expect("-")
+	if p.accept("[") {
+		if t := p.peek(); t.kind == tokIdent || t.kind == tokQuoted {
+			r.name = p.name()
+		}
+		if p.accept(":") {
+			r.types = append(r.types, p.name())
+			for p.accept("|") {
+				p.accept(":")
+				r.types = append(r.types, p.name())
+			}
+		}
+		if p.peek().is("*") {
+			p.fail(p.peek(), "variable length relationships are not supported")
+		}
+		if p.peek().is("{") || p.peek().is("$") {
+			r.props = p.atom()
+		}
+		p.expect("]")
+	}
+	p.expect("-")
+	right := p.accept(">")
+
+	switch {
+	case left && right:
+		p.fail(p.peek(), "a relationship can't point both ways")
+	case left:
+		r.dir = incoming
+	case right:
+		r.dir = outgoing
+	default:
+		r.dir = either
+	}
+
+	return r
+}
+
+func (p *parser) labels() []string {
+	var labels []string
+	for p.accept(":") {
+		labels = append(labels, p.name())
+	}
+
+	return labels
+}
+
+func (p *parser) exprList() []expr {
+	exprs := []expr{p.expr()}
+	for p.accept(",") {
+		exprs = append(exprs, p.expr())
+	}
+
+	return exprs
+}
+
+// expressions, from lowest to highest precedence
+
+func (p *parser) expr() expr {
+	return p.or()
+}
+
+func (p *parser) or() expr {
+	e := p.xor()
+	for p.acceptKeyword("OR") {
+		e = &binary{"OR", e, p.xor()}
+	}
+
+	return e
+}
+
+func (p *parser) xor() expr {
+	e := p.and()
+	for p.acceptKeyword("XOR") {
+		e = &binary{"XOR", e, p.and()}
+	}
+
+	return e
+}
+
+func (p *parser) and() expr {
+	e := p.not()
+	for p.acceptKeyword("AND") {
+		e = &binary{"AND", e, p.not()}
+	}
+
+	return e
+}
+
+func (p *parser) not() expr {
+	if p.acceptKeyword("NOT") {
+		return &unary{"NOT", p.not()}
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() expr {
+	e := p.additive()
+	for {
+		t := p.peek()
+		switch {
+		case t.is("=") || t.is("<>") || t.is("<") || t.is("<=") || t.is(">") || t.is(">="):
+			p.next()
+			e = &binary{t.text, e, p.additive()}
+		case p.acceptKeyword("IN"):
+			e = &binary{"IN", e, p.additive()}
+		case p.acceptKeyword("CONTAINS"):
+			e = &binary{"CONTAINS", e, p.additive()}
+		case p.acceptKeyword("STARTS", "WITH"):
+			e = &binary{"STARTS WITH", e, p.additive()}
+		case p.acceptKeyword("ENDS", "WITH"):
+			e = &binary{"ENDS WITH", e, p.additive()}
+		case p.acceptKeyword("IS", "NOT", "NULL"):
+			e = &isNull{e, true}
+		case p.acceptKeyword("IS", "NULL"):
+			e = &isNull{e, false}
+		default:
+			return e
+		}
+	}
+}
+
+func (p *parser) additive() expr {
+	e := p.multiplicative()
+	for {
+		t := p.peek()
+		if !t.is("+") && !t.is("-") {
+			return e
+		}
+		p.next()
+		e = &binary{t.text, e, p.multiplicative()}
+	}
+}
+
+func (p *parser) multiplicative() expr {
+	e := p.power()
+	for {
+		t := p.peek()
+		if !t.is("*") && !t.is("/") && !t.is("%") {
+			return e
+		}
+		p.next()
+		e = &binary{t.text, e, p.power()}
+	}
+}
+
+func (p *parser) power() expr {
+	e := p.unary()
+	if p.accept("^") {
+		return &binary{"^", e, p.power()}
+	}
+
+	return e
+}
+
+func (p *parser) unary() expr {
+	if p.accept("-") {
+		return &unary{"-", p.unary()}
+	}
+	p.accept("+")
+
+	return p.postfix()
+}
+
+func (p *parser) postfix() expr {
+	e := p.atom()
+	for {
+		switch {
+		case p.accept("."):
+			e = &property{e, p.name()}
+		case p.peek().is("[") && !p.peekAt(1).is("]"):
+			p.next()
+			e = &index{e, p.expr()}
+			p.expect("]")
+		case p.peek().is(":") && isVariable(e):
+			e = &labelCheck{e, p.labels()}
+		default:
+			return e
+		}
+	}
+}
+
+func isVariable(e expr) bool {
+	_, ok := e.(*variable)
+
+	return ok
+}
+
+func (p *parser) atom() expr {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return &literal{t.text}
+	case tokInt:
+		i, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			p.fail(t, "invalid integer %s", t.text)
+		}
+
+		return &literal{i}
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.fail(t, "invalid number %s", t.text)
+		}
+
+		return &literal{f}
+	case tokQuoted:
+		return &variable{t.text}
+	case tokIdent:
+		switch {
+		case t.keyword("true"):
+			return &literal{true}
+		case t.keyword("false"):
+			return &literal{false}
+		case t.keyword("null"):
+			return &literal{nil}
+		case p.peek().is("("):
+			return p.call(t)
+		}
+
+		return &variable{t.text}
+	}
+
+	switch {
+	case t.is("("):
+		e := p.expr()
+		p.expect(")")
+
+		return e
+	case t.is("["):
+		l := new(listExpr)
+		if !p.accept("]") {
+			l.items = p.exprList()
+			p.expect("]")
+		}
+
+		return l
+	case t.is("$"):
+		next := p.next()
+		if next.kind != tokIdent && next.kind != tokInt && next.kind != tokQuoted {
+			p.fail(next, "expected a parameter name but found %s", describe(next))
+		}
+
+		p.params = append(p.params, next.text)
+
+		return &param{next.text}
+	case t.is("{"):
+		// {name} is a parameter, anything else is a map
+		if n := p.peek(); (n.kind == tokIdent || n.kind == tokQuoted || n.kind == tokInt) && p.peekAt(1).is("}") {
+			p.next()
+			p.next()
+			p.params = append(p.params, n.text)
+
+			return &param{n.text}
+		}
+
+		m := new(mapExpr)
+		for !p.accept("}") {
+			if len(m.keys) > 0 {
+				p.expect(",")
+			}
+			m.keys = append(m.keys, p.name())
+			p.expect(":")
+			m.vals = append(m.vals, p.expr())
+		}
+
+		return m
+	}
+
+	p.fail(t, "unexpected %s", describe(t))
+
+	return nil
+}
+
+func (p *parser) call(name token) expr {
+	p.expect("(")
+	c := &call{name: strings.ToLower(name.text)}
+	if p.accept("*") {
+		c.star = true
+		p.expect(")")
+
+		return c
+	}
+	c.distinct = p.acceptKeyword("DISTINCT")
+	if !p.accept(")") {
+		c.args = p.exprList()
+		p.expect(")")
+	}
+
+	return c
+}
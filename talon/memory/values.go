@@ -0,0 +1,428 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	boltGraph "github.com/johnnadratowski/golang-neo4j-bolt-driver/structures/graph"
+)
+
+// convert values given as parameters into the types queries work with,
+// integers become int64, other numbers float64, lists []interface{} and maps
+// map[string]interface{}.
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil, bool, int64, float64, string:
+		return v
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = normalize(rv.Index(i).Interface())
+		}
+
+		return list
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = normalize(rv.MapIndex(k).Interface())
+		}
+
+		return m
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+
+		return normalize(rv.Elem().Interface())
+	}
+
+	return val
+}
+
+func normalizeParams(params map[string]interface{}) map[string]interface{} {
+	np := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		np[k] = normalize(v)
+	}
+
+	return np
+}
+
+// check the value can be stored as a property, only primitives and lists of
+// primitives can be.
+func checkProperty(key string, val interface{}) error {
+	switch v := val.(type) {
+	case nil, bool, int64, float64, string:
+		return nil
+	case []interface{}:
+		for _, item := range v {
+			switch item.(type) {
+			case bool, int64, float64, string:
+			default:
+				return fmt.Errorf("memory: property %q can't hold a list containing %s", key, typeName(item))
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("memory: property %q can't hold %s", key, typeName(val))
+}
+
+func typeName(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a float"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a map"
+	case *node:
+		return "a node"
+	case *rel:
+		return "a relationship"
+	case *path:
+		return "a path"
+	}
+
+	return fmt.Sprintf("%T", val)
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+// equal implements Cypher equality, the result is nil when either side is
+// null.
+func equal(a, b interface{}) interface{} {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+
+		return ok && af == bf
+	}
+
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		var result interface{} = true
+		for i := range av {
+			switch equal(av[i], bv[i]) {
+			case false:
+				return false
+			case nil:
+				result = nil
+			}
+		}
+
+		return result
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		var result interface{} = true
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok {
+				return false
+			}
+			switch equal(v, other) {
+			case false:
+				return false
+			case nil:
+				result = nil
+			}
+		}
+
+		return result
+	case *path:
+		bv, ok := b.(*path)
+
+		return ok && key(av) == key(bv)
+	}
+
+	return a == b
+}
+
+// compare orders two values of the same type, ok is false if they can't be
+// compared.
+func compare(a, b interface{}) (c int, ok bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok || math.IsNaN(af) || math.IsNaN(bf) {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+
+		return 0, true
+	}
+
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		}
+
+		return 0, true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		}
+
+		return 1, true
+	}
+
+	return 0, false
+}
+
+// rank of each type when ordering values of different types
+func typeRank(val interface{}) int {
+	switch val.(type) {
+	case map[string]interface{}:
+		return 0
+	case *node:
+		return 1
+	case *rel:
+		return 2
+	case []interface{}:
+		return 3
+	case *path:
+		return 4
+	case string:
+		return 5
+	case bool:
+		return 6
+	case int64, float64:
+		return 7
+	case nil:
+		return 9
+	}
+
+	return 8
+}
+
+// order values for sorting, any two values can be ordered and nulls come
+// last.
+func order(a, b interface{}) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case *node:
+		return int(av.id - b.(*node).id)
+	case *rel:
+		return int(av.id - b.(*rel).id)
+	case []interface{}:
+		bv := b.([]interface{})
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := order(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+
+		return len(av) - len(bv)
+	}
+
+	return 0
+}
+
+// key produces a string that is the same for any two equal values, used to
+// find distinct values and group rows.
+func key(val interface{}) string {
+	var buf bytes.Buffer
+	writeKey(&buf, val)
+
+	return buf.String()
+}
+
+func writeKey(buf *bytes.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString("#")
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString("#")
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			buf.WriteString(strconv.FormatInt(int64(v), 10))
+		} else {
+			buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case string:
+		buf.WriteString(strconv.Quote(v))
+	case []interface{}:
+		buf.WriteRune('[')
+		for _, item := range v {
+			writeKey(buf, item)
+			buf.WriteRune(',')
+		}
+		buf.WriteRune(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteRune('{')
+		for _, k := range keys {
+			buf.WriteString(strconv.Quote(k))
+			buf.WriteRune(':')
+			writeKey(buf, v[k])
+			buf.WriteRune(',')
+		}
+		buf.WriteRune('}')
+	case *node:
+		fmt.Fprintf(buf, "(%d)", v.id)
+	case *rel:
+		fmt.Fprintf(buf, "[%d]", v.id)
+	case *path:
+		for i, n := range v.nodes {
+			fmt.Fprintf(buf, "(%d)", n.id)
+			if i < len(v.rels) {
+				fmt.Fprintf(buf, "[%d]", v.rels[i].id)
+			}
+		}
+	default:
+		fmt.Fprintf(buf, "%#v", v)
+	}
+}
+
+// convert a value into what the bolt driver would return for it
+func toBolt(val interface{}) interface{} {
+	switch v := val.(type) {
+	case *node:
+		return boltNode(v)
+	case *rel:
+		return boltGraph.Relationship{
+			RelIdentity:       v.id,
+			StartNodeIdentity: v.start.id,
+			EndNodeIdentity:   v.end.id,
+			Type:              v.typ,
+			Properties:        copyProps(v.props),
+		}
+	case *path:
+		// talon reads the sequence as alternating node and relationship
+		// indexes, the last node is implied
+		bp := boltGraph.Path{}
+		for i, n := range v.nodes {
+			bp.Nodes = append(bp.Nodes, boltNode(n))
+			if i < len(v.rels) {
+				r := v.rels[i]
+				bp.Relationships = append(bp.Relationships, boltGraph.UnboundRelationship{
+					RelIdentity: r.id,
+					Type:        r.typ,
+					Properties:  copyProps(r.props),
+				})
+				bp.Sequence = append(bp.Sequence, i+1, i+1)
+			}
+		}
+
+		return bp
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = toBolt(item)
+		}
+
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = toBolt(item)
+		}
+
+		return m
+	}
+
+	return val
+}
+
+func boltNode(n *node) boltGraph.Node {
+	return boltGraph.Node{
+		NodeIdentity: n.id,
+		Labels:       append([]string(nil), n.labels...),
+		Properties:   copyProps(n.props),
+	}
+}
+
+func copyProps(props map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		if list, ok := v.([]interface{}); ok {
+			v = append([]interface{}(nil), list...)
+		}
+		cp[k] = v
+	}
+
+	return cp
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var identifierRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quote an identifier (label, relationship type, etc...) with backticks
+// unless it's a plain identifier that doesn't need them.
+func quoteIdentifier(name string) string {
+	if identifierRx.MatchString(name) {
+		return name
+	}
+
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// Pattern is anything that can be matched or created in a query, such as a
+// node, relationship or path of nodes and relationships.
+type Pattern interface {
+	pattern(b *Builder) string
+	conditions() []Condition
+}
+
+// NodePattern describes a node in a pattern, like (p:Player {name: {p0}}).
+type NodePattern struct {
+	name   string
+	labels []string
+	props  Properties
+	where  []Condition
+}
+
+// N begins a node pattern with the given variable name and labels. The name
+// can be empty if the node does not need to be referenced.
+func N(name string, labels ...string) *NodePattern {
+	return &NodePattern{
+		name:   name,
+		labels: labels,
+	}
+}
+
+// Props sets properties that are part of the pattern itself, these are
+// passed to the query as parameters.
+func (n *NodePattern) Props(p Properties) *NodePattern {
+	n.props = n.props.Merge(p)
+
+	return n
+}
+
+// Where adds conditions the node must meet. Fields given to the conditions
+// that don't reference a variable are assumed to belong to this node, so
+// Eq("name", "bob") becomes p.name = {p0}. Only named nodes can have
+// conditions, the query fails with ErrUnnamedWhere otherwise.
+func (n *NodePattern) Where(conds ...Condition) *NodePattern {
+	for _, cond := range conds {
+		n.where = append(n.where, scoped{n.name, cond})
+	}
+
+	return n
+}
+
+// Out begins a path from this node, following the outgoing relationship to
+// the node given.
+func (n *NodePattern) Out(r *RelPattern, to *NodePattern) *PathPattern {
+	return newPath(n).Out(r, to)
+}
+
+// In begins a path from this node, following the incoming relationship from
+// the node given.
+func (n *NodePattern) In(r *RelPattern, from *NodePattern) *PathPattern {
+	return newPath(n).In(r, from)
+}
+
+// Both begins a path from this node, following the relationship to the node
+// given in either direction.
+func (n *NodePattern) Both(r *RelPattern, other *NodePattern) *PathPattern {
+	return newPath(n).Both(r, other)
+}
+
+func (n *NodePattern) pattern(b *Builder) string {
+	var buf bytes.Buffer
+	buf.WriteRune('(')
+	if n.name != "" {
+		buf.WriteString(quoteIdentifier(n.name))
+	}
+	for _, label := range n.labels {
+		buf.WriteRune(':')
+		buf.WriteString(quoteIdentifier(label))
+	}
+	if len(n.props) > 0 {
+		if buf.Len() > 1 {
+			buf.WriteRune(' ')
+		}
+		buf.WriteString(b.inlineProps(n.props))
+	}
+	buf.WriteRune(')')
+
+	return buf.String()
+}
+
+func (n *NodePattern) conditions() []Condition {
+	return n.where
+}
+
+// RelPattern describes a relationship in a pattern, like [r:IN].
+type RelPattern struct {
+	name  string
+	types []string
+	props Properties
+	where []Condition
+}
+
+// R begins a relationship pattern with the given variable name and types, if
+// more than one type is given any of them will match.
+func R(name string, types ...string) *RelPattern {
+	return &RelPattern{
+		name:  name,
+		types: types,
+	}
+}
+
+// Props sets properties that are part of the pattern itself, these are
+// passed to the query as parameters.
+func (r *RelPattern) Props(p Properties) *RelPattern {
+	r.props = r.props.Merge(p)
+
+	return r
+}
+
+// Where adds conditions the relationship must meet, fields are scoped to the
+// relationship the same way they are for NodePattern.Where.
+func (r *RelPattern) Where(conds ...Condition) *RelPattern {
+	for _, cond := range conds {
+		r.where = append(r.where, scoped{r.name, cond})
+	}
+
+	return r
+}
+
+func (r *RelPattern) pattern(b *Builder) string {
+	var buf bytes.Buffer
+	if r.name != "" {
+		buf.WriteString(quoteIdentifier(r.name))
+	}
+	for i, typ := range r.types {
+		if i == 0 {
+			buf.WriteRune(':')
+		} else {
+			buf.WriteRune('|')
+		}
+		buf.WriteString(quoteIdentifier(typ))
+	}
+	if len(r.props) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteRune(' ')
+		}
+		buf.WriteString(b.inlineProps(r.props))
+	}
+	if buf.Len() == 0 {
+		return ""
+	}
+
+	return "[" + buf.String() + "]"
+}
+
+func (r *RelPattern) conditions() []Condition {
+	return r.where
+}
+
+// direction a relationship is followed in a path
+type direction int
+
+const (
+	outgoing direction = iota
+	incoming
+	either
+)
+
+type pathStep struct {
+	rel *RelPattern
+	dir direction
+	to  *NodePattern
+}
+
+// PathPattern is a chain of nodes connected by relationships, like
+// (p:Player)-[:IN]->(r:Room). Paths are started from a node with Out, In or
+// Both.
+type PathPattern struct {
+	name  string
+	start *NodePattern
+	steps []pathStep
+}
+
+// begin a path pattern at the given node
+func newPath(start *NodePattern) *PathPattern {
+	return &PathPattern{start: start}
+}
+
+// As names the path so it can be referenced (or returned) in the query.
+func (p *PathPattern) As(name string) *PathPattern {
+	p.name = name
+
+	return p
+}
+
+// Out follows an outgoing relationship from the last node in the path.
+func (p *PathPattern) Out(r *RelPattern, to *NodePattern) *PathPattern {
+	p.steps = append(p.steps, pathStep{r, outgoing, to})
+
+	return p
+}
+
+// In follows an incoming relationship to the last node in the path.
+func (p *PathPattern) In(r *RelPattern, from *NodePattern) *PathPattern {
+	p.steps = append(p.steps, pathStep{r, incoming, from})
+
+	return p
+}
+
+// Both follows a relationship in either direction from the last node in the
+// path.
+func (p *PathPattern) Both(r *RelPattern, other *NodePattern) *PathPattern {
+	p.steps = append(p.steps, pathStep{r, either, other})
+
+	return p
+}
+
+func (p *PathPattern) pattern(b *Builder) string {
+	var buf bytes.Buffer
+	if p.name != "" {
+		buf.WriteString(quoteIdentifier(p.name))
+		buf.WriteString(" = ")
+	}
+	buf.WriteString(p.start.pattern(b))
+	for _, step := range p.steps {
+		rel := ""
+		if step.rel != nil {
+			rel = step.rel.pattern(b)
+		}
+		switch step.dir {
+		case outgoing:
+			buf.WriteString("-" + rel + "->")
+		case incoming:
+			buf.WriteString("<-" + rel + "-")
+		default:
+			buf.WriteString("-" + rel + "-")
+		}
+		buf.WriteString(step.to.pattern(b))
+	}
+
+	return buf.String()
+}
+
+func (p *PathPattern) conditions() []Condition {
+	conds := append([]Condition{}, p.start.conditions()...)
+	for _, step := range p.steps {
+		if step.rel != nil {
+			conds = append(conds, step.rel.conditions()...)
+		}
+		conds = append(conds, step.to.conditions()...)
+	}
+
+	return conds
+}
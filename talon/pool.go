@@ -0,0 +1,437 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	sqldriver "database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	boltErrors "github.com/johnnadratowski/golang-neo4j-bolt-driver/errors"
+	"github.com/johnnadratowski/golang-neo4j-bolt-driver/structures/messages"
+)
+
+// Defaults used for connection options that are not set.
+const (
+	DefaultPoolSize            = 10
+	DefaultHealthCheckInterval = 30 * time.Second
+	DefaultRetryBackoff        = 100 * time.Millisecond
+	maxRetryBackoff            = 5 * time.Second
+)
+
+// the query used to check a connection is still alive
+const healthCheckQuery = "RETURN 1"
+
+var (
+	// ErrClosed is returned when fetching a connection from a database that
+	// has been closed.
+	ErrClosed = errors.New("talon: database has been closed")
+
+	// ErrPoolTimeout is returned when no connection became available within
+	// the wait timeout.
+	ErrPoolTimeout = errors.New("talon: timed out waiting for a connection")
+)
+
+// Dialer opens a brand new connection to the database.
+type Dialer func() (bolt.Conn, error)
+
+// Conn calls the dialer, this allows a dialer to be used as a Driver that
+// opens a new connection for every query.
+func (d Dialer) Conn() (bolt.Conn, error) {
+	return d()
+}
+
+// PoolCounters are running totals kept by a Pool over it's lifetime.
+//   Checkouts is the number of connections handed out.
+//   WaitTime is the total time spent waiting for (or opening) a connection.
+//   Timeouts is the number of times no connection was available in time.
+//   Opened is the number of connections successfully opened.
+//   Retries is the number of failed attempts to open a connection that were
+//     retried after backing off.
+//   Failures is the number of times a connection couldn't be opened even
+//     after retrying.
+//   Discarded is the number of connections thrown away, either for failing
+//     a health check or for failing a query.
+type PoolCounters struct {
+	Checkouts uint64
+	WaitTime  time.Duration
+	Timeouts  uint64
+	Opened    uint64
+	Retries   uint64
+	Failures  uint64
+	Discarded uint64
+}
+
+// PoolStats is a snapshot of the state of a pool.
+type PoolStats struct {
+	PoolCounters
+	Open    int
+	Idle    int
+	InUse   int
+	MaxOpen int
+}
+
+// track an idle connection and when it was last used.
+type idleConn struct {
+	conn     bolt.Conn
+	lastUsed time.Time
+}
+
+// Pool is a bounded set of connections to the database. Connections are
+// opened as they're needed up to the pool size, after which callers wait for one
+// to be released. Connections that have sat idle longer than the health
+// check interval are checked before they're reused and connections that fail
+// a query are thrown away rather than reused. Failing to open a connection
+// is retried with an exponential backoff.
+type Pool struct {
+	dial                Dialer
+	maxOpen             int
+	timeout             time.Duration
+	waitTimeout         time.Duration
+	healthCheckInterval time.Duration
+	maxRetries          int
+	retryBackoff        time.Duration
+
+	mutex    *sync.Mutex
+	slots    chan struct{}
+	done     chan struct{}
+	idle     []idleConn
+	open     int
+	closed   bool
+	counters PoolCounters
+}
+
+// NewPool creates a pool that opens it's connections with the dialer, sized
+// and configured from the options. No connections are opened until they're
+// needed.
+func NewPool(dial Dialer, co ConnectOptions) *Pool {
+	size := int(co.Pool)
+	if size == 0 {
+		size = DefaultPoolSize
+	}
+	interval := co.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	backoff := co.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return &Pool{
+		dial:                dial,
+		maxOpen:             size,
+		timeout:             co.Timeout,
+		waitTimeout:         co.WaitTimeout,
+		healthCheckInterval: interval,
+		maxRetries:          co.MaxRetries,
+		retryBackoff:        backoff,
+		mutex:               new(sync.Mutex),
+		slots:               make(chan struct{}, size),
+		done:                make(chan struct{}),
+	}
+}
+
+// Conn fetches an idle connection or opens a new one. Closing the returned
+// connection releases it back to the pool.
+func (p *Pool) Conn() (bolt.Conn, error) {
+	start := time.Now()
+	if err := p.acquire(); err != nil {
+		return nil, err
+	}
+
+	conn, err := p.idleConn()
+	if conn == nil && err == nil {
+		conn, err = p.connect()
+	}
+
+	p.mutex.Lock()
+	p.counters.WaitTime += time.Since(start)
+	if err == nil {
+		p.counters.Checkouts++
+	}
+	p.mutex.Unlock()
+
+	if err != nil {
+		<-p.slots
+
+		return nil, err
+	}
+	if p.timeout > 0 {
+		conn.SetTimeout(p.timeout)
+	}
+
+	return &pooledConn{Conn: conn, pool: p}, nil
+}
+
+// Close shuts the pool down, closing every idle connection. Connections in
+// use are closed as they're released.
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.mutex.Unlock()
+
+	var err error
+	for _, ic := range idle {
+		if cerr := ic.conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Stats returns a snapshot of the pool and it's counters.
+func (p *Pool) Stats() PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return PoolStats{
+		PoolCounters: p.counters,
+		Open:         p.open,
+		Idle:         len(p.idle),
+		InUse:        p.open - len(p.idle),
+		MaxOpen:      p.maxOpen,
+	}
+}
+
+// wait for a free slot, there is one slot for each connection the pool is
+// allowed to have open.
+func (p *Pool) acquire() error {
+	var timeout <-chan time.Time
+	if p.waitTimeout > 0 {
+		timer := time.NewTimer(p.waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-p.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-p.done:
+		return ErrClosed
+	case <-timeout:
+		p.mutex.Lock()
+		p.counters.Timeouts++
+		p.mutex.Unlock()
+
+		return ErrPoolTimeout
+	}
+}
+
+// pop the most recently used idle connection, health checking connections
+// that have been idle for too long. Returns nil if there are no usable idle
+// connections.
+func (p *Pool) idleConn() (bolt.Conn, error) {
+	for {
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+
+			return nil, ErrClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mutex.Unlock()
+
+			return nil, nil
+		}
+		ic := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mutex.Unlock()
+
+		if p.healthCheckInterval < 0 || time.Since(ic.lastUsed) < p.healthCheckInterval {
+			return ic.conn, nil
+		}
+		if _, err := ic.conn.ExecNeo(healthCheckQuery, nil); err == nil {
+			return ic.conn, nil
+		}
+		p.discard(ic.conn)
+	}
+}
+
+// open a new connection, retrying with an exponential backoff.
+func (p *Pool) connect() (bolt.Conn, error) {
+	backoff := p.retryBackoff
+	for attempt := 0; ; attempt++ {
+		conn, err := p.dial()
+		if err == nil {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if p.closed {
+				conn.Close()
+
+				return nil, ErrClosed
+			}
+			p.open++
+			p.counters.Opened++
+
+			return conn, nil
+		}
+
+		if attempt >= p.maxRetries {
+			p.mutex.Lock()
+			p.counters.Failures++
+			p.mutex.Unlock()
+
+			return nil, err
+		}
+
+		p.mutex.Lock()
+		p.counters.Retries++
+		p.mutex.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-p.done:
+			return nil, ErrClosed
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// put a connection back in the pool, or close it if it's broken or the pool
+// has been closed.
+func (p *Pool) put(conn bolt.Conn, broken bool) {
+	defer func() { <-p.slots }()
+
+	if broken {
+		p.discard(conn)
+
+		return
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.open--
+		p.mutex.Unlock()
+		conn.Close()
+
+		return
+	}
+	p.idle = append(p.idle, idleConn{
+		conn:     conn,
+		lastUsed: time.Now(),
+	})
+	p.mutex.Unlock()
+}
+
+// close a connection that can't be reused
+func (p *Pool) discard(conn bolt.Conn) {
+	p.mutex.Lock()
+	p.open--
+	p.counters.Discarded++
+	p.mutex.Unlock()
+
+	conn.Close()
+}
+
+// pooledConn wraps a connection from the pool, Close releases the connection
+// back to the pool instead of closing it. Queries that fail before Neo4j
+// answers mark the connection as broken since it can be left part way through
+// a message, failures reported by Neo4j (syntax errors, constraint violations)
+// are acknowledged by the driver and leave the connection usable.
+type pooledConn struct {
+	bolt.Conn
+	pool     *Pool
+	broken   bool
+	released bool
+}
+
+func (pc *pooledConn) PrepareNeo(query string) (bolt.Stmt, error) {
+	stmt, err := pc.Conn.PrepareNeo(query)
+	pc.check(err)
+
+	return stmt, err
+}
+
+func (pc *pooledConn) QueryNeo(query string, params map[string]interface{}) (bolt.Rows, error) {
+	rows, err := pc.Conn.QueryNeo(query, params)
+	pc.check(err)
+
+	return rows, err
+}
+
+func (pc *pooledConn) ExecNeo(query string, params map[string]interface{}) (bolt.Result, error) {
+	result, err := pc.Conn.ExecNeo(query, params)
+	pc.check(err)
+
+	return result, err
+}
+
+func (pc *pooledConn) Begin() (sqldriver.Tx, error) {
+	tx, err := pc.Conn.Begin()
+	pc.check(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pooledTx{Tx: tx, conn: pc}, nil
+}
+
+func (pc *pooledConn) Close() error {
+	if !pc.released {
+		pc.released = true
+		pc.pool.put(pc.Conn, pc.broken)
+	}
+
+	return nil
+}
+
+func (pc *pooledConn) check(err error) {
+	if err != nil && !isFailure(err) {
+		pc.broken = true
+	}
+}
+
+// isFailure determines if the error is a failure reported by Neo4j for the
+// statement, rather than a problem talking to it.
+func isFailure(err error) bool {
+	if be, ok := err.(*boltErrors.Error); ok {
+		err = be.InnerMost()
+	}
+	_, ok := err.(messages.FailureMessage)
+
+	return ok
+}
+
+// pooledTx marks it's connection as broken if the transaction fails to
+// commit or roll back.
+type pooledTx struct {
+	sqldriver.Tx
+	conn *pooledConn
+}
+
+func (pt *pooledTx) Commit() error {
+	err := pt.Tx.Commit()
+	pt.conn.check(err)
+
+	return err
+}
+
+func (pt *pooledTx) Rollback() error {
+	err := pt.Tx.Rollback()
+	pt.conn.check(err)
+
+	return err
+}
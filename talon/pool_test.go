@@ -0,0 +1,177 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/bbuck/dragon-mud/talon"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+	boltErrors "github.com/johnnadratowski/golang-neo4j-bolt-driver/errors"
+	"github.com/johnnadratowski/golang-neo4j-bolt-driver/structures/messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		pool    *Pool
+		dialed  []*fakeConn
+		dialErr []error
+		co      ConnectOptions
+	)
+
+	dial := func() (bolt.Conn, error) {
+		if len(dialErr) > 0 {
+			err := dialErr[0]
+			dialErr = dialErr[1:]
+
+			return nil, err
+		}
+		conn := new(fakeConn)
+		dialed = append(dialed, conn)
+
+		return conn, nil
+	}
+
+	BeforeEach(func() {
+		dialed = nil
+		dialErr = nil
+		co = ConnectOptions{
+			Pool:         2,
+			WaitTimeout:  10 * time.Millisecond,
+			RetryBackoff: time.Millisecond,
+		}
+	})
+
+	JustBeforeEach(func() {
+		pool = NewPool(dial, co)
+	})
+
+	It("reuses released connections", func() {
+		conn, err := pool.Conn()
+		Ω(err).Should(BeNil())
+		conn.Close()
+
+		conn, err = pool.Conn()
+		Ω(err).Should(BeNil())
+		conn.Close()
+
+		Ω(dialed).Should(HaveLen(1))
+		Ω(pool.Stats().Checkouts).Should(Equal(uint64(2)))
+		Ω(pool.Stats().Idle).Should(Equal(1))
+	})
+
+	It("only releases a connection once", func() {
+		conn, _ := pool.Conn()
+		conn.Close()
+		conn.Close()
+
+		Ω(pool.Stats().Idle).Should(Equal(1))
+	})
+
+	It("waits for a connection when all of them are in use", func() {
+		pool.Conn()
+		pool.Conn()
+
+		_, err := pool.Conn()
+		Ω(err).Should(Equal(ErrPoolTimeout))
+		Ω(pool.Stats().Timeouts).Should(Equal(uint64(1)))
+		Ω(pool.Stats().InUse).Should(Equal(2))
+	})
+
+	It("discards connections that fail a query", func() {
+		conn, _ := pool.Conn()
+		dialed[0].err = errors.New("broken")
+		_, err := conn.ExecNeo("RETURN 1", nil)
+		Ω(err).ShouldNot(BeNil())
+		conn.Close()
+
+		stats := pool.Stats()
+		Ω(stats.Discarded).Should(Equal(uint64(1)))
+		Ω(stats.Open).Should(Equal(0))
+		Ω(dialed[0].events).Should(Equal([]string{"close"}))
+	})
+
+	It("keeps connections when Neo4j reports a failure", func() {
+		conn, _ := pool.Conn()
+		dialed[0].err = boltErrors.Wrap(messages.NewFailureMessage(map[string]interface{}{
+			"code": "Neo.ClientError.Statement.SyntaxError",
+		}), "Neo4J reported a failure for the query")
+		_, err := conn.ExecNeo("RETURN", nil)
+		Ω(err).ShouldNot(BeNil())
+		conn.Close()
+
+		stats := pool.Stats()
+		Ω(stats.Discarded).Should(Equal(uint64(0)))
+		Ω(stats.Idle).Should(Equal(1))
+	})
+
+	It("retries opening a connection", func() {
+		dialErr = []error{errors.New("refused")}
+		co.MaxRetries = 1
+		pool = NewPool(dial, co)
+
+		_, err := pool.Conn()
+		Ω(err).Should(BeNil())
+		Ω(pool.Stats().Retries).Should(Equal(uint64(1)))
+	})
+
+	It("gives up after the retries are used", func() {
+		refused := errors.New("refused")
+		dialErr = []error{refused, refused}
+		co.MaxRetries = 1
+		pool = NewPool(dial, co)
+
+		_, err := pool.Conn()
+		Ω(err).Should(Equal(refused))
+		Ω(pool.Stats().Failures).Should(Equal(uint64(1)))
+		Ω(pool.Stats().InUse).Should(Equal(0))
+	})
+
+	Context("with health checks on every checkout", func() {
+		BeforeEach(func() {
+			co.HealthCheckInterval = time.Nanosecond
+		})
+
+		It("replaces connections that fail the check", func() {
+			conn, _ := pool.Conn()
+			conn.Close()
+			dialed[0].err = errors.New("gone away")
+
+			_, err := pool.Conn()
+			Ω(err).Should(BeNil())
+			Ω(dialed).Should(HaveLen(2))
+			Ω(dialed[0].executed).Should(Equal([]string{"RETURN 1"}))
+			Ω(pool.Stats().Discarded).Should(Equal(uint64(1)))
+		})
+	})
+
+	Context("when closed", func() {
+		It("closes idle connections", func() {
+			conn, _ := pool.Conn()
+			conn.Close()
+			pool.Close()
+
+			Ω(dialed[0].events).Should(Equal([]string{"close"}))
+			Ω(pool.Stats().Open).Should(Equal(0))
+		})
+
+		It("closes connections in use as they're released", func() {
+			conn, _ := pool.Conn()
+			pool.Close()
+			conn.Close()
+
+			Ω(dialed[0].events).Should(Equal([]string{"close"}))
+		})
+
+		It("doesn't hand out connections", func() {
+			pool.Close()
+
+			_, err := pool.Conn()
+			Ω(err).Should(Equal(ErrClosed))
+		})
+	})
+})
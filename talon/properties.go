@@ -132,12 +132,48 @@ func (p *Properties) UnmarshalTalon(bs []byte) error {
 	return errors.New("invalid data format for properties")
 }
 
+// List is a list of values given as a query parameter, such as the values
+// given to In. Unlike other slices (which are stored as JSON) lists are sent to
+// the database as they are.
+type List []interface{}
+
+// ListOf converts any slice or array into a List, nil is an empty list and
+// any other value is returned as a single item list.
+func ListOf(values interface{}) List {
+	switch v := values.(type) {
+	case nil:
+		return List{}
+	case List:
+		return v
+	}
+
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return List{values}
+	}
+
+	list := make(List, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+
+	return list
+}
+
 // MarshaledProperties will attempt to TalonMarshal all property values that
-// can be marshaled.
+// can be marshaled, Lists are left as they are.
 func (p Properties) MarshaledProperties() (Properties, error) {
 	mp := make(Properties)
 	for k, v := range p {
 		switch t := v.(type) {
+		case nil:
+			mp[k] = nil
+
+			continue
+		case List:
+			mp[k] = []interface{}(t)
+
+			continue
 		case Marshaler:
 			bs, err := t.MarshalTalon()
 			if err != nil {
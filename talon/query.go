@@ -2,22 +2,19 @@
 
 package talon
 
-import (
-	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
-)
-
 var noProperties = make(Properties)
 
 // Query reprsents a Talon query before it's been converted in Cypher
 type Query struct {
 	db         *DB
+	tx         *Tx
 	rawCypher  string
 	properties Properties
 }
 
 // ToCypher converts a query object into a Cypher query string.
-// NOTE: For the time being raw queries (strings with property injection)
-//       are the only types of queries supported.
+// NOTE: Queries are always raw Cypher (strings with property injection), the
+//       Builder produces raw Cypher for the queries it builds.
 func (q *Query) ToCypher() string {
 	if q.rawCypher != "" {
 		return q.rawCypher
@@ -26,14 +23,20 @@ func (q *Query) ToCypher() string {
 	return "__INVALID__;"
 }
 
-// Query executes a fetch query, expecting rows to be returned.
+// Query executes a fetch query, expecting rows to be returned. The
+// connection used for the query is held until the rows are closed, which
+// happens on it's own once every row has been read.
 func (q *Query) Query() (*Rows, error) {
-	conn, stmt, err := q.getStatement()
+	if q.tx != nil {
+		return q.tx.query(q)
+	}
+
+	conn, err := q.db.Conn()
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := stmt.QueryNeo(q.propsForQuery())
+	rows, err := conn.QueryNeo(q.ToCypher(), q.propsForQuery())
 	if err != nil {
 		conn.Close()
 
@@ -41,39 +44,29 @@ func (q *Query) Query() (*Rows, error) {
 	}
 
 	r := wrapBoltRows(rows)
+	r.conn = conn
 
 	return r, nil
 }
 
 // Exec runs a query that doesn't expect rows to be returned.
 func (q *Query) Exec() (*Result, error) {
-	_, stmt, err := q.getStatement()
-	if err != nil {
-		return nil, err
+	if q.tx != nil {
+		return q.tx.exec(q)
 	}
 
-	result, err := stmt.ExecNeo(q.propsForQuery())
+	conn, err := q.db.Conn()
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
 
-	return wrapBoltResult(result), nil
-}
-
-func (q *Query) getStatement() (bolt.Conn, bolt.Stmt, error) {
-	conn, err := q.db.conn()
+	result, err := conn.ExecNeo(q.ToCypher(), q.propsForQuery())
 	if err != nil {
-		return nil, nil, err
-	}
-
-	stmt, err := conn.PrepareNeo(q.ToCypher())
-	if err != nil {
-		conn.Close()
-
-		return nil, nil, err
+		return nil, err
 	}
 
-	return conn, stmt, nil
+	return wrapBoltResult(result), nil
 }
 
 func (q *Query) propsForQuery() map[string]interface{} {
@@ -15,6 +15,16 @@ type ResultStats struct {
 	RelationshipsDeleted int64
 }
 
+// add the counts from the other stats to these
+func (s *ResultStats) add(other ResultStats) {
+	s.LabelsAdded += other.LabelsAdded
+	s.NodesCreated += other.NodesCreated
+	s.PropertiesSet += other.PropertiesSet
+	s.NodesDeleted += other.NodesDeleted
+	s.RelationshipsCreated += other.RelationshipsCreated
+	s.RelationshipsDeleted += other.RelationshipsDeleted
+}
+
 // Result represents a return from a non-row based query like a create/delete
 // or upate where you're not using something like "return" in the query.
 type Result struct {
@@ -3,6 +3,8 @@
 package talon
 
 import (
+	"io"
+
 	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
 	boltGraph "github.com/johnnadratowski/golang-neo4j-bolt-driver/structures/graph"
 )
@@ -81,6 +83,7 @@ type Rows struct {
 
 	closed   bool
 	boltRows bolt.Rows
+	conn     io.Closer
 }
 
 // create a talon.Rows object from a bolt.Rows object.
@@ -91,11 +94,15 @@ func wrapBoltRows(rs bolt.Rows) *Rows {
 	}
 }
 
-// Close will close the incoming stream of graph entities.
+// Close will close the incoming stream of graph entities, releasing the
+// connection used for the query.
 func (r *Rows) Close() {
 	if !r.closed {
 		r.closed = true
 		r.boltRows.Close()
+		if r.conn != nil {
+			r.conn.Close()
+		}
 	}
 }
 
@@ -106,9 +113,14 @@ func (r *Rows) IsOpen() bool {
 	return !r.closed
 }
 
-// Next fetches the next row in the resultset.
+// Next fetches the next row in the resultset. The rows are closed once the
+// last row has been read (Next returns io.EOF) or reading fails, so the
+// connection is released even if they're never closed.
 func (r *Rows) Next() (*Row, error) {
 	boltRow, _, err := r.boltRows.NextNeo()
+	if err != nil {
+		r.Close()
+	}
 	row := &Row{
 		fields:   make([]interface{}, len(boltRow)),
 		Metadata: r.Metadata,
@@ -116,6 +128,8 @@ func (r *Rows) Next() (*Row, error) {
 	for i, boltEnt := range boltRow {
 		ent, err := boltToTalonEntity(boltEnt)
 		if err != nil {
+			r.Close()
+
 			return nil, err
 		}
 		row.fields[i] = ent
@@ -124,8 +138,11 @@ func (r *Rows) Next() (*Row, error) {
 	return row, err
 }
 
-// All returns all the rows up front instead of using the streaming API.
+// All returns all the rows up front instead of using the streaming API, the
+// rows are closed afterwards.
 func (r *Rows) All() ([]*Row, error) {
+	defer r.Close()
+
 	all, _, err := r.boltRows.All()
 	if err != nil {
 		return nil, err
@@ -145,7 +162,6 @@ func (r *Rows) All() ([]*Row, error) {
 		}
 		results = append(results, row)
 	}
-	r.Close()
 
 	return results, nil
 }
@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	"io"
+
+	. "github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rows", func() {
+	var (
+		pool *Pool
+		db   *DB
+	)
+
+	BeforeEach(func() {
+		pool = NewPool(memory.NewDriver().Conn, ConnectOptions{Pool: 1})
+		db = NewDB(pool)
+		_, err := db.Cypher("CREATE (:Room {name: 'Hall'})").Exec()
+		Ω(err).Should(BeNil())
+	})
+
+	It("releases the connection once the last row is read", func() {
+		rows, err := db.Cypher("MATCH (r:Room) RETURN r.name AS name").Query()
+		Ω(err).Should(BeNil())
+		Ω(pool.Stats().InUse).Should(Equal(1))
+
+		_, err = rows.Next()
+		Ω(err).Should(BeNil())
+		_, err = rows.Next()
+		Ω(err).Should(Equal(io.EOF))
+		Ω(rows.IsOpen()).Should(BeFalse())
+		Ω(pool.Stats().InUse).Should(Equal(0))
+	})
+
+	It("releases the connection after reading them all", func() {
+		rows, err := db.Cypher("MATCH (r:Room) RETURN r.name AS name").Query()
+		Ω(err).Should(BeNil())
+
+		all, err := rows.All()
+		Ω(err).Should(BeNil())
+		Ω(all).Should(HaveLen(1))
+		Ω(pool.Stats().InUse).Should(Equal(0))
+	})
+})
@@ -0,0 +1,172 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon
+
+import (
+	sqldriver "database/sql/driver"
+	"errors"
+
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+)
+
+// ErrTxFinished is returned when using a transaction that has already been
+// committed or rolled back.
+var ErrTxFinished = errors.New("transaction has already been committed or rolled back")
+
+// Querier is anything queries can be run against, either a DB where each
+// query stands on it's own or a Tx where they are all part of a transaction.
+type Querier interface {
+	Cypher(cypher string) *Query
+	CypherP(cypher string, p Properties) (*Query, error)
+	Match(patterns ...Pattern) *Builder
+	OptionalMatch(patterns ...Pattern) *Builder
+	Create(patterns ...Pattern) *Builder
+	Merge(pattern Pattern) *Builder
+	Batch(cypher string, rows []Properties) (*Result, error)
+}
+
+// Tx is a database transaction, every query run through it uses the same
+// connection and none of their changes are visible until the transaction is
+// committed. Rows returned from a query must be closed before running the
+// next query in the transaction.
+type Tx struct {
+	db       *DB
+	conn     bolt.Conn
+	tx       sqldriver.Tx
+	finished bool
+}
+
+// Begin starts a new transaction, the transaction holds on to a connection
+// until it's committed or rolled back.
+func (d *DB) Begin() (*Tx, error) {
+	conn, err := d.Conn()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return &Tx{
+		db:   d,
+		conn: conn,
+		tx:   tx,
+	}, nil
+}
+
+// CypherP builds a query with properties that will run within the
+// transaction.
+func (t *Tx) CypherP(cypher string, p Properties) (*Query, error) {
+	q, err := t.db.CypherP(cypher, p)
+	if err != nil {
+		return nil, err
+	}
+	q.tx = t
+
+	return q, nil
+}
+
+// MustCypherP calls CypherP but will panic on error.
+func (t *Tx) MustCypherP(cypher string, p Properties) *Query {
+	q, err := t.CypherP(cypher, p)
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// Cypher builds a query without properties that will run within the
+// transaction.
+func (t *Tx) Cypher(cypher string) *Query {
+	q, _ := t.CypherP(cypher, noProperties)
+
+	return q
+}
+
+// Match starts a query within the transaction matching the given patterns.
+func (t *Tx) Match(patterns ...Pattern) *Builder {
+	return newBuilder(t).Match(patterns...)
+}
+
+// OptionalMatch starts a query within the transaction optionally matching
+// the given patterns.
+func (t *Tx) OptionalMatch(patterns ...Pattern) *Builder {
+	return newBuilder(t).OptionalMatch(patterns...)
+}
+
+// Create starts a query within the transaction that creates the given
+// patterns.
+func (t *Tx) Create(patterns ...Pattern) *Builder {
+	return newBuilder(t).Create(patterns...)
+}
+
+// Merge starts a query within the transaction that matches the pattern or
+// creates it if it doesn't exist.
+func (t *Tx) Merge(pattern Pattern) *Builder {
+	return newBuilder(t).Merge(pattern)
+}
+
+// IsOpen is true until the transaction has been committed or rolled back.
+func (t *Tx) IsOpen() bool {
+	return !t.finished
+}
+
+// Commit makes the changes from the transaction permanent and releases it's
+// connection.
+func (t *Tx) Commit() error {
+	if t.finished {
+		return ErrTxFinished
+	}
+	defer t.finish()
+
+	return t.tx.Commit()
+}
+
+// Rollback discards the changes from the transaction and releases it's
+// connection.
+func (t *Tx) Rollback() error {
+	if t.finished {
+		return ErrTxFinished
+	}
+	defer t.finish()
+
+	return t.tx.Rollback()
+}
+
+func (t *Tx) finish() {
+	t.finished = true
+	t.conn.Close()
+}
+
+// run a query expecting rows on the transaction's connection
+func (t *Tx) query(q *Query) (*Rows, error) {
+	if t.finished {
+		return nil, ErrTxFinished
+	}
+
+	rows, err := t.conn.QueryNeo(q.ToCypher(), q.propsForQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapBoltRows(rows), nil
+}
+
+// run a query not expecting rows on the transaction's connection
+func (t *Tx) exec(q *Query) (*Result, error) {
+	if t.finished {
+		return nil, ErrTxFinished
+	}
+
+	result, err := t.conn.ExecNeo(q.ToCypher(), q.propsForQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapBoltResult(result), nil
+}
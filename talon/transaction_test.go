@@ -0,0 +1,136 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package talon_test
+
+import (
+	"database/sql/driver"
+	"time"
+
+	. "github.com/bbuck/dragon-mud/talon"
+	bolt "github.com/johnnadratowski/golang-neo4j-bolt-driver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// records what happens to a connection, only the methods used by
+// transactions do anything.
+type fakeConn struct {
+	bolt.Conn
+	executed []string
+	events   []string
+	err      error
+	rows     bolt.Rows
+}
+
+// hands out the same connection every time
+type fakeDriver struct {
+	conn *fakeConn
+}
+
+func (d fakeDriver) Conn() (bolt.Conn, error) {
+	return d.conn, nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.events = append(c.events, "begin")
+
+	return &fakeTx{c}, nil
+}
+
+func (c *fakeConn) ExecNeo(query string, _ map[string]interface{}) (bolt.Result, error) {
+	c.executed = append(c.executed, query)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return fakeResult{}, nil
+}
+
+func (c *fakeConn) QueryNeo(query string, _ map[string]interface{}) (bolt.Rows, error) {
+	c.executed = append(c.executed, query)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return c.rows, nil
+}
+
+func (c *fakeConn) Close() error {
+	c.events = append(c.events, "close")
+
+	return nil
+}
+
+func (c *fakeConn) SetTimeout(time.Duration) {}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (t *fakeTx) Commit() error {
+	t.conn.events = append(t.conn.events, "commit")
+
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.conn.events = append(t.conn.events, "rollback")
+
+	return nil
+}
+
+type fakeResult struct {
+	bolt.Result
+}
+
+func (fakeResult) Metadata() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+var _ = Describe("Tx", func() {
+	var (
+		conn *fakeConn
+		tx   *Tx
+	)
+
+	BeforeEach(func() {
+		conn = new(fakeConn)
+		var err error
+		tx, err = NewDB(fakeDriver{conn}).Begin()
+		Ω(err).Should(BeNil())
+	})
+
+	It("begins a transaction", func() {
+		Ω(conn.events).Should(Equal([]string{"begin"}))
+		Ω(tx.IsOpen()).Should(BeTrue())
+	})
+
+	It("runs queries on the transaction's connection", func() {
+		_, err := tx.Cypher("CREATE (n:Test)").Exec()
+		Ω(err).Should(BeNil())
+		_, err = tx.Create(N("n", "Other")).Exec()
+		Ω(err).Should(BeNil())
+
+		Ω(conn.executed).Should(Equal([]string{"CREATE (n:Test)", "CREATE (n:Other)"}))
+	})
+
+	It("commits and releases the connection", func() {
+		Ω(tx.Commit()).Should(BeNil())
+		Ω(conn.events).Should(Equal([]string{"begin", "commit", "close"}))
+		Ω(tx.IsOpen()).Should(BeFalse())
+	})
+
+	It("rolls back and releases the connection", func() {
+		Ω(tx.Rollback()).Should(BeNil())
+		Ω(conn.events).Should(Equal([]string{"begin", "rollback", "close"}))
+	})
+
+	It("can't be used once it's finished", func() {
+		tx.Commit()
+
+		Ω(tx.Rollback()).Should(Equal(ErrTxFinished))
+		_, err := tx.Cypher("CREATE (n:Test)").Exec()
+		Ω(err).Should(Equal(ErrTxFinished))
+	})
+})
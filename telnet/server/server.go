@@ -3,14 +3,22 @@
 package server
 
 import (
+	"bufio"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"time"
 
+	"github.com/bbuck/dragon-mud/data"
+	"github.com/bbuck/dragon-mud/events"
 	"github.com/bbuck/dragon-mud/logger"
 	"github.com/bbuck/dragon-mud/plugins"
 	"github.com/bbuck/dragon-mud/scripting"
+	"github.com/bbuck/dragon-mud/session"
+	"github.com/bbuck/dragon-mud/world"
 	"github.com/spf13/viper"
 )
 
@@ -29,6 +37,9 @@ func Run() {
 	if err := plugins.LoadViews(); err != nil {
 		log.WithError(err).Error("Failed to load views")
 	}
+	if err := plugins.LoadTables(); err != nil {
+		log.WithError(err).Error("Failed to load random tables")
+	}
 	serverRunning = true
 	host := viper.GetString("telnet.interface")
 	port := viper.GetString("telnet.port")
@@ -36,6 +47,7 @@ func Run() {
 	scripting.Initialize()
 	done := scripting.ServerEmitter.EmitOnce("server:init", nil)
 	<-done
+	go handleShutdown()
 
 	listener, err := net.Listen("tcp", host+":"+port)
 	if err != nil {
@@ -70,11 +82,29 @@ func runServer(listener net.Listener) {
 	}
 }
 
+// wait for the server to be interrupted, then let scripts know and write any
+// unsaved changes before exiting.
+func handleShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	log.Info("Shutting down.")
+	serverRunning = false
+	<-scripting.ServerEmitter.Emit("server:shutdown", nil)
+	if err := data.Close(); err != nil {
+		log.WithError(err).Error("Failed to close the database.")
+	}
+
+	os.Exit(0)
+}
+
 func runServerTicks() {
 	go runTicker(time.Tick(1*time.Second), "tick:1s")
 	go runTicker(time.Tick(5*time.Second), "tick:5s")
 	go runTicker(time.Tick(30*time.Second), "tick:30s")
 	go runTicker(time.Tick(1*time.Minute), "tick:1m")
+	go runResets(time.Tick(5 * time.Second))
 }
 
 func runTicker(tick <-chan time.Time, evt string) {
@@ -87,7 +117,58 @@ func runTicker(tick <-chan time.Time, evt string) {
 	}
 }
 
+// reset every area when the server starts and then as they come due, checking
+// on each tick
+func runResets(tick <-chan time.Time) {
+	w, err := data.World()
+	if err != nil {
+		log.WithError(err).Error("Failed to load the world, areas won't be reset.")
+
+		return
+	}
+
+	s := world.NewScheduler(w, viper.GetDuration("world.reset_interval"))
+	resetAreas(s, time.Now())
+	for now := range tick {
+		if !serverRunning {
+			return
+		}
+
+		resetAreas(s, now)
+	}
+}
+
+func resetAreas(s *world.Scheduler, now time.Time) {
+	reports, err := s.Tick(now)
+	for _, r := range reports {
+		for _, warning := range r.Warnings {
+			log.WithField("area", r.Area).Warn(warning)
+		}
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to reset an area.")
+	}
+}
+
+// connections are given to server scripts as the session of the
+// "player:connect" event, they log the player in and attach the session to
+// their character with channels.attach. Each line the player sends is emitted
+// as "player:input" and once they disconnect the entities the session was
+// attached to are emitted with "player:disconnect".
 func handleConnection(conn net.Conn) {
-	conn.Write([]byte("You were connected successfully, closing connection.\r\n"))
-	conn.Close()
+	defer conn.Close()
+
+	s := session.NewWriter(conn)
+	<-scripting.ServerEmitter.Emit("player:connect", events.Data{"session": s})
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		<-scripting.ServerEmitter.Emit("player:input", events.Data{
+			"session": s,
+			"input":   scanner.Text(),
+		})
+	}
+
+	entities := session.Online.Release(s)
+	scripting.ServerEmitter.Emit("player:disconnect", events.Data{"entities": entities})
 }
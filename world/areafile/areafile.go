@@ -0,0 +1,570 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package areafile moves areas between the world and files. Classic ROM
+// style .are files can be imported and areas are exported to (and imported
+// from) a native TOML or JSON format meant to be kept in version control.
+// Rooms and prototypes are numbered with vnums in every format so exits and
+// resets can refer to them.
+package areafile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// ErrAreaExists is returned when importing an area that's already in the
+// world without replacing it.
+var ErrAreaExists = errors.New("areafile: an area with that name already exists, it can be replaced")
+
+// File is an area and everything in it.
+type File struct {
+	Area    Area        `json:"area" mapstructure:"area"`
+	Rooms   []Room      `json:"rooms,omitempty" mapstructure:"rooms"`
+	Mobiles []Prototype `json:"mobiles,omitempty" mapstructure:"mobiles"`
+	Objects []Prototype `json:"objects,omitempty" mapstructure:"objects"`
+	Resets  []Reset     `json:"resets,omitempty" mapstructure:"resets"`
+}
+
+// Area is the name and properties of the area.
+type Area struct {
+	Name       string                 `json:"name" mapstructure:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty" mapstructure:"properties"`
+}
+
+// Room is a room and the exits leading out of it.
+type Room struct {
+	Vnum       int                    `json:"vnum" mapstructure:"vnum"`
+	Name       string                 `json:"name" mapstructure:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty" mapstructure:"properties"`
+	Exits      []Exit                 `json:"exits,omitempty" mapstructure:"exits"`
+}
+
+// Exit leads to the room with the vnum To. Exits linked both ways name the
+// exit leading back in Back and both sides are listed.
+type Exit struct {
+	Name       string                 `json:"name" mapstructure:"name"`
+	To         int                    `json:"to" mapstructure:"to"`
+	Back       string                 `json:"back,omitempty" mapstructure:"back"`
+	Door       *Door                  `json:"door,omitempty" mapstructure:"door"`
+	Properties map[string]interface{} `json:"properties,omitempty" mapstructure:"properties"`
+}
+
+// Door is a door in an exit.
+type Door struct {
+	Closed bool   `json:"closed,omitempty" mapstructure:"closed"`
+	Locked bool   `json:"locked,omitempty" mapstructure:"locked"`
+	Key    string `json:"key,omitempty" mapstructure:"key"`
+}
+
+// Prototype is a mobile or an object.
+type Prototype struct {
+	Vnum       int                    `json:"vnum" mapstructure:"vnum"`
+	Name       string                 `json:"name" mapstructure:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty" mapstructure:"properties"`
+}
+
+// Reset is a step in repopulating the area, see world.Reset.
+type Reset struct {
+	Action    string `json:"action" mapstructure:"action"`
+	Vnum      int    `json:"vnum,omitempty" mapstructure:"vnum"`
+	Room      int    `json:"room,omitempty" mapstructure:"room"`
+	Container int    `json:"container,omitempty" mapstructure:"container"`
+	Limit     int    `json:"limit,omitempty" mapstructure:"limit"`
+	Count     int    `json:"count,omitempty" mapstructure:"count"`
+	Wear      string `json:"wear,omitempty" mapstructure:"wear"`
+	Exit      string `json:"exit,omitempty" mapstructure:"exit"`
+	State     string `json:"state,omitempty" mapstructure:"state"`
+}
+
+// ImportOptions control how an area is imported.
+type ImportOptions struct {
+	// Name replaces the name of the area in the file.
+	Name string
+
+	// Parent is the ID of the area the imported area is part of.
+	Parent string
+
+	// Replace an area with the same name, removing it's rooms, prototypes
+	// and resets first.
+	Replace bool
+}
+
+// Result describes what was imported.
+type Result struct {
+	Area    *world.Area
+	Rooms   int
+	Exits   int
+	Mobiles int
+	Objects int
+	Resets  int
+
+	// Warnings about anything that couldn't be imported, like exits to rooms
+	// that don't exist.
+	Warnings []string
+}
+
+// Import writes the area in the file into the world. Rooms and prototypes
+// can't use vnums already used outside of the area, exits leading to rooms
+// that aren't in the file are linked if the room is already in the world.
+// The file is checked before anything is changed, if the import still fails
+// the area is removed (or restored to what it was before it was replaced).
+func Import(w *world.World, f *File, opts ImportOptions) (*Result, error) {
+	name := f.Area.Name
+	if opts.Name != "" {
+		name = opts.Name
+	}
+	if name == "" {
+		return nil, world.ErrMissingName
+	}
+	if err := validate(f); err != nil {
+		return nil, err
+	}
+
+	area, backup, err := prepareArea(w, name, f, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fill(w, area, f)
+	if err != nil {
+		if rerr := restore(w, area, backup); rerr != nil {
+			return nil, fmt.Errorf("%s (and the area couldn't be restored: %s)", err, rerr)
+		}
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// check the file for anything the world would refuse, so the area is only
+// changed once it's known the file can be imported
+func validate(f *File) error {
+	rooms := make(map[int]bool, len(f.Rooms))
+	for _, r := range f.Rooms {
+		if r.Name == "" {
+			return fmt.Errorf("areafile: room %d: %s", r.Vnum, world.ErrMissingName)
+		}
+		if rooms[r.Vnum] {
+			return fmt.Errorf("areafile: room %d is in the file more than once", r.Vnum)
+		}
+		rooms[r.Vnum] = true
+
+		for _, e := range r.Exits {
+			if world.ExitName(e.Name) == "" {
+				return fmt.Errorf("areafile: room %d: exit to %d: %s", r.Vnum, e.To, world.ErrMissingName)
+			}
+		}
+	}
+
+	for _, check := range []struct {
+		kind   string
+		protos []Prototype
+	}{{world.MobileKind, f.Mobiles}, {world.ObjectKind, f.Objects}} {
+		vnums := make(map[int]bool, len(check.protos))
+		for _, p := range check.protos {
+			if p.Name == "" {
+				return fmt.Errorf("areafile: %s %d: %s", check.kind, p.Vnum, world.ErrMissingName)
+			}
+			if vnums[p.Vnum] {
+				return fmt.Errorf("areafile: %s %d is in the file more than once", check.kind, p.Vnum)
+			}
+			vnums[p.Vnum] = true
+		}
+	}
+
+	return nil
+}
+
+// write the rooms, exits, prototypes and resets in the file into the area
+func fill(w *world.World, area *world.Area, f *File) (*Result, error) {
+	res := &Result{Area: area}
+	rooms := make(map[int]string, len(f.Rooms))
+	for _, r := range f.Rooms {
+		props := storage.Properties{world.VnumProperty: r.Vnum}
+		for k, v := range r.Properties {
+			props[k] = v
+		}
+		room, err := w.CreateRoom(r.Name, area.ID, props)
+		if err != nil {
+			return nil, fmt.Errorf("areafile: room %d: %s", r.Vnum, err)
+		}
+		rooms[r.Vnum] = room.ID
+		res.Rooms++
+	}
+
+	if err := linkExits(w, f, rooms, res); err != nil {
+		return nil, err
+	}
+
+	for _, kind := range []string{world.MobileKind, world.ObjectKind} {
+		protos, count := f.Mobiles, &res.Mobiles
+		if kind == world.ObjectKind {
+			protos, count = f.Objects, &res.Objects
+		}
+		for _, p := range protos {
+			props := storage.Properties(copyProperties(p.Properties))
+			if _, err := w.CreatePrototype(kind, p.Vnum, p.Name, area.ID, props); err != nil {
+				return nil, fmt.Errorf("areafile: %s %d: %s", kind, p.Vnum, err)
+			}
+			*count++
+		}
+	}
+
+	for _, r := range f.Resets {
+		_, err := w.AddReset(area.ID, world.Reset{
+			Action:    r.Action,
+			Vnum:      r.Vnum,
+			Room:      r.Room,
+			Container: r.Container,
+			Limit:     r.Limit,
+			Count:     r.Count,
+			Wear:      r.Wear,
+			Exit:      r.Exit,
+			State:     r.State,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res.Resets++
+	}
+
+	return res, nil
+}
+
+// undo a failed import, the area is emptied and then removed if the import
+// created it, or filled with the backup taken before it was replaced
+func restore(w *world.World, area *world.Area, backup *File) error {
+	if err := emptyArea(w, area.ID); err != nil {
+		return err
+	}
+	if backup == nil {
+		return w.DestroyArea(area.ID)
+	}
+
+	if err := w.UpdateArea(area.ID, storage.Properties(copyProperties(backup.Area.Properties))); err != nil {
+		return err
+	}
+	_, err := fill(w, area, backup)
+
+	return err
+}
+
+// create the area, or empty the existing area when replacing it, after
+// making sure none of the vnums in the file are used elsewhere. A replaced
+// area is exported first so it can be restored if the import fails.
+func prepareArea(w *world.World, name string, f *File, opts ImportOptions) (*world.Area, *File, error) {
+	existing, err := w.FindArea(name)
+	if err != nil && err != world.ErrAreaNotFound {
+		return nil, nil, err
+	}
+	if existing != nil && !opts.Replace {
+		return nil, nil, ErrAreaExists
+	}
+
+	owned := func(area string) bool {
+		return existing != nil && area == existing.ID
+	}
+	for _, r := range f.Rooms {
+		room, err := w.FindRoom(r.Vnum)
+		if err == nil && !owned(room.Area) {
+			return nil, nil, fmt.Errorf("areafile: room %d is already in the world", r.Vnum)
+		}
+	}
+	for _, check := range []struct {
+		kind   string
+		protos []Prototype
+	}{{world.MobileKind, f.Mobiles}, {world.ObjectKind, f.Objects}} {
+		for _, p := range check.protos {
+			proto, err := w.FindPrototype(check.kind, p.Vnum)
+			if err == nil && !owned(proto.Area) {
+				return nil, nil, fmt.Errorf("areafile: %s %d is already in the world", check.kind, p.Vnum)
+			}
+		}
+	}
+
+	if existing == nil {
+		area, err := w.CreateArea(name, opts.Parent, storage.Properties(copyProperties(f.Area.Properties)))
+
+		return area, nil, err
+	}
+
+	backup, err := Export(w, existing.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := emptyArea(w, existing.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := w.UpdateArea(existing.ID, storage.Properties(copyProperties(f.Area.Properties))); err != nil {
+		return nil, nil, err
+	}
+	area, err := w.Area(existing.ID)
+
+	return area, backup, err
+}
+
+// remove the rooms, prototypes and resets of the area
+func emptyArea(w *world.World, area string) error {
+	rooms, err := w.Rooms(area)
+	if err != nil {
+		return err
+	}
+	for _, r := range rooms {
+		if err := w.DestroyRoom(r.ID); err != nil {
+			return err
+		}
+	}
+
+	protos, err := w.Prototypes(area, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range protos {
+		if err := w.DestroyPrototype(p.ID); err != nil {
+			return err
+		}
+	}
+
+	return w.ClearResets(area)
+}
+
+// link the exits of every room, exits listed on both sides with their Back
+// names are linked both ways so they share their door
+func linkExits(w *world.World, f *File, rooms map[int]string, res *Result) error {
+	type side struct {
+		room int
+		name string
+	}
+	exits := make(map[side]Exit)
+	for _, r := range f.Rooms {
+		for _, e := range r.Exits {
+			exits[side{r.Vnum, world.ExitName(e.Name)}] = e
+		}
+	}
+
+	linked := make(map[side]bool)
+	for _, r := range f.Rooms {
+		for _, e := range r.Exits {
+			here := side{r.Vnum, world.ExitName(e.Name)}
+			if linked[here] {
+				continue
+			}
+
+			to, ok := rooms[e.To]
+			if !ok {
+				room, err := w.FindRoom(e.To)
+				if err != nil {
+					res.Warnings = append(res.Warnings, fmt.Sprintf("room %d: exit %s leads to room %d which doesn't exist", r.Vnum, e.Name, e.To))
+
+					continue
+				}
+				to = room.ID
+			}
+
+			opts := world.LinkOptions{
+				OneWay:     true,
+				Properties: storage.Properties(copyProperties(e.Properties)),
+			}
+			there := side{e.To, world.ExitName(e.Back)}
+			back, paired := exits[there]
+			paired = paired && e.Back != "" && back.To == r.Vnum && world.ExitName(back.Back) == here.name
+			door := e.Door
+			if paired {
+				opts.OneWay = false
+				opts.Back = e.Back
+				if door == nil {
+					door = back.Door
+				}
+			}
+			if door != nil {
+				opts.Door = &world.Door{
+					Closed: door.Closed,
+					Locked: door.Locked,
+					Key:    door.Key,
+				}
+			}
+
+			exit, err := w.Link(rooms[r.Vnum], to, e.Name, opts)
+			if err != nil {
+				return fmt.Errorf("areafile: room %d: exit %s: %s", r.Vnum, e.Name, err)
+			}
+			linked[here] = true
+			res.Exits++
+			if !paired {
+				continue
+			}
+
+			linked[there] = true
+			res.Exits++
+			if len(back.Properties) > 0 || len(e.Properties) > 0 {
+				// linking gave both sides this side's properties
+				updates := storage.Properties(copyProperties(back.Properties))
+				for k := range e.Properties {
+					if _, ok := updates[k]; !ok {
+						updates[k] = nil
+					}
+				}
+				if err := w.UpdateExit(exit.Pair(), updates); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Export reads the area and everything in it from the world. Rooms without
+// a vnum are given one after the highest vnum in the area, exits leading to
+// rooms outside of the area without a vnum are left out.
+func Export(w *world.World, id string) (*File, error) {
+	area, err := w.Area(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Area: Area{
+			Name:       area.Name,
+			Properties: copyProperties(area.Properties),
+		},
+	}
+
+	rooms, err := w.Rooms(id)
+	if err != nil {
+		return nil, err
+	}
+	vnums := make(map[string]int, len(rooms))
+	var highest int
+	for _, r := range rooms {
+		if v, ok := vnumOf(r.Properties); ok {
+			vnums[r.ID] = v
+			if v > highest {
+				highest = v
+			}
+		}
+	}
+	for _, r := range rooms {
+		if _, ok := vnums[r.ID]; !ok {
+			highest++
+			vnums[r.ID] = highest
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return vnums[rooms[i].ID] < vnums[rooms[j].ID]
+	})
+
+	for _, r := range rooms {
+		room := Room{
+			Vnum:       vnums[r.ID],
+			Name:       r.Name,
+			Properties: copyProperties(r.Properties),
+		}
+		delete(room.Properties, world.VnumProperty)
+
+		exits, err := w.Exits(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range exits {
+			to, ok := vnums[e.To]
+			if !ok {
+				target, err := w.Room(e.To)
+				if err != nil {
+					return nil, err
+				}
+				if to, ok = vnumOf(target.Properties); !ok {
+					continue
+				}
+			}
+
+			exit := Exit{
+				Name:       e.Name,
+				To:         to,
+				Properties: copyProperties(e.Properties),
+			}
+			if e.Pair() != "" {
+				if back, err := w.Exit(e.Pair()); err == nil {
+					exit.Back = back.Name
+				}
+			}
+			if e.Door != nil {
+				exit.Door = &Door{
+					Closed: e.Door.Closed,
+					Locked: e.Door.Locked,
+					Key:    e.Door.Key,
+				}
+			}
+			room.Exits = append(room.Exits, exit)
+		}
+		f.Rooms = append(f.Rooms, room)
+	}
+
+	protos, err := w.Prototypes(id, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range protos {
+		proto := Prototype{
+			Vnum:       p.Vnum,
+			Name:       p.Name,
+			Properties: copyProperties(p.Properties),
+		}
+		switch p.Kind {
+		case world.MobileKind:
+			f.Mobiles = append(f.Mobiles, proto)
+		case world.ObjectKind:
+			f.Objects = append(f.Objects, proto)
+		}
+	}
+
+	resets, err := w.Resets(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resets {
+		f.Resets = append(f.Resets, Reset{
+			Action:    r.Action,
+			Vnum:      r.Vnum,
+			Room:      r.Room,
+			Container: r.Container,
+			Limit:     r.Limit,
+			Count:     r.Count,
+			Wear:      r.Wear,
+			Exit:      r.Exit,
+			State:     r.State,
+		})
+	}
+
+	return f, nil
+}
+
+func vnumOf(props storage.Properties) (int, bool) {
+	switch v := props[world.VnumProperty].(type) {
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+
+	return 0, false
+}
+
+// copy the properties, empty properties are nil so they're left out of files
+func copyProperties(props map[string]interface{}) map[string]interface{} {
+	if len(props) == 0 {
+		return nil
+	}
+
+	c := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,13 @@
+package areafile_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAreafile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Areafile Suite")
+}
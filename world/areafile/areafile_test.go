@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package areafile_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+	"github.com/bbuck/dragon-mud/world"
+
+	. "github.com/bbuck/dragon-mud/world/areafile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Areafile", func() {
+	var (
+		w   *world.World
+		rom *File
+	)
+
+	BeforeEach(func() {
+		w = world.New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+
+		var err error
+		rom, err = ParseROM(strings.NewReader(romArea))
+		Ω(err).Should(BeNil())
+	})
+
+	Describe("Import", func() {
+		var res *Result
+
+		BeforeEach(func() {
+			var err error
+			res, err = Import(w, rom, ImportOptions{})
+			Ω(err).Should(BeNil())
+		})
+
+		It("imports everything in the file", func() {
+			Ω(res.Area.Name).Should(Equal("Tiny Town"))
+			Ω(res.Rooms).Should(Equal(2))
+			Ω(res.Exits).Should(Equal(2))
+			Ω(res.Mobiles).Should(Equal(1))
+			Ω(res.Objects).Should(Equal(1))
+			Ω(res.Resets).Should(Equal(4))
+			Ω(res.Warnings).Should(Equal([]string{
+				"room 3002: exit east leads to room 9999 which doesn't exist",
+			}))
+		})
+
+		It("writes rooms into the world", func() {
+			temple, err := w.FindRoom(3001)
+			Ω(err).Should(BeNil())
+			Ω(temple.Area).Should(Equal(res.Area.ID))
+			Ω(temple.Properties["extra:altar"]).Should(Equal("A plain altar.\n"))
+		})
+
+		It("links exits both ways with their own properties", func() {
+			temple, _ := w.FindRoom(3001)
+			north, err := w.FindExit(temple.ID, "north")
+			Ω(err).Should(BeNil())
+			Ω(north.Pair()).ShouldNot(BeEmpty())
+			Ω(north.Door).Should(Equal(&world.Door{Key: "3001"}))
+			Ω(north.Properties).Should(Equal(storage.Properties{"description": "You see the square.\n"}))
+
+			south, err := w.Exit(north.Pair())
+			Ω(err).Should(BeNil())
+			Ω(south.Name).Should(Equal("south"))
+			Ω(south.Properties).Should(Equal(storage.Properties{"keywords": "door"}))
+		})
+
+		It("writes prototypes and resets", func() {
+			wizard, err := w.FindPrototype(world.MobileKind, 3000)
+			Ω(err).Should(BeNil())
+			Ω(wizard.Name).Should(Equal("the wizard"))
+			Ω(wizard.Area).Should(Equal(res.Area.ID))
+
+			resets, err := w.Resets(res.Area.ID)
+			Ω(err).Should(BeNil())
+			Ω(resets).Should(HaveLen(4))
+			Ω(resets[2].State).Should(Equal("locked"))
+		})
+
+		It("doesn't import an area twice", func() {
+			_, err := Import(w, rom, ImportOptions{})
+			Ω(err).Should(Equal(ErrAreaExists))
+		})
+
+		It("doesn't reuse vnums from other areas", func() {
+			_, err := Import(w, rom, ImportOptions{Name: "Copy"})
+			Ω(err).Should(MatchError("areafile: room 3001 is already in the world"))
+		})
+
+		It("replaces areas", func() {
+			again, err := Import(w, rom, ImportOptions{Replace: true})
+			Ω(err).Should(BeNil())
+			Ω(again.Area.ID).Should(Equal(res.Area.ID))
+
+			rooms, err := w.Rooms(res.Area.ID)
+			Ω(err).Should(BeNil())
+			Ω(rooms).Should(HaveLen(2))
+			resets, err := w.Resets(res.Area.ID)
+			Ω(err).Should(BeNil())
+			Ω(resets).Should(HaveLen(4))
+		})
+
+		Context("with a file that can't be imported", func() {
+			var broken *File
+
+			BeforeEach(func() {
+				copied := *rom
+				copied.Rooms = append(append([]Room(nil), rom.Rooms...), Room{Vnum: 3050})
+				copied.Mobiles = append(append([]Prototype(nil), rom.Mobiles...), rom.Mobiles[0])
+				broken = &copied
+			})
+
+			It("doesn't touch the area it would replace", func() {
+				_, err := Import(w, broken, ImportOptions{Replace: true})
+				Ω(err).Should(MatchError("areafile: room 3050: " + world.ErrMissingName.Error()))
+
+				rooms, err := w.Rooms(res.Area.ID)
+				Ω(err).Should(BeNil())
+				Ω(rooms).Should(HaveLen(2))
+				resets, err := w.Resets(res.Area.ID)
+				Ω(err).Should(BeNil())
+				Ω(resets).Should(HaveLen(4))
+			})
+
+			It("doesn't create an area", func() {
+				broken.Rooms = rom.Rooms
+				_, err := Import(w, broken, ImportOptions{Name: "Copy", Replace: true})
+				Ω(err).Should(MatchError(ContainSubstring("is in the file more than once")))
+
+				_, err = w.FindArea("Copy")
+				Ω(err).Should(Equal(world.ErrAreaNotFound))
+			})
+		})
+	})
+
+	Describe("Export", func() {
+		var exported *File
+
+		BeforeEach(func() {
+			res, err := Import(w, rom, ImportOptions{})
+			Ω(err).Should(BeNil())
+			exported, err = Export(w, res.Area.ID)
+			Ω(err).Should(BeNil())
+		})
+
+		It("exports what was imported", func() {
+			Ω(exported.Area.Name).Should(Equal("Tiny Town"))
+			Ω(exported.Rooms).Should(HaveLen(2))
+			Ω(exported.Rooms[0].Exits).Should(Equal([]Exit{{
+				Name:       "north",
+				To:         3002,
+				Back:       "south",
+				Door:       &Door{Key: "3001"},
+				Properties: map[string]interface{}{"description": "You see the square.\n"},
+			}}))
+			Ω(exported.Mobiles).Should(HaveLen(1))
+			Ω(exported.Objects).Should(HaveLen(1))
+			Ω(exported.Resets).Should(Equal(rom.Resets))
+		})
+
+		for _, format := range []string{FormatTOML, FormatJSON} {
+			format := format
+
+			It("round trips through "+format, func() {
+				var buf bytes.Buffer
+				Ω(Write(&buf, exported, format)).Should(BeNil())
+				written := buf.String()
+
+				read, err := Read(strings.NewReader(written), format)
+				Ω(err).Should(BeNil())
+
+				other := world.New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+				res, err := Import(other, read, ImportOptions{})
+				Ω(err).Should(BeNil())
+				again, err := Export(other, res.Area.ID)
+				Ω(err).Should(BeNil())
+
+				buf.Reset()
+				Ω(Write(&buf, again, format)).Should(BeNil())
+				Ω(buf.String()).Should(Equal(written))
+			})
+		}
+
+		It("writes readable TOML", func() {
+			var buf bytes.Buffer
+			Ω(Write(&buf, exported, FormatTOML)).Should(BeNil())
+			Ω(buf.String()).Should(HavePrefix(`[area]
+name = "Tiny Town"
+
+[area.properties]
+credits = "{ 1 50} Builder Tiny Town"
+file = "tiny.are"
+vnum_high = 3099
+vnum_low = 3000
+
+[[rooms]]
+vnum = 3001
+name = "The Temple"
+
+[rooms.properties]
+description = """
+You are in the temple.
+"""
+"extra:altar" = """
+A plain altar.
+"""
+flags = "CDS"
+sector = "inside"
+
+[[rooms.exits]]
+name = "north"
+to = 3002
+back = "south"
+
+[rooms.exits.door]
+closed = false
+locked = false
+key = "3001"
+`))
+		})
+
+		It("can't write ROM files", func() {
+			Ω(Write(new(bytes.Buffer), exported, FormatROM)).Should(Equal(UnknownFormatError(FormatROM)))
+		})
+	})
+
+	It("picks formats from file names", func() {
+		Ω(FormatFor("midgaard.are")).Should(Equal(FormatROM))
+		Ω(FormatFor("midgaard.JSON")).Should(Equal(FormatJSON))
+		Ω(FormatFor("midgaard.toml")).Should(Equal(FormatTOML))
+	})
+})
@@ -0,0 +1,329 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package areafile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Formats area files can be in, ROM files can only be read.
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatROM  = "rom"
+)
+
+// UnknownFormatError is returned for formats that aren't supported.
+type UnknownFormatError string
+
+// Error describes the format requested.
+func (ufe UnknownFormatError) Error() string {
+	return fmt.Sprintf("areafile: unknown format %q, expected %q, %q or %q", string(ufe), FormatTOML, FormatJSON, FormatROM)
+}
+
+// FormatFor picks the format of a file from it's extension, ".are" files are
+// ROM files, ".json" files JSON and anything else TOML.
+func FormatFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".are":
+		return FormatROM
+	case ".json":
+		return FormatJSON
+	}
+
+	return FormatTOML
+}
+
+// ReadFile reads the area file in the format picked by FormatFor.
+func ReadFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file, FormatFor(path))
+}
+
+// Read reads an area in the format.
+func Read(r io.Reader, format string) (*File, error) {
+	switch format {
+	case FormatROM:
+		return ParseROM(r)
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		// properties keep integers as integers
+		dec.UseNumber()
+		f := new(File)
+		if err := dec.Decode(f); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+	case FormatTOML:
+		v := viper.New()
+		v.SetConfigType("toml")
+		if err := v.ReadConfig(r); err != nil {
+			return nil, err
+		}
+
+		f := new(File)
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			WeaklyTypedInput: true,
+			Result:           f,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := dec.Decode(v.AllSettings()); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+	}
+
+	return nil, UnknownFormatError(format)
+}
+
+// Write writes the area in the format, TOML or JSON. Both are written the
+// same way every time so changes to an area are easy to follow.
+func Write(w io.Writer, f *File, format string) error {
+	switch format {
+	case FormatJSON:
+		b, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+		_, err = w.Write(b)
+
+		return err
+	case FormatTOML:
+		_, err := w.Write(encodeTOML(f))
+
+		return err
+	}
+
+	return UnknownFormatError(format)
+}
+
+// the format is fixed so it's written directly, instead of through a
+// generic encoder, to keep a stable order of tables and keys
+func encodeTOML(f *File) []byte {
+	t := new(tomlWriter)
+	t.table("area")
+	t.value("name", f.Area.Name)
+	t.properties("area.properties", f.Area.Properties)
+
+	for _, r := range f.Rooms {
+		t.arrayTable("rooms")
+		t.value("vnum", r.Vnum)
+		t.value("name", r.Name)
+		t.properties("rooms.properties", r.Properties)
+		for _, e := range r.Exits {
+			t.arrayTable("rooms.exits")
+			t.value("name", e.Name)
+			t.value("to", e.To)
+			if e.Back != "" {
+				t.value("back", e.Back)
+			}
+			if e.Door != nil {
+				t.table("rooms.exits.door")
+				t.value("closed", e.Door.Closed)
+				t.value("locked", e.Door.Locked)
+				if e.Door.Key != "" {
+					t.value("key", e.Door.Key)
+				}
+			}
+			t.properties("rooms.exits.properties", e.Properties)
+		}
+	}
+
+	for _, list := range []struct {
+		name   string
+		protos []Prototype
+	}{{"mobiles", f.Mobiles}, {"objects", f.Objects}} {
+		for _, p := range list.protos {
+			t.arrayTable(list.name)
+			t.value("vnum", p.Vnum)
+			t.value("name", p.Name)
+			t.properties(list.name+".properties", p.Properties)
+		}
+	}
+
+	for _, r := range f.Resets {
+		t.arrayTable("resets")
+		t.value("action", r.Action)
+		for _, v := range []struct {
+			key string
+			val int
+		}{{"vnum", r.Vnum}, {"room", r.Room}, {"container", r.Container}, {"limit", r.Limit}, {"count", r.Count}} {
+			if v.val != 0 {
+				t.value(v.key, v.val)
+			}
+		}
+		for _, v := range []struct {
+			key string
+			val string
+		}{{"wear", r.Wear}, {"exit", r.Exit}, {"state", r.State}} {
+			if v.val != "" {
+				t.value(v.key, v.val)
+			}
+		}
+	}
+
+	return t.buf.Bytes()
+}
+
+type tomlWriter struct {
+	buf bytes.Buffer
+}
+
+func (t *tomlWriter) header(h string) {
+	if t.buf.Len() > 0 {
+		t.buf.WriteByte('\n')
+	}
+	t.buf.WriteString(h)
+	t.buf.WriteByte('\n')
+}
+
+func (t *tomlWriter) table(name string) {
+	t.header("[" + name + "]")
+}
+
+func (t *tomlWriter) arrayTable(name string) {
+	t.header("[[" + name + "]]")
+}
+
+func (t *tomlWriter) properties(name string, props map[string]interface{}) {
+	if len(props) == 0 {
+		return
+	}
+
+	t.table(name)
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		t.value(k, props[k])
+	}
+}
+
+func (t *tomlWriter) value(key string, val interface{}) {
+	t.buf.WriteString(tomlKey(key))
+	t.buf.WriteString(" = ")
+	t.buf.WriteString(tomlValue(val))
+	t.buf.WriteByte('\n')
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+
+	return tomlString(key)
+}
+
+func tomlValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		if strings.Contains(v, "\n") {
+			return `"""` + "\n" + escapeTOML(v, true) + `"""`
+		}
+
+		return tomlString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case json.Number:
+		return v.String()
+	case float64:
+		return tomlFloat(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = tomlValue(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = tomlString(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return tomlString(fmt.Sprint(val))
+}
+
+func tomlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func tomlString(s string) string {
+	return `"` + escapeTOML(s, false) + `"`
+}
+
+// escape the string for a basic string, multiline strings keep their new
+// lines
+func escapeTOML(s string, multiline bool) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\n' && multiline:
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,530 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package areafile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bbuck/dragon-mud/world"
+)
+
+// ParseError describes a problem with a ROM area file.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+// Error describes the problem and where it was found.
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("areafile: line %d: %s", pe.Line, pe.Msg)
+}
+
+// exits in ROM files are numbered
+var romDirections = []string{"north", "east", "south", "west", "up", "down"}
+
+var romSectors = []string{
+	"inside", "city", "field", "forest", "hills", "mountain",
+	"water_swim", "water_noswim", "unused", "air", "desert",
+}
+
+var romWearLocations = []string{
+	"light", "finger_l", "finger_r", "neck_1", "neck_2", "body", "head",
+	"legs", "feet", "hands", "arms", "shield", "about", "waist", "wrist_l",
+	"wrist_r", "wield", "hold", "float",
+}
+
+var romDoorStates = []string{"open", "closed", "locked"}
+
+// ParseROM reads a ROM 2.4 style area file, the #AREA, #ROOMS, #MOBILES,
+// #OBJECTS and #RESETS sections are read and any other section (#HELPS,
+// #SHOPS, #SPECIALS, ...) is skipped. Flags are kept as they're written in the
+// file, exits found in both rooms they join are linked both ways and extra
+// descriptions become "extra:<keywords>" properties.
+func ParseROM(in io.Reader) (f *File, err error) {
+	r := &romReader{
+		in:   bufio.NewReader(in),
+		line: 1,
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			pe, ok := rec.(*ParseError)
+			if !ok {
+				panic(rec)
+			}
+			f, err = nil, pe
+		}
+	}()
+
+	f = new(File)
+	for {
+		if c := r.letter(); c != '#' {
+			r.fail("expected a section, found %q", c)
+		}
+
+		switch section := r.word(); section {
+		case "$":
+			pairROMExits(f)
+
+			return f, nil
+		case "AREA":
+			r.area(f)
+		case "ROOMS":
+			r.rooms(f)
+		case "MOBILES":
+			r.mobiles(f)
+		case "OBJECTS":
+			r.objects(f)
+		case "RESETS":
+			r.resets(f)
+		default:
+			r.skipSection()
+		}
+	}
+}
+
+// exits are listed in each room they leave, when two rooms lead to each
+// other in opposite directions they're linked both ways
+func pairROMExits(f *File) {
+	rooms := make(map[int]*Room, len(f.Rooms))
+	for i := range f.Rooms {
+		rooms[f.Rooms[i].Vnum] = &f.Rooms[i]
+	}
+
+	for i := range f.Rooms {
+		from := &f.Rooms[i]
+		for j := range from.Exits {
+			e := &from.Exits[j]
+			to, ok := rooms[e.To]
+			d, isDir := world.ParseDirection(e.Name)
+			if !ok || !isDir {
+				continue
+			}
+			for k := range to.Exits {
+				back := &to.Exits[k]
+				if back.Name == string(d.Opposite()) && back.To == from.Vnum {
+					e.Back = back.Name
+					back.Back = e.Name
+				}
+			}
+		}
+	}
+}
+
+// romReader reads the tokens of an area file, it panics with a *ParseError
+// when the file is invalid.
+type romReader struct {
+	in   *bufio.Reader
+	line int
+}
+
+func (r *romReader) fail(format string, args ...interface{}) {
+	panic(&ParseError{
+		Line: r.line,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *romReader) read() byte {
+	c, err := r.in.ReadByte()
+	if err == io.EOF {
+		r.fail("unexpected end of file")
+	}
+	if err != nil {
+		r.fail("%s", err)
+	}
+	if c == '\n' {
+		r.line++
+	}
+
+	return c
+}
+
+func (r *romReader) unread(c byte) {
+	r.in.UnreadByte()
+	if c == '\n' {
+		r.line--
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// the next character that isn't a space
+func (r *romReader) letter() byte {
+	for {
+		if c := r.read(); !isSpace(c) {
+			return c
+		}
+	}
+}
+
+// the next word, words in quotes can have spaces
+func (r *romReader) word() string {
+	c := r.letter()
+	if c == '\'' || c == '"' {
+		quote := c
+		var buf []byte
+		for c = r.read(); c != quote; c = r.read() {
+			buf = append(buf, c)
+		}
+
+		return string(buf)
+	}
+
+	buf := []byte{c}
+	for {
+		c, err := r.in.ReadByte()
+		if err != nil {
+			return string(buf)
+		}
+		if isSpace(c) {
+			// read without counting lines, so it's put back the same way
+			r.in.UnreadByte()
+
+			return string(buf)
+		}
+		buf = append(buf, c)
+	}
+}
+
+func (r *romReader) number() int {
+	w := r.word()
+	n, err := strconv.Atoi(w)
+	if err != nil {
+		r.fail("expected a number, found %q", w)
+	}
+
+	return n
+}
+
+// a string ending with a ~, leading spaces are dropped
+func (r *romReader) str() string {
+	c := r.letter()
+	var buf []byte
+	for ; c != '~'; c = r.read() {
+		if c != '\r' {
+			buf = append(buf, c)
+		}
+	}
+
+	return string(buf)
+}
+
+// the rest of the line
+func (r *romReader) eol() string {
+	var buf []byte
+	for {
+		c, err := r.in.ReadByte()
+		if err != nil || c == '\n' {
+			if err == nil {
+				r.line++
+			}
+
+			return strings.TrimRight(string(buf), "\r")
+		}
+		buf = append(buf, c)
+	}
+}
+
+// skip to the next section, sections start at the beginning of a line with #
+// followed by a letter or $
+func (r *romReader) skipSection() {
+	r.eol()
+	for {
+		b, err := r.in.Peek(2)
+		if err != nil {
+			r.fail("unexpected end of file")
+		}
+		if b[0] == '#' && (b[1] == '$' || (b[1] >= 'A' && b[1] <= 'Z')) {
+			return
+		}
+		r.eol()
+	}
+}
+
+// the vnum starting the next entry in a section, 0 ends the section
+func (r *romReader) vnum() int {
+	if c := r.letter(); c != '#' {
+		r.fail("expected a vnum, found %q", c)
+	}
+
+	return r.number()
+}
+
+func (r *romReader) area(f *File) {
+	first := r.str()
+	c := r.letter()
+	r.unread(c)
+	if c == '#' {
+		// older areas have a single "{credits} name" string
+		name := first
+		if i := strings.Index(name, "}"); strings.HasPrefix(name, "{") && i > 0 {
+			name = name[i+1:]
+		}
+		f.Area.Name = strings.TrimSpace(name)
+		f.Area.Properties = map[string]interface{}{"credits": first}
+
+		return
+	}
+
+	f.Area.Name = r.str()
+	f.Area.Properties = map[string]interface{}{
+		"file":      first,
+		"credits":   r.str(),
+		"vnum_low":  r.number(),
+		"vnum_high": r.number(),
+	}
+}
+
+func (r *romReader) rooms(f *File) {
+	for vnum := r.vnum(); vnum != 0; vnum = r.vnum() {
+		room := Room{
+			Vnum: vnum,
+			Name: r.str(),
+		}
+		props := map[string]interface{}{
+			"description": r.str(),
+		}
+		r.word() // the area number, unused
+		if flags := r.word(); flags != "0" {
+			props["flags"] = flags
+		}
+		props["sector"] = romName(romSectors, r.number())
+
+	fields:
+		for {
+			switch c := r.letter(); c {
+			case 'S':
+				break fields
+			case 'H':
+				props["heal_rate"] = r.number()
+			case 'M':
+				props["mana_rate"] = r.number()
+			case 'C':
+				props["clan"] = r.str()
+			case 'O':
+				props["owner"] = r.str()
+			case 'E':
+				r.extra(props)
+			case 'D':
+				room.Exits = append(room.Exits, r.exit())
+			default:
+				r.fail("unexpected %q in room %d", c, vnum)
+			}
+		}
+
+		room.Properties = props
+		f.Rooms = append(f.Rooms, room)
+	}
+}
+
+func (r *romReader) exit() Exit {
+	e := Exit{Name: romName(romDirections, r.number())}
+	props := make(map[string]interface{})
+	if desc := r.str(); desc != "" {
+		props["description"] = desc
+	}
+	if keywords := r.str(); keywords != "" {
+		props["keywords"] = keywords
+	}
+	locks, key := r.number(), r.number()
+	e.To = r.number()
+
+	if locks > 0 {
+		e.Door = new(Door)
+		if key > 0 {
+			e.Door.Key = strconv.Itoa(key)
+		}
+	}
+	switch locks {
+	case 2:
+		props["pickproof"] = true
+	case 3:
+		props["nopass"] = true
+	case 4:
+		props["pickproof"] = true
+		props["nopass"] = true
+	}
+	if len(props) > 0 {
+		e.Properties = props
+	}
+
+	return e
+}
+
+// extra descriptions are kept as properties named after their keywords
+func (r *romReader) extra(props map[string]interface{}) {
+	keywords := strings.ToLower(r.str())
+	props["extra:"+keywords] = r.str()
+}
+
+func (r *romReader) mobiles(f *File) {
+	for vnum := r.vnum(); vnum != 0; vnum = r.vnum() {
+		keywords := r.str()
+		p := Prototype{
+			Vnum: vnum,
+			Name: r.str(),
+		}
+		props := map[string]interface{}{
+			"keywords":    keywords,
+			"long":        r.str(),
+			"description": r.str(),
+			"race":        r.str(),
+		}
+		r.fields(props, "act", "affect", "alignment", "group")
+		r.fields(props, "level", "hitroll", "hit", "mana", "damage", "dam_type")
+		props["armor"] = []interface{}{r.number(), r.number(), r.number(), r.number()}
+		r.fields(props, "offense", "immune", "resist", "vulnerable")
+		r.fields(props, "start_position", "position", "sex", "wealth")
+		r.fields(props, "form", "parts", "size", "material")
+
+		var programs []interface{}
+	extras:
+		for {
+			c := r.letter()
+			switch c {
+			case 'F':
+				kind := r.word()
+				props["remove_"+kind] = r.word()
+			case 'M':
+				trigger := r.word()
+				program := r.word()
+				programs = append(programs, fmt.Sprintf("%s %s %s", trigger, program, r.str()))
+			default:
+				r.unread(c)
+
+				break extras
+			}
+		}
+		if len(programs) > 0 {
+			props["programs"] = programs
+		}
+
+		p.Properties = props
+		f.Mobiles = append(f.Mobiles, p)
+	}
+}
+
+func (r *romReader) objects(f *File) {
+	for vnum := r.vnum(); vnum != 0; vnum = r.vnum() {
+		keywords := r.str()
+		p := Prototype{
+			Vnum: vnum,
+			Name: r.str(),
+		}
+		props := map[string]interface{}{
+			"keywords": keywords,
+			"long":     r.str(),
+			"material": r.str(),
+		}
+		r.fields(props, "type", "extra_flags", "wear_flags")
+		props["values"] = []interface{}{r.word(), r.word(), r.word(), r.word(), r.word()}
+		r.fields(props, "level", "weight", "cost", "condition")
+
+		var applies, affects []interface{}
+	extras:
+		for {
+			c := r.letter()
+			switch c {
+			case 'A':
+				applies = append(applies, fmt.Sprintf("%d %d", r.number(), r.number()))
+			case 'F':
+				affects = append(affects, fmt.Sprintf("%s %d %d %s", r.word(), r.number(), r.number(), r.word()))
+			case 'E':
+				r.extra(props)
+			default:
+				r.unread(c)
+
+				break extras
+			}
+		}
+		if len(applies) > 0 {
+			props["applies"] = applies
+		}
+		if len(affects) > 0 {
+			props["affects"] = affects
+		}
+
+		p.Properties = props
+		f.Objects = append(f.Objects, p)
+	}
+}
+
+func (r *romReader) resets(f *File) {
+	for {
+		c := r.letter()
+		switch c {
+		case 'S':
+			return
+		case '*':
+			r.eol()
+
+			continue
+		}
+
+		// the numbers are followed by comments
+		var args []int
+		for _, field := range strings.Fields(r.eol()) {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				break
+			}
+			args = append(args, n)
+		}
+		// args[0] is unused by ROM
+		arg := func(i int) int {
+			if i < len(args) {
+				return args[i]
+			}
+
+			return 0
+		}
+
+		var reset Reset
+		switch c {
+		case 'M':
+			reset = Reset{Action: world.ResetMobile, Vnum: arg(1), Limit: arg(2), Room: arg(3), Count: arg(4)}
+		case 'O':
+			reset = Reset{Action: world.ResetObject, Vnum: arg(1), Room: arg(3)}
+		case 'P':
+			reset = Reset{Action: world.ResetPut, Vnum: arg(1), Limit: arg(2), Container: arg(3), Count: arg(4)}
+		case 'G':
+			reset = Reset{Action: world.ResetGive, Vnum: arg(1), Limit: arg(2)}
+		case 'E':
+			reset = Reset{Action: world.ResetEquip, Vnum: arg(1), Limit: arg(2), Wear: romName(romWearLocations, arg(3))}
+		case 'D':
+			reset = Reset{Action: world.ResetDoor, Room: arg(1), Exit: romName(romDirections, arg(2)), State: romName(romDoorStates, arg(3))}
+		case 'R':
+			reset = Reset{Action: world.ResetRandomize, Room: arg(1), Count: arg(2)}
+		default:
+			r.fail("unknown reset %q", c)
+		}
+		f.Resets = append(f.Resets, reset)
+	}
+}
+
+// read words into the properties, numbers are kept as numbers
+func (r *romReader) fields(props map[string]interface{}, names ...string) {
+	for _, name := range names {
+		w := r.word()
+		if n, err := strconv.Atoi(w); err == nil {
+			props[name] = n
+		} else {
+			props[name] = w
+		}
+	}
+}
+
+// the name at the index, or the index when it's out of range
+func romName(names []string, i int) string {
+	if i >= 0 && i < len(names) {
+		return names[i]
+	}
+
+	return strconv.Itoa(i)
+}
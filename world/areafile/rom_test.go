@@ -0,0 +1,213 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package areafile_test
+
+import (
+	"strings"
+
+	. "github.com/bbuck/dragon-mud/world/areafile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a trimmed down ROM area, with a section the parser skips
+const romArea = `#AREA
+tiny.are~
+Tiny Town~
+{ 1 50} Builder Tiny Town~
+3000 3099
+
+#HELPS
+0 TINY~
+Tiny Town is very small.
+~
+0 $~
+
+#MOBILES
+#3000
+wizard~
+the wizard~
+A wizard walks around behind the counter, talking to himself.
+~
+The wizard looks old and senile.
+~
+human~
+ABV DFHJ 900 0
+31 20 31d11+1200 31d9+100 3d9+20 blast
+-14 -14 -14 -2
+0 0 0 0
+stand stand male 10000
+0 0 medium 0
+F act V
+M greet 3000 100~
+#0
+
+#OBJECTS
+#3001
+barrel beer~
+a barrel of beer~
+A beer barrel has been left here.~
+wood~
+drink_container 0 A
+300 300 'beer' 0 0
+0 160 100 P
+A
+17 2
+E
+barrel~
+It's full of beer.
+~
+#0
+
+#ROOMS
+#3001
+The Temple~
+You are in the temple.
+~
+0 CDS 0
+D0
+You see the square.
+~
+~
+0 -1 3002
+E
+altar~
+A plain altar.
+~
+S
+#3002
+The Square~
+The square is busy.
+~
+0 0 1
+D2
+~
+door~
+1 3001 3001
+D1
+~
+~
+0 0 9999
+H 150
+S
+#0
+
+#SPECIALS
+M 3000 spec_cast_mage
+S
+
+#RESETS
+* the wizard
+M 0 3000 1 3002 1	* the wizard
+E 1 3001 0 16
+D 0 3002 2 2
+O 0 3001 0 3001
+S
+
+#$
+`
+
+var _ = Describe("ParseROM", func() {
+	var (
+		f   *File
+		err error
+	)
+
+	BeforeEach(func() {
+		f, err = ParseROM(strings.NewReader(romArea))
+	})
+
+	It("parses the file", func() {
+		Ω(err).Should(BeNil())
+	})
+
+	It("reads the area", func() {
+		Ω(f.Area).Should(Equal(Area{
+			Name: "Tiny Town",
+			Properties: map[string]interface{}{
+				"file":      "tiny.are",
+				"credits":   "{ 1 50} Builder Tiny Town",
+				"vnum_low":  3000,
+				"vnum_high": 3099,
+			},
+		}))
+	})
+
+	It("reads rooms", func() {
+		Ω(f.Rooms).Should(HaveLen(2))
+
+		temple := f.Rooms[0]
+		Ω(temple.Vnum).Should(Equal(3001))
+		Ω(temple.Name).Should(Equal("The Temple"))
+		Ω(temple.Properties).Should(Equal(map[string]interface{}{
+			"description": "You are in the temple.\n",
+			"flags":       "CDS",
+			"sector":      "inside",
+			"extra:altar": "A plain altar.\n",
+		}))
+		Ω(temple.Exits).Should(Equal([]Exit{{
+			Name:       "north",
+			To:         3002,
+			Back:       "south",
+			Properties: map[string]interface{}{"description": "You see the square.\n"},
+		}}))
+
+		square := f.Rooms[1]
+		Ω(square.Properties["heal_rate"]).Should(Equal(150))
+		Ω(square.Properties["sector"]).Should(Equal("city"))
+		Ω(square.Exits).Should(Equal([]Exit{
+			{
+				Name:       "south",
+				To:         3001,
+				Back:       "north",
+				Door:       &Door{Key: "3001"},
+				Properties: map[string]interface{}{"keywords": "door"},
+			},
+			{Name: "east", To: 9999},
+		}))
+	})
+
+	It("reads mobiles", func() {
+		Ω(f.Mobiles).Should(HaveLen(1))
+
+		wizard := f.Mobiles[0]
+		Ω(wizard.Vnum).Should(Equal(3000))
+		Ω(wizard.Name).Should(Equal("the wizard"))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("keywords", "wizard"))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("level", 31))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("hit", "31d11+1200"))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("armor", []interface{}{-14, -14, -14, -2}))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("remove_act", "V"))
+		Ω(wizard.Properties).Should(HaveKeyWithValue("programs", []interface{}{"greet 3000 100"}))
+	})
+
+	It("reads objects", func() {
+		Ω(f.Objects).Should(HaveLen(1))
+
+		barrel := f.Objects[0]
+		Ω(barrel.Name).Should(Equal("a barrel of beer"))
+		Ω(barrel.Properties).Should(HaveKeyWithValue("type", "drink_container"))
+		Ω(barrel.Properties).Should(HaveKeyWithValue("values", []interface{}{"300", "300", "beer", "0", "0"}))
+		Ω(barrel.Properties).Should(HaveKeyWithValue("weight", 160))
+		Ω(barrel.Properties).Should(HaveKeyWithValue("applies", []interface{}{"17 2"}))
+		Ω(barrel.Properties).Should(HaveKeyWithValue("extra:barrel", "It's full of beer.\n"))
+	})
+
+	It("reads resets", func() {
+		Ω(f.Resets).Should(Equal([]Reset{
+			{Action: "mobile", Vnum: 3000, Limit: 1, Room: 3002, Count: 1},
+			{Action: "equip", Vnum: 3001, Wear: "wield"},
+			{Action: "door", Room: 3002, Exit: "south", State: "locked"},
+			{Action: "object", Vnum: 3001, Room: 3001},
+		}))
+	})
+
+	It("reports where the file is invalid", func() {
+		_, err := ParseROM(strings.NewReader("#ROOMS\n#3001\nRoom~\nDesc~\n0 0 0\nX\n"))
+		Ω(err).Should(Equal(&ParseError{Line: 6, Msg: `unexpected 'X' in room 3001`}))
+
+		_, err = ParseROM(strings.NewReader("#ROOMS\n#3001\nRoom~\n"))
+		Ω(err).Should(MatchError(ContainSubstring("unexpected end of file")))
+	})
+})
@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import "strings"
+
+// Direction is a compass (or vertical) direction an exit can lead in.
+type Direction string
+
+// Directions understood by the world, exits named after a direction are
+// linked back in the opposite direction by default.
+const (
+	North     Direction = "north"
+	South     Direction = "south"
+	East      Direction = "east"
+	West      Direction = "west"
+	Northeast Direction = "northeast"
+	Northwest Direction = "northwest"
+	Southeast Direction = "southeast"
+	Southwest Direction = "southwest"
+	Up        Direction = "up"
+	Down      Direction = "down"
+	In        Direction = "in"
+	Out       Direction = "out"
+)
+
+// Directions lists every direction, in the order they're usually shown.
+var Directions = []Direction{
+	North, South, East, West,
+	Northeast, Northwest, Southeast, Southwest,
+	Up, Down, In, Out,
+}
+
+var opposites = map[Direction]Direction{
+	North:     South,
+	South:     North,
+	East:      West,
+	West:      East,
+	Northeast: Southwest,
+	Southwest: Northeast,
+	Northwest: Southeast,
+	Southeast: Northwest,
+	Up:        Down,
+	Down:      Up,
+	In:        Out,
+	Out:       In,
+}
+
+var directionAliases = map[string]Direction{
+	"n":  North,
+	"s":  South,
+	"e":  East,
+	"w":  West,
+	"ne": Northeast,
+	"nw": Northwest,
+	"se": Southeast,
+	"sw": Southwest,
+	"u":  Up,
+	"d":  Down,
+}
+
+// ParseDirection understands full direction names and their abbreviations
+// like "n" or "sw", case insensitively.
+func ParseDirection(str string) (Direction, bool) {
+	str = strings.ToLower(strings.TrimSpace(str))
+	if d, ok := directionAliases[str]; ok {
+		return d, true
+	}
+	if _, ok := opposites[Direction(str)]; ok {
+		return Direction(str), true
+	}
+
+	return "", false
+}
+
+// Opposite returns the direction leading back the way this one came.
+func (d Direction) Opposite() Direction {
+	return opposites[d]
+}
+
+// ExitName normalizes the name of an exit, directions are given their full
+// name and other names are lowercased.
+func ExitName(name string) string {
+	if d, ok := ParseDirection(name); ok {
+		return string(d)
+	}
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
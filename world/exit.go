@@ -0,0 +1,378 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"sort"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// properties of an exit relationship the world manages itself
+const (
+	exitNameProperty   = "name"
+	exitPairProperty   = "pair"
+	exitDoorProperty   = "door"
+	exitClosedProperty = "closed"
+	exitLockedProperty = "locked"
+	exitKeyProperty    = "key"
+)
+
+var managedExitProperties = []string{
+	exitNameProperty,
+	exitPairProperty,
+	exitDoorProperty,
+	exitClosedProperty,
+	exitLockedProperty,
+	exitKeyProperty,
+}
+
+// Door blocks an exit while it's closed, locked doors can't be opened until
+// they're unlocked. A door with a Key can only be locked and unlocked with
+// that key, what the key is (an item ID, a password) is up to the game.
+type Door struct {
+	Closed bool
+	Locked bool
+	Key    string
+}
+
+// Exit leads from one room to another. Exits are named after the direction
+// they lead or anything else, like "portal". Exits linked in both directions
+// share their door.
+type Exit struct {
+	ID         string
+	Name       string
+	From       string
+	To         string
+	Door       *Door
+	Properties storage.Properties
+
+	pair string
+}
+
+// Direction returns the direction the exit leads, if it's named after one.
+func (e *Exit) Direction() (Direction, bool) {
+	return ParseDirection(e.Name)
+}
+
+// Blocked determines if there's a closed door in the way.
+func (e *Exit) Blocked() bool {
+	return e.Door != nil && e.Door.Closed
+}
+
+// Pair is the ID of the exit leading back, if the exit was linked both ways.
+func (e *Exit) Pair() string {
+	return e.pair
+}
+
+// LinkOptions control how two rooms are linked.
+type LinkOptions struct {
+	// OneWay only creates the exit from the first room.
+	OneWay bool
+
+	// Back is the name of the exit leading back, it defaults to the opposite
+	// direction or to the same name for exits that aren't directions.
+	Back string
+
+	// Door puts a door in the exit, shared by the exit leading back.
+	Door *Door
+
+	// Properties are given to the exits in both directions.
+	Properties storage.Properties
+}
+
+// Link creates an exit from one room to another, and unless it's one way, an
+// exit back.
+func (w *World) Link(from, to, name string, opts LinkOptions) (*Exit, error) {
+	name = ExitName(name)
+	if name == "" {
+		return nil, ErrMissingName
+	}
+	back := ExitName(opts.Back)
+	if back == "" {
+		back = name
+		if d, ok := ParseDirection(name); ok {
+			back = string(d.Opposite())
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.node(to, RoomLabel, ErrRoomNotFound); err != nil {
+		return nil, err
+	}
+	if err := w.checkExitFree(from, name); err != nil {
+		return nil, err
+	}
+	if !opts.OneWay {
+		if err := w.checkExitFree(to, back); err != nil {
+			return nil, err
+		}
+	}
+
+	exit, err := w.store.CreateRelationship(from, to, ExitType, exitProperties(name, opts))
+	if err != nil {
+		return nil, err
+	}
+	defer w.changed()
+	if opts.OneWay {
+		return toExit(exit), nil
+	}
+
+	props := exitProperties(back, opts)
+	props[exitPairProperty] = exit.ID
+	reverse, err := w.store.CreateRelationship(to, from, ExitType, props)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.store.UpdateRelationship(exit.ID, storage.Properties{exitPairProperty: reverse.ID}); err != nil {
+		return nil, err
+	}
+	exit.Properties[exitPairProperty] = reverse.ID
+
+	return toExit(exit), nil
+}
+
+// Unlink removes the exit and the exit leading back, if there is one.
+func (w *World) Unlink(id string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	exit, err := w.Exit(id)
+	if err != nil {
+		return err
+	}
+	defer w.changed()
+
+	if err := w.store.DeleteRelationship(exit.ID); err != nil {
+		return err
+	}
+	if exit.pair != "" {
+		if err := w.store.DeleteRelationship(exit.pair); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateExit merges the properties into the exit's, only the exit is changed
+// and not the exit leading back. The name and door can't be changed this way.
+func (w *World) UpdateExit(id string, props storage.Properties) error {
+	if _, err := w.Exit(id); err != nil {
+		return err
+	}
+
+	updates := make(storage.Properties, len(props))
+	for k, v := range props {
+		updates[k] = v
+	}
+	for _, k := range managedExitProperties {
+		delete(updates, k)
+	}
+	defer w.changed()
+
+	return w.store.UpdateRelationship(id, updates)
+}
+
+// Exit fetches the exit with the ID.
+func (w *World) Exit(id string) (*Exit, error) {
+	rel, err := w.store.GetRelationship(id)
+	if err == storage.ErrNotFound || (err == nil && rel.Type != ExitType) {
+		return nil, ErrExitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toExit(rel), nil
+}
+
+// Exits fetches the exits leading out of the room, sorted by name.
+func (w *World) Exits(room string) ([]*Exit, error) {
+	if _, err := w.node(room, RoomLabel, ErrRoomNotFound); err != nil {
+		return nil, err
+	}
+
+	rels, err := w.store.Relationships(room, ExitType, storage.Outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	exits := make([]*Exit, len(rels))
+	for i, r := range rels {
+		exits[i] = toExit(r)
+	}
+	sort.Slice(exits, func(i, j int) bool {
+		return exits[i].Name < exits[j].Name
+	})
+
+	return exits, nil
+}
+
+// FindExit fetches the exit leading out of the room with the name, directions
+// can be abbreviated.
+func (w *World) FindExit(room, name string) (*Exit, error) {
+	exits, err := w.Exits(room)
+	if err != nil {
+		return nil, err
+	}
+
+	name = ExitName(name)
+	for _, e := range exits {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+
+	return nil, ErrExitNotFound
+}
+
+// OpenDoor opens the door in the exit, locked doors must be unlocked first.
+func (w *World) OpenDoor(id string) error {
+	return w.changeDoor(id, EvtDoorOpened, func(d *Door) error {
+		if d.Locked {
+			return ErrDoorLocked
+		}
+		d.Closed = false
+
+		return nil
+	})
+}
+
+// CloseDoor closes the door in the exit.
+func (w *World) CloseDoor(id string) error {
+	return w.changeDoor(id, EvtDoorClosed, func(d *Door) error {
+		d.Closed = true
+
+		return nil
+	})
+}
+
+// LockDoor locks the door in the exit, the door has to be closed and if the
+// door has a key it must be given.
+func (w *World) LockDoor(id, key string) error {
+	return w.changeDoor(id, EvtDoorLocked, func(d *Door) error {
+		if !d.Closed {
+			return ErrDoorOpen
+		}
+		if d.Key != "" && d.Key != key {
+			return ErrWrongKey
+		}
+		d.Locked = true
+
+		return nil
+	})
+}
+
+// UnlockDoor unlocks the door in the exit, if the door has a key it must be
+// given.
+func (w *World) UnlockDoor(id, key string) error {
+	return w.changeDoor(id, EvtDoorUnlocked, func(d *Door) error {
+		if d.Key != "" && d.Key != key {
+			return ErrWrongKey
+		}
+		d.Locked = false
+
+		return nil
+	})
+}
+
+// change the door on both sides of the exit, firing the event when done
+func (w *World) changeDoor(id, evt string, change func(*Door) error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	exit, err := w.Exit(id)
+	if err != nil {
+		return err
+	}
+	if exit.Door == nil {
+		return ErrNoDoor
+	}
+	if err := change(exit.Door); err != nil {
+		return err
+	}
+	defer w.changed()
+
+	props := storage.Properties{
+		exitClosedProperty: exit.Door.Closed,
+		exitLockedProperty: exit.Door.Locked,
+	}
+	if err := w.store.UpdateRelationship(exit.ID, props); err != nil {
+		return err
+	}
+	if exit.pair != "" {
+		if err := w.store.UpdateRelationship(exit.pair, props); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+	}
+
+	w.events.Emit(evt, events.Data{
+		"exit": exit.ID,
+		"room": exit.From,
+		"name": exit.Name,
+	})
+
+	return nil
+}
+
+// ensure the room exists and doesn't have an exit with the name
+func (w *World) checkExitFree(room, name string) error {
+	if _, err := w.FindExit(room, name); err != ErrExitNotFound {
+		if err == nil {
+			return ErrExitExists
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func exitProperties(name string, opts LinkOptions) storage.Properties {
+	props := make(storage.Properties, len(opts.Properties)+5)
+	for k, v := range opts.Properties {
+		props[k] = v
+	}
+	props[exitNameProperty] = name
+	if opts.Door != nil {
+		props[exitDoorProperty] = true
+		props[exitClosedProperty] = opts.Door.Closed
+		props[exitLockedProperty] = opts.Door.Locked
+		if opts.Door.Key != "" {
+			props[exitKeyProperty] = opts.Door.Key
+		}
+	}
+
+	return props
+}
+
+func toExit(r *storage.Relationship) *Exit {
+	props := make(storage.Properties, len(r.Properties))
+	for k, v := range r.Properties {
+		props[k] = v
+	}
+
+	e := &Exit{
+		ID:   r.ID,
+		From: r.From,
+		To:   r.To,
+	}
+	e.Name, _ = props[exitNameProperty].(string)
+	e.pair, _ = props[exitPairProperty].(string)
+	if hasDoor, _ := props[exitDoorProperty].(bool); hasDoor {
+		e.Door = new(Door)
+		e.Door.Closed, _ = props[exitClosedProperty].(bool)
+		e.Door.Locked, _ = props[exitLockedProperty].(bool)
+		e.Door.Key, _ = props[exitKeyProperty].(string)
+	}
+	for _, k := range managedExitProperties {
+		delete(props, k)
+	}
+	e.Properties = props
+
+	return e
+}
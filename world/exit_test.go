@@ -0,0 +1,162 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exit", func() {
+	var (
+		w            *World
+		hall, garden *Room
+	)
+
+	BeforeEach(func() {
+		w = newWorld()
+		hall, _ = w.CreateRoom("Hall", "", nil)
+		garden, _ = w.CreateRoom("Garden", "", nil)
+	})
+
+	Describe("directions", func() {
+		It("parses names and abbreviations", func() {
+			d, ok := ParseDirection("NE")
+			Ω(ok).Should(BeTrue())
+			Ω(d).Should(Equal(Northeast))
+			Ω(d.Opposite()).Should(Equal(Southwest))
+
+			_, ok = ParseDirection("portal")
+			Ω(ok).Should(BeFalse())
+		})
+
+		It("normalizes exit names", func() {
+			Ω(ExitName(" n ")).Should(Equal("north"))
+			Ω(ExitName("Portal")).Should(Equal("portal"))
+		})
+	})
+
+	Describe("Link", func() {
+		It("links rooms in both directions", func() {
+			exit, err := w.Link(hall.ID, garden.ID, "n", LinkOptions{})
+			Ω(err).Should(BeNil())
+			Ω(exit.Name).Should(Equal("north"))
+			d, ok := exit.Direction()
+			Ω(ok).Should(BeTrue())
+			Ω(d).Should(Equal(North))
+
+			back, err := w.FindExit(garden.ID, "s")
+			Ω(err).Should(BeNil())
+			Ω(back.To).Should(Equal(hall.ID))
+		})
+
+		It("links named exits back with the same name", func() {
+			_, err := w.Link(hall.ID, garden.ID, "trellis", LinkOptions{
+				Properties: storage.Properties{"hidden": true},
+			})
+			Ω(err).Should(BeNil())
+
+			back, err := w.FindExit(garden.ID, "trellis")
+			Ω(err).Should(BeNil())
+			Ω(back.Properties).Should(Equal(storage.Properties{"hidden": true}))
+		})
+
+		It("links rooms in one direction", func() {
+			_, err := w.Link(hall.ID, garden.ID, "down", LinkOptions{OneWay: true})
+			Ω(err).Should(BeNil())
+
+			exits, err := w.Exits(garden.ID)
+			Ω(err).Should(BeNil())
+			Ω(exits).Should(BeEmpty())
+		})
+
+		It("names the exit back", func() {
+			_, err := w.Link(hall.ID, garden.ID, "portal", LinkOptions{Back: "gate"})
+			Ω(err).Should(BeNil())
+
+			_, err = w.FindExit(garden.ID, "gate")
+			Ω(err).Should(BeNil())
+		})
+
+		It("doesn't allow two exits with the same name", func() {
+			_, err := w.Link(hall.ID, garden.ID, "north", LinkOptions{})
+			Ω(err).Should(BeNil())
+
+			_, err = w.Link(hall.ID, garden.ID, "n", LinkOptions{OneWay: true})
+			Ω(err).Should(Equal(ErrExitExists))
+		})
+
+		It("requires both rooms", func() {
+			_, err := w.Link(hall.ID, "missing", "north", LinkOptions{})
+			Ω(err).Should(Equal(ErrRoomNotFound))
+		})
+
+		It("removes both exits when unlinked", func() {
+			exit, _ := w.Link(hall.ID, garden.ID, "east", LinkOptions{})
+			Ω(w.Unlink(exit.ID)).Should(BeNil())
+
+			for _, room := range []*Room{hall, garden} {
+				exits, err := w.Exits(room.ID)
+				Ω(err).Should(BeNil())
+				Ω(exits).Should(BeEmpty())
+			}
+		})
+	})
+
+	Describe("doors", func() {
+		var (
+			exit  *Exit
+			fired *recorder
+		)
+
+		BeforeEach(func() {
+			var err error
+			exit, err = w.Link(hall.ID, garden.ID, "west", LinkOptions{
+				Door: &Door{Closed: true, Locked: true, Key: "brass key"},
+			})
+			Ω(err).Should(BeNil())
+
+			fired = record(w, EvtDoorOpened, EvtDoorClosed, EvtDoorLocked, EvtDoorUnlocked)
+		})
+
+		It("can't be opened while locked", func() {
+			Ω(exit.Blocked()).Should(BeTrue())
+			Ω(w.OpenDoor(exit.ID)).Should(Equal(ErrDoorLocked))
+		})
+
+		It("needs the key", func() {
+			Ω(w.UnlockDoor(exit.ID, "iron key")).Should(Equal(ErrWrongKey))
+			Ω(w.UnlockDoor(exit.ID, "brass key")).Should(BeNil())
+			Ω(w.OpenDoor(exit.ID)).Should(BeNil())
+			Ω(w.LockDoor(exit.ID, "brass key")).Should(Equal(ErrDoorOpen))
+		})
+
+		It("shares the door with the exit back", func() {
+			Ω(w.UnlockDoor(exit.ID, "brass key")).Should(BeNil())
+			Ω(w.OpenDoor(exit.ID)).Should(BeNil())
+
+			back, err := w.FindExit(garden.ID, "east")
+			Ω(err).Should(BeNil())
+			Ω(back.Door).Should(Equal(&Door{Key: "brass key"}))
+
+			Ω(w.CloseDoor(back.ID)).Should(BeNil())
+			found, _ := w.Exit(exit.ID)
+			Ω(found.Blocked()).Should(BeTrue())
+		})
+
+		It("fires events", func() {
+			Ω(w.UnlockDoor(exit.ID, "brass key")).Should(BeNil())
+			Ω(w.OpenDoor(exit.ID)).Should(BeNil())
+			Eventually(fired.names).Should(ConsistOf(EvtDoorUnlocked, EvtDoorOpened))
+		})
+
+		It("fails for exits without doors", func() {
+			plain, _ := w.Link(hall.ID, garden.ID, "up", LinkOptions{OneWay: true})
+			Ω(w.OpenDoor(plain.ID)).Should(Equal(ErrNoDoor))
+		})
+	})
+})
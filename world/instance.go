@@ -0,0 +1,121 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"sort"
+
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// Labels and relationship types used to store mobiles and objects created
+// from prototypes.
+const (
+	MobileLabel = "Mobile"
+	ObjectLabel = "Object"
+
+	// InstanceOfType goes from a mobile or object to it's prototype.
+	InstanceOfType = "INSTANCE_OF"
+
+	// CarriedByType goes from an object to the mobile carrying it, objects
+	// being worn have a WearProperty naming where they're worn.
+	CarriedByType = "CARRIED_BY"
+
+	// InsideType goes from an object to the object containing it.
+	InsideType = "INSIDE"
+
+	WearProperty = "wear"
+)
+
+var kindLabels = map[string]string{
+	MobileKind: MobileLabel,
+	ObjectKind: ObjectLabel,
+}
+
+// Spawn creates a mobile or object from the prototype, it's not anywhere
+// until it's moved into a room or given to something.
+func (w *World) Spawn(prototype string) (string, error) {
+	p, err := w.Prototype(prototype)
+	if err != nil {
+		return "", err
+	}
+
+	var labels []string
+	if label, ok := kindLabels[p.Kind]; ok {
+		labels = append(labels, label)
+	}
+	node, err := w.store.CreateNode(labels, withName(p.Properties, p.Name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.store.CreateRelationship(node.ID, p.ID, InstanceOfType, nil); err != nil {
+		return "", err
+	}
+
+	return node.ID, nil
+}
+
+// Instances fetches the IDs of everything spawned from the prototype, sorted.
+func (w *World) Instances(prototype string) ([]string, error) {
+	if _, err := w.node(prototype, PrototypeLabel, ErrPrototypeNotFound); err != nil {
+		return nil, err
+	}
+
+	return w.incoming(prototype, InstanceOfType)
+}
+
+// InstanceOf fetches the ID of the prototype the entity was spawned from, it's
+// empty if the entity wasn't spawned.
+func (w *World) InstanceOf(entity string) (string, error) {
+	return w.related(entity, InstanceOfType)
+}
+
+// the IDs of the nodes with relationships of the type to the node, sorted
+func (w *World) incoming(id, typ string) ([]string, error) {
+	rels, err := w.store.Relationships(id, typ, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(rels))
+	for i, r := range rels {
+		ids[i] = r.From
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// count the entities of the IDs spawned from the prototype
+func (w *World) countInstances(ids []string, prototype string) (int, error) {
+	count := 0
+	for _, id := range ids {
+		p, err := w.InstanceOf(id)
+		if err != nil {
+			return 0, err
+		}
+		if p == prototype {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// put the object in or on the holder, taking it from wherever it was
+func (w *World) hold(object, holder, typ string, props storage.Properties) error {
+	for _, t := range []string{LocatedInType, CarriedByType, InsideType} {
+		rels, err := w.store.Relationships(object, t, storage.Outgoing)
+		if err != nil {
+			return err
+		}
+		for _, r := range rels {
+			if err := w.store.DeleteRelationship(r.ID); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := w.store.CreateRelationship(object, holder, typ, props)
+
+	return err
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"sort"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// Location fetches the room the entity is in, returning ErrNowhere if it's
+// not in one.
+func (w *World) Location(entity string) (*Room, error) {
+	room, err := w.related(entity, LocatedInType)
+	if err != nil {
+		return nil, err
+	}
+	if room == "" {
+		return nil, ErrNowhere
+	}
+
+	return w.Room(room)
+}
+
+// Occupants fetches the IDs of every entity in the room, sorted.
+func (w *World) Occupants(room string) ([]string, error) {
+	if _, err := w.node(room, RoomLabel, ErrRoomNotFound); err != nil {
+		return nil, err
+	}
+
+	rels, err := w.store.Relationships(room, LocatedInType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(rels))
+	for i, r := range rels {
+		ids[i] = r.From
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// Move puts the entity in the room, wherever it was before. The entity must
+// be a node in the world's store.
+func (w *World) Move(entity, room string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.node(room, RoomLabel, ErrRoomNotFound); err != nil {
+		return err
+	}
+
+	return w.move(entity, room, "")
+}
+
+// Go moves the entity through the named exit of the room it's in, returning
+// the room it ends up in. Closed doors block the way.
+func (w *World) Go(entity, exit string) (*Room, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	from, err := w.related(entity, LocatedInType)
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		return nil, ErrNowhere
+	}
+
+	e, err := w.FindExit(from, exit)
+	if err != nil {
+		return nil, err
+	}
+	if e.Blocked() {
+		return nil, ErrDoorClosed
+	}
+	if err := w.move(entity, e.To, e.Name); err != nil {
+		return nil, err
+	}
+
+	return w.Room(e.To)
+}
+
+// Remove takes the entity out of the room it's in, leaving it nowhere.
+func (w *World) Remove(entity string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err := w.leave(entity)
+
+	return err
+}
+
+// move the entity, the caller must hold the mutex
+func (w *World) move(entity, room, exit string) error {
+	from, err := w.leave(entity)
+	if err != nil {
+		return err
+	}
+	if _, err := w.store.CreateRelationship(entity, room, LocatedInType, nil); err != nil {
+		return err
+	}
+
+	w.events.Emit(EvtMoved, events.Data{
+		"entity": entity,
+		"from":   from,
+		"to":     room,
+		"exit":   exit,
+	})
+
+	return nil
+}
+
+// remove the entity from the room it's in, returning the room's ID
+func (w *World) leave(entity string) (string, error) {
+	rels, err := w.store.Relationships(entity, LocatedInType, storage.Outgoing)
+	if err != nil {
+		return "", err
+	}
+
+	from := ""
+	for _, r := range rels {
+		from = r.To
+		if err := w.store.DeleteRelationship(r.ID); err != nil {
+			return "", err
+		}
+	}
+
+	return from, nil
+}
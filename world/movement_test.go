@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"github.com/bbuck/dragon-mud/events"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Movement", func() {
+	var (
+		w            *World
+		hall, garden *Room
+		bob          string
+		moves        *recorder
+	)
+
+	BeforeEach(func() {
+		w = newWorld()
+		hall, _ = w.CreateRoom("Hall", "", nil)
+		garden, _ = w.CreateRoom("Garden", "", nil)
+		node, err := w.Store().CreateNode([]string{"Player"}, nil)
+		Ω(err).Should(BeNil())
+		bob = node.ID
+
+		moves = record(w, EvtMoved)
+	})
+
+	It("starts nowhere", func() {
+		_, err := w.Location(bob)
+		Ω(err).Should(Equal(ErrNowhere))
+	})
+
+	It("moves entities between rooms", func() {
+		Ω(w.Move(bob, hall.ID)).Should(BeNil())
+		Ω(w.Move(bob, garden.ID)).Should(BeNil())
+
+		r, err := w.Location(bob)
+		Ω(err).Should(BeNil())
+		Ω(r.ID).Should(Equal(garden.ID))
+
+		occupants, err := w.Occupants(hall.ID)
+		Ω(err).Should(BeNil())
+		Ω(occupants).Should(BeEmpty())
+		occupants, err = w.Occupants(garden.ID)
+		Ω(err).Should(BeNil())
+		Ω(occupants).Should(Equal([]string{bob}))
+
+		Eventually(moves.data).Should(ContainElement(events.Data{
+			"entity": bob,
+			"from":   hall.ID,
+			"to":     garden.ID,
+			"exit":   "",
+		}))
+	})
+
+	It("moves entities through exits", func() {
+		w.Link(hall.ID, garden.ID, "north", LinkOptions{})
+		Ω(w.Move(bob, hall.ID)).Should(BeNil())
+
+		r, err := w.Go(bob, "n")
+		Ω(err).Should(BeNil())
+		Ω(r.ID).Should(Equal(garden.ID))
+		Eventually(moves.data).Should(ContainElement(events.Data{
+			"entity": bob,
+			"from":   hall.ID,
+			"to":     garden.ID,
+			"exit":   "north",
+		}))
+
+		_, err = w.Go(bob, "north")
+		Ω(err).Should(Equal(ErrExitNotFound))
+	})
+
+	It("is blocked by closed doors", func() {
+		w.Link(hall.ID, garden.ID, "north", LinkOptions{Door: &Door{Closed: true}})
+		Ω(w.Move(bob, hall.ID)).Should(BeNil())
+
+		_, err := w.Go(bob, "north")
+		Ω(err).Should(Equal(ErrDoorClosed))
+	})
+
+	It("can't go anywhere from nowhere", func() {
+		_, err := w.Go(bob, "north")
+		Ω(err).Should(Equal(ErrNowhere))
+	})
+
+	It("removes entities from the world", func() {
+		Ω(w.Move(bob, hall.ID)).Should(BeNil())
+		Ω(w.Remove(bob)).Should(BeNil())
+
+		_, err := w.Location(bob)
+		Ω(err).Should(Equal(ErrNowhere))
+	})
+
+	It("only moves entities into rooms", func() {
+		Ω(w.Move(bob, bob)).Should(Equal(ErrRoomNotFound))
+	})
+})
@@ -0,0 +1,560 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// Errors returned when finding paths.
+var (
+	ErrNoPath         = errors.New("world: there's no path between the rooms")
+	ErrUncachedOption = errors.New("world: area paths can't be built with costs, heuristics or a maximum cost")
+)
+
+// CostProperty is the exit property holding the cost of going through the
+// exit, exits without one cost 1.
+const CostProperty = "cost"
+
+// PathOptions control which exits a path can go through and what they cost.
+type PathOptions struct {
+	// Steps finds the path through the fewest exits, ignoring costs.
+	Steps bool
+
+	// AvoidClosedDoors doesn't go through closed doors, AvoidLockedDoors only
+	// avoids locked ones (someone walking the path can open the others).
+	AvoidClosedDoors bool
+	AvoidLockedDoors bool
+
+	// Area keeps the path in the area and it's subareas.
+	Area string
+
+	// MaxCost gives up on paths costing more, zero means there's no limit.
+	MaxCost float64
+
+	// Cost is the cost of going through the exit, a negative cost means it
+	// can't be gone through. It defaults to ExitCost.
+	Cost func(*Exit) float64
+
+	// Heuristic estimates the cost from a room to the destination, it must
+	// never overestimate. Without one the search is a plain Dijkstra search.
+	Heuristic func(from, to *Room) float64
+}
+
+// cacheable options are the only ones that can be used for cached paths
+func (o PathOptions) cacheable() bool {
+	return o.Cost == nil && o.Heuristic == nil && o.MaxCost == 0
+}
+
+// Path is a way from one room to another.
+type Path struct {
+	// Rooms visited, starting with the first room and ending at the last.
+	Rooms []string
+
+	// Exits gone through, one fewer than rooms.
+	Exits []*Exit
+
+	// Cost of the whole path.
+	Cost float64
+}
+
+// Steps lists the names of the exits along the path, ready to speedwalk.
+func (p *Path) Steps() []string {
+	steps := make([]string, len(p.Exits))
+	for i, e := range p.Exits {
+		steps[i] = e.Name
+	}
+
+	return steps
+}
+
+// ExitCost is the cost of the exit from it's cost property, defaulting to 1.
+func ExitCost(e *Exit) float64 {
+	if c, ok := number(e.Properties[CostProperty]); ok {
+		return c
+	}
+
+	return 1
+}
+
+// CoordinateHeuristic estimates the distance between rooms with x, y and z
+// properties by the number of steps between them, it's only safe to use when
+// no exit costs less than 1. Rooms without coordinates are given no estimate.
+func CoordinateHeuristic(from, to *Room) float64 {
+	var total float64
+	for _, axis := range []string{"x", "y", "z"} {
+		a, aok := number(from.Properties[axis])
+		b, bok := number(to.Properties[axis])
+		if !aok && !bok {
+			continue
+		}
+		if aok != bok {
+			return 0
+		}
+		total += math.Abs(a - b)
+	}
+
+	return total
+}
+
+// Path finds the cheapest path from one room to another with A*, or the
+// path through the fewest exits with a breadth first search if opts.Steps is
+// set.
+func (w *World) Path(from, to string, opts PathOptions) (*Path, error) {
+	if _, err := w.node(from, RoomLabel, ErrRoomNotFound); err != nil {
+		return nil, err
+	}
+	target, err := w.Room(to)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := w.newSearch(target, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Steps {
+		return s.breadthFirst(from)
+	}
+
+	return s.aStar(from)
+}
+
+// Distance is the cost of the cheapest path between the rooms, or the number
+// of exits between them if opts.Steps is set.
+func (w *World) Distance(from, to string, opts PathOptions) (float64, error) {
+	p, err := w.Path(from, to, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.Cost, nil
+}
+
+// a single search for a path to the target
+type search struct {
+	w      *World
+	target *Room
+	opts   PathOptions
+	areas  map[string]bool
+}
+
+func (w *World) newSearch(target *Room, opts PathOptions) (*search, error) {
+	s := &search{
+		w:      w,
+		target: target,
+		opts:   opts,
+	}
+	if opts.Cost == nil {
+		s.opts.Cost = ExitCost
+	}
+	if opts.Steps {
+		s.opts.Cost = func(*Exit) float64 { return 1 }
+	}
+	if opts.Area != "" {
+		areas, err := w.areaTree(opts.Area)
+		if err != nil {
+			return nil, err
+		}
+		s.areas = areas
+		if !s.areas[target.Area] {
+			return nil, ErrNoPath
+		}
+	}
+
+	return s, nil
+}
+
+// the exits out of the room the search can go through, with their cost
+func (s *search) exits(room string) ([]*Exit, []float64, error) {
+	exits, err := s.w.Exits(room)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		usable = exits[:0]
+		costs  []float64
+	)
+	for _, e := range exits {
+		if e.Door != nil {
+			if s.opts.AvoidClosedDoors && e.Door.Closed {
+				continue
+			}
+			if s.opts.AvoidLockedDoors && e.Door.Locked {
+				continue
+			}
+		}
+		cost := s.opts.Cost(e)
+		if cost < 0 {
+			continue
+		}
+		if s.areas != nil {
+			area, err := s.w.related(e.To, InAreaType)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !s.areas[area] {
+				continue
+			}
+		}
+		usable = append(usable, e)
+		costs = append(costs, cost)
+	}
+
+	return usable, costs, nil
+}
+
+// a room reached during a search and the exit it was reached through
+type visit struct {
+	room  string
+	exit  *Exit
+	prev  *visit
+	cost  float64
+	guess float64
+	index int
+}
+
+func (v *visit) path() *Path {
+	p := &Path{Cost: v.cost}
+	for ; v != nil; v = v.prev {
+		p.Rooms = append([]string{v.room}, p.Rooms...)
+		if v.exit != nil {
+			p.Exits = append([]*Exit{v.exit}, p.Exits...)
+		}
+	}
+
+	return p
+}
+
+func (s *search) breadthFirst(from string) (*Path, error) {
+	seen := map[string]bool{from: true}
+	queue := []*visit{{room: from}}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if v.room == s.target.ID {
+			return v.path(), nil
+		}
+		if s.opts.MaxCost > 0 && v.cost >= s.opts.MaxCost {
+			continue
+		}
+
+		exits, _, err := s.exits(v.room)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range exits {
+			if seen[e.To] {
+				continue
+			}
+			seen[e.To] = true
+			queue = append(queue, &visit{room: e.To, exit: e, prev: v, cost: v.cost + 1})
+		}
+	}
+
+	return nil, ErrNoPath
+}
+
+func (s *search) aStar(from string) (*Path, error) {
+	var (
+		open   visitQueue
+		best   = make(map[string]*visit)
+		closed = make(map[string]bool)
+	)
+	start := &visit{room: from}
+	start.guess = s.estimate(from)
+	heap.Push(&open, start)
+	best[from] = start
+
+	for open.Len() > 0 {
+		v := heap.Pop(&open).(*visit)
+		if v.room == s.target.ID {
+			return v.path(), nil
+		}
+		closed[v.room] = true
+
+		exits, costs, err := s.exits(v.room)
+		if err != nil {
+			return nil, err
+		}
+		for i, e := range exits {
+			if closed[e.To] {
+				continue
+			}
+			cost := v.cost + costs[i]
+			if s.opts.MaxCost > 0 && cost > s.opts.MaxCost {
+				continue
+			}
+			if known, ok := best[e.To]; ok {
+				if cost >= known.cost {
+					continue
+				}
+				known.exit, known.prev, known.cost = e, v, cost
+				known.guess = cost + s.estimate(e.To)
+				heap.Fix(&open, known.index)
+
+				continue
+			}
+
+			next := &visit{room: e.To, exit: e, prev: v, cost: cost}
+			next.guess = cost + s.estimate(e.To)
+			best[e.To] = next
+			heap.Push(&open, next)
+		}
+	}
+
+	return nil, ErrNoPath
+}
+
+// estimate the cost from the room to the target, rooms that can't be loaded
+// aren't estimated
+func (s *search) estimate(room string) float64 {
+	if s.opts.Heuristic == nil {
+		return 0
+	}
+	r, err := s.w.Room(room)
+	if err != nil {
+		return 0
+	}
+
+	return s.opts.Heuristic(r, s.target)
+}
+
+// visitQueue is a heap of visits, cheapest guess first
+type visitQueue []*visit
+
+func (q visitQueue) Len() int           { return len(q) }
+func (q visitQueue) Less(i, j int) bool { return q[i].guess < q[j].guess }
+
+func (q visitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *visitQueue) Push(x interface{}) {
+	v := x.(*visit)
+	v.index = len(*q)
+	*q = append(*q, v)
+}
+
+func (q *visitQueue) Pop() interface{} {
+	old := *q
+	v := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return v
+}
+
+// PathTable holds the shortest path between every pair of rooms in an area.
+type PathTable struct {
+	Area string
+
+	generation uint64
+	rooms      []string
+	index      map[string]int
+	cost       [][]float64
+	next       [][]int
+	exits      [][]*Exit
+}
+
+// pathTableKey identifies a cached table by the options it was built with
+type pathTableKey struct {
+	area        string
+	steps       bool
+	closedDoors bool
+	lockedDoors bool
+}
+
+// AreaPaths builds (or reuses) the table of shortest paths between every room
+// in the area and it's subareas, paths stay inside the area. Tables are
+// cached until the world's rooms, exits or doors change, only the Steps and
+// door options can be given.
+func (w *World) AreaPaths(area string, opts PathOptions) (*PathTable, error) {
+	if !opts.cacheable() {
+		return nil, ErrUncachedOption
+	}
+
+	key := pathTableKey{
+		area:        area,
+		steps:       opts.Steps,
+		closedDoors: opts.AvoidClosedDoors,
+		lockedDoors: opts.AvoidLockedDoors,
+	}
+	generation := atomic.LoadUint64(&w.generation)
+
+	w.pathMutex.Lock()
+	defer w.pathMutex.Unlock()
+	if t, ok := w.paths[key]; ok && t.generation == generation {
+		return t, nil
+	}
+
+	opts.Area = area
+	t, err := w.buildPathTable(opts)
+	if err != nil {
+		return nil, err
+	}
+	t.generation = generation
+	if w.paths == nil {
+		w.paths = make(map[pathTableKey]*PathTable)
+	}
+	w.paths[key] = t
+
+	return t, nil
+}
+
+// build the table with Floyd-Warshall over the rooms of the area
+func (w *World) buildPathTable(opts PathOptions) (*PathTable, error) {
+	areas, err := w.areaTree(opts.Area)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &PathTable{
+		Area:  opts.Area,
+		index: make(map[string]int),
+	}
+	for area := range areas {
+		rooms, err := w.Rooms(area)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rooms {
+			t.index[r.ID] = len(t.rooms)
+			t.rooms = append(t.rooms, r.ID)
+		}
+	}
+
+	n := len(t.rooms)
+	t.cost = make([][]float64, n)
+	t.next = make([][]int, n)
+	t.exits = make([][]*Exit, n)
+	for i := range t.rooms {
+		t.cost[i] = make([]float64, n)
+		t.next[i] = make([]int, n)
+		t.exits[i] = make([]*Exit, n)
+		for j := range t.cost[i] {
+			t.cost[i][j] = math.Inf(1)
+			t.next[i][j] = -1
+		}
+		t.cost[i][i] = 0
+		t.next[i][i] = i
+	}
+
+	s := &search{w: w, opts: opts, areas: areas}
+	s.opts.Cost = ExitCost
+	if opts.Steps {
+		s.opts.Cost = func(*Exit) float64 { return 1 }
+	}
+	for i, room := range t.rooms {
+		exits, costs, err := s.exits(room)
+		if err != nil {
+			return nil, err
+		}
+		for k, e := range exits {
+			j := t.index[e.To]
+			if costs[k] < t.cost[i][j] {
+				t.cost[i][j] = costs[k]
+				t.next[i][j] = j
+				t.exits[i][j] = e
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			if math.IsInf(t.cost[i][k], 1) {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				if c := t.cost[i][k] + t.cost[k][j]; c < t.cost[i][j] {
+					t.cost[i][j] = c
+					t.next[i][j] = t.next[i][k]
+				}
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Path fetches the shortest path between two rooms in the table's area.
+func (t *PathTable) Path(from, to string) (*Path, error) {
+	i, iok := t.index[from]
+	j, jok := t.index[to]
+	if !iok || !jok || t.next[i][j] < 0 {
+		return nil, ErrNoPath
+	}
+
+	p := &Path{
+		Rooms: []string{from},
+		Cost:  t.cost[i][j],
+	}
+	for i != j {
+		k := t.next[i][j]
+		p.Exits = append(p.Exits, t.exits[i][k])
+		p.Rooms = append(p.Rooms, t.rooms[k])
+		i = k
+	}
+
+	return p, nil
+}
+
+// Distance fetches the cost of the shortest path between two rooms in the
+// table's area.
+func (t *PathTable) Distance(from, to string) (float64, error) {
+	i, iok := t.index[from]
+	j, jok := t.index[to]
+	if !iok || !jok || t.next[i][j] < 0 {
+		return 0, ErrNoPath
+	}
+
+	return t.cost[i][j], nil
+}
+
+// the IDs of the area and every area inside it
+func (w *World) areaTree(area string) (map[string]bool, error) {
+	if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+		return nil, err
+	}
+
+	areas := map[string]bool{area: true}
+	queue := []string{area}
+	for len(queue) > 0 {
+		subs, err := w.Subareas(queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		for _, a := range subs {
+			if !areas[a.ID] {
+				areas[a.ID] = true
+				queue = append(queue, a.ID)
+			}
+		}
+	}
+
+	return areas, nil
+}
+
+// changed marks the world's paths out of date
+func (w *World) changed() {
+	atomic.AddUint64(&w.generation, 1)
+}
+
+func number(val interface{}) (float64, bool) {
+	switch n := val.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path", func() {
+	var (
+		w                       *World
+		town, market            *Area
+		gate, road, square, inn *Room
+		stall, cellar           *Room
+	)
+
+	// the town is laid out as
+	//
+	//   gate - road - square - inn (door) - cellar (down)
+	//     \___________/   \
+	//     (muddy, cost 5)  market/stall
+	BeforeEach(func() {
+		w = newWorld()
+		town, _ = w.CreateArea("Town", "", nil)
+		market, _ = w.CreateArea("Market", town.ID, nil)
+		gate, _ = w.CreateRoom("Gate", town.ID, storage.Properties{"x": 0, "y": 0})
+		road, _ = w.CreateRoom("Road", town.ID, storage.Properties{"x": 1, "y": 0})
+		square, _ = w.CreateRoom("Square", town.ID, storage.Properties{"x": 2, "y": 0})
+		inn, _ = w.CreateRoom("Inn", town.ID, storage.Properties{"x": 3, "y": 0})
+		stall, _ = w.CreateRoom("Stall", market.ID, storage.Properties{"x": 2, "y": 1})
+		cellar, _ = w.CreateRoom("Cellar", "", nil)
+
+		w.Link(gate.ID, road.ID, "east", LinkOptions{})
+		w.Link(road.ID, square.ID, "east", LinkOptions{})
+		w.Link(gate.ID, square.ID, "path", LinkOptions{Properties: storage.Properties{CostProperty: 5}})
+		w.Link(square.ID, inn.ID, "east", LinkOptions{Door: &Door{Closed: true}})
+		w.Link(square.ID, stall.ID, "south", LinkOptions{})
+		w.Link(inn.ID, cellar.ID, "down", LinkOptions{})
+	})
+
+	Describe("Path", func() {
+		It("finds the cheapest path", func() {
+			p, err := w.Path(gate.ID, inn.ID, PathOptions{})
+			Ω(err).Should(BeNil())
+			Ω(p.Rooms).Should(Equal([]string{gate.ID, road.ID, square.ID, inn.ID}))
+			Ω(p.Steps()).Should(Equal([]string{"east", "east", "east"}))
+			Ω(p.Cost).Should(Equal(float64(3)))
+		})
+
+		It("finds the path through the fewest exits", func() {
+			p, err := w.Path(gate.ID, inn.ID, PathOptions{Steps: true})
+			Ω(err).Should(BeNil())
+			Ω(p.Steps()).Should(Equal([]string{"path", "east"}))
+			Ω(p.Cost).Should(Equal(float64(2)))
+		})
+
+		It("uses custom costs", func() {
+			p, err := w.Path(gate.ID, square.ID, PathOptions{
+				Cost: func(e *Exit) float64 {
+					if e.From == road.ID {
+						return -1
+					}
+
+					return 1
+				},
+			})
+			Ω(err).Should(BeNil())
+			Ω(p.Steps()).Should(Equal([]string{"path"}))
+		})
+
+		It("uses a heuristic", func() {
+			p, err := w.Path(gate.ID, stall.ID, PathOptions{Heuristic: CoordinateHeuristic})
+			Ω(err).Should(BeNil())
+			Ω(p.Steps()).Should(Equal([]string{"east", "east", "south"}))
+		})
+
+		It("avoids closed doors", func() {
+			_, err := w.Path(gate.ID, cellar.ID, PathOptions{AvoidClosedDoors: true})
+			Ω(err).Should(Equal(ErrNoPath))
+
+			_, err = w.Path(gate.ID, cellar.ID, PathOptions{AvoidLockedDoors: true})
+			Ω(err).Should(BeNil())
+		})
+
+		It("stays in the area", func() {
+			_, err := w.Path(gate.ID, cellar.ID, PathOptions{Area: town.ID})
+			Ω(err).Should(Equal(ErrNoPath))
+
+			p, err := w.Path(gate.ID, stall.ID, PathOptions{Area: town.ID})
+			Ω(err).Should(BeNil())
+			Ω(p.Rooms).Should(HaveLen(4))
+
+			_, err = w.Path(gate.ID, stall.ID, PathOptions{Area: market.ID})
+			Ω(err).Should(Equal(ErrNoPath))
+		})
+
+		It("gives up on paths that cost too much", func() {
+			_, err := w.Path(gate.ID, cellar.ID, PathOptions{MaxCost: 3})
+			Ω(err).Should(Equal(ErrNoPath))
+
+			d, err := w.Distance(gate.ID, cellar.ID, PathOptions{MaxCost: 4})
+			Ω(err).Should(BeNil())
+			Ω(d).Should(Equal(float64(4)))
+		})
+
+		It("finds the way to where it started", func() {
+			p, err := w.Path(gate.ID, gate.ID, PathOptions{})
+			Ω(err).Should(BeNil())
+			Ω(p.Rooms).Should(Equal([]string{gate.ID}))
+			Ω(p.Exits).Should(BeEmpty())
+		})
+
+		It("requires both rooms", func() {
+			_, err := w.Path(gate.ID, town.ID, PathOptions{})
+			Ω(err).Should(Equal(ErrRoomNotFound))
+		})
+	})
+
+	Describe("AreaPaths", func() {
+		It("finds paths between every room in the area", func() {
+			t, err := w.AreaPaths(town.ID, PathOptions{})
+			Ω(err).Should(BeNil())
+
+			p, err := t.Path(stall.ID, gate.ID)
+			Ω(err).Should(BeNil())
+			Ω(p.Steps()).Should(Equal([]string{"north", "west", "west"}))
+			Ω(p.Cost).Should(Equal(float64(3)))
+
+			d, err := t.Distance(gate.ID, inn.ID)
+			Ω(err).Should(BeNil())
+			Ω(d).Should(Equal(float64(3)))
+
+			_, err = t.Path(gate.ID, cellar.ID)
+			Ω(err).Should(Equal(ErrNoPath))
+		})
+
+		It("is cached until the world changes", func() {
+			t, _ := w.AreaPaths(town.ID, PathOptions{})
+			same, _ := w.AreaPaths(town.ID, PathOptions{})
+			Ω(same).Should(BeIdenticalTo(t))
+
+			w.Link(gate.ID, inn.ID, "portal", LinkOptions{})
+			changed, _ := w.AreaPaths(town.ID, PathOptions{})
+			Ω(changed).ShouldNot(BeIdenticalTo(t))
+			d, err := changed.Distance(gate.ID, inn.ID)
+			Ω(err).Should(BeNil())
+			Ω(d).Should(Equal(float64(1)))
+		})
+
+		It("is cached separately for each set of options", func() {
+			t, _ := w.AreaPaths(town.ID, PathOptions{})
+			doors, _ := w.AreaPaths(town.ID, PathOptions{AvoidClosedDoors: true})
+			Ω(doors).ShouldNot(BeIdenticalTo(t))
+
+			_, err := doors.Path(gate.ID, inn.ID)
+			Ω(err).Should(Equal(ErrNoPath))
+		})
+
+		It("can't be built with custom costs", func() {
+			_, err := w.AreaPaths(town.ID, PathOptions{MaxCost: 5})
+			Ω(err).Should(Equal(ErrUncachedOption))
+		})
+	})
+})
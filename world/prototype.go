@@ -0,0 +1,338 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// Labels and properties used to store prototypes and resets.
+const (
+	PrototypeLabel = "Prototype"
+	ResetLabel     = "Reset"
+
+	// VnumProperty numbers rooms and prototypes the way area files do, so
+	// resets and exits can refer to them before they have an ID.
+	VnumProperty = "vnum"
+)
+
+// Kinds of prototypes.
+const (
+	MobileKind = "mobile"
+	ObjectKind = "object"
+)
+
+// Errors returned for prototypes.
+var (
+	ErrPrototypeNotFound = errors.New("world: prototype not found")
+	ErrPrototypeExists   = errors.New("world: a prototype of that kind already has the vnum")
+)
+
+// Prototype describes a mobile or object that resets create copies of.
+type Prototype struct {
+	ID         string
+	Kind       string
+	Vnum       int
+	Name       string
+	Area       string
+	Properties storage.Properties
+}
+
+// CreatePrototype adds a prototype of the kind to the area, vnums are unique
+// for each kind.
+func (w *World) CreatePrototype(kind string, vnum int, name, area string, props storage.Properties) (*Prototype, error) {
+	if name == "" {
+		return nil, ErrMissingName
+	}
+	if _, err := w.FindPrototype(kind, vnum); err != ErrPrototypeNotFound {
+		if err == nil {
+			return nil, ErrPrototypeExists
+		}
+
+		return nil, err
+	}
+	if area != "" {
+		if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+			return nil, err
+		}
+	}
+
+	props = withName(props, name)
+	props["kind"] = kind
+	props[VnumProperty] = vnum
+	node, err := w.store.CreateNode([]string{PrototypeLabel}, props)
+	if err != nil {
+		return nil, err
+	}
+	if area != "" {
+		if _, err := w.store.CreateRelationship(node.ID, area, InAreaType, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return toPrototype(node, area), nil
+}
+
+// Prototype fetches the prototype with the ID.
+func (w *World) Prototype(id string) (*Prototype, error) {
+	node, err := w.node(id, PrototypeLabel, ErrPrototypeNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	area, err := w.related(id, InAreaType)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPrototype(node, area), nil
+}
+
+// FindPrototype fetches the prototype of the kind with the vnum.
+func (w *World) FindPrototype(kind string, vnum int) (*Prototype, error) {
+	nodes, err := w.store.FindNodes(PrototypeLabel, storage.Properties{"kind": kind, VnumProperty: vnum})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrPrototypeNotFound
+	}
+
+	return w.Prototype(nodes[0].ID)
+}
+
+// Prototypes fetches the prototypes of the kind in the area, sorted by vnum.
+// An empty kind fetches every prototype.
+func (w *World) Prototypes(area, kind string) ([]*Prototype, error) {
+	rels, err := w.store.Relationships(area, InAreaType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	var protos []*Prototype
+	for _, r := range rels {
+		node, err := w.store.GetNode(r.From)
+		if err != nil {
+			return nil, err
+		}
+		if !node.HasLabel(PrototypeLabel) {
+			continue
+		}
+		p := toPrototype(node, area)
+		if kind == "" || p.Kind == kind {
+			protos = append(protos, p)
+		}
+	}
+	sort.Slice(protos, func(i, j int) bool {
+		if protos[i].Kind != protos[j].Kind {
+			return protos[i].Kind < protos[j].Kind
+		}
+
+		return protos[i].Vnum < protos[j].Vnum
+	})
+
+	return protos, nil
+}
+
+// DestroyPrototype removes the prototype, copies made from it are left alone.
+func (w *World) DestroyPrototype(id string) error {
+	if _, err := w.node(id, PrototypeLabel, ErrPrototypeNotFound); err != nil {
+		return err
+	}
+
+	return w.store.DeleteNode(id)
+}
+
+// FindRoom fetches the room with the vnum.
+func (w *World) FindRoom(vnum int) (*Room, error) {
+	nodes, err := w.store.FindNodes(RoomLabel, storage.Properties{VnumProperty: vnum})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrRoomNotFound
+	}
+
+	return w.Room(nodes[0].ID)
+}
+
+func toPrototype(n *storage.Node, area string) *Prototype {
+	name, props := splitName(n.Properties)
+	p := &Prototype{
+		ID:   n.ID,
+		Name: name,
+		Area: area,
+	}
+	p.Kind, _ = props["kind"].(string)
+	vnum, _ := number(props[VnumProperty])
+	p.Vnum = int(vnum)
+	delete(props, "kind")
+	delete(props, VnumProperty)
+	p.Properties = props
+
+	return p
+}
+
+// Actions a reset can take, named after the resets of classic area files.
+const (
+	// ResetMobile creates a mobile from the Vnum prototype in the Room,
+	// unless there are already Limit of them in the world or Count of them
+	// in the room.
+	ResetMobile = "mobile"
+
+	// ResetObject creates an object from the Vnum prototype on the floor of
+	// the Room.
+	ResetObject = "object"
+
+	// ResetGive and ResetEquip give the last mobile created an object, the
+	// equipped object is worn in the Wear location.
+	ResetGive  = "give"
+	ResetEquip = "equip"
+
+	// ResetPut puts Count objects from the Vnum prototype in the last object
+	// created from the Container prototype.
+	ResetPut = "put"
+
+	// ResetDoor sets the door of the Room's Exit to the State "open",
+	// "closed" or "locked".
+	ResetDoor = "door"
+
+	// ResetRandomize shuffles the first Count exits of the Room.
+	ResetRandomize = "randomize"
+)
+
+// Reset is a step in repopulating an area, resets run in order.
+type Reset struct {
+	ID        string
+	Action    string
+	Vnum      int
+	Room      int
+	Container int
+	Limit     int
+	Count     int
+	Wear      string
+	Exit      string
+	State     string
+}
+
+// AddReset adds the reset to the end of the area's resets.
+func (w *World) AddReset(area string, r Reset) (*Reset, error) {
+	if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+		return nil, err
+	}
+	existing, err := w.store.Relationships(area, InAreaType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	props := storage.Properties{
+		"action": r.Action,
+		"order":  len(existing),
+	}
+	for k, v := range map[string]int{"vnum": r.Vnum, "room": r.Room, "container": r.Container, "limit": r.Limit, "count": r.Count} {
+		if v != 0 {
+			props[k] = v
+		}
+	}
+	for k, v := range map[string]string{"wear": r.Wear, "exit": r.Exit, "state": r.State} {
+		if v != "" {
+			props[k] = v
+		}
+	}
+
+	node, err := w.store.CreateNode([]string{ResetLabel}, props)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.store.CreateRelationship(node.ID, area, InAreaType, nil); err != nil {
+		return nil, err
+	}
+	r.ID = node.ID
+
+	return &r, nil
+}
+
+// Resets fetches the area's resets in the order they run.
+func (w *World) Resets(area string) ([]*Reset, error) {
+	nodes, err := w.resetNodes(area)
+	if err != nil {
+		return nil, err
+	}
+
+	resets := make([]*Reset, len(nodes))
+	for i, n := range nodes {
+		resets[i] = toReset(n)
+	}
+
+	return resets, nil
+}
+
+// ClearResets removes every reset from the area.
+func (w *World) ClearResets(area string) error {
+	nodes, err := w.resetNodes(area)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err := w.store.DeleteNode(n.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the area's reset nodes sorted by their order
+func (w *World) resetNodes(area string) ([]*storage.Node, error) {
+	if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+		return nil, err
+	}
+	rels, err := w.store.Relationships(area, InAreaType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*storage.Node
+	for _, r := range rels {
+		node, err := w.store.GetNode(r.From)
+		if err != nil {
+			return nil, err
+		}
+		if node.HasLabel(ResetLabel) {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, _ := number(nodes[i].Properties["order"])
+		b, _ := number(nodes[j].Properties["order"])
+
+		return a < b
+	})
+
+	return nodes, nil
+}
+
+func toReset(n *storage.Node) *Reset {
+	integer := func(key string) int {
+		i, _ := number(n.Properties[key])
+
+		return int(i)
+	}
+	r := &Reset{
+		ID:        n.ID,
+		Vnum:      integer("vnum"),
+		Room:      integer("room"),
+		Container: integer("container"),
+		Limit:     integer("limit"),
+		Count:     integer("count"),
+	}
+	r.Action, _ = n.Properties["action"].(string)
+	r.Wear, _ = n.Properties["wear"].(string)
+	r.Exit, _ = n.Properties["exit"].(string)
+	r.State, _ = n.Properties["state"].(string)
+
+	return r
+}
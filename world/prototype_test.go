@@ -0,0 +1,104 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prototype", func() {
+	var (
+		w    *World
+		town *Area
+	)
+
+	BeforeEach(func() {
+		w = newWorld()
+		town, _ = w.CreateArea("Town", "", nil)
+	})
+
+	It("finds prototypes by vnum", func() {
+		p, err := w.CreatePrototype(MobileKind, 3000, "the wizard", town.ID, storage.Properties{"level": 31})
+		Ω(err).Should(BeNil())
+
+		found, err := w.FindPrototype(MobileKind, 3000)
+		Ω(err).Should(BeNil())
+		Ω(found).Should(Equal(&Prototype{
+			ID:         p.ID,
+			Kind:       MobileKind,
+			Vnum:       3000,
+			Name:       "the wizard",
+			Area:       town.ID,
+			Properties: storage.Properties{"level": int64(31)},
+		}))
+
+		_, err = w.FindPrototype(ObjectKind, 3000)
+		Ω(err).Should(Equal(ErrPrototypeNotFound))
+	})
+
+	It("keeps vnums unique for each kind", func() {
+		_, err := w.CreatePrototype(ObjectKind, 1, "a sword", town.ID, nil)
+		Ω(err).Should(BeNil())
+		_, err = w.CreatePrototype(MobileKind, 1, "a guard", town.ID, nil)
+		Ω(err).Should(BeNil())
+		_, err = w.CreatePrototype(ObjectKind, 1, "a shield", "", nil)
+		Ω(err).Should(Equal(ErrPrototypeExists))
+	})
+
+	It("lists the area's prototypes", func() {
+		w.CreatePrototype(ObjectKind, 2, "a shield", town.ID, nil)
+		w.CreatePrototype(ObjectKind, 1, "a sword", town.ID, nil)
+		w.CreatePrototype(MobileKind, 5, "a guard", town.ID, nil)
+		w.CreateRoom("Square", town.ID, nil)
+
+		protos, err := w.Prototypes(town.ID, ObjectKind)
+		Ω(err).Should(BeNil())
+		Ω(protos).Should(HaveLen(2))
+		Ω(protos[0].Name).Should(Equal("a sword"))
+
+		all, err := w.Prototypes(town.ID, "")
+		Ω(err).Should(BeNil())
+		Ω(all).Should(HaveLen(3))
+
+		rooms, err := w.Rooms(town.ID)
+		Ω(err).Should(BeNil())
+		Ω(rooms).Should(HaveLen(1))
+	})
+
+	It("finds rooms by vnum", func() {
+		r, _ := w.CreateRoom("Square", town.ID, storage.Properties{VnumProperty: 3001})
+		found, err := w.FindRoom(3001)
+		Ω(err).Should(BeNil())
+		Ω(found.ID).Should(Equal(r.ID))
+	})
+
+	Describe("resets", func() {
+		It("keeps resets in order", func() {
+			w.AddReset(town.ID, Reset{Action: ResetMobile, Vnum: 3000, Room: 3001, Limit: 1})
+			w.AddReset(town.ID, Reset{Action: ResetEquip, Vnum: 3020, Wear: "wield"})
+			w.AddReset(town.ID, Reset{Action: ResetDoor, Room: 3001, Exit: "north", State: "locked"})
+
+			resets, err := w.Resets(town.ID)
+			Ω(err).Should(BeNil())
+			Ω(resets).Should(HaveLen(3))
+			Ω(resets[0].Action).Should(Equal(ResetMobile))
+			Ω(resets[0].Limit).Should(Equal(1))
+			Ω(resets[1].Wear).Should(Equal("wield"))
+			Ω(resets[2].State).Should(Equal("locked"))
+		})
+
+		It("clears resets", func() {
+			w.AddReset(town.ID, Reset{Action: ResetObject, Vnum: 1, Room: 2})
+			Ω(w.ClearResets(town.ID)).Should(BeNil())
+
+			resets, err := w.Resets(town.ID)
+			Ω(err).Should(BeNil())
+			Ω(resets).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,435 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/random"
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// EvtAreaReset is fired after an area is reset, with "area", the area's ID,
+// "name", it's name and "mobiles" and "objects", the number of each that were
+// spawned.
+const EvtAreaReset = "area:reset"
+
+// ResetIntervalProperty is the area property holding how often the area is
+// reset, a duration like "15m" or a number of minutes.
+const ResetIntervalProperty = "reset_interval"
+
+// the exits a randomize reset shuffles, in the order of classic door numbers
+var randomizeOrder = []Direction{North, East, South, West, Up, Down}
+
+// ResetReport describes what resetting an area did.
+type ResetReport struct {
+	Area string
+
+	// Mobiles and Objects are the IDs of everything spawned.
+	Mobiles []string
+	Objects []string
+
+	// Doors is the number of doors that were changed.
+	Doors int
+
+	// Warnings describe resets that were skipped because the prototype,
+	// room or exit they refer to doesn't exist.
+	Warnings []string
+}
+
+// ResetArea runs the area's resets in order, repopulating it. Mobile and
+// object resets only spawn what's missing, so resetting an area that's
+// already populated leaves it alone.
+func (w *World) ResetArea(id string) (*ResetReport, error) {
+	w.resetMutex.Lock()
+	defer w.resetMutex.Unlock()
+
+	area, err := w.Area(id)
+	if err != nil {
+		return nil, err
+	}
+	resets, err := w.Resets(id)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &resetRun{
+		w:       w,
+		report:  &ResetReport{Area: id},
+		objects: make(map[int][]string),
+	}
+	for i, r := range resets {
+		run.index = i
+		if err := run.reset(r); err != nil {
+			return nil, err
+		}
+	}
+
+	w.events.Emit(EvtAreaReset, events.Data{
+		"area":    area.ID,
+		"name":    area.Name,
+		"mobiles": len(run.report.Mobiles),
+		"objects": len(run.report.Objects),
+	})
+
+	return run.report, nil
+}
+
+type resetRun struct {
+	w      *World
+	report *ResetReport
+	index  int
+
+	// mobiles spawned by the last mobile reset, and objects spawned by
+	// prototype vnum
+	mobiles []string
+	objects map[int][]string
+}
+
+func (run *resetRun) reset(r *Reset) error {
+	switch r.Action {
+	case ResetMobile:
+		run.mobiles = nil
+		spawned, err := run.fill(r, MobileKind)
+		run.mobiles = spawned
+		run.report.Mobiles = append(run.report.Mobiles, spawned...)
+
+		return err
+	case ResetObject:
+		spawned, err := run.fill(r, ObjectKind)
+		run.spawnedObjects(r.Vnum, spawned)
+
+		return err
+	case ResetGive, ResetEquip:
+		return run.give(r)
+	case ResetPut:
+		return run.put(r)
+	case ResetDoor:
+		return run.door(r)
+	case ResetRandomize:
+		return run.randomize(r)
+	}
+
+	run.warn("unknown action %q", r.Action)
+
+	return nil
+}
+
+// spawn copies of the prototype in the room until there are Count (or 1)
+// of them, without going over Limit in the world
+func (run *resetRun) fill(r *Reset, kind string) ([]string, error) {
+	proto, ok, err := run.prototype(kind, r.Vnum)
+	if !ok || err != nil {
+		return nil, err
+	}
+	room, ok, err := run.room(r.Room)
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	existing, err := run.w.Instances(proto.ID)
+	if err != nil {
+		return nil, err
+	}
+	occupants, err := run.w.Occupants(room.ID)
+	if err != nil {
+		return nil, err
+	}
+	present, err := run.w.countInstances(occupants, proto.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var spawned []string
+	for present+len(spawned) < atLeastOne(r.Count) && (r.Limit <= 0 || len(existing)+len(spawned) < r.Limit) {
+		id, err := run.w.Spawn(proto.ID)
+		if err != nil {
+			return spawned, err
+		}
+		spawned = append(spawned, id)
+		if err := run.w.Move(id, room.ID); err != nil {
+			return spawned, err
+		}
+	}
+
+	return spawned, nil
+}
+
+// give an object to each mobile spawned by the last mobile reset
+func (run *resetRun) give(r *Reset) error {
+	if len(run.mobiles) == 0 {
+		return nil
+	}
+	proto, ok, err := run.prototype(ObjectKind, r.Vnum)
+	if !ok || err != nil {
+		return err
+	}
+
+	var props storage.Properties
+	if r.Action == ResetEquip && r.Wear != "" {
+		props = storage.Properties{WearProperty: r.Wear}
+	}
+	for _, m := range run.mobiles {
+		id, err := run.w.Spawn(proto.ID)
+		if err != nil {
+			return err
+		}
+		run.spawnedObjects(r.Vnum, []string{id})
+		if err := run.w.hold(id, m, CarriedByType, props); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// put objects in each container spawned during this reset until they hold
+// Count (or 1) of them
+func (run *resetRun) put(r *Reset) error {
+	containers := run.objects[r.Container]
+	if len(containers) == 0 {
+		return nil
+	}
+	proto, ok, err := run.prototype(ObjectKind, r.Vnum)
+	if !ok || err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		contents, err := run.w.incoming(c, InsideType)
+		if err != nil {
+			return err
+		}
+		present, err := run.w.countInstances(contents, proto.ID)
+		if err != nil {
+			return err
+		}
+		for ; present < atLeastOne(r.Count); present++ {
+			id, err := run.w.Spawn(proto.ID)
+			if err != nil {
+				return err
+			}
+			run.spawnedObjects(r.Vnum, []string{id})
+			if err := run.w.hold(id, c, InsideType, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// set the door to the reset's state, the door's events are only fired if it
+// changes
+func (run *resetRun) door(r *Reset) error {
+	room, ok, err := run.room(r.Room)
+	if !ok || err != nil {
+		return err
+	}
+	exit, err := run.w.FindExit(room.ID, r.Exit)
+	if err == ErrExitNotFound || (err == nil && exit.Door == nil) {
+		run.warn("room %d has no door %s", r.Room, r.Exit)
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	closed := r.State == "closed" || r.State == "locked"
+	locked := r.State == "locked"
+	if exit.Door.Closed == closed && exit.Door.Locked == locked {
+		return nil
+	}
+
+	evt := EvtDoorOpened
+	switch {
+	case locked:
+		evt = EvtDoorLocked
+	case closed:
+		evt = EvtDoorClosed
+	}
+	run.report.Doors++
+
+	return run.w.changeDoor(exit.ID, evt, func(d *Door) error {
+		d.Closed = closed
+		d.Locked = locked
+
+		return nil
+	})
+}
+
+// shuffle where the room's first Count exits lead by shuffling their names,
+// the exits leading back are left alone
+func (run *resetRun) randomize(r *Reset) error {
+	room, ok, err := run.room(r.Room)
+	if !ok || err != nil {
+		return err
+	}
+
+	count := r.Count
+	if count > len(randomizeOrder) {
+		count = len(randomizeOrder)
+	}
+	var exits []*Exit
+	for _, d := range randomizeOrder[:count] {
+		exit, err := run.w.FindExit(room.ID, string(d))
+		if err == ErrExitNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		exits = append(exits, exit)
+	}
+	if len(exits) < 2 {
+		return nil
+	}
+
+	rng := random.Stream("resets")
+	names := make([]string, len(exits))
+	for i, e := range exits {
+		names[i] = e.Name
+	}
+	for i := len(names) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		names[i], names[j] = names[j], names[i]
+	}
+
+	defer run.w.changed()
+	for i, e := range exits {
+		if e.Name == names[i] {
+			continue
+		}
+		if err := run.w.store.UpdateRelationship(e.ID, storage.Properties{exitNameProperty: names[i]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (run *resetRun) prototype(kind string, vnum int) (*Prototype, bool, error) {
+	p, err := run.w.FindPrototype(kind, vnum)
+	if err == ErrPrototypeNotFound {
+		run.warn("there's no %s %d", kind, vnum)
+
+		return nil, false, nil
+	}
+
+	return p, err == nil, err
+}
+
+func (run *resetRun) room(vnum int) (*Room, bool, error) {
+	room, err := run.w.FindRoom(vnum)
+	if err == ErrRoomNotFound {
+		run.warn("there's no room %d", vnum)
+
+		return nil, false, nil
+	}
+
+	return room, err == nil, err
+}
+
+func (run *resetRun) spawnedObjects(vnum int, ids []string) {
+	run.objects[vnum] = append(run.objects[vnum], ids...)
+	run.report.Objects = append(run.report.Objects, ids...)
+}
+
+func (run *resetRun) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf("reset %d: ", run.index+1) + fmt.Sprintf(format, args...)
+	run.report.Warnings = append(run.report.Warnings, msg)
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+
+	return n
+}
+
+// Scheduler resets areas as they come due, each area is reset every
+// ResetIntervalProperty or the scheduler's interval. It's driven by calling
+// Tick, which the server does on it's tick.
+type Scheduler struct {
+	world    *World
+	interval time.Duration
+
+	mutex sync.Mutex
+	last  map[string]time.Time
+}
+
+// NewScheduler creates a scheduler resetting areas of the world every
+// interval, unless they say otherwise.
+func NewScheduler(w *World, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		world:    w,
+		interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Tick resets every area that's due, areas the scheduler hasn't seen before
+// are reset right away. The reports of the areas that were reset are
+// returned, if an area fails to reset the rest are still reset and the first
+// error is returned.
+func (s *Scheduler) Tick(now time.Time) ([]*ResetReport, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	areas, err := s.world.Areas()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		reports  []*ResetReport
+		firstErr error
+	)
+	for _, a := range areas {
+		last, seen := s.last[a.ID]
+		if seen && now.Sub(last) < s.intervalFor(a) {
+			continue
+		}
+		s.last[a.ID] = now
+
+		report, err := s.world.ResetArea(a.ID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, firstErr
+}
+
+// Due makes the area reset on the next tick.
+func (s *Scheduler) Due(area string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.last, area)
+}
+
+func (s *Scheduler) intervalFor(a *Area) time.Duration {
+	switch v := a.Properties[ResetIntervalProperty].(type) {
+	case string:
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	default:
+		if n, ok := number(v); ok && n > 0 {
+			return time.Duration(n * float64(time.Minute))
+		}
+	}
+
+	return s.interval
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reset", func() {
+	var (
+		w       *World
+		town    *Area
+		square  *Room
+		armory  *Room
+		goblin  *Prototype
+		gate    *Exit
+		resets  []Reset
+		spawned func(room string, proto *Prototype) []string
+	)
+
+	BeforeEach(func() {
+		w = newWorld()
+		town, _ = w.CreateArea("Town", "", nil)
+		square, _ = w.CreateRoom("Square", town.ID, storage.Properties{VnumProperty: 3001})
+		armory, _ = w.CreateRoom("Armory", town.ID, storage.Properties{VnumProperty: 3002})
+		gate, _ = w.Link(square.ID, armory.ID, "north", LinkOptions{Door: &Door{}})
+		goblin, _ = w.CreatePrototype(MobileKind, 10, "a goblin", town.ID, storage.Properties{"level": 2})
+		w.CreatePrototype(ObjectKind, 20, "a rusty sword", town.ID, nil)
+		w.CreatePrototype(ObjectKind, 21, "a chest", town.ID, nil)
+		w.CreatePrototype(ObjectKind, 22, "a gold coin", town.ID, nil)
+
+		resets = []Reset{
+			{Action: ResetMobile, Vnum: 10, Room: 3001, Limit: 3, Count: 2},
+			{Action: ResetEquip, Vnum: 20, Wear: "wield"},
+			{Action: ResetObject, Vnum: 21, Room: 3002},
+			{Action: ResetPut, Vnum: 22, Container: 21, Count: 3},
+			{Action: ResetDoor, Room: 3001, Exit: "north", State: "locked"},
+		}
+		for _, r := range resets {
+			w.AddReset(town.ID, r)
+		}
+
+		spawned = func(room string, proto *Prototype) []string {
+			occupants, err := w.Occupants(room)
+			Ω(err).Should(BeNil())
+
+			var ids []string
+			for _, id := range occupants {
+				if p, _ := w.InstanceOf(id); p == proto.ID {
+					ids = append(ids, id)
+				}
+			}
+
+			return ids
+		}
+	})
+
+	It("repopulates the area", func() {
+		report, err := w.ResetArea(town.ID)
+		Ω(err).Should(BeNil())
+		Ω(report.Mobiles).Should(HaveLen(2))
+		Ω(report.Objects).Should(HaveLen(6))
+		Ω(report.Doors).Should(Equal(1))
+		Ω(report.Warnings).Should(BeEmpty())
+
+		goblins := spawned(square.ID, goblin)
+		Ω(goblins).Should(HaveLen(2))
+		node, err := w.Store().GetNode(goblins[0])
+		Ω(err).Should(BeNil())
+		Ω(node.HasLabel(MobileLabel)).Should(BeTrue())
+		Ω(node.Properties).Should(Equal(storage.Properties{"name": "a goblin", "level": int64(2)}))
+
+		for _, g := range goblins {
+			rels, err := w.Store().Relationships(g, CarriedByType, storage.Incoming)
+			Ω(err).Should(BeNil())
+			Ω(rels).Should(HaveLen(1))
+			Ω(rels[0].Properties[WearProperty]).Should(Equal("wield"))
+		}
+
+		chest, _ := w.FindPrototype(ObjectKind, 21)
+		chests := spawned(armory.ID, chest)
+		Ω(chests).Should(HaveLen(1))
+		rels, err := w.Store().Relationships(chests[0], InsideType, storage.Incoming)
+		Ω(err).Should(BeNil())
+		Ω(rels).Should(HaveLen(3))
+
+		door, _ := w.Exit(gate.ID)
+		Ω(door.Door).Should(Equal(&Door{Closed: true, Locked: true}))
+	})
+
+	It("only spawns what's missing", func() {
+		w.ResetArea(town.ID)
+		report, err := w.ResetArea(town.ID)
+		Ω(err).Should(BeNil())
+		Ω(report.Mobiles).Should(BeEmpty())
+		Ω(report.Objects).Should(BeEmpty())
+		Ω(report.Doors).Should(Equal(0))
+		Ω(spawned(square.ID, goblin)).Should(HaveLen(2))
+	})
+
+	It("doesn't go over the limit in the world", func() {
+		w.ResetArea(town.ID)
+		for _, g := range spawned(square.ID, goblin) {
+			Ω(w.Remove(g)).Should(BeNil())
+		}
+
+		report, err := w.ResetArea(town.ID)
+		Ω(err).Should(BeNil())
+		Ω(report.Mobiles).Should(HaveLen(1))
+		instances, err := w.Instances(goblin.ID)
+		Ω(err).Should(BeNil())
+		Ω(instances).Should(HaveLen(3))
+	})
+
+	It("warns about resets it can't run", func() {
+		w.ClearResets(town.ID)
+		w.AddReset(town.ID, Reset{Action: ResetMobile, Vnum: 99, Room: 3001})
+		w.AddReset(town.ID, Reset{Action: ResetObject, Vnum: 20, Room: 9999})
+		w.AddReset(town.ID, Reset{Action: ResetDoor, Room: 3002, Exit: "east", State: "closed"})
+
+		report, err := w.ResetArea(town.ID)
+		Ω(err).Should(BeNil())
+		Ω(report.Warnings).Should(Equal([]string{
+			"reset 1: there's no mobile 99",
+			"reset 2: there's no room 9999",
+			"reset 3: room 3002 has no door east",
+		}))
+	})
+
+	It("fires an event", func() {
+		rec := record(w, EvtAreaReset)
+		w.ResetArea(town.ID)
+
+		Eventually(rec.data).Should(Equal([]events.Data{{
+			"area":    town.ID,
+			"name":    "Town",
+			"mobiles": 2,
+			"objects": 6,
+		}}))
+	})
+
+	It("shuffles exits", func() {
+		w.ClearResets(town.ID)
+		hub, _ := w.CreateRoom("Hub", town.ID, storage.Properties{VnumProperty: 3003})
+		for _, dir := range []string{"north", "east", "south", "west"} {
+			room, _ := w.CreateRoom(dir, town.ID, nil)
+			w.Link(hub.ID, room.ID, dir, LinkOptions{OneWay: true})
+		}
+		w.AddReset(town.ID, Reset{Action: ResetRandomize, Room: 3003, Count: 4})
+
+		_, err := w.ResetArea(town.ID)
+		Ω(err).Should(BeNil())
+
+		exits, err := w.Exits(hub.ID)
+		Ω(err).Should(BeNil())
+		var names, to []string
+		for _, e := range exits {
+			names = append(names, e.Name)
+			room, _ := w.Room(e.To)
+			to = append(to, room.Name)
+		}
+		sort.Strings(names)
+		sort.Strings(to)
+		Ω(names).Should(Equal([]string{"east", "north", "south", "west"}))
+		Ω(to).Should(Equal(names))
+	})
+
+	Describe("Scheduler", func() {
+		var (
+			s   *Scheduler
+			now time.Time
+		)
+
+		BeforeEach(func() {
+			s = NewScheduler(w, 15*time.Minute)
+			now = time.Now()
+		})
+
+		It("resets areas when they're due", func() {
+			reports, err := s.Tick(now)
+			Ω(err).Should(BeNil())
+			Ω(reports).Should(HaveLen(1))
+
+			reports, err = s.Tick(now.Add(time.Minute))
+			Ω(err).Should(BeNil())
+			Ω(reports).Should(BeEmpty())
+
+			reports, err = s.Tick(now.Add(15 * time.Minute))
+			Ω(err).Should(BeNil())
+			Ω(reports).Should(HaveLen(1))
+		})
+
+		It("uses the area's reset interval", func() {
+			w.UpdateArea(town.ID, storage.Properties{ResetIntervalProperty: "5m"})
+			s.Tick(now)
+
+			reports, _ := s.Tick(now.Add(5 * time.Minute))
+			Ω(reports).Should(HaveLen(1))
+
+			w.UpdateArea(town.ID, storage.Properties{ResetIntervalProperty: 2})
+			reports, _ = s.Tick(now.Add(7 * time.Minute))
+			Ω(reports).Should(HaveLen(1))
+		})
+
+		It("can reset an area on the next tick", func() {
+			s.Tick(now)
+			s.Due(town.ID)
+
+			reports, _ := s.Tick(now.Add(time.Second))
+			Ω(reports).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,424 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+// Package world is the shared spatial model of the game. Rooms are grouped
+// into areas, which can be grouped into larger areas (zones), and are joined
+// by exits that may have doors. Entities are located in rooms and move
+// between them through exits. The world is kept in a storage.Store so any
+// room plugin can build on the same graph.
+package world
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/logger"
+	"github.com/bbuck/dragon-mud/storage"
+)
+
+// Labels and relationship types used to store the world.
+const (
+	AreaLabel = "Area"
+	RoomLabel = "Room"
+
+	// ExitType goes from a room to the room the exit leads to.
+	ExitType = "EXIT"
+
+	// InAreaType goes from a room to it's area.
+	InAreaType = "IN_AREA"
+
+	// PartOfType goes from an area to the area (or zone) containing it.
+	PartOfType = "PART_OF"
+
+	// LocatedInType goes from an entity to the room it's in.
+	LocatedInType = "LOCATED_IN"
+)
+
+// Events fired on the world's emitter, see World.On.
+const (
+	// EvtMoved is fired when an entity moves, with "entity", "from" (empty if
+	// the entity wasn't anywhere), "to" and "exit" (empty if the entity
+	// didn't move through an exit).
+	EvtMoved = "entity:moved"
+
+	// Door events are fired with "exit", the ID of the exit, "room", the room
+	// the exit leaves and "name", the name of the exit.
+	EvtDoorOpened   = "door:opened"
+	EvtDoorClosed   = "door:closed"
+	EvtDoorLocked   = "door:locked"
+	EvtDoorUnlocked = "door:unlocked"
+)
+
+// Events lists every event fired by the world.
+var Events = []string{EvtMoved, EvtDoorOpened, EvtDoorClosed, EvtDoorLocked, EvtDoorUnlocked, EvtAreaReset}
+
+// Errors returned by the world.
+var (
+	ErrAreaNotFound = errors.New("world: area not found")
+	ErrRoomNotFound = errors.New("world: room not found")
+	ErrExitNotFound = errors.New("world: exit not found")
+	ErrExitExists   = errors.New("world: the room already has an exit with that name")
+	ErrMissingName  = errors.New("world: a name is required")
+	ErrNowhere      = errors.New("world: the entity isn't in a room")
+	ErrNoDoor       = errors.New("world: the exit has no door")
+	ErrDoorClosed   = errors.New("world: the door is closed")
+	ErrDoorLocked   = errors.New("world: the door is locked")
+	ErrDoorOpen     = errors.New("world: the door is open")
+	ErrWrongKey     = errors.New("world: that's not the key for the door")
+)
+
+// World is the graph of areas, rooms and exits kept in a store.
+type World struct {
+	// generation counts changes to rooms, exits and doors so cached paths
+	// know when they're out of date, it's first to keep it 64-bit aligned.
+	generation uint64
+
+	store  storage.Store
+	events *events.Emitter
+
+	pathMutex sync.Mutex
+	paths     map[pathTableKey]*PathTable
+
+	// areas are reset one at a time so a reset sees what the last one spawned
+	resetMutex sync.Mutex
+
+	// moving entities and changing doors touch more than one relationship,
+	// this keeps them from interleaving.
+	mutex sync.Mutex
+}
+
+// New creates a world kept in the store.
+func New(store storage.Store) *World {
+	return &World{
+		store:  store,
+		events: events.NewEmitter(logger.NewWithSource("world")),
+	}
+}
+
+// Store returns the store the world is kept in.
+func (w *World) Store() storage.Store {
+	return w.store
+}
+
+// On registers a handler for one of the world's events.
+func (w *World) On(evt string, h events.Handler) {
+	w.events.On(evt, h)
+}
+
+// Area is a named group of rooms, areas can be part of a larger area.
+type Area struct {
+	ID         string
+	Name       string
+	Parent     string
+	Properties storage.Properties
+}
+
+// CreateArea adds an area to the world, parent is the ID of the area
+// containing it or empty.
+func (w *World) CreateArea(name, parent string, props storage.Properties) (*Area, error) {
+	if name == "" {
+		return nil, ErrMissingName
+	}
+	if parent != "" {
+		if _, err := w.Area(parent); err != nil {
+			return nil, err
+		}
+	}
+
+	node, err := w.store.CreateNode([]string{AreaLabel}, withName(props, name))
+	if err != nil {
+		return nil, err
+	}
+	if parent != "" {
+		if _, err := w.store.CreateRelationship(node.ID, parent, PartOfType, nil); err != nil {
+			return nil, err
+		}
+		w.changed()
+	}
+
+	return w.toArea(node, parent), nil
+}
+
+// Area fetches the area with the ID.
+func (w *World) Area(id string) (*Area, error) {
+	node, err := w.node(id, AreaLabel, ErrAreaNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := w.related(id, PartOfType)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.toArea(node, parent), nil
+}
+
+// FindArea fetches the area with the name.
+func (w *World) FindArea(name string) (*Area, error) {
+	nodes, err := w.store.FindNodes(AreaLabel, storage.Properties{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrAreaNotFound
+	}
+
+	return w.Area(nodes[0].ID)
+}
+
+// Areas fetches every area, sorted by name.
+func (w *World) Areas() ([]*Area, error) {
+	nodes, err := w.store.FindNodes(AreaLabel, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	areas := make([]*Area, 0, len(nodes))
+	for _, n := range nodes {
+		a, err := w.Area(n.ID)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, a)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].Name < areas[j].Name
+	})
+
+	return areas, nil
+}
+
+// Subareas fetches the areas that are part of the area.
+func (w *World) Subareas(id string) ([]*Area, error) {
+	rels, err := w.store.Relationships(id, PartOfType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	areas := make([]*Area, 0, len(rels))
+	for _, r := range rels {
+		a, err := w.Area(r.From)
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, a)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i].Name < areas[j].Name
+	})
+
+	return areas, nil
+}
+
+// UpdateArea merges the properties into the area's, a "name" property renames
+// it.
+func (w *World) UpdateArea(id string, props storage.Properties) error {
+	if _, err := w.node(id, AreaLabel, ErrAreaNotFound); err != nil {
+		return err
+	}
+
+	return w.store.UpdateNode(id, props)
+}
+
+// DestroyArea removes the area, it's rooms are left without an area and it's
+// subareas become top level areas.
+func (w *World) DestroyArea(id string) error {
+	if _, err := w.node(id, AreaLabel, ErrAreaNotFound); err != nil {
+		return err
+	}
+	defer w.changed()
+
+	return w.store.DeleteNode(id)
+}
+
+func (w *World) toArea(n *storage.Node, parent string) *Area {
+	name, props := splitName(n.Properties)
+
+	return &Area{
+		ID:         n.ID,
+		Name:       name,
+		Parent:     parent,
+		Properties: props,
+	}
+}
+
+// Room is a single location in the world.
+type Room struct {
+	ID         string
+	Name       string
+	Area       string
+	Properties storage.Properties
+}
+
+// CreateRoom adds a room to the world, area is the ID of the area the room is
+// in or empty.
+func (w *World) CreateRoom(name, area string, props storage.Properties) (*Room, error) {
+	if name == "" {
+		return nil, ErrMissingName
+	}
+	if area != "" {
+		if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+			return nil, err
+		}
+	}
+
+	node, err := w.store.CreateNode([]string{RoomLabel}, withName(props, name))
+	if err != nil {
+		return nil, err
+	}
+	w.changed()
+	if area != "" {
+		if _, err := w.store.CreateRelationship(node.ID, area, InAreaType, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return w.toRoom(node, area), nil
+}
+
+// Room fetches the room with the ID.
+func (w *World) Room(id string) (*Room, error) {
+	node, err := w.node(id, RoomLabel, ErrRoomNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	area, err := w.related(id, InAreaType)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.toRoom(node, area), nil
+}
+
+// Rooms fetches the rooms in the area, sorted by name.
+func (w *World) Rooms(area string) ([]*Room, error) {
+	rels, err := w.store.Relationships(area, InAreaType, storage.Incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]*Room, 0, len(rels))
+	for _, r := range rels {
+		// prototypes and resets are in areas too
+		room, err := w.Room(r.From)
+		if err == ErrRoomNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+
+	return rooms, nil
+}
+
+// UpdateRoom merges the properties into the room's, a "name" property renames
+// it.
+func (w *World) UpdateRoom(id string, props storage.Properties) error {
+	if _, err := w.node(id, RoomLabel, ErrRoomNotFound); err != nil {
+		return err
+	}
+
+	return w.store.UpdateNode(id, props)
+}
+
+// SetRoomArea moves the room into the area, an empty area removes the room
+// from it's area.
+func (w *World) SetRoomArea(id, area string) error {
+	if _, err := w.node(id, RoomLabel, ErrRoomNotFound); err != nil {
+		return err
+	}
+	if area != "" {
+		if _, err := w.node(area, AreaLabel, ErrAreaNotFound); err != nil {
+			return err
+		}
+	}
+
+	defer w.changed()
+
+	rels, err := w.store.Relationships(id, InAreaType, storage.Outgoing)
+	if err != nil {
+		return err
+	}
+	for _, r := range rels {
+		if err := w.store.DeleteRelationship(r.ID); err != nil {
+			return err
+		}
+	}
+	if area == "" {
+		return nil
+	}
+	_, err = w.store.CreateRelationship(id, area, InAreaType, nil)
+
+	return err
+}
+
+// DestroyRoom removes the room along with every exit leading to or from it,
+// anything in the room is left nowhere.
+func (w *World) DestroyRoom(id string) error {
+	if _, err := w.node(id, RoomLabel, ErrRoomNotFound); err != nil {
+		return err
+	}
+	defer w.changed()
+
+	return w.store.DeleteNode(id)
+}
+
+func (w *World) toRoom(n *storage.Node, area string) *Room {
+	name, props := splitName(n.Properties)
+
+	return &Room{
+		ID:         n.ID,
+		Name:       name,
+		Area:       area,
+		Properties: props,
+	}
+}
+
+// fetch a node, ensuring it has the label
+func (w *World) node(id, label string, notFound error) (*storage.Node, error) {
+	node, err := w.store.GetNode(id)
+	if err == storage.ErrNotFound || (err == nil && !node.HasLabel(label)) {
+		return nil, notFound
+	}
+
+	return node, err
+}
+
+// the ID of the node the first outgoing relationship of the type leads to
+func (w *World) related(id, typ string) (string, error) {
+	rels, err := w.store.Relationships(id, typ, storage.Outgoing)
+	if err != nil || len(rels) == 0 {
+		return "", err
+	}
+
+	return rels[0].To, nil
+}
+
+func withName(props storage.Properties, name string) storage.Properties {
+	named := make(storage.Properties, len(props)+1)
+	for k, v := range props {
+		named[k] = v
+	}
+	named["name"] = name
+
+	return named
+}
+
+func splitName(props storage.Properties) (string, storage.Properties) {
+	rest := make(storage.Properties, len(props))
+	for k, v := range props {
+		rest[k] = v
+	}
+	name, _ := rest["name"].(string)
+	delete(rest, "name")
+
+	return name, rest
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2016-2017 Brandon Buck
+
+package world_test
+
+import (
+	"sync"
+
+	"github.com/bbuck/dragon-mud/events"
+	"github.com/bbuck/dragon-mud/storage"
+	"github.com/bbuck/dragon-mud/talon"
+	"github.com/bbuck/dragon-mud/talon/memory"
+
+	. "github.com/bbuck/dragon-mud/world"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a world kept in an empty in memory database
+func newWorld() *World {
+	return New(storage.NewNeo4jStore(talon.NewDB(memory.NewDriver())))
+}
+
+// recorder keeps the events fired by a world, events are emitted
+// asynchronously so they're read with Eventually.
+type recorder struct {
+	mutex  sync.Mutex
+	fired  []string
+	fields []events.Data
+}
+
+func record(w *World, evts ...string) *recorder {
+	r := new(recorder)
+	for _, evt := range evts {
+		evt := evt
+		w.On(evt, events.HandlerFunc(func(d events.Data) error {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.fired = append(r.fired, evt)
+			r.fields = append(r.fields, d)
+
+			return nil
+		}))
+	}
+
+	return r
+}
+
+func (r *recorder) names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.fired...)
+}
+
+func (r *recorder) data() []events.Data {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]events.Data(nil), r.fields...)
+}
+
+var _ = Describe("World", func() {
+	var (
+		w    *World
+		zone *Area
+		town *Area
+	)
+
+	BeforeEach(func() {
+		w = newWorld()
+
+		var err error
+		zone, err = w.CreateArea("Midlands", "", nil)
+		Ω(err).Should(BeNil())
+		town, err = w.CreateArea("Town", zone.ID, storage.Properties{"level": 1})
+		Ω(err).Should(BeNil())
+	})
+
+	Describe("areas", func() {
+		It("fetches areas by ID and name", func() {
+			a, err := w.Area(town.ID)
+			Ω(err).Should(BeNil())
+			Ω(a.Name).Should(Equal("Town"))
+			Ω(a.Parent).Should(Equal(zone.ID))
+			Ω(a.Properties).Should(Equal(storage.Properties{"level": int64(1)}))
+
+			a, err = w.FindArea("Midlands")
+			Ω(err).Should(BeNil())
+			Ω(a.ID).Should(Equal(zone.ID))
+			Ω(a.Parent).Should(BeEmpty())
+		})
+
+		It("lists areas and subareas", func() {
+			areas, err := w.Areas()
+			Ω(err).Should(BeNil())
+			Ω(areas).Should(HaveLen(2))
+			Ω(areas[0].Name).Should(Equal("Midlands"))
+
+			subs, err := w.Subareas(zone.ID)
+			Ω(err).Should(BeNil())
+			Ω(subs).Should(HaveLen(1))
+			Ω(subs[0].ID).Should(Equal(town.ID))
+		})
+
+		It("requires parents to exist", func() {
+			_, err := w.CreateArea("Lost", "missing", nil)
+			Ω(err).Should(Equal(ErrAreaNotFound))
+		})
+
+		It("updates and destroys areas", func() {
+			Ω(w.UpdateArea(town.ID, storage.Properties{"name": "City"})).Should(BeNil())
+			a, _ := w.Area(town.ID)
+			Ω(a.Name).Should(Equal("City"))
+
+			Ω(w.DestroyArea(zone.ID)).Should(BeNil())
+			_, err := w.Area(zone.ID)
+			Ω(err).Should(Equal(ErrAreaNotFound))
+			a, _ = w.Area(town.ID)
+			Ω(a.Parent).Should(BeEmpty())
+		})
+	})
+
+	Describe("rooms", func() {
+		var square *Room
+
+		BeforeEach(func() {
+			var err error
+			square, err = w.CreateRoom("Town Square", town.ID, storage.Properties{"description": "A busy square."})
+			Ω(err).Should(BeNil())
+		})
+
+		It("fetches rooms by ID", func() {
+			r, err := w.Room(square.ID)
+			Ω(err).Should(BeNil())
+			Ω(r.Name).Should(Equal("Town Square"))
+			Ω(r.Area).Should(Equal(town.ID))
+			Ω(r.Properties["description"]).Should(Equal("A busy square."))
+		})
+
+		It("lists the rooms in an area", func() {
+			w.CreateRoom("Alley", town.ID, nil)
+			w.CreateRoom("Nowhere", "", nil)
+
+			rooms, err := w.Rooms(town.ID)
+			Ω(err).Should(BeNil())
+			Ω(rooms).Should(HaveLen(2))
+			Ω(rooms[0].Name).Should(Equal("Alley"))
+			Ω(rooms[1].Name).Should(Equal("Town Square"))
+		})
+
+		It("moves rooms between areas", func() {
+			Ω(w.SetRoomArea(square.ID, zone.ID)).Should(BeNil())
+			r, _ := w.Room(square.ID)
+			Ω(r.Area).Should(Equal(zone.ID))
+
+			Ω(w.SetRoomArea(square.ID, "")).Should(BeNil())
+			r, _ = w.Room(square.ID)
+			Ω(r.Area).Should(BeEmpty())
+		})
+
+		It("doesn't treat areas as rooms", func() {
+			_, err := w.Room(town.ID)
+			Ω(err).Should(Equal(ErrRoomNotFound))
+		})
+
+		It("requires a name", func() {
+			_, err := w.CreateRoom("", town.ID, nil)
+			Ω(err).Should(Equal(ErrMissingName))
+		})
+
+		It("updates and destroys rooms", func() {
+			Ω(w.UpdateRoom(square.ID, storage.Properties{"description": nil, "lit": true})).Should(BeNil())
+			r, _ := w.Room(square.ID)
+			Ω(r.Properties).Should(Equal(storage.Properties{"lit": true}))
+
+			Ω(w.DestroyRoom(square.ID)).Should(BeNil())
+			_, err := w.Room(square.ID)
+			Ω(err).Should(Equal(ErrRoomNotFound))
+		})
+	})
+})